@@ -2,24 +2,62 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/alias"
+	"github.com/lostmyescape/url-shortener/internal/analytics"
+	"github.com/lostmyescape/url-shortener/internal/apikey"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/cache"
 	ssogrpc "github.com/lostmyescape/url-shortener/internal/clients/sso/grpc"
 	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/domains"
+	"github.com/lostmyescape/url-shortener/internal/expiry"
 	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/deleteURL"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/health"
 	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/redirect"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/batch"
+	urlDomains "github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/domains"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/export"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/get"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/keys"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/list"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/qr"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/revisions"
 	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/stats"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/update"
 	mwLogger "github.com/lostmyescape/url-shortener/internal/http-server/logger/middleware"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/aliasparam"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
 	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogpretty"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogtrace"
 	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/lib/realip"
+	"github.com/lostmyescape/url-shortener/internal/lifecycle"
+	"github.com/lostmyescape/url-shortener/internal/metrics"
+	"github.com/lostmyescape/url-shortener/internal/preview"
+	"github.com/lostmyescape/url-shortener/internal/qrcode"
+	"github.com/lostmyescape/url-shortener/internal/ratelimit"
 	dbstorage "github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/tracing"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 )
 
+// closeTimeout is how long everything but the http server may take to close
+const closeTimeout = 5 * time.Second
+
 const (
 	envLocal = "local"
 	envDev   = "dev"
@@ -40,49 +78,245 @@ func main() {
 
 	log.Debug("debug messages are enabled")
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, log, os.Args[2:]))
+	}
+
+	os.Exit(run(cfg, log))
+}
+
+// run serves until SIGINT or SIGTERM and returns the exit code.
+// Whatever was started is closed before it returns, the last started first.
+func run(cfg *config.Config, log *slog.Logger) (code int) {
+	lc := lifecycle.New(log)
+	m := metrics.New()
+
+	defer func() {
+		if err := lc.Shutdown(); err != nil && code == 0 {
+			code = 1
+		}
+
+		log.Info("server stopped")
+	}()
+
+	tr, err := tracing.New(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", slog.String("exporter", cfg.Tracing.Exporter), sl.Err(err))
+		return 1
+	}
+
+	// closed last to export the spans of everything closed before
+	lc.Add("tracing", closeTimeout, tr.Shutdown)
+
 	ssoClient, err := ssogrpc.New(
 		log,
 		cfg.Clients.SSO.Address,
 		cfg.Clients.SSO.Timeout,
 		cfg.Clients.SSO.RetriesCount,
+		tr.UnaryClientInterceptor(),
+		m.UnaryClientInterceptor(),
 	)
 	if err != nil {
 		log.Error("failed to init sso client", sl.Err(err))
-		os.Exit(1)
+		return 1
 	}
-	ssoClient.IsAdmin(context.Background(), 1)
+
+	lc.Add("sso client", closeTimeout, func(context.Context) error { return ssoClient.Close() })
 
 	storage, err := dbstorage.NewStorage(cfg)
 	if err != nil {
-		log.Error("DB connection error: %v", sl.Err(err))
-		os.Exit(1)
+		log.Error("failed to init storage", slog.String("type", cfg.Storage.Type), sl.Err(err))
+		return 1
 	}
 
-	defer func(DB *sql.DB) {
-		err := storage.DB.Close()
-		if err != nil {
-			log.Error("DB close error: %v", err)
-			return
-		}
-	}(storage.DB)
+	// storage is replaced with the cache in front of it, closing the cache closes both
+	lc.Add("storage", closeTimeout, func(context.Context) error { return storage.Close() })
+
+	// links about to be updated are read from db past the cache, their revision must be current
+	db := tr.WrapStorage(m.WrapStorage(storage), cfg.Storage.Type)
+
+	cached, err := cache.New(log, db, cfg.Cache, m)
+	if err != nil {
+		log.Error("failed to init cache", slog.String("type", cfg.Cache.Type), sl.Err(err))
+		return 1
+	}
+	storage = cached
+
+	aliasGenerator, err := alias.New(cfg.Alias, storage)
+	if err != nil {
+		log.Error("failed to init alias generator", slog.String("strategy", cfg.Alias.Strategy), sl.Err(err))
+		return 1
+	}
+
+	aliasRules, err := alias.NewRules(cfg.Alias.Rules)
+	if err != nil {
+		log.Error("failed to init alias rules", sl.Err(err))
+		return 1
+	}
+
+	// roles are cached, so a slow or failing SSO service doesn't hold up every request
+	roles := authz.NewResolver(log, ssoClient, cfg.Authz, aliasRules.Fold)
+	policy := authz.NewPolicy(roles)
+
+	// clients are told apart by the same address for analytics and rate limits
+	clientIPs, err := realip.New(cfg.HTTPServer.TrustedProxies)
+	if err != nil {
+		log.Error("invalid trusted proxies", sl.Err(err))
+		return 1
+	}
+
+	clickRecorder, err := analytics.NewRecorder(log, storage, clientIPs, cfg.Analytics)
+	if err != nil {
+		log.Error("failed to init click recorder", sl.Err(err))
+		return 1
+	}
+
+	lc.Add("click recorder", closeTimeout, clickRecorder.Close)
+
+	reaper, err := expiry.NewReaper(log, storage, cfg.Expiry.ReapInterval)
+	if err != nil {
+		log.Error("failed to init expired links reaper", sl.Err(err))
+		return 1
+	}
+
+	lc.Add("expired links reaper", closeTimeout, reaper.Close)
+
+	limiter, err := newLimiter(cfg, log, lc, clientIPs)
+	if err != nil {
+		log.Error("failed to init rate limiter", slog.String("store", cfg.RateLimit.Store), sl.Err(err))
+		return 1
+	}
+
+	createLimit, err := ratelimit.LimitFrom(cfg.RateLimit.Create)
+	if err != nil {
+		log.Error("invalid create rate limit", sl.Err(err))
+		return 1
+	}
+
+	redirectLimit, err := ratelimit.LimitFrom(cfg.RateLimit.Redirect)
+	if err != nil {
+		log.Error("invalid redirect rate limit", sl.Err(err))
+		return 1
+	}
+
+	createLimited := limiter.Middleware(ratelimit.PolicyCreate, createLimit)
+
+	baseURL, err := parseBaseURL(cfg.HTTPServer.BaseURL)
+	if err != nil {
+		log.Error("invalid base url", sl.Err(err))
+		return 1
+	}
+
+	domainRegistry := domains.New(storage, cfg.Domains, baseURL.Hostname())
+
+	urlPolicy, err := newURLPolicy(cfg.URLPolicy, baseURL.Host, domainRegistry)
+	if err != nil {
+		log.Error("failed to init url policy", sl.Err(err))
+		return 1
+	}
+
+	if !models.ValidDuplicates(cfg.Links.Duplicates) {
+		log.Error("invalid duplicates mode", slog.String("duplicates", cfg.Links.Duplicates))
+		return 1
+	}
 
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
+	router.Use(tr.Middleware)
 	router.Use(middleware.Logger)
 	router.Use(mwLogger.New(log))
 	router.Use(middleware.Recoverer)
+	router.Use(m.Middleware)
 	router.Use(middleware.URLFormat)
 
+	router.Get("/healthz", health.Liveness())
+	router.Get("/readyz", health.Readiness(log, lc, map[string]health.Check{
+		"storage": storage.Ping,
+		"migrations": func(ctx context.Context) error {
+			pending, err := storage.PendingMigrations(ctx)
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				return fmt.Errorf("%d pending migration(s)", pending)
+			}
+			return nil
+		},
+		"sso": func(context.Context) error { return ssoClient.CheckConnection() },
+	}))
+
+	qrCodes := qrcode.NewGenerator(cfg.QR.CacheSize)
+
+	canRead := auth.RequireScope(models.ScopeLinksRead)
+	canWrite := auth.RequireScope(models.ScopeLinksWrite)
+	canDelete := auth.RequireScope(models.ScopeLinksDelete)
+	canReadStats := auth.RequireScope(models.ScopeStatsRead)
+
 	router.Route("/url", func(r chi.Router) {
-		r.Use(middleware.BasicAuth("url-shortener", map[string]string{
-			cfg.HTTPServer.User: cfg.HTTPServer.Password,
-		}))
-		r.Post("/", save.New(log, storage))
-		r.Delete("/{alias}", deleteURL.New(log, storage))
+		r.Use(auth.New(log, cfg.AppSecret, cfg.HTTPServer.User, cfg.HTTPServer.Password, apikey.NewAuthenticator(log, storage)))
+		r.With(canRead).Get("/", list.New(log, storage, policy))
+		r.With(canWrite, save.Idempotent(log, storage, cfg.Links.IdempotencyKeyTTL), createLimited).Post("/", save.New(log, storage, storage, cfg.Links.Duplicates, aliasGenerator, aliasRules, urlPolicy, policy, domainRegistry))
+		// every item of a batch takes a token of the create limit
+		r.With(canWrite).Post("/batch", batch.NewSave(log, storage, storage, cfg.Links.Duplicates, aliasGenerator, aliasRules, urlPolicy, policy, domainRegistry, limiter.Charger(ratelimit.PolicyCreate, createLimit)))
+		r.With(canDelete).Delete("/batch", batch.NewDelete(log, storage, policy))
+		r.With(canRead).Get("/export", export.New(log, storage, policy))
+
+		r.Route("/keys", func(r chi.Router) {
+			r.Post("/", keys.NewCreate(log, storage))
+			r.Get("/", keys.NewList(log, storage))
+			r.Delete("/{id}", keys.NewRevoke(log, storage, policy))
+		})
+
+		r.Route("/domains", func(r chi.Router) {
+			r.With(canRead).Get("/", urlDomains.NewList(log, domainRegistry))
+			r.Group(func(r chi.Router) {
+				r.Use(canWrite, authz.Require(log, policy, authz.ActionManageDomains))
+				r.Post("/", urlDomains.NewCreate(log, domainRegistry, urlPolicy))
+				r.Put("/{host}", urlDomains.NewUpdate(log, domainRegistry, urlPolicy))
+				r.Delete("/{host}", urlDomains.NewDelete(log, domainRegistry))
+			})
+		})
+
+		link := func(r chi.Router) {
+			r.Use(aliasparam.New(aliasRules.Fold, storage))
+			r.With(canRead).Get("/", get.New(log, db, policy))
+			r.With(canWrite).Patch("/", update.New(log, db, storage, cfg.Links.Duplicates, policy, urlPolicy))
+			r.With(canWrite).Put("/", update.New(log, db, storage, cfg.Links.Duplicates, policy, urlPolicy))
+			r.With(canDelete).Delete("/", deleteURL.New(log, storage, policy))
+			r.With(canRead).Get("/revisions", revisions.New(log, db, policy))
+			r.With(canReadStats).Get("/stats", stats.New(log, storage, policy))
+			r.With(canRead).Get("/qr", qr.New(log, storage, qrCodes, baseURL.String()))
+		}
+
+		r.Route("/{alias}", link)
+		r.Route("/d/{domain}/{alias}", link)
+		if cfg.Alias.Rules.Namespaces {
+			r.Route("/t/{team}/{alias}", link)
+			r.Route("/d/{domain}/t/{team}/{alias}", link)
+		}
 	})
 
-	router.Get("/{alias}", redirect.Redirect(log, storage))
+	redirects := router.With(
+		limiter.Middleware(ratelimit.PolicyRedirect, redirectLimit),
+		// the domain joins the alias as it was asked for, the case policy folds both
+		domains.Middleware(log, domainRegistry),
+		aliasparam.New(aliasRules.Fold, storage),
+	)
+	pages := preview.New(cfg.Preview, nil)
+	redirects.Get("/", redirect.Root(log))
+	redirects.Get("/{alias}", redirect.Redirect(log, storage, clickRecorder, pages, cfg.Redirect.PermanentMaxAge))
+	redirects.Get("/{alias}+", redirect.Preview(log, storage, pages))
+	if cfg.Alias.Rules.Namespaces {
+		redirects.Get("/t/{team}/{alias}", redirect.Redirect(log, storage, clickRecorder, pages, cfg.Redirect.PermanentMaxAge))
+		redirects.Get("/t/{team}/{alias}+", redirect.Preview(log, storage, pages))
+	}
+
+	// no custom alias may shadow one of the routes above
+	if err := aliasRules.ReserveRoutes(router); err != nil {
+		log.Error("failed to reserve routes", sl.Err(err))
+		return 1
+	}
 
 	log.Info("starting server", slog.String("address", cfg.HTTPServer.Address))
 
@@ -94,12 +328,95 @@ func main() {
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 	}
 
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Error("failed to start server: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", m.Handler())
+
+	metricsSrv := &http.Server{
+		Addr:        cfg.HTTPServer.MetricsAddress,
+		Handler:     metricsMux,
+		ReadTimeout: cfg.HTTPServer.Timeout,
+		IdleTimeout: cfg.HTTPServer.IdleTimeout,
+	}
+
+	log.Info("starting metrics server", slog.String("address", cfg.HTTPServer.MetricsAddress))
+
+	serveErr := make(chan error, 2)
+	go func() { serveErr <- metricsSrv.ListenAndServe() }()
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	// metrics are scraped until the very end of the drain
+	lc.Add("metrics server", closeTimeout, metricsSrv.Shutdown)
+
+	// in-flight requests finish before anything they use is closed
+	lc.Add("http server", cfg.HTTPServer.ShutdownTimeout, srv.Shutdown)
+
+	// runs first: /readyz already fails, new requests are still served
+	lc.Add("shutdown delay", cfg.HTTPServer.ShutdownDelay+time.Second, func(ctx context.Context) error {
+		select {
+		case <-time.After(cfg.HTTPServer.ShutdownDelay):
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	select {
+	case <-ctx.Done():
+		// a second signal kills the process right away
+		stop()
+		log.Info("shutting down")
+
+		return 0
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", sl.Err(err))
+		}
+
+		return 1
+	}
+}
+
+// newLimiter sets up the rate limit store, the limiter limits nothing with the "none" store
+func newLimiter(cfg *config.Config, log *slog.Logger, lc *lifecycle.Manager, resolver *realip.Resolver) (*ratelimit.Limiter, error) {
+	store, err := ratelimit.NewStore(cfg.RateLimit)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Error("server stopped")
+	if store != nil {
+		lc.Add("rate limit store", closeTimeout, func(context.Context) error { return store.Close() })
+	}
+
+	return ratelimit.NewLimiter(log, store, resolver), nil
+}
+
+// newURLPolicy creates the policy of cfg, links to baseHost and to the
+// custom domains are rejected too
+func newURLPolicy(cfg config.URLPolicy, baseHost string, customDomains urlpolicy.DomainFinder) (*urlpolicy.Policy, error) {
+	var reputation urlpolicy.ReputationChecker
+	if cfg.ReputationURL != "" {
+		reputation = urlpolicy.NewWebhook(cfg.ReputationURL, cfg.ReputationTimeout)
+	}
+
+	cfg.SelfHosts = append(slices.Clone(cfg.SelfHosts), baseHost)
+
+	return urlpolicy.New(cfg, customDomains, nil, reputation)
+}
+
+// parseBaseURL checks that raw is an absolute http or https URL
+func parseBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http or https URL", raw)
+	}
 
+	return u, nil
 }
 
 func setupLogger(env string) *slog.Logger {
@@ -119,7 +436,8 @@ func setupLogger(env string) *slog.Logger {
 
 	}
 
-	return log
+	// records logged with the context of a request carry its trace id
+	return slog.New(slogtrace.NewTraceHandler(log.Handler()))
 }
 
 func setupPrettySlog() *slog.Logger {
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	dbstorage "github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/storage/migrations"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const migrateUsage = "usage: url-shortener migrate up|down|status"
+
+// runMigrate handles `url-shortener migrate up|down|status` and returns the exit code
+func runMigrate(cfg *config.Config, log *slog.Logger, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := dbstorage.OpenDB(cfg)
+	if err != nil {
+		log.Error("failed to open database", sl.Err(err))
+		return 1
+	}
+	defer func() { _ = db.Close() }()
+
+	m, err := migrations.New(db, cfg.Storage.Type)
+	if err != nil {
+		log.Error("failed to load migrations", sl.Err(err))
+		return 1
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mg := range applied {
+			log.Info("migration applied", slog.Int64("version", mg.Version), slog.String("name", mg.Name))
+		}
+		if err != nil {
+			log.Error("failed to apply migrations", sl.Err(err))
+			return 1
+		}
+		if len(applied) == 0 {
+			log.Info("no pending migrations")
+		}
+
+	case "down":
+		mg, err := m.Down(ctx)
+		if errors.Is(err, migrations.ErrNoApplied) {
+			log.Info("nothing to roll back")
+			return 0
+		}
+		if err != nil {
+			log.Error("failed to roll back migration", sl.Err(err))
+			return 1
+		}
+		log.Info("migration rolled back", slog.Int64("version", mg.Version), slog.String("name", mg.Name))
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Error("failed to get migrations status", sl.Err(err))
+			return 1
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-30s  %s\n", st.Version, st.Name, applied)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
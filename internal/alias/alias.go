@@ -0,0 +1,132 @@
+package alias
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/lib/random"
+	"strings"
+)
+
+const (
+	StrategyRandom     = "random"
+	StrategySequential = "sequential"
+	StrategyHashids    = "hashids"
+	StrategyWords      = "words"
+)
+
+// Generator makes aliases for links saved without one
+type Generator interface {
+	// Generate returns a new alias and the url id reserved for it,
+	// id is 0 unless the alias is derived from the id
+	Generate(ctx context.Context) (alias string, id int64, err error)
+}
+
+// IDReserver hands out the ids of urls before they are saved
+type IDReserver interface {
+	NextURLID(ctx context.Context) (int64, error)
+}
+
+// New returns the generator selected by cfg.Strategy, sequential and
+// hashids aliases are derived from ids reserved with ids
+func New(cfg config.Alias, ids IDReserver) (Generator, error) {
+	const op = "alias.New"
+
+	alphabet := cfg.Alphabet
+	if alphabet == "" {
+		alphabet = random.Alphabet
+	}
+
+	// links are case-insensitive, so generated aliases must be lowercase too
+	if cfg.Rules.Case == CaseLower {
+		alphabet = lowerAlphabet(alphabet)
+	}
+
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cfg.Length < 1 {
+		return nil, fmt.Errorf("%s: length must be positive", op)
+	}
+
+	switch cfg.Strategy {
+	case StrategyRandom, "":
+		return NewRandom(alphabet, cfg.Length), nil
+	case StrategySequential:
+		return NewSequential(ids, alphabet), nil
+	case StrategyHashids:
+		h, err := NewHashids(ids, alphabet, cfg.Salt, cfg.Length)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return h, nil
+	case StrategyWords:
+		return NewWords(cfg.Length), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown alias strategy %q", op, cfg.Strategy)
+	}
+}
+
+// checkAlphabet allows distinct letters, digits, "-" and "_" only,
+// other characters have a meaning in the path of a short link
+func checkAlphabet(alphabet string) error {
+	seen := make(map[rune]struct{})
+
+	for _, c := range alphabet {
+		valid := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+		if !valid {
+			return fmt.Errorf("alphabet has invalid character %q", c)
+		}
+
+		if _, ok := seen[c]; ok {
+			return fmt.Errorf("alphabet has duplicate character %q", c)
+		}
+		seen[c] = struct{}{}
+	}
+
+	if len(seen) < 2 {
+		return errors.New("alphabet must have at least 2 characters")
+	}
+
+	return nil
+}
+
+// lowerAlphabet lowercases alphabet and drops the letters that repeat then
+func lowerAlphabet(alphabet string) string {
+	var (
+		b    strings.Builder
+		seen = make(map[rune]bool)
+	)
+
+	for _, c := range strings.ToLower(alphabet) {
+		if !seen[c] {
+			seen[c] = true
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+// encode writes n in base len(alphabet), 0 is alphabet[0]
+func encode(n uint64, alphabet []rune) string {
+	base := uint64(len(alphabet))
+
+	var out []rune
+	for {
+		out = append(out, alphabet[n%base])
+		n /= base
+
+		if n == 0 {
+			break
+		}
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return string(out)
+}
@@ -0,0 +1,174 @@
+package alias
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     config.Alias
+		wantErr string
+	}{
+		{name: "Default", cfg: config.Alias{Length: 6}},
+		{name: "Sequential", cfg: config.Alias{Strategy: StrategySequential, Length: 6}},
+		{name: "Hashids", cfg: config.Alias{Strategy: StrategyHashids, Length: 6, Salt: "pepper"}},
+		{name: "Words", cfg: config.Alias{Strategy: StrategyWords, Length: 6}},
+		{
+			name:    "Unknown strategy",
+			cfg:     config.Alias{Strategy: "uuid", Length: 6},
+			wantErr: `alias.New: unknown alias strategy "uuid"`,
+		},
+		{
+			name:    "Duplicate character",
+			cfg:     config.Alias{Length: 6, Alphabet: "MOPOR"},
+			wantErr: `alias.New: alphabet has duplicate character 'O'`,
+		},
+		{
+			name:    "Invalid character",
+			cfg:     config.Alias{Length: 6, Alphabet: "ab.c"},
+			wantErr: `alias.New: alphabet has invalid character '.'`,
+		},
+		{
+			name:    "Short alphabet",
+			cfg:     config.Alias{Length: 6, Alphabet: "a"},
+			wantErr: "alias.New: alphabet must have at least 2 characters",
+		},
+		{
+			name:    "Zero length",
+			cfg:     config.Alias{},
+			wantErr: "alias.New: length must be positive",
+		},
+		{
+			name:    "Hashids too long",
+			cfg:     config.Alias{Strategy: StrategyHashids, Length: 20},
+			wantErr: "alias.New: hashids length is too big for the alphabet",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := New(tc.cfg, storage.NewMemory())
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, g)
+		})
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name      string
+		generator Generator
+		pattern   string
+		withID    bool
+	}{
+		{
+			name:      "Random",
+			generator: NewRandom("abc123", 8),
+			pattern:   `^[abc123]{8}$`,
+		},
+		{
+			name:      "Sequential",
+			generator: NewSequential(storage.NewMemory(), "0123456789"),
+			pattern:   `^[1-9][0-9]*$`,
+			withID:    true,
+		},
+		{
+			name:      "Hashids",
+			generator: must(NewHashids(storage.NewMemory(), "abcdefghij", "salt", 5)),
+			pattern:   `^[a-j]{5,}$`,
+			withID:    true,
+		},
+		{
+			name:      "Words",
+			generator: NewWords(7),
+			pattern:   `^([bdfghjklmnprstvz][aeiou]){3}[bdfghjklmnprstvz]$`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pattern := regexp.MustCompile(tc.pattern)
+			seen := make(map[string]bool)
+
+			for i := 0; i < 200; i++ {
+				alias, id, err := tc.generator.Generate(ctx)
+				require.NoError(t, err)
+				require.Regexp(t, pattern, alias)
+
+				if tc.withID {
+					require.Equal(t, int64(i+1), id)
+					require.False(t, seen[alias], "duplicate %q", alias)
+				} else {
+					require.Zero(t, id)
+				}
+				seen[alias] = true
+			}
+		})
+	}
+}
+
+func TestSequential(t *testing.T) {
+	g := NewSequential(storage.NewMemory(), "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+	var got []string
+	for i := 0; i < 62; i++ {
+		alias, _, err := g.Generate(context.Background())
+		require.NoError(t, err)
+		got = append(got, alias)
+	}
+
+	require.Equal(t, []string{"1", "a", "Z", "10"}, []string{got[0], got[9], got[60], got[61]})
+}
+
+func TestHashids(t *testing.T) {
+	g := must(NewHashids(storage.NewMemory(), "abcdefghijklmnopqrstuvwxyz", "salt", 4))
+	other := must(NewHashids(storage.NewMemory(), "abcdefghijklmnopqrstuvwxyz", "pepper", 4))
+
+	// consecutive ids don't look consecutive
+	require.NotEqual(t, g.encode(1)[1:], g.encode(2)[1:])
+	require.NotEqual(t, g.encode(1), other.encode(1))
+	require.Equal(t, g.encode(42), g.encode(42))
+	require.Len(t, g.encode(1), 4)
+
+	// every id gets its own alias, across the scrambled ones and the longer ones too
+	small := must(NewHashids(storage.NewMemory(), "abcdef", "salt", 4))
+	seen := make(map[string]int64)
+	for id := int64(1); id < 1000; id++ {
+		alias := small.encode(id)
+		require.GreaterOrEqual(t, len(alias), 4)
+
+		prev, ok := seen[alias]
+		require.False(t, ok, "%q of %d and %d", alias, prev, id)
+		seen[alias] = id
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	alphabet := []rune("abcdef")
+
+	require.Equal(t, alphabet, shuffle(alphabet, nil))
+	require.ElementsMatch(t, alphabet, shuffle(alphabet, []rune("salt")))
+	require.Equal(t, shuffle(alphabet, []rune("salt")), shuffle(alphabet, []rune("salt")))
+	require.Equal(t, []rune("abcdef"), alphabet, "the input is kept")
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
@@ -0,0 +1,120 @@
+package alias
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// Hashids makes aliases that are unique like sequential ones but don't
+// reveal the order or the number of links, the way hashids does it:
+// the first character is picked by the id and reshuffles the alphabet
+// the rest of the id is written in. Changing the salt changes every alias.
+type Hashids struct {
+	ids      IDReserver
+	alphabet []rune
+	salt     []rune
+
+	// ids below space are scrambled with (id*mul + add) % space and written
+	// with exactly digits characters, the bigger ones are written as is
+	// with more characters, so aliases of different ids never match
+	space  uint64
+	digits int
+	mul    uint64
+	add    uint64
+}
+
+func NewHashids(ids IDReserver, alphabet, salt string, minLength int) (*Hashids, error) {
+	shuffled := shuffle([]rune(alphabet), []rune(salt))
+	base := uint64(len(shuffled))
+
+	// the lottery character and minLength-1 digits, ids are below 1<<63
+	space, digits := uint64(1), max(minLength-1, 0)
+	for i := 0; i < digits; i++ {
+		if space > (1<<63)/base {
+			return nil, errors.New("hashids length is too big for the alphabet")
+		}
+		space *= base
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(salt))
+	seed := h.Sum64()
+
+	// mul is coprime with space, so the scramble is a permutation
+	mul := seed%space | 1
+	for gcd(mul, base) != 1 {
+		mul += 2
+	}
+
+	return &Hashids{
+		ids:      ids,
+		alphabet: shuffled,
+		salt:     []rune(salt),
+		space:    space,
+		digits:   digits,
+		mul:      mul % space,
+		add:      (seed >> 32) % space,
+	}, nil
+}
+
+func (g *Hashids) Generate(ctx context.Context) (string, int64, error) {
+	const op = "alias.Hashids.Generate"
+
+	id, err := g.ids.NextURLID(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return g.encode(id), id, nil
+}
+
+func (g *Hashids) encode(id int64) string {
+	n := uint64(id)
+
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	alphabet := shuffle(g.alphabet, append([]rune{lottery}, g.salt...))
+
+	if n >= g.space {
+		return string(lottery) + encode(n, alphabet)
+	}
+
+	hi, lo := bits.Mul64(n, g.mul)
+	lo, carry := bits.Add64(lo, g.add, 0)
+	scrambled := bits.Rem64(hi+carry, lo, g.space)
+
+	digits := encode(scrambled, alphabet)
+	pad := strings.Repeat(string(alphabet[0]), g.digits-len([]rune(digits)))
+
+	return string(lottery) + pad + digits
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// shuffle is the consistent shuffle of hashids, the same salt always
+// gives the same order
+func shuffle(alphabet, salt []rune) []rune {
+	out := slices.Clone(alphabet)
+	if len(salt) == 0 {
+		return out
+	}
+
+	for i, v, p := len(out)-1, 0, 0; i > 0; i, v = i-1, v+1 {
+		v %= len(salt)
+		p += int(salt[v])
+		j := (int(salt[v]) + v + p) % i
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return out
+}
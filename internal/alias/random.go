@@ -0,0 +1,28 @@
+package alias
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/lib/random"
+)
+
+// Random makes aliases of length characters of alphabet picked with crypto/rand
+type Random struct {
+	alphabet string
+	length   int
+}
+
+func NewRandom(alphabet string, length int) *Random {
+	return &Random{alphabet: alphabet, length: length}
+}
+
+func (g *Random) Generate(_ context.Context) (string, int64, error) {
+	const op = "alias.Random.Generate"
+
+	alias, err := random.String(g.alphabet, g.length)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return alias, 0, nil
+}
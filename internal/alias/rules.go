@@ -0,0 +1,276 @@
+package alias
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/lib/random"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	CaseSensitive = "sensitive"
+	CaseLower     = "lower"
+)
+
+// Rules an alias or a team can be rejected by
+const (
+	RuleLength    = "length"
+	RuleCharset   = "charset"
+	RuleReserved  = "reserved"
+	RuleProfanity = "profanity"
+	RuleNamespace = "namespace"
+)
+
+// defaultReserved are taken besides the registered routes: the metrics
+// endpoint served on its own address and paths we are likely to need
+var defaultReserved = []string{
+	"admin", "api", "app", "assets", "docs", "help", "keys", "login",
+	"logout", "metrics", "qr", "static", "status", "t", "www",
+}
+
+//go:embed profanity.txt
+var builtinProfanity string
+
+// leet folds the digits that stand in for letters
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b",
+	"-", "", "_", "",
+)
+
+// Violation is the reason a custom alias or a team is rejected
+type Violation struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Rules check the aliases users pick, so they can't shadow a route of the
+// service, break the path of a link or put a profane word in it
+type Rules struct {
+	minLength  int
+	maxLength  int
+	charset    map[rune]bool
+	lower      bool
+	reserved   map[string]bool
+	profanity  []string
+	namespaces bool
+}
+
+func NewRules(cfg config.AliasRules) (*Rules, error) {
+	const op = "alias.NewRules"
+
+	if cfg.MinLength < 1 || cfg.MaxLength < cfg.MinLength {
+		return nil, fmt.Errorf("%s: lengths must be 1 <= min_length <= max_length", op)
+	}
+
+	charset := cfg.Charset
+	if charset == "" {
+		charset = random.Alphabet + "-_"
+	}
+
+	if err := checkAlphabet(charset); err != nil {
+		return nil, fmt.Errorf("%s: charset: %w", op, err)
+	}
+
+	r := &Rules{
+		minLength:  cfg.MinLength,
+		maxLength:  cfg.MaxLength,
+		charset:    make(map[rune]bool, len(charset)),
+		reserved:   make(map[string]bool),
+		namespaces: cfg.Namespaces,
+	}
+
+	for _, c := range charset {
+		r.charset[c] = true
+	}
+
+	switch cfg.Case {
+	case CaseSensitive, "":
+	case CaseLower:
+		r.lower = true
+	default:
+		return nil, fmt.Errorf("%s: unknown case policy %q", op, cfg.Case)
+	}
+
+	r.Reserve(defaultReserved...)
+	r.Reserve(cfg.Reserved...)
+
+	if cfg.ProfanityFilter {
+		words, err := loadWords(builtinProfanity, cfg.ProfanityWords, cfg.ProfanityFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.profanity = words
+	}
+
+	return r, nil
+}
+
+// Reserve takes words away from custom and generated aliases, it is
+// called before the server starts, the rules aren't changed after that
+func (r *Rules) Reserve(words ...string) {
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			r.reserved[word] = true
+		}
+	}
+}
+
+// ReserveRoutes reserves every static segment of the routes, like "url",
+// "batch" or "healthz", so no alias is shadowed by a route or shadows one
+func (r *Rules) ReserveRoutes(routes chi.Routes) error {
+	return chi.Walk(routes, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		for _, segment := range strings.Split(route, "/") {
+			if segment == "" || segment == "*" || strings.HasPrefix(segment, "{") {
+				continue
+			}
+			r.Reserve(segment)
+		}
+
+		return nil
+	})
+}
+
+// Fold returns the alias as it is stored, lowercased under the lower case policy
+func (r *Rules) Fold(alias string) string {
+	if r.lower {
+		return strings.ToLower(alias)
+	}
+
+	return alias
+}
+
+// Custom checks an alias picked by a user and returns it as it is stored
+func (r *Rules) Custom(alias string) (string, error) {
+	alias = r.Fold(alias)
+
+	if err := r.check("Alias", alias, r.minLength); err != nil {
+		return "", err
+	}
+
+	if r.reserved[strings.ToLower(alias)] {
+		return "", &Violation{Field: "Alias", Rule: RuleReserved, Message: "field Alias is reserved"}
+	}
+
+	return alias, nil
+}
+
+// Generated checks a generated alias, one that is reserved or profane
+// should be replaced with the next one
+func (r *Rules) Generated(alias string) error {
+	if r.reserved[strings.ToLower(alias)] {
+		return &Violation{Field: "Alias", Rule: RuleReserved, Message: "field Alias is reserved"}
+	}
+
+	if r.profane(alias) {
+		return &Violation{Field: "Alias", Rule: RuleProfanity, Message: "field Alias contains a profane word"}
+	}
+
+	return nil
+}
+
+// Team checks the namespace of an alias and returns it as it is stored,
+// an empty team is no namespace
+func (r *Rules) Team(team string) (string, error) {
+	if team == "" {
+		return "", nil
+	}
+
+	if !r.namespaces {
+		return "", &Violation{Field: "Team", Rule: RuleNamespace, Message: "team namespaces are disabled"}
+	}
+
+	team = r.Fold(team)
+
+	if err := r.check("Team", team, 1); err != nil {
+		return "", err
+	}
+
+	return team, nil
+}
+
+func (r *Rules) check(field, value string, minLength int) error {
+	if n := utf8.RuneCountInString(value); n < minLength || n > r.maxLength {
+		return &Violation{
+			Field:   field,
+			Rule:    RuleLength,
+			Message: fmt.Sprintf("field %s must be from %d to %d characters long", field, minLength, r.maxLength),
+		}
+	}
+
+	for _, c := range value {
+		if !r.charset[c] {
+			return &Violation{
+				Field:   field,
+				Rule:    RuleCharset,
+				Message: fmt.Sprintf("field %s has the invalid character %q", field, c),
+			}
+		}
+	}
+
+	if r.profane(value) {
+		return &Violation{Field: field, Rule: RuleProfanity, Message: fmt.Sprintf("field %s contains a profane word", field)}
+	}
+
+	return nil
+}
+
+func (r *Rules) profane(value string) bool {
+	if len(r.profanity) == 0 {
+		return false
+	}
+
+	folded := leet.Replace(strings.ToLower(value))
+	for _, word := range r.profanity {
+		if strings.Contains(folded, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadWords merges the words of builtin, list and file, one per line,
+// blank lines and the ones starting with # are skipped
+func loadWords(builtin string, list []string, file string) ([]string, error) {
+	words := strings.Split(builtin, "\n")
+	words = append(words, list...)
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			words = append(words, scanner.Text())
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+	}
+
+	var out []string
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		out = append(out, leet.Replace(strings.ToLower(word)))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,180 @@
+package alias
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRulesCustom(t *testing.T) {
+	profanityFile := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(profanityFile, []byte("# local slang\nbadword\n"), 0o600))
+
+	rules, err := NewRules(config.AliasRules{
+		MinLength:       3,
+		MaxLength:       16,
+		Reserved:        []string{"Promo"},
+		ProfanityFilter: true,
+		ProfanityFile:   profanityFile,
+	})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Get("/healthz", func(http.ResponseWriter, *http.Request) {})
+	router.Route("/url", func(r chi.Router) {
+		r.Post("/batch", func(http.ResponseWriter, *http.Request) {})
+		r.Get("/{alias}/revisions", func(http.ResponseWriter, *http.Request) {})
+	})
+	require.NoError(t, rules.ReserveRoutes(router))
+
+	cases := []struct {
+		alias    string
+		wantRule string
+	}{
+		{alias: "google"},
+		{alias: "Go_Lang-2024"},
+		{alias: "passage"},
+		{alias: "go", wantRule: RuleLength},
+		{alias: strings.Repeat("a", 17), wantRule: RuleLength},
+		{alias: "a/b/c", wantRule: RuleCharset},
+		{alias: "path.json", wantRule: RuleCharset},
+		{alias: "привет", wantRule: RuleCharset},
+		{alias: "url", wantRule: RuleReserved},
+		{alias: "URL", wantRule: RuleReserved},
+		{alias: "healthz", wantRule: RuleReserved},
+		{alias: "batch", wantRule: RuleReserved},
+		{alias: "revisions", wantRule: RuleReserved},
+		{alias: "metrics", wantRule: RuleReserved},
+		{alias: "qr", wantRule: RuleLength},
+		{alias: "keys", wantRule: RuleReserved},
+		{alias: "promo", wantRule: RuleReserved},
+		{alias: "holy-sh1t", wantRule: RuleProfanity},
+		{alias: "F_U_C_K", wantRule: RuleProfanity},
+		{alias: "my-badword", wantRule: RuleProfanity},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.alias, func(t *testing.T) {
+			got, err := rules.Custom(tc.alias)
+			if tc.wantRule == "" {
+				require.NoError(t, err)
+				require.Equal(t, tc.alias, got)
+				return
+			}
+
+			var violation *Violation
+			require.ErrorAs(t, err, &violation)
+			require.Equal(t, "Alias", violation.Field)
+			require.Equal(t, tc.wantRule, violation.Rule)
+		})
+	}
+}
+
+func TestRulesGenerated(t *testing.T) {
+	rules, err := NewRules(config.AliasRules{MinLength: 8, MaxLength: 8, ProfanityFilter: true})
+	require.NoError(t, err)
+
+	// generated aliases don't follow the length and charset of custom ones
+	require.NoError(t, rules.Generated("Ab3"))
+	require.Error(t, rules.Generated("api"))
+	require.Error(t, rules.Generated("xPornx"))
+
+	rules, err = NewRules(config.AliasRules{MinLength: 1, MaxLength: 8})
+	require.NoError(t, err)
+	require.NoError(t, rules.Generated("xPornx"))
+}
+
+func TestRulesTeam(t *testing.T) {
+	rules, err := NewRules(config.AliasRules{MinLength: 3, MaxLength: 8, Case: CaseLower, Namespaces: true})
+	require.NoError(t, err)
+
+	team, err := rules.Team("Sales")
+	require.NoError(t, err)
+	require.Equal(t, "sales", team)
+
+	// a team may be short and named like a route, it is a namespace of its own
+	team, err = rules.Team("qa")
+	require.NoError(t, err)
+	require.Equal(t, "qa", team)
+
+	custom, err := rules.Custom("Spring")
+	require.NoError(t, err)
+	require.Equal(t, "spring", custom)
+
+	var violation *Violation
+	_, err = rules.Team("sales/eu")
+	require.ErrorAs(t, err, &violation)
+	require.Equal(t, "Team", violation.Field)
+	require.Equal(t, RuleCharset, violation.Rule)
+
+	rules, err = NewRules(config.AliasRules{MinLength: 1, MaxLength: 8})
+	require.NoError(t, err)
+
+	team, err = rules.Team("")
+	require.NoError(t, err)
+	require.Empty(t, team)
+
+	_, err = rules.Team("sales")
+	require.ErrorAs(t, err, &violation)
+	require.Equal(t, RuleNamespace, violation.Rule)
+}
+
+func TestNewRules(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     config.AliasRules
+		wantErr string
+	}{
+		{
+			name:    "Zero length",
+			cfg:     config.AliasRules{MaxLength: 8},
+			wantErr: "alias.NewRules: lengths must be 1 <= min_length <= max_length",
+		},
+		{
+			name:    "Min over max",
+			cfg:     config.AliasRules{MinLength: 9, MaxLength: 8},
+			wantErr: "alias.NewRules: lengths must be 1 <= min_length <= max_length",
+		},
+		{
+			name:    "Slash in charset",
+			cfg:     config.AliasRules{MinLength: 1, MaxLength: 8, Charset: "ab/"},
+			wantErr: `alias.NewRules: charset: alphabet has invalid character '/'`,
+		},
+		{
+			name:    "Unknown case",
+			cfg:     config.AliasRules{MinLength: 1, MaxLength: 8, Case: "upper"},
+			wantErr: `alias.NewRules: unknown case policy "upper"`,
+		},
+		{
+			name:    "Missing profanity file",
+			cfg:     config.AliasRules{MinLength: 1, MaxLength: 8, ProfanityFilter: true, ProfanityFile: "/nonexistent"},
+			wantErr: "alias.NewRules: open /nonexistent: no such file or directory",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRules(tc.cfg)
+			require.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestNewLowerCase(t *testing.T) {
+	g, err := New(config.Alias{Length: 12, Rules: config.AliasRules{Case: CaseLower}}, storage.NewMemory())
+	require.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		alias, _, err := g.Generate(context.Background())
+		require.NoError(t, err)
+		require.Regexp(t, regexp.MustCompile(`^[a-z0-9]{12}$`), alias)
+	}
+}
@@ -0,0 +1,28 @@
+package alias
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sequential makes the shortest possible aliases, the id of the url in
+// base len(alphabet) (base62 by default). They are easy to enumerate.
+type Sequential struct {
+	ids      IDReserver
+	alphabet []rune
+}
+
+func NewSequential(ids IDReserver, alphabet string) *Sequential {
+	return &Sequential{ids: ids, alphabet: []rune(alphabet)}
+}
+
+func (g *Sequential) Generate(ctx context.Context) (string, int64, error) {
+	const op = "alias.Sequential.Generate"
+
+	id, err := g.ids.NextURLID(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return encode(uint64(id), g.alphabet), id, nil
+}
@@ -0,0 +1,44 @@
+package alias
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/lib/random"
+	"strings"
+)
+
+const (
+	// consonants leave out letters that are easy to mishear
+	consonants = "bdfghjklmnprstvz"
+	vowels     = "aeiou"
+)
+
+// Words makes pronounceable aliases like "bakotu" of alternating
+// consonants and vowels, easy to read out and to type from memory
+type Words struct {
+	length int
+}
+
+func NewWords(length int) *Words {
+	return &Words{length: length}
+}
+
+func (g *Words) Generate(_ context.Context) (string, int64, error) {
+	const op = "alias.Words.Generate"
+
+	var b strings.Builder
+	for i := 0; i < g.length; i++ {
+		letters := consonants
+		if i%2 == 1 {
+			letters = vowels
+		}
+
+		letter, err := random.String(letters, 1)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: %w", op, err)
+		}
+		b.WriteString(letter)
+	}
+
+	return b.String(), 0, nil
+}
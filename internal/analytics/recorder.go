@@ -0,0 +1,160 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/lib/realip"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ClickSaver interface {
+	SaveClicks(ctx context.Context, clicks []models.Click) error
+}
+
+// Recorder writes clicks in the background so redirects never wait on the database.
+// Clicks are buffered and saved in batches, when the buffer is full new clicks are dropped.
+type Recorder struct {
+	log      *slog.Logger
+	saver    ClickSaver
+	resolver *realip.Resolver
+	cfg      config.Analytics
+
+	clicks    chan models.Click
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRecorder starts a recorder that saves clicks with saver, visitors are
+// told apart by the client address of resolver. The flush interval and
+// batch size must be positive.
+func NewRecorder(log *slog.Logger, saver ClickSaver, resolver *realip.Resolver, cfg config.Analytics) (*Recorder, error) {
+	const op = "analytics.NewRecorder"
+
+	if cfg.FlushInterval <= 0 {
+		return nil, fmt.Errorf("%s: flush interval must be positive", op)
+	}
+
+	if cfg.BatchSize <= 0 {
+		return nil, fmt.Errorf("%s: batch size must be positive", op)
+	}
+
+	if cfg.BufferSize < 0 {
+		return nil, fmt.Errorf("%s: buffer size must not be negative", op)
+	}
+
+	r := &Recorder{
+		log:      log.With(slog.String("component", "analytics/recorder")),
+		saver:    saver,
+		resolver: resolver,
+		cfg:      cfg,
+		clicks:   make(chan models.Click, cfg.BufferSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// Track records a click on alias of domain made by req
+func (r *Recorder) Track(req *http.Request, domain, alias string) {
+	r.Record(models.Click{
+		Domain:    domain,
+		Alias:     alias,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  req.Referer(),
+		UserAgent: req.UserAgent(),
+		Country:   req.Header.Get(r.cfg.CountryHeader),
+		RequestID: middleware.GetReqID(req.Context()),
+		VisitorID: r.visitorID(req),
+	})
+}
+
+// Record queues click without blocking
+func (r *Recorder) Record(click models.Click) {
+	select {
+	case <-r.stop:
+		r.log.Warn("recorder is closed, click dropped", slog.String("alias", click.Alias))
+	case r.clicks <- click:
+	default:
+		r.log.Warn("clicks buffer is full, click dropped", slog.String("alias", click.Alias))
+	}
+}
+
+// Close stops accepting clicks and flushes the buffered ones
+func (r *Recorder) Close(ctx context.Context) error {
+	r.closeOnce.Do(func() { close(r.stop) })
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Click, 0, r.cfg.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := r.saver.SaveClicks(context.Background(), batch); err != nil {
+			r.log.Error("failed to save clicks", slog.Int("count", len(batch)), sl.Err(err))
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case click := <-r.clicks:
+			batch = append(batch, click)
+			if len(batch) >= r.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-r.stop:
+			// drain whatever was queued before close
+			for {
+				select {
+				case click := <-r.clicks:
+					batch = append(batch, click)
+					if len(batch) >= r.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// visitorID identifies a client by its address and user agent without storing the address itself,
+// behind trusted proxies the address is the forwarded one
+func (r *Recorder) visitorID(req *http.Request) string {
+	sum := sha256.Sum256([]byte(r.resolver.ClientIP(req) + "|" + req.UserAgent()))
+
+	return hex.EncodeToString(sum[:8])
+}
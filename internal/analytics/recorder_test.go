@@ -0,0 +1,138 @@
+package analytics
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/lib/realip"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type clickSaverStub struct {
+	mu     sync.Mutex
+	clicks []models.Click
+}
+
+func (s *clickSaverStub) SaveClicks(_ context.Context, clicks []models.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clicks = append(s.clicks, clicks...)
+
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	saver := &clickSaverStub{}
+
+	rec, err := NewRecorder(slogdiscard.NewDiscardLogger(), saver, noProxies(t), config.Analytics{
+		BufferSize:    10,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		CountryHeader: "CF-IPCountry",
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/google", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("Referer", "https://news.ycombinator.com")
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("CF-IPCountry", "NL")
+
+	for i := 0; i < 3; i++ {
+		rec.Track(req, "", "google")
+	}
+
+	// the third click is below the batch size and only written on close
+	require.NoError(t, rec.Close(context.Background()))
+	require.Len(t, saver.clicks, 3)
+
+	click := saver.clicks[0]
+	require.Equal(t, "google", click.Alias)
+	require.Equal(t, "https://news.ycombinator.com", click.Referrer)
+	require.Equal(t, "curl/8.0", click.UserAgent)
+	require.Equal(t, "NL", click.Country)
+	require.NotEmpty(t, click.VisitorID)
+	require.NotContains(t, click.VisitorID, "10.0.0.1")
+
+	// closed recorder drops clicks instead of blocking
+	rec.Track(req, "", "google")
+	require.NoError(t, rec.Close(context.Background()))
+	require.Len(t, saver.clicks, 3)
+}
+
+func TestRecorderVisitorBehindProxy(t *testing.T) {
+	resolver, err := realip.New([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	saver := &clickSaverStub{}
+
+	rec, err := NewRecorder(slogdiscard.NewDiscardLogger(), saver, resolver, config.Analytics{
+		BufferSize:    10,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	for _, client := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.1"} {
+		req := httptest.NewRequest("GET", "/google", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", client)
+		req.Header.Set("User-Agent", "curl/8.0")
+
+		rec.Track(req, "", "google")
+	}
+
+	require.NoError(t, rec.Close(context.Background()))
+	require.Len(t, saver.clicks, 3)
+
+	// the proxy is the peer of every click, the visitors are the forwarded clients
+	require.NotEqual(t, saver.clicks[0].VisitorID, saver.clicks[1].VisitorID)
+	require.Equal(t, saver.clicks[0].VisitorID, saver.clicks[2].VisitorID)
+}
+
+func TestNewRecorderInvalidConfig(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  config.Analytics
+	}{
+		{
+			name: "Zero flush interval",
+			cfg:  config.Analytics{BatchSize: 1},
+		},
+		{
+			name: "Negative flush interval",
+			cfg:  config.Analytics{FlushInterval: -time.Second, BatchSize: 1},
+		},
+		{
+			name: "Zero batch size",
+			cfg:  config.Analytics{FlushInterval: time.Second},
+		},
+		{
+			name: "Negative buffer size",
+			cfg:  config.Analytics{FlushInterval: time.Second, BatchSize: 1, BufferSize: -1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := NewRecorder(slogdiscard.NewDiscardLogger(), &clickSaverStub{}, noProxies(t), tc.cfg)
+			require.Error(t, err)
+			require.Nil(t, rec)
+		})
+	}
+}
+
+func noProxies(t *testing.T) *realip.Resolver {
+	t.Helper()
+
+	resolver, err := realip.New(nil)
+	require.NoError(t, err)
+
+	return resolver
+}
@@ -0,0 +1,148 @@
+// Package apikey issues API keys and authenticates requests by them
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Prefix starts every key, it tells keys from SSO tokens in the Authorization header
+const Prefix = "usk_"
+
+const (
+	alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// secretLength random characters make about 238 bits
+	secretLength = 40
+	// displayLength characters of the secret are kept in plain text to tell keys apart
+	displayLength = 6
+	// touchInterval limits the writes of the last use to one per key a minute
+	touchInterval = time.Minute
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid api key")
+	ErrKeyExpired = fmt.Errorf("%w: key expired", ErrInvalidKey)
+	ErrKeyRevoked = fmt.Errorf("%w: key revoked", ErrInvalidKey)
+)
+
+// IsKey reports whether token looks like an API key, it doesn't check it
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Hash is what is stored of key, keys are random so a fast hash is enough
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// New generates a key for userID, it returns the key to hand out once
+// and the APIKey to store
+func New(name string, scopes []string, userID int64, expiresAt *time.Time) (string, models.APIKey, error) {
+	const op = "apikey.New"
+
+	secret, err := randomString(secretLength)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+	key := Prefix + secret
+
+	return key, models.APIKey{
+		Name:      name,
+		Prefix:    key[:len(Prefix)+displayLength],
+		Hash:      Hash(key),
+		Scopes:    scopes,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// randomString returns n characters of alphabet, bytes past the last whole
+// multiple of its length are skipped so every character is equally likely
+func randomString(n int) (string, error) {
+	const limit = 256 - 256%len(alphabet)
+
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			if int(b) < limit && len(out) < n {
+				out = append(out, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+
+	return string(out), nil
+}
+
+// Store is the part of the storage keys are checked against
+type Store interface {
+	APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id int64, at time.Time) error
+}
+
+// Authenticator checks keys against the storage
+type Authenticator struct {
+	log   *slog.Logger
+	store Store
+	now   func() time.Time
+}
+
+func NewAuthenticator(log *slog.Logger, store Store) *Authenticator {
+	return &Authenticator{
+		log:   log.With(slog.String("component", "apikey")),
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Authenticate returns the stored key of key, errors wrapping ErrInvalidKey
+// mean the key can't be used. The last use is recorded at most once a minute.
+func (a *Authenticator) Authenticate(ctx context.Context, key string) (models.APIKey, error) {
+	const op = "apikey.Authenticate"
+
+	if !IsKey(key) {
+		return models.APIKey{}, ErrInvalidKey
+	}
+
+	k, err := a.store.APIKeyByHash(ctx, Hash(key))
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		return models.APIKey{}, ErrInvalidKey
+	}
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := a.now()
+	if k.Revoked() {
+		return models.APIKey{}, ErrKeyRevoked
+	}
+	if k.Expired(now) {
+		return models.APIKey{}, ErrKeyExpired
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= touchInterval {
+		// a failed write only loses the last use, the request goes on
+		if err := a.store.TouchAPIKey(ctx, k.ID, now); err != nil {
+			a.log.WarnContext(ctx, "failed to record api key use", slog.Int64("key_id", k.ID), sl.Err(err))
+		} else {
+			k.LastUsedAt = &now
+		}
+	}
+
+	return k, nil
+}
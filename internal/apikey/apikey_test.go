@@ -0,0 +1,88 @@
+package apikey
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	key, k, err := New("deploy", []string{models.ScopeLinksWrite}, 42, nil)
+	require.NoError(t, err)
+
+	require.True(t, IsKey(key))
+	require.Len(t, key, len(Prefix)+secretLength)
+	require.Equal(t, strings.Trim(key, alphabet+"_"), "")
+	require.True(t, strings.HasPrefix(key, k.Prefix))
+	require.Len(t, k.Prefix, len(Prefix)+displayLength)
+	require.Equal(t, Hash(key), k.Hash)
+	require.Equal(t, int64(42), k.UserID)
+
+	other, _, err := New("deploy", nil, 42, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := NewAuthenticator(slogdiscard.NewDiscardLogger(), store)
+	a.now = func() time.Time { return now }
+
+	save := func(expiresAt *time.Time) (string, int64) {
+		key, k, err := New("key", []string{models.ScopeStatsRead}, 42, expiresAt)
+		require.NoError(t, err)
+
+		id, err := store.SaveAPIKey(ctx, k)
+		require.NoError(t, err)
+
+		return key, id
+	}
+
+	key, id := save(nil)
+
+	k, err := a.Authenticate(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, id, k.ID)
+	require.Equal(t, []string{models.ScopeStatsRead}, k.Scopes)
+	require.Equal(t, now, *k.LastUsedAt)
+
+	// the last use isn't written again within a minute
+	now = now.Add(30 * time.Second)
+	k, err = a.Authenticate(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(-30*time.Second), *k.LastUsedAt)
+
+	now = now.Add(time.Minute)
+	k, err = a.Authenticate(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, now, *k.LastUsedAt)
+
+	_, err = a.Authenticate(ctx, key+"x")
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = a.Authenticate(ctx, "not a key")
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	expires := now.Add(time.Hour)
+	expiring, _ := save(&expires)
+	_, err = a.Authenticate(ctx, expiring)
+	require.NoError(t, err)
+
+	now = expires
+	_, err = a.Authenticate(ctx, expiring)
+	require.ErrorIs(t, err, ErrKeyExpired)
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = store.RevokeAPIKey(ctx, id, nil, now)
+	require.NoError(t, err)
+	_, err = a.Authenticate(ctx, key)
+	require.ErrorIs(t, err, ErrKeyRevoked)
+}
@@ -0,0 +1,149 @@
+// Package authz decides what an authenticated user may do with links
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"slices"
+)
+
+// Action is what a user asks to do
+type Action string
+
+const (
+	ActionCreate        Action = "create"
+	ActionList          Action = "list"
+	ActionUpdate        Action = "update"
+	ActionDelete        Action = "delete"
+	ActionViewStats     Action = "view_stats"
+	ActionRevokeKey     Action = "revoke_key"
+	ActionUseDomain     Action = "use_domain"
+	ActionManageDomains Action = "manage_domains"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// Resource is what an action is taken on, the zero Resource is the service itself
+type Resource struct {
+	// Owner is the user that owns the link, 0 for links without an owner
+	Owner int64
+	// Team is the namespace of the link, empty outside namespaces
+	Team string
+}
+
+// LinkOf is the resource of a saved link
+func LinkOf(u models.URL) Resource {
+	return Resource{Owner: u.UserID, Team: models.TeamOf(u.Alias)}
+}
+
+// DomainOf is the resource of a custom domain, it belongs to the user that added it
+func DomainOf(d models.Domain) Resource {
+	return Resource{Owner: d.UserID}
+}
+
+// Roles are what a user is besides the owner of its links
+type Roles struct {
+	Admin bool
+	// Teams are the namespaces the user is a member of
+	Teams []string
+}
+
+// Member reports whether the roles include team
+func (r Roles) Member(team string) bool {
+	return team != "" && slices.Contains(r.Teams, team)
+}
+
+// RoleResolver finds the roles of a user
+type RoleResolver interface {
+	Roles(ctx context.Context, user auth.User) (Roles, error)
+}
+
+// Policy is the default set of rules:
+//   - the service account and admins may do anything
+//   - anyone may create links outside namespaces, members of a team may create them in its namespace
+//   - owners of a link and members of its team may update it, delete it and view its stats
+//   - users may list their own links and revoke their own keys, only admins anyone's
+//   - links on a custom domain may be created by the user that added it and admins
+//   - only admins may manage domains
+type Policy struct {
+	roles RoleResolver
+}
+
+func NewPolicy(roles RoleResolver) *Policy {
+	return &Policy{roles: roles}
+}
+
+// Authorize returns ErrForbidden if user may not take action on res, roles are only
+// resolved if owning the resource doesn't decide it
+func (p *Policy) Authorize(ctx context.Context, user auth.User, action Action, res Resource) error {
+	const op = "authz.Authorize"
+
+	if user.Service {
+		return nil
+	}
+
+	switch action {
+	case ActionCreate:
+		if res.Team == "" {
+			return nil
+		}
+	case ActionList, ActionUpdate, ActionDelete, ActionViewStats, ActionRevokeKey, ActionUseDomain:
+		if res.Owner != 0 && res.Owner == user.ID {
+			return nil
+		}
+	case ActionManageDomains:
+	default:
+		return fmt.Errorf("%s: unknown action %q: %w", op, action, ErrForbidden)
+	}
+
+	roles, err := p.roles.Roles(ctx, user)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if roles.Admin {
+		return nil
+	}
+
+	// a team works on every link of its namespace, domains belong to nobody
+	if action != ActionManageDomains && roles.Member(res.Team) {
+		return nil
+	}
+
+	return ErrForbidden
+}
+
+// Owner narrows a request of user to take action on the links or keys of
+// owner, nil for everyone's, to what the policy allows: nil stays nil only
+// for users that may take action on anyone's and becomes the user otherwise.
+// Roles that can't be resolved narrow it too, taking action on one's own
+// needs none. Another owner than the user is ErrForbidden unless the policy
+// allows it.
+func Owner(ctx context.Context, log *slog.Logger, policy Authorizer, user auth.User, action Action, owner *int64) (*int64, error) {
+	var res Resource
+	if owner != nil {
+		res.Owner = *owner
+	}
+
+	err := policy.Authorize(ctx, user, action, res)
+	if err != nil && owner == nil {
+		if !errors.Is(err, ErrForbidden) {
+			log.WarnContext(ctx, "failed to resolve roles, taken for a user without any",
+				slog.Int64("user_id", user.ID),
+				sl.Err(err),
+			)
+		}
+
+		return &user.ID, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return owner, nil
+}
@@ -0,0 +1,244 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSO answers IsAdmin for the users in admins and Teams from teams,
+// a nil teams keeps none, or fails with err
+type fakeSSO struct {
+	admins map[int64]bool
+	teams  map[int64][]string
+	err    error
+	calls  int
+}
+
+func (f *fakeSSO) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	f.calls++
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.admins[userID], nil
+}
+
+func (f *fakeSSO) Teams(_ context.Context, userID int64) ([]string, bool, error) {
+	if f.err != nil {
+		return nil, false, f.err
+	}
+	return f.teams[userID], f.teams != nil, nil
+}
+
+func TestPolicy(t *testing.T) {
+	sso := &fakeSSO{admins: map[int64]bool{1: true}}
+	policy := NewPolicy(NewResolver(slogdiscard.NewDiscardLogger(), sso, config.Authz{CacheTTL: time.Minute, CacheSize: 10}, strings.ToLower))
+
+	admin := auth.User{ID: 1}
+	owner := auth.User{ID: 7}
+	// the claim is folded like the namespaces of aliases
+	member := auth.User{ID: 8, Teams: []string{"Sales"}}
+	stranger := auth.User{ID: 9}
+	service := auth.User{Service: true}
+
+	link := Resource{Owner: 7}
+	teamLink := Resource{Owner: 7, Team: "sales"}
+
+	cases := []struct {
+		name    string
+		user    auth.User
+		action  Action
+		res     Resource
+		allowed bool
+	}{
+		{name: "Anyone creates outside namespaces", user: stranger, action: ActionCreate, allowed: true},
+		{name: "Member creates in the team", user: member, action: ActionCreate, res: Resource{Team: "sales"}, allowed: true},
+		{name: "Stranger creates in the team", user: stranger, action: ActionCreate, res: Resource{Team: "sales"}},
+		{name: "Admin creates in the team", user: admin, action: ActionCreate, res: Resource{Team: "sales"}, allowed: true},
+		{name: "Owner updates", user: owner, action: ActionUpdate, res: link, allowed: true},
+		{name: "Owner deletes", user: owner, action: ActionDelete, res: link, allowed: true},
+		{name: "Owner views stats", user: owner, action: ActionViewStats, res: link, allowed: true},
+		{name: "Stranger deletes", user: stranger, action: ActionDelete, res: link},
+		{name: "Stranger views stats", user: stranger, action: ActionViewStats, res: link},
+		{name: "Member deletes a team link", user: member, action: ActionDelete, res: teamLink, allowed: true},
+		{name: "Member deletes a link outside the team", user: member, action: ActionDelete, res: link},
+		{name: "Nobody owns a link without an owner", user: auth.User{}, action: ActionUpdate, res: Resource{}},
+		{name: "Admin deletes", user: admin, action: ActionDelete, res: link, allowed: true},
+		{name: "Service account deletes", user: service, action: ActionDelete, res: link, allowed: true},
+		{name: "Owner lists own links", user: owner, action: ActionList, res: Resource{Owner: 7}, allowed: true},
+		{name: "Stranger lists links of another", user: stranger, action: ActionList, res: link},
+		{name: "Stranger lists every link", user: stranger, action: ActionList},
+		{name: "Admin lists every link", user: admin, action: ActionList, allowed: true},
+		{name: "Member revokes keys", user: member, action: ActionRevokeKey},
+		{name: "Admin revokes keys", user: admin, action: ActionRevokeKey, allowed: true},
+		{name: "Admin manages domains", user: admin, action: ActionManageDomains, allowed: true},
+		{name: "Member manages domains", user: member, action: ActionManageDomains, res: Resource{Team: "sales"}},
+		{name: "Service account manages domains", user: service, action: ActionManageDomains, allowed: true},
+		{name: "Unknown action", user: admin, action: Action("archive"), res: link},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Authorize(context.Background(), tc.user, tc.action, tc.res)
+			if tc.allowed {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrForbidden)
+		})
+	}
+
+	// an SSO failure without known roles isn't taken for a denial
+	sso.err = errors.New("unavailable")
+	err := policy.Authorize(context.Background(), auth.User{ID: 10}, ActionDelete, link)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrForbidden)
+}
+
+func TestOwner(t *testing.T) {
+	ctx := context.Background()
+	log := slogdiscard.NewDiscardLogger()
+	sso := &fakeSSO{admins: map[int64]bool{1: true}}
+	policy := NewPolicy(NewResolver(log, sso, config.Authz{CacheSize: 10}, nil))
+
+	admin := auth.User{ID: 1}
+	user := auth.User{ID: 7}
+	other := int64(8)
+
+	owner, err := Owner(ctx, log, policy, admin, ActionList, nil)
+	require.NoError(t, err)
+	require.Nil(t, owner)
+
+	owner, err = Owner(ctx, log, policy, admin, ActionList, &other)
+	require.NoError(t, err)
+	require.Equal(t, &other, owner)
+
+	// everyone's links become the user's own
+	owner, err = Owner(ctx, log, policy, user, ActionList, nil)
+	require.NoError(t, err)
+	require.Equal(t, &user.ID, owner)
+
+	owner, err = Owner(ctx, log, policy, user, ActionList, &user.ID)
+	require.NoError(t, err)
+	require.Equal(t, &user.ID, owner)
+
+	_, err = Owner(ctx, log, policy, user, ActionList, &other)
+	require.ErrorIs(t, err, ErrForbidden)
+
+	// roles that can't be resolved are taken for none
+	sso.err = errors.New("unavailable")
+
+	owner, err = Owner(ctx, log, policy, admin, ActionList, nil)
+	require.NoError(t, err)
+	require.Equal(t, &admin.ID, owner)
+
+	owner, err = Owner(ctx, log, policy, user, ActionList, &user.ID)
+	require.NoError(t, err)
+	require.Equal(t, &user.ID, owner)
+
+	// but another owner can't be told apart from a forbidden one
+	_, err = Owner(ctx, log, policy, admin, ActionList, &other)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrForbidden)
+}
+
+func TestResolverCache(t *testing.T) {
+	ctx := context.Background()
+	sso := &fakeSSO{admins: map[int64]bool{1: true}}
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewResolver(slogdiscard.NewDiscardLogger(), sso, config.Authz{
+		CacheTTL:    time.Minute,
+		FallbackTTL: time.Hour,
+		CacheSize:   10,
+	}, nil)
+	r.now = func() time.Time { return now }
+
+	roles, err := r.Roles(ctx, auth.User{ID: 1, Teams: []string{"sales"}})
+	require.NoError(t, err)
+	require.Equal(t, Roles{Admin: true, Teams: []string{"sales"}}, roles)
+	require.Equal(t, 1, sso.calls)
+
+	// fresh roles are reused
+	now = now.Add(30 * time.Second)
+	admin, err := r.IsAdmin(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, admin)
+	require.Equal(t, 1, sso.calls)
+
+	// stale ones are asked for again
+	now = now.Add(time.Minute)
+	sso.admins[1] = false
+	admin, err = r.IsAdmin(ctx, 1)
+	require.NoError(t, err)
+	require.False(t, admin)
+	require.Equal(t, 2, sso.calls)
+
+	// while the SSO service fails the last known roles are used
+	now = now.Add(30 * time.Minute)
+	sso.err = errors.New("unavailable")
+	admin, err = r.IsAdmin(ctx, 1)
+	require.NoError(t, err)
+	require.False(t, admin)
+
+	// but not past the fallback ttl
+	now = now.Add(time.Hour)
+	_, err = r.IsAdmin(ctx, 1)
+	require.Error(t, err)
+
+	// nor for users never seen before
+	_, err = r.IsAdmin(ctx, 2)
+	require.Error(t, err)
+
+	// the service account isn't asked about
+	calls := sso.calls
+	roles, err = r.Roles(ctx, auth.User{Service: true})
+	require.NoError(t, err)
+	require.True(t, roles.Admin)
+	require.Equal(t, calls, sso.calls)
+}
+
+func TestResolverTeams(t *testing.T) {
+	ctx := context.Background()
+	sso := &fakeSSO{teams: map[int64][]string{1: {"Sales"}}}
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewResolver(slogdiscard.NewDiscardLogger(), sso, config.Authz{
+		CacheTTL:    time.Minute,
+		FallbackTTL: time.Hour,
+		CacheSize:   10,
+	}, strings.ToLower)
+	r.now = func() time.Time { return now }
+
+	// memberships the service keeps win over the claim, a key has none
+	roles, err := r.Roles(ctx, auth.User{ID: 1, Teams: []string{"ops"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"sales"}, roles.Teams)
+
+	roles, err = r.Roles(ctx, auth.User{ID: 2, Teams: []string{"ops"}})
+	require.NoError(t, err)
+	require.Empty(t, roles.Teams)
+
+	// they are cached and fall back like admins
+	calls := sso.calls
+	now = now.Add(30 * time.Minute)
+	sso.err = errors.New("unavailable")
+	roles, err = r.Roles(ctx, auth.User{ID: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"sales"}, roles.Teams)
+	require.Equal(t, calls+1, sso.calls)
+
+	// a service that doesn't keep them leaves the claim
+	sso.err = nil
+	sso.teams = nil
+	now = now.Add(time.Minute)
+	roles, err = r.Roles(ctx, auth.User{ID: 1, Teams: []string{"Ops"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ops"}, roles.Teams)
+}
@@ -0,0 +1,56 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+)
+
+// Authorizer decides whether user may take action on res
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action Action, res Resource) error
+}
+
+// Require lets a request through if its user may take action at all, checks
+// of a single link are left to the handler that loads it
+func Require(log *slog.Logger, policy Authorizer, action Action) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/authz"),
+			slog.String("action", string(action)),
+		)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := log.With(slog.String("request_id", middleware.GetReqID(r.Context())))
+
+			user, ok := auth.UserFromContext(r.Context())
+			if !ok {
+				log.ErrorContext(r.Context(), "no authenticated user")
+				resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+				return
+			}
+
+			err := policy.Authorize(r.Context(), user, action, Resource{})
+			if errors.Is(err, ErrForbidden) {
+				log.WarnContext(r.Context(), "action is forbidden", slog.Int64("user_id", user.ID))
+				resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+				return
+			}
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to authorize", slog.Int64("user_id", user.ID), sl.Err(err))
+				resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
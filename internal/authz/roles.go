@@ -0,0 +1,141 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/lib/lru"
+	"log/slog"
+	"time"
+)
+
+// SSO asks the SSO service about the roles of a user
+type SSO interface {
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	// Teams are the teams userID is a member of, ok is false if the service doesn't keep them
+	Teams(ctx context.Context, userID int64) (teams []string, ok bool, err error)
+}
+
+// Resolver resolves roles by the SSO service and caches them. If the
+// service doesn't keep team memberships they come from the token of the user.
+type Resolver struct {
+	log      *slog.Logger
+	sso      SSO
+	fold     func(string) string
+	cache    *lru.Cache[int64, entry]
+	ttl      time.Duration
+	fallback time.Duration
+	now      func() time.Time
+}
+
+type entry struct {
+	admin bool
+	teams []string
+	// ssoTeams is set if teams come from the SSO service
+	ssoTeams  bool
+	fetchedAt time.Time
+}
+
+// NewResolver folds the teams of users with fold, the case policy of the
+// aliases, so that a team matches its namespace whatever the case of the
+// claim. A nil fold keeps them as they are.
+func NewResolver(log *slog.Logger, sso SSO, cfg config.Authz, fold func(string) string) *Resolver {
+	if fold == nil {
+		fold = func(team string) string { return team }
+	}
+
+	r := &Resolver{
+		log:      log.With(slog.String("component", "authz")),
+		sso:      sso,
+		fold:     fold,
+		ttl:      cfg.CacheTTL,
+		fallback: cfg.FallbackTTL,
+		now:      time.Now,
+	}
+	r.cache = lru.New[int64, entry](cfg.CacheSize, func() time.Time { return r.now() })
+
+	return r
+}
+
+func (r *Resolver) Roles(ctx context.Context, user auth.User) (Roles, error) {
+	if user.Service {
+		return Roles{Admin: true}, nil
+	}
+
+	e, err := r.lookup(ctx, user.ID)
+	if err != nil {
+		return Roles{}, err
+	}
+
+	claimed := e.teams
+	if !e.ssoTeams {
+		claimed = user.Teams
+	}
+
+	teams := make([]string, 0, len(claimed))
+	for _, team := range claimed {
+		teams = append(teams, r.fold(team))
+	}
+
+	return Roles{Admin: e.admin, Teams: teams}, nil
+}
+
+// IsAdmin is the answer of the SSO service for userID, see lookup
+func (r *Resolver) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	e, err := r.lookup(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return e.admin, nil
+}
+
+// lookup returns the roles the SSO service knows of userID, ones younger
+// than the cache ttl are reused. If the service fails the last answer is
+// used for up to the fallback ttl more.
+func (r *Resolver) lookup(ctx context.Context, userID int64) (entry, error) {
+	const op = "authz.lookup"
+
+	cached, ok := r.cache.Get(userID)
+	if ok && r.now().Sub(cached.fetchedAt) < r.ttl {
+		return cached, nil
+	}
+
+	fetched, err := r.fetch(ctx, userID)
+	if err != nil {
+		// entries are dropped once the fallback ttl is over too
+		if ok {
+			r.log.WarnContext(ctx, "sso failed, using the last known roles",
+				slog.Int64("user_id", userID),
+				slog.Duration("age", r.now().Sub(cached.fetchedAt)),
+				sl.Err(err),
+			)
+
+			return cached, nil
+		}
+
+		return entry{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if keep := r.ttl + r.fallback; keep > 0 {
+		r.cache.Set(userID, fetched, keep)
+	}
+
+	return fetched, nil
+}
+
+func (r *Resolver) fetch(ctx context.Context, userID int64) (entry, error) {
+	admin, err := r.sso.IsAdmin(ctx, userID)
+	if err != nil {
+		return entry{}, err
+	}
+
+	teams, ok, err := r.sso.Teams(ctx, userID)
+	if err != nil {
+		return entry{}, err
+	}
+
+	return entry{admin: admin, teams: teams, ssoTeams: ok, fetchedAt: r.now()}, nil
+}
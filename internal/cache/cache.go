@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"time"
+)
+
+const (
+	TypeMemory = "memory"
+	TypeRedis  = "redis"
+	TypeNone   = "none"
+)
+
+// Entry is a cached lookup, NotFound remembers that the alias doesn't exist.
+// An Invalidated entry is a tombstone of a changed alias: lookups read the
+// storage and don't cache what they read until it expires.
+type Entry struct {
+	URL         models.URL `json:"url"`
+	NotFound    bool       `json:"not_found,omitempty"`
+	Invalidated bool       `json:"invalidated,omitempty"`
+}
+
+// tombstoneTTL is how long lookups of a changed alias don't fill the cache,
+// far longer than a lookup that read the alias before the change should take
+const tombstoneTTL = 5 * time.Second
+
+// Results of a lookup reported to the Observer
+const (
+	ResultHit   = "hit"
+	ResultMiss  = "miss"
+	ResultError = "error"
+)
+
+// Observer is told the result of every lookup, nil observes nothing
+type Observer interface {
+	ObserveCache(result string)
+}
+
+// Backend keeps entries by the key of a link until their ttl passes
+type Backend interface {
+	Get(ctx context.Context, key string) (Entry, bool, error)
+	// Add keeps entry for ttl unless key has an entry, a tombstone included
+	Add(ctx context.Context, key string, entry Entry, ttl time.Duration) error
+	// Invalidate replaces the entries of keys with tombstones kept for ttl
+	Invalidate(ctx context.Context, ttl time.Duration, keys ...string) error
+	Close() error
+}
+
+// Key is the key of the link of alias on domain, links of the primary
+// domain are kept under their alias. Hosts have no spaces.
+func Key(domain, alias string) string {
+	if domain == "" {
+		return alias
+	}
+
+	return domain + " " + alias
+}
+
+// Storage is a read-through cache of GetUrl in front of another storage.
+// Every method that changes a link replaces it in the cache with a
+// tombstone, so a lookup that read the link before the change can't put
+// it back. A backend shared by all instances (redis) is stale only if such
+// a lookup takes longer than tombstoneTTL, then for up to the ttl, while
+// the in-process one may be stale on other instances for up to the ttl.
+type Storage struct {
+	storage.Storage
+
+	log         *slog.Logger
+	backend     Backend
+	observer    Observer
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+// New wraps next with the cache selected by cfg.Type, it returns next itself for "none"
+func New(log *slog.Logger, next storage.Storage, cfg config.Cache, observer Observer) (storage.Storage, error) {
+	const op = "cache.New"
+
+	var backend Backend
+
+	switch cfg.Type {
+	case TypeMemory, "":
+		backend = NewLRU(cfg.Size)
+	case TypeRedis:
+		redis, err := NewRedis(cfg.Redis)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		backend = redis
+	case TypeNone:
+		return next, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown cache type %q", op, cfg.Type)
+	}
+
+	return Wrap(log, next, backend, cfg.TTL, cfg.NegativeTTL, observer), nil
+}
+
+// Wrap puts backend in front of next
+func Wrap(log *slog.Logger, next storage.Storage, backend Backend, ttl, negativeTTL time.Duration, observer Observer) *Storage {
+	return &Storage{
+		Storage:     next,
+		log:         log.With(slog.String("component", "cache")),
+		backend:     backend,
+		observer:    observer,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+// GetUrl answers from the cache and falls back to the storage on a miss.
+// A failing cache is logged and bypassed, it never fails a lookup.
+func (s *Storage) GetUrl(ctx context.Context, domain, alias string) (models.URL, error) {
+	key := Key(domain, alias)
+
+	entry, ok, err := s.backend.Get(ctx, key)
+	switch {
+	case err != nil:
+		s.log.WarnContext(ctx, "failed to read cache", slog.String("domain", domain), slog.String("alias", alias), sl.Err(err))
+		s.observe(ResultError)
+	case ok && !entry.Invalidated:
+		s.observe(ResultHit)
+	default:
+		s.observe(ResultMiss)
+	}
+
+	if ok && !entry.Invalidated {
+		if entry.NotFound {
+			return models.URL{}, storage.ErrURLNotFound
+		}
+		return entry.URL, nil
+	}
+
+	u, err := s.Storage.GetUrl(ctx, domain, alias)
+	switch {
+	case errors.Is(err, storage.ErrURLNotFound):
+		s.add(ctx, key, Entry{NotFound: true}, s.negativeTTL)
+	case err == nil:
+		s.add(ctx, key, Entry{URL: u}, s.ttlOf(u))
+	}
+
+	return u, err
+}
+
+func (s *Storage) observe(result string) {
+	if s.observer != nil {
+		s.observer.ObserveCache(result)
+	}
+}
+
+// ttlOf keeps an expiring link no longer than it lives
+func (s *Storage) ttlOf(u models.URL) time.Duration {
+	if u.ExpiresAt == nil {
+		return s.ttl
+	}
+
+	return max(min(s.ttl, time.Until(*u.ExpiresAt)), 0)
+}
+
+// add fills the cache unless the link was changed since, see Storage
+func (s *Storage) add(ctx context.Context, key string, entry Entry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	if err := s.backend.Add(ctx, key, entry, ttl); err != nil {
+		s.log.WarnContext(ctx, "failed to write cache", slog.String("key", key), sl.Err(err))
+	}
+}
+
+// invalidate replaces the links of aliases on domain with tombstones
+func (s *Storage) invalidate(ctx context.Context, domain string, aliases ...string) {
+	if len(aliases) == 0 {
+		return
+	}
+
+	keys := make([]string, len(aliases))
+	for i, alias := range aliases {
+		keys[i] = Key(domain, alias)
+	}
+
+	if err := s.backend.Invalidate(ctx, tombstoneTTL, keys...); err != nil {
+		s.log.ErrorContext(ctx, "failed to invalidate cache", slog.Any("keys", keys), sl.Err(err))
+	}
+}
+
+// SaveURL replaces a cached "not found" of the new alias
+func (s *Storage) SaveURL(ctx context.Context, u models.URL, unique bool) (int64, error) {
+	id, err := s.Storage.SaveURL(ctx, u, unique)
+	if err == nil {
+		s.invalidate(ctx, u.Domain, u.Alias)
+	}
+
+	return id, err
+}
+
+func (s *Storage) SaveURLs(ctx context.Context, urls []models.URL, unique bool) ([]error, error) {
+	errs, err := s.Storage.SaveURLs(ctx, urls, unique)
+	if err != nil {
+		return errs, err
+	}
+
+	// a batch may save links on several domains
+	saved := make(map[string][]string)
+	for i, u := range urls {
+		if errs[i] == nil {
+			saved[u.Domain] = append(saved[u.Domain], u.Alias)
+		}
+	}
+	for domain, aliases := range saved {
+		s.invalidate(ctx, domain, aliases...)
+	}
+
+	return errs, nil
+}
+
+func (s *Storage) UpdateURL(ctx context.Context, u models.URL, revision int64, changedBy int64, unique bool) (models.URL, error) {
+	updated, err := s.Storage.UpdateURL(ctx, u, revision, changedBy, unique)
+	// a revision mismatch means the cached revision may be the stale one
+	if err == nil || errors.Is(err, storage.ErrRevisionMismatch) {
+		s.invalidate(ctx, u.Domain, u.Alias)
+	}
+
+	return updated, err
+}
+
+func (s *Storage) DeleteURL(ctx context.Context, domain, alias string) error {
+	err := s.Storage.DeleteURL(ctx, domain, alias)
+	s.invalidate(ctx, domain, alias)
+
+	return err
+}
+
+func (s *Storage) DeleteURLs(ctx context.Context, domain string, aliases []string, userID *int64) ([]string, error) {
+	deleted, err := s.Storage.DeleteURLs(ctx, domain, aliases, userID)
+	s.invalidate(ctx, domain, deleted...)
+
+	return deleted, err
+}
+
+// Close closes the cache and the storage behind it
+func (s *Storage) Close() error {
+	return errors.Join(s.backend.Close(), s.Storage.Close())
+}
@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// testBackend is a Backend whose clock the test moves with wait
+type testBackend struct {
+	Backend
+	wait func(d time.Duration)
+}
+
+func backends(t *testing.T) map[string]testBackend {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+
+	redis, err := NewRedis(config.Redis{Address: server.Addr(), KeyPrefix: "test:"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = redis.Close() })
+
+	now := time.Now()
+	memory := NewLRU(10)
+	memory.now = func() time.Time { return now }
+
+	return map[string]testBackend{
+		"memory": {Backend: memory, wait: func(d time.Duration) { now = now.Add(d) }},
+		"redis":  {Backend: redis, wait: server.FastForward},
+	}
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+	u := models.URL{ID: 1, Alias: "google", URL: "https://google.com", UserID: 42, Revision: 2}
+
+	for name, b := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			_, ok, err := b.Get(ctx, "google")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			require.NoError(t, b.Add(ctx, "google", Entry{URL: u}, time.Minute))
+			require.NoError(t, b.Add(ctx, "missing", Entry{NotFound: true}, time.Minute))
+
+			// an entry is never replaced by Add
+			require.NoError(t, b.Add(ctx, "google", Entry{NotFound: true}, time.Minute))
+
+			entry, ok, err := b.Get(ctx, "google")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, u, entry.URL)
+
+			entry, ok, err = b.Get(ctx, "missing")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.True(t, entry.NotFound)
+
+			require.NoError(t, b.Invalidate(ctx, time.Second, "google", "missing", "unknown"))
+
+			for _, alias := range []string{"google", "missing", "unknown"} {
+				entry, ok, err = b.Get(ctx, alias)
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.True(t, entry.Invalidated)
+
+				// nor is a tombstone
+				require.NoError(t, b.Add(ctx, alias, Entry{URL: u}, time.Minute))
+				entry, _, _ = b.Get(ctx, alias)
+				require.True(t, entry.Invalidated)
+			}
+
+			b.wait(2 * time.Second)
+
+			_, ok, err = b.Get(ctx, "google")
+			require.NoError(t, err)
+			require.False(t, ok)
+			require.NoError(t, b.Add(ctx, "google", Entry{URL: u}, time.Minute))
+			entry, _, _ = b.Get(ctx, "google")
+			require.Equal(t, u, entry.URL)
+		})
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	c := NewLRU(2)
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Add(ctx, "a", Entry{}, time.Minute))
+	require.NoError(t, c.Add(ctx, "b", Entry{}, time.Minute))
+
+	// a is used, so b is the least recently used one
+	_, ok, _ := c.Get(ctx, "a")
+	require.True(t, ok)
+	require.NoError(t, c.Add(ctx, "c", Entry{}, time.Hour))
+	require.Equal(t, 2, c.Len())
+
+	_, ok, _ = c.Get(ctx, "b")
+	require.False(t, ok)
+
+	now = now.Add(2 * time.Minute)
+
+	_, ok, _ = c.Get(ctx, "a")
+	require.False(t, ok, "expired")
+	_, ok, _ = c.Get(ctx, "c")
+	require.True(t, ok)
+	require.Equal(t, 1, c.Len())
+}
+
+// countingStorage counts the lookups that reach the storage
+type countingStorage struct {
+	storage.Storage
+	gets int
+}
+
+func (s *countingStorage) GetUrl(ctx context.Context, domain, alias string) (models.URL, error) {
+	s.gets++
+	return s.Storage.GetUrl(ctx, domain, alias)
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+
+	for name, b := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			next := &countingStorage{Storage: storage.NewMemory()}
+			s := Wrap(slogdiscard.NewDiscardLogger(), next, b, time.Minute, time.Minute, nil)
+
+			// unknown aliases are cached too
+			for i := 0; i < 2; i++ {
+				_, err := s.GetUrl(ctx, "", "google")
+				require.ErrorIs(t, err, storage.ErrURLNotFound)
+			}
+			require.Equal(t, 1, next.gets)
+
+			_, err := s.SaveURL(ctx, models.URL{URL: "https://gogle.com", Alias: "google"}, false)
+			require.NoError(t, err)
+
+			// a changed alias is read from the storage until its tombstone expires
+			u, err := s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, "https://gogle.com", u.URL)
+			require.Equal(t, 2, next.gets)
+
+			b.wait(tombstoneTTL)
+
+			for i := 0; i < 2; i++ {
+				u, err := s.GetUrl(ctx, "", "google")
+				require.NoError(t, err)
+				require.Equal(t, "https://gogle.com", u.URL)
+			}
+			require.Equal(t, 3, next.gets)
+
+			u.URL = "https://google.com"
+			_, err = s.UpdateURL(ctx, u, u.Revision, 0, false)
+			require.NoError(t, err)
+
+			u, err = s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, "https://google.com", u.URL)
+			require.Equal(t, 4, next.gets)
+
+			b.wait(tombstoneTTL)
+
+			require.NoError(t, s.DeleteURL(ctx, "", "google"))
+
+			_, err = s.GetUrl(ctx, "", "google")
+			require.ErrorIs(t, err, storage.ErrURLNotFound)
+
+			errs, err := s.SaveURLs(ctx, []models.URL{{URL: "https://yandex.ru", Alias: "google"}}, false)
+			require.NoError(t, err)
+			require.NoError(t, errs[0])
+
+			u, err = s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, "https://yandex.ru", u.URL)
+
+			deleted, err := s.DeleteURLs(ctx, "", []string{"google"}, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"google"}, deleted)
+
+			_, err = s.GetUrl(ctx, "", "google")
+			require.ErrorIs(t, err, storage.ErrURLNotFound)
+		})
+	}
+}
+
+// racingStorage runs change after a lookup read the storage and before it fills the cache
+type racingStorage struct {
+	storage.Storage
+	change func()
+}
+
+func (s *racingStorage) GetUrl(ctx context.Context, domain, alias string) (models.URL, error) {
+	u, err := s.Storage.GetUrl(ctx, domain, alias)
+	if s.change != nil {
+		change := s.change
+		s.change = nil
+		change()
+	}
+
+	return u, err
+}
+
+func TestStorageChangedDuringLookup(t *testing.T) {
+	ctx := context.Background()
+
+	for name, b := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			next := &racingStorage{Storage: storage.NewMemory()}
+			s := Wrap(slogdiscard.NewDiscardLogger(), next, b, time.Minute, time.Minute, nil)
+
+			_, err := s.SaveURL(ctx, models.URL{URL: "https://gogle.com", Alias: "google"}, false)
+			require.NoError(t, err)
+			b.wait(tombstoneTTL)
+
+			next.change = func() {
+				u, err := next.Storage.GetUrl(ctx, "", "google")
+				require.NoError(t, err)
+
+				u.URL = "https://google.com"
+				_, err = s.UpdateURL(ctx, u, u.Revision, 0, false)
+				require.NoError(t, err)
+			}
+
+			// the lookup read the old link, it must not be cached
+			u, err := s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, "https://gogle.com", u.URL)
+
+			u, err = s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, "https://google.com", u.URL)
+
+			b.wait(tombstoneTTL)
+
+			u, err = s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, "https://google.com", u.URL)
+		})
+	}
+}
+
+func TestStorageExpiringLink(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(-time.Second)
+
+	next := &countingStorage{Storage: storage.NewMemory()}
+	s := Wrap(slogdiscard.NewDiscardLogger(), next, NewLRU(10), time.Minute, time.Minute, nil)
+
+	_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google", ExpiresAt: &expiresAt}, false)
+	require.NoError(t, err)
+
+	// an expired link isn't cached, it is gone from the storage soon
+	for i := 0; i < 2; i++ {
+		_, err := s.GetUrl(ctx, "", "google")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, next.gets)
+}
+
+type observerStub map[string]int
+
+func (o observerStub) ObserveCache(result string) {
+	o[result]++
+}
+
+func TestStorageObserver(t *testing.T) {
+	ctx := context.Background()
+	observed := observerStub{}
+
+	s := Wrap(slogdiscard.NewDiscardLogger(), storage.NewMemory(), NewLRU(10), time.Minute, time.Minute, observed)
+
+	for i := 0; i < 3; i++ {
+		_, _ = s.GetUrl(ctx, "", "google")
+	}
+
+	require.Equal(t, observerStub{ResultMiss: 1, ResultHit: 2}, observed)
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/lib/lru"
+	"time"
+)
+
+// LRU is an in-process Backend that evicts the least recently used
+// link once it holds size entries
+type LRU struct {
+	entries *lru.Cache[string, Entry]
+
+	now func() time.Time
+}
+
+func NewLRU(size int) *LRU {
+	c := &LRU{now: time.Now}
+	c.entries = lru.New[string, Entry](size, func() time.Time { return c.now() })
+
+	return c
+}
+
+func (c *LRU) Get(_ context.Context, key string) (Entry, bool, error) {
+	entry, ok := c.entries.Get(key)
+
+	return entry, ok, nil
+}
+
+// Add keeps entry for ttl, the storage never asks to keep one for no time
+func (c *LRU) Add(_ context.Context, key string, entry Entry, ttl time.Duration) error {
+	c.entries.Add(key, entry, ttl)
+
+	return nil
+}
+
+func (c *LRU) Invalidate(_ context.Context, ttl time.Duration, keys ...string) error {
+	for _, key := range keys {
+		c.entries.Set(key, Entry{Invalidated: true}, ttl)
+	}
+
+	return nil
+}
+
+func (c *LRU) Close() error {
+	return nil
+}
+
+// Len returns the number of entries, expired ones included
+func (c *LRU) Len() int {
+	return c.entries.Len()
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// Redis is a Backend shared by every instance of the service,
+// entries are stored as JSON under KeyPrefix + "alias:" + the Key of the link
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedis(cfg config.Redis) (*Redis, error) {
+	const op = "cache.NewRedis"
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Redis{client: client, prefix: cfg.KeyPrefix + "alias:"}, nil
+}
+
+func (c *Redis) Get(ctx context.Context, key string) (Entry, bool, error) {
+	const op = "cache.Redis.Get"
+
+	raw, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return Entry{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entry, true, nil
+}
+
+// Add stores entry with SET NX, so it never replaces a tombstone
+func (c *Redis) Add(ctx context.Context, key string, entry Entry, ttl time.Duration) error {
+	const op = "cache.Redis.Add"
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := c.client.SetNX(ctx, c.prefix+key, raw, ttl).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c *Redis) Invalidate(ctx context.Context, ttl time.Duration, keys ...string) error {
+	const op = "cache.Redis.Invalidate"
+
+	raw, err := json.Marshal(Entry{Invalidated: true})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Set(ctx, c.prefix+key, raw, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c *Redis) Close() error {
+	return c.client.Close()
+}
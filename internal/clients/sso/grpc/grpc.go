@@ -8,21 +8,26 @@ import (
 	ssov1 "github.com/lostmyescape/protos/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 	"log/slog"
 	"time"
 )
 
 type Client struct {
-	api ssov1.AuthClient
-	log *slog.Logger
+	api  ssov1.AuthClient
+	conn *grpc.ClientConn
+	log  *slog.Logger
 }
 
+// New connects to the SSO service at addr, interceptors go first in the
+// chain and see every call once, however many times it is retried
 func New(
 	log *slog.Logger,
 	addr string,
 	timeout time.Duration,
 	retriesCount int,
+	interceptors ...grpc.UnaryClientInterceptor,
 ) (*Client, error) {
 	const op = "grpc.New"
 
@@ -36,11 +41,13 @@ func New(
 		grpclog.WithLogOnEvents(grpclog.PayloadReceived, grpclog.PayloadSent),
 	}
 
+	interceptors = append(interceptors,
+		grpclog.UnaryClientInterceptor(InterceptorLogger(log), logOpts...),
+		grpcretry.UnaryClientInterceptor(retryOpts...),
+	)
+
 	cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithChainUnaryInterceptor(
-			grpclog.UnaryClientInterceptor(InterceptorLogger(log), logOpts...),
-			grpcretry.UnaryClientInterceptor(retryOpts...),
-		),
+		grpc.WithChainUnaryInterceptor(interceptors...),
 	)
 
 	if err != nil {
@@ -48,10 +55,33 @@ func New(
 	}
 
 	return &Client{
-		api: ssov1.NewAuthClient(cc),
+		api:  ssov1.NewAuthClient(cc),
+		conn: cc,
 	}, nil
 }
 
+// CheckConnection fails if the connection to the SSO service is broken or
+// closed. An idle one is only asked to connect since it connects on the next
+// call anyway, and a connecting one right after that isn't broken either.
+func (c *Client) CheckConnection() error {
+	const op = "grpc.CheckConnection"
+
+	switch state := c.conn.GetState(); state {
+	case connectivity.Ready, connectivity.Connecting:
+		return nil
+	case connectivity.Idle:
+		c.conn.Connect()
+		return nil
+	default:
+		return fmt.Errorf("%s: connection is %s", op, state)
+	}
+}
+
+// Close closes the connection to the SSO service
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
 func (c *Client) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	const op = "grpc.IsAdmin"
 
@@ -65,6 +95,12 @@ func (c *Client) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	return resp.IsAdmin, nil
 }
 
+// Teams reports that the SSO service doesn't keep team memberships: its
+// API has no call for them, they only come with the tokens it issues
+func (c *Client) Teams(_ context.Context, _ int64) ([]string, bool, error) {
+	return nil, false, nil
+}
+
 func InterceptorLogger(l *slog.Logger) grpclog.Logger {
 	return grpclog.LoggerFunc(func(ctx context.Context, level grpclog.Level, msg string, fields ...any) {
 		l.Log(ctx, slog.Level(level), msg, fields...)
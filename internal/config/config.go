@@ -12,8 +12,23 @@ type Config struct {
 	Address    string `yaml:"address"`
 	HTTPServer `yaml:"http_server"`
 	Clients    ClientsConfig `yaml:"clients"`
+	Analytics  Analytics     `yaml:"analytics"`
+	Expiry     Expiry        `yaml:"expiry"`
+	Cache      Cache         `yaml:"cache"`
+	Alias      Alias         `yaml:"alias"`
+	Redirect   Redirect      `yaml:"redirect"`
+	Preview    Preview       `yaml:"preview"`
+	QR         QR            `yaml:"qr"`
+	Authz      Authz         `yaml:"authz"`
+	Domains    Domains       `yaml:"domains"`
+	Links      Links         `yaml:"links"`
+	Tracing    Tracing       `yaml:"tracing"`
+	RateLimit  RateLimit     `yaml:"rate_limit"`
+	URLPolicy  URLPolicy     `yaml:"url_policy"`
 	AppSecret  string        `yaml:"app_secret" env:"APP_SECRET"`
 	Storage    struct {
+		Type     string `yaml:"type" env:"STORAGE_TYPE" env-default:"postgres"`   // postgres, sqlite, memory
+		Path     string `yaml:"path" env:"STORAGE_PATH" env-default:"storage.db"` // sqlite only
 		Host     string `yaml:"host"`
 		Port     int    `yaml:"port"`
 		User     string `yaml:"user"`
@@ -24,11 +39,174 @@ type Config struct {
 }
 
 type HTTPServer struct {
-	Address     string        `yaml:"address" env-default:"localhost:8080"`
+	Address string `yaml:"address" env-default:"localhost:8080"`
+	// BaseURL is where the service is publicly served, short links like QR
+	// codes are built from it
+	BaseURL     string        `yaml:"base_url" env:"BASE_URL" env-default:"http://localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
-	User        string        `yaml:"user" env-required:"true"`
-	Password    string        `yaml:"password" env-required:"true" env:"HTTP_SERVER_PASSWORD"`
+	// MetricsAddress is the listener of /metrics, apart from the public API
+	MetricsAddress string `yaml:"metrics_address" env:"METRICS_ADDRESS" env-default:"localhost:8081"`
+	// ShutdownDelay keeps serving with /readyz failing on shutdown, so load
+	// balancers stop routing to the instance before it stops listening
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"0s"`
+	// ShutdownTimeout is how long in-flight requests may take to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"15s"`
+	// TrustedProxies are the addresses or CIDRs of the proxies whose
+	// X-Forwarded-For and X-Real-IP headers tell the client address
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	// User and Password are the shared basic auth account, an empty User turns it off
+	User     string `yaml:"user" env:"HTTP_SERVER_USER"`
+	Password string `yaml:"password" env:"HTTP_SERVER_PASSWORD"`
+}
+
+type Analytics struct {
+	BufferSize    int           `yaml:"buffer_size" env-default:"4096"`
+	BatchSize     int           `yaml:"batch_size" env-default:"100"`
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"1s"`
+	CountryHeader string        `yaml:"country_header" env-default:"CF-IPCountry"`
+}
+
+type Expiry struct {
+	ReapInterval time.Duration `yaml:"reap_interval" env-default:"1m"`
+}
+
+type Cache struct {
+	Type string `yaml:"type" env:"CACHE_TYPE" env-default:"memory"` // memory, redis, none
+	// Size is the number of aliases the in-process cache keeps
+	Size int           `yaml:"size" env-default:"10000"`
+	TTL  time.Duration `yaml:"ttl" env-default:"5m"`
+	// NegativeTTL is how long an unknown alias is remembered as such
+	NegativeTTL time.Duration `yaml:"negative_ttl" env-default:"30s"`
+	Redis       Redis         `yaml:"redis"`
+}
+
+type Alias struct {
+	Strategy string `yaml:"strategy" env:"ALIAS_STRATEGY" env-default:"random"` // random, sequential, hashids, words
+	// Length is the length of random and words aliases and the minimum length of hashids ones
+	Length int `yaml:"length" env-default:"6"`
+	// Alphabet is used by random, sequential and hashids, letters and digits if empty
+	Alphabet string `yaml:"alphabet"`
+	Salt     string `yaml:"salt" env:"ALIAS_SALT"` // hashids only
+	// Rules are checked against custom aliases, generated ones only have to
+	// avoid reserved and profane words
+	Rules AliasRules `yaml:"rules"`
+}
+
+type AliasRules struct {
+	MinLength int `yaml:"min_length" env-default:"1"`
+	MaxLength int `yaml:"max_length" env-default:"64"`
+	// Charset is the characters a custom alias may have, letters, digits, "-" and "_" if empty
+	Charset string `yaml:"charset"`
+	// Case is sensitive or lower, lower makes every alias lowercase and links case-insensitive
+	Case string `yaml:"case" env:"ALIAS_CASE" env-default:"sensitive"`
+	// Reserved are words taken by the service besides the registered routes
+	Reserved        []string `yaml:"reserved"`
+	ProfanityFilter bool     `yaml:"profanity_filter" env-default:"true"`
+	// ProfanityWords and ProfanityFile extend the built-in list of profane words
+	ProfanityWords []string `yaml:"profanity_words"`
+	ProfanityFile  string   `yaml:"profanity_file"`
+	// Namespaces enables team aliases served at /t/{team}/{alias}
+	Namespaces bool `yaml:"namespaces" env:"ALIAS_NAMESPACES"`
+}
+
+type Redirect struct {
+	// PermanentMaxAge is how long clients and proxies may cache 301 and 308
+	// redirects, clicks served from their cache aren't counted. Zero turns caching off.
+	PermanentMaxAge time.Duration `yaml:"permanent_max_age" env-default:"24h"`
+}
+
+// Preview configures fetching the title and the favicon shown on the preview page
+type Preview struct {
+	// Timeout bounds fetching a destination and its favicon
+	Timeout time.Duration `yaml:"timeout" env:"PREVIEW_TIMEOUT" env-default:"3s"`
+	// CacheTTL of zero keeps pages until they are evicted
+	CacheTTL  time.Duration `yaml:"cache_ttl" env-default:"1h"`
+	CacheSize int           `yaml:"cache_size" env-default:"1000"`
+}
+
+type QR struct {
+	// CacheSize is how many rendered codes are kept in memory
+	CacheSize int `yaml:"cache_size" env-default:"1000"`
+}
+
+// Authz configures how long the roles of a user resolved by the SSO service are trusted
+type Authz struct {
+	// CacheTTL is how long roles are used before they are asked for again
+	CacheTTL time.Duration `yaml:"cache_ttl" env-default:"1m"`
+	// FallbackTTL is how long past CacheTTL the last known roles are used while the SSO service fails
+	FallbackTTL time.Duration `yaml:"fallback_ttl" env-default:"1h"`
+	CacheSize   int           `yaml:"cache_size" env-default:"10000"`
+}
+
+// Domains configures looking up the custom domain of a request host
+type Domains struct {
+	// CacheTTL is how long a host is remembered, other instances may serve a changed domain that long
+	CacheTTL  time.Duration `yaml:"cache_ttl" env-default:"1m"`
+	CacheSize int           `yaml:"cache_size" env-default:"1000"`
+}
+
+type Links struct {
+	// Duplicates is what saving a url that already has a link does: reject,
+	// idempotent (answer with the existing alias) or allow
+	Duplicates string `yaml:"duplicates" env:"LINKS_DUPLICATES" env-default:"reject"`
+	// IdempotencyKeyTTL is how long the response to a POST /url with an
+	// Idempotency-Key header is replayed to retries with the same key, 0 ignores the header
+	IdempotencyKeyTTL time.Duration `yaml:"idempotency_key_ttl" env:"LINKS_IDEMPOTENCY_KEY_TTL" env-default:"24h"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"` // otlp, stdout, none
+	// Endpoint is the host:port of the OTLP gRPC collector
+	Endpoint string `yaml:"endpoint" env:"TRACING_ENDPOINT" env-default:"localhost:4317"`
+	Insecure bool   `yaml:"insecure" env-default:"true"`
+	// SampleRatio is the share of traces started here that are recorded,
+	// a request that comes with a sampled trace is always recorded
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+	ServiceName string  `yaml:"service_name" env-default:"url-shortener"`
+}
+
+type RateLimit struct {
+	Store string `yaml:"store" env:"RATE_LIMIT_STORE" env-default:"memory"` // memory, redis, none
+	// Create limits creating links per user, Redirect limits redirects per client address
+	Create   Limit `yaml:"create"`
+	Redirect Limit `yaml:"redirect"`
+	Redis    Redis `yaml:"redis"`
+}
+
+// Limit lets a client make Requests per Period, up to Burst of them at once
+// (Requests if zero). Zero Requests means no limit.
+type Limit struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"`
+}
+
+// URLPolicy is what a link may point to
+type URLPolicy struct {
+	Schemes []string `yaml:"schemes" env-default:"http,https"`
+	// BlockPrivateNetworks rejects hosts that are or resolve to loopback, private or link-local addresses
+	BlockPrivateNetworks bool          `yaml:"block_private_networks" env-default:"true"`
+	ResolveTimeout       time.Duration `yaml:"resolve_timeout" env-default:"2s"`
+	// ResolveFailOpen accepts hosts whose lookup fails or times out, a host that doesn't exist is always accepted
+	ResolveFailOpen bool `yaml:"resolve_fail_open"`
+	// AllowedDomains, if any, are the only domains links may point to, subdomains included
+	AllowedDomains     []string `yaml:"allowed_domains"`
+	AllowedDomainsFile string   `yaml:"allowed_domains_file"`
+	DeniedDomains      []string `yaml:"denied_domains"`
+	DeniedDomainsFile  string   `yaml:"denied_domains_file"`
+	// SelfHosts are the hosts the service is served at, links to them would loop
+	SelfHosts []string `yaml:"self_hosts"`
+	// ReputationURL is a webhook asked about every link, none if empty
+	ReputationURL     string        `yaml:"reputation_url"`
+	ReputationTimeout time.Duration `yaml:"reputation_timeout" env-default:"2s"`
+}
+
+type Redis struct {
+	Address   string `yaml:"address" env:"REDIS_ADDRESS" env-default:"localhost:6379"`
+	Password  string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB        int    `yaml:"db"`
+	KeyPrefix string `yaml:"key_prefix" env-default:"url-shortener:"`
 }
 
 type Client struct {
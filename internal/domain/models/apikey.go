@@ -0,0 +1,49 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Scopes an API key can be granted
+const (
+	ScopeLinksRead   = "links:read"
+	ScopeLinksWrite  = "links:write"
+	ScopeLinksDelete = "links:delete"
+	ScopeStatsRead   = "stats:read"
+)
+
+// Scopes are all the scopes a key can have
+var Scopes = []string{ScopeLinksRead, ScopeLinksWrite, ScopeLinksDelete, ScopeStatsRead}
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// APIKey authenticates scripts in place of the shared basic auth pair.
+// Only the hash of the key is stored, the key itself is shown once on creation.
+type APIKey struct {
+	ID   int64
+	Name string
+	// Prefix is the start of the key, it tells keys apart in listings
+	Prefix string
+	Hash   string
+	Scopes []string
+	// UserID is the SSO user the key acts as, 0 for the service account
+	UserID     int64
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// Expired reports whether the key can't be used at now anymore
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Revoked reports whether the key was revoked
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
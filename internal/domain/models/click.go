@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Click is a single redirect through an alias
+type Click struct {
+	// Domain is the custom domain of the link, empty for the primary one
+	Domain    string
+	Alias     string
+	ClickedAt time.Time
+	Referrer  string
+	UserAgent string
+	Country   string
+	RequestID string
+	// VisitorID is a hash of the client address and user agent,
+	// it lets us count unique visitors without storing ip addresses
+	VisitorID string
+}
+
+type Stats struct {
+	Domain         string
+	Alias          string
+	From           time.Time
+	To             time.Time
+	Total          int64
+	UniqueVisitors int64
+	Buckets        []StatsBucket
+}
+
+type StatsBucket struct {
+	Start time.Time
+	Count int64
+}
+
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Domain is a custom short domain links may be created under besides the
+// primary one. Its links have it as their Domain.
+type Domain struct {
+	ID int64
+	// Host is the lowercased host name the domain is served at
+	Host string
+	// DefaultURL is where the root of the domain redirects, it answers 404 if empty
+	DefaultURL string
+	// NotFoundURL is where unknown aliases of the domain redirect, they get the 404 page if empty
+	NotFoundURL string
+	// UserID is the user that added the domain, 0 for the service account
+	UserID    int64
+	CreatedAt time.Time
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header, so a retry of the request gets it again
+// instead of repeating the request
+type IdempotencyKey struct {
+	// Owner is the client the key belongs to, keys of different clients never clash
+	Owner string
+	Key   string
+	// RequestHash is the SHA-256 of the request body, a request with another body can't reuse the key
+	RequestHash string
+	// Status is 0 while the first request is in progress
+	Status    int
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Pending reports whether the first request with the key hasn't been answered yet
+func (k IdempotencyKey) Pending() bool {
+	return k.Status == 0
+}
+
+// Expired reports whether the key can be used for another request at now
+func (k IdempotencyKey) Expired(now time.Time) bool {
+	return !now.Before(k.ExpiresAt)
+}
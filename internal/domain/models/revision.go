@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// URLRevision is the state of a link after a create or an update
+type URLRevision struct {
+	Revision     int64
+	URL          string
+	ExpiresAt    *time.Time
+	RedirectType int
+	PassQuery    bool
+	UTM          UTM
+	Interstitial bool
+	// ChangedBy is the SSO user that made the change, 0 for the service account
+	ChangedBy int64
+	ChangedAt time.Time
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+type URL struct {
+	ID int64
+	// Domain is the custom domain the link is served on, empty for the primary one
+	Domain    string
+	Alias     string
+	URL       string
+	ExpiresAt *time.Time
+	// UserID is the SSO user that owns the link, 0 for links without an owner
+	UserID    int64
+	CreatedAt time.Time
+	Clicks    int64
+	// RedirectType is the status code the alias redirects with
+	RedirectType int
+	// Revision grows by one on every update, it is the ETag of the link
+	Revision int64
+	// PassQuery appends the query of the redirect request to the destination
+	PassQuery bool
+	// UTM parameters are added to the destination unless it sets them itself
+	UTM UTM
+	// Interstitial shows the preview page instead of redirecting straight away
+	Interstitial bool
+}
+
+// UTM are the campaign parameters of a link, empty ones aren't added
+type UTM struct {
+	Source   string
+	Medium   string
+	Campaign string
+	Term     string
+	Content  string
+}
+
+// Params returns the utm_* query parameters of u that are set
+func (u UTM) Params() url.Values {
+	params := make(url.Values)
+	for key, value := range map[string]string{
+		"utm_source":   u.Source,
+		"utm_medium":   u.Medium,
+		"utm_campaign": u.Campaign,
+		"utm_term":     u.Term,
+		"utm_content":  u.Content,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	return params
+}
+
+// UTMFromParams is the opposite of UTM.Params, other parameters are ignored
+func UTMFromParams(params url.Values) UTM {
+	return UTM{
+		Source:   params.Get("utm_source"),
+		Medium:   params.Get("utm_medium"),
+		Campaign: params.Get("utm_campaign"),
+		Term:     params.Get("utm_term"),
+		Content:  params.Get("utm_content"),
+	}
+}
+
+// DefaultRedirectType is used when a link doesn't set its own
+const DefaultRedirectType = 302
+
+// PermanentRedirect reports whether clients may cache a redirect with code
+func PermanentRedirect(code int) bool {
+	return code == 301 || code == 308
+}
+
+// ValidRedirectType reports whether code is a redirect status a link may use
+func ValidRedirectType(code int) bool {
+	switch code {
+	case 301, 302, 307, 308:
+		return true
+	default:
+		return false
+	}
+}
+
+// Expired reports whether the link is past its expiry at now
+func (u URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// What saving a url that already has a live link of the same owner, a user or
+// the team of the namespace, on the same domain does
+const (
+	// DuplicatesReject fails the save
+	DuplicatesReject = "reject"
+	// DuplicatesIdempotent answers with the existing link instead
+	DuplicatesIdempotent = "idempotent"
+	// DuplicatesAllow saves another link
+	DuplicatesAllow = "allow"
+)
+
+// ValidDuplicates reports whether mode is one of the duplicate modes
+func ValidDuplicates(mode string) bool {
+	switch mode {
+	case DuplicatesReject, DuplicatesIdempotent, DuplicatesAllow:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	SortByCreated = "created"
+	SortByClicks  = "clicks"
+)
+
+// URLFilter selects a page of links, zero values mean "no filter"
+type URLFilter struct {
+	UserID      *int64
+	AliasPrefix string
+	// Domain matches the host of the destination url exactly
+	Domain string
+	// ShortDomain is the custom domain the links are on, empty for the
+	// primary one and nil for every domain
+	ShortDomain *string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	SortBy      string
+	Desc        bool
+	Limit       int
+	// After continues the listing after the last link of the previous page
+	After *URLCursor
+}
+
+// URLCursor is the position of a link in a listing sorted by URLFilter.SortBy
+type URLCursor struct {
+	ID        int64
+	CreatedAt time.Time
+	Clicks    int64
+}
+
+type URLPage struct {
+	URLs []URL
+	// Next is nil on the last page
+	Next *URLCursor
+}
+
+// CursorOf returns the position of u in a listing
+func CursorOf(u URL) *URLCursor {
+	return &URLCursor{ID: u.ID, CreatedAt: u.CreatedAt, Clicks: u.Clicks}
+}
+
+// TeamAlias is the alias a link in the namespace of team is stored under,
+// it is served at /t/{team}/{alias}
+func TeamAlias(team, alias string) string {
+	if team == "" {
+		return alias
+	}
+
+	return team + "/" + alias
+}
+
+// TeamOf is the team of an alias saved with TeamAlias, empty for aliases outside namespaces
+func TeamOf(alias string) string {
+	team, _, ok := strings.Cut(alias, "/")
+	if !ok {
+		return ""
+	}
+
+	return team
+}
+
+// AliasPath is the path alias is served at on its domain, team aliases are under /t/
+func AliasPath(alias string) string {
+	segments := strings.Split(alias, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	if len(segments) > 1 {
+		return "/t/" + strings.Join(segments, "/")
+	}
+
+	return "/" + segments[0]
+}
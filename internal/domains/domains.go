@@ -0,0 +1,162 @@
+// Package domains serves links of custom short domains by the host a request is sent to
+package domains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/lru"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidHost = errors.New("invalid host")
+	// ErrPrimaryHost means the host is where the primary domain is served
+	ErrPrimaryHost = errors.New("host of the primary domain")
+)
+
+// Store keeps the domains
+type Store interface {
+	SaveDomain(ctx context.Context, d models.Domain) (int64, error)
+	GetDomain(ctx context.Context, host string) (models.Domain, error)
+	ListDomains(ctx context.Context) ([]models.Domain, error)
+	UpdateDomain(ctx context.Context, d models.Domain) (models.Domain, error)
+	DeleteDomain(ctx context.Context, host string) error
+}
+
+// Registry is a Store whose lookups are cached, every redirect looks up its
+// host. Changes made through it are seen at once, changes made on other
+// instances once the cache ttl passes.
+type Registry struct {
+	store   Store
+	primary string
+	cache   *lru.Cache[string, lookup]
+	ttl     time.Duration
+}
+
+// lookup is a cached GetDomain, found is false for hosts that aren't custom domains
+type lookup struct {
+	domain models.Domain
+	found  bool
+}
+
+// New creates a Registry in front of store, primary is the host of the
+// primary domain, it can't be added as a custom one
+func New(store Store, cfg config.Domains, primary string) *Registry {
+	return &Registry{
+		store:   store,
+		primary: strings.ToLower(primary),
+		cache:   lru.New[string, lookup](cfg.CacheSize, nil),
+		ttl:     cfg.CacheTTL,
+	}
+}
+
+// GetDomain returns the domain served at host, storage.ErrDomainNotFound
+// for hosts that aren't custom domains
+func (r *Registry) GetDomain(ctx context.Context, host string) (models.Domain, error) {
+	if cached, ok := r.cache.Get(host); ok {
+		if !cached.found {
+			return models.Domain{}, storage.ErrDomainNotFound
+		}
+
+		return cached.domain, nil
+	}
+
+	d, err := r.store.GetDomain(ctx, host)
+	switch {
+	case errors.Is(err, storage.ErrDomainNotFound):
+		r.remember(host, lookup{})
+	case err == nil:
+		r.remember(host, lookup{domain: d, found: true})
+	}
+
+	return d, err
+}
+
+// SaveDomain adds d, its host must be valid and not the primary one
+func (r *Registry) SaveDomain(ctx context.Context, d models.Domain) (int64, error) {
+	const op = "domains.SaveDomain"
+
+	host, err := Host(d.Host)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if host == r.primary {
+		return 0, fmt.Errorf("%s: %w", op, ErrPrimaryHost)
+	}
+	d.Host = host
+
+	id, err := r.store.SaveDomain(ctx, d)
+	if err == nil {
+		r.cache.Delete(host)
+	}
+
+	return id, err
+}
+
+func (r *Registry) ListDomains(ctx context.Context) ([]models.Domain, error) {
+	return r.store.ListDomains(ctx)
+}
+
+func (r *Registry) UpdateDomain(ctx context.Context, d models.Domain) (models.Domain, error) {
+	updated, err := r.store.UpdateDomain(ctx, d)
+	if err == nil {
+		r.cache.Delete(d.Host)
+	}
+
+	return updated, err
+}
+
+func (r *Registry) DeleteDomain(ctx context.Context, host string) error {
+	err := r.store.DeleteDomain(ctx, host)
+	if err == nil {
+		r.cache.Delete(host)
+	}
+
+	return err
+}
+
+func (r *Registry) remember(host string, l lookup) {
+	// a zero ttl turns caching off, lru would keep the entry forever
+	if r.ttl > 0 {
+		r.cache.Set(host, l, r.ttl)
+	}
+}
+
+// Host normalizes the host of a domain or of a request: the port and a
+// trailing dot are dropped and it is lowercased. Labels may have letters,
+// digits and inner "-" only.
+func Host(raw string) (string, error) {
+	host := strings.ToLower(strings.TrimSpace(raw))
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return "", ErrInvalidHost
+		}
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	if host == "" || len(host) > 253 {
+		return "", ErrInvalidHost
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", ErrInvalidHost
+		}
+
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return "", ErrInvalidHost
+			}
+		}
+	}
+
+	return host, nil
+}
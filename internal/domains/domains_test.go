@@ -0,0 +1,125 @@
+package domains
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHost(t *testing.T) {
+	for raw, want := range map[string]string{
+		"Go.Brand.com":       "go.brand.com",
+		"go.brand.com:8080":  "go.brand.com",
+		"go.brand.com.":      "go.brand.com",
+		"localhost":          "localhost",
+		"xn--80ak6aa92e.com": "xn--80ak6aa92e.com",
+	} {
+		host, err := Host(raw)
+		require.NoError(t, err, raw)
+		require.Equal(t, want, host)
+	}
+
+	for _, raw := range []string{"", "go..brand.com", "-go.brand.com", "go_brand.com", "go.brand.com/path", "user@brand.com", "https://brand.com"} {
+		_, err := Host(raw)
+		require.ErrorIs(t, err, ErrInvalidHost, raw)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	r := New(store, config.Domains{CacheTTL: time.Minute, CacheSize: 10}, "sho.rt")
+
+	_, err := r.SaveDomain(ctx, models.Domain{Host: "Sho.rt"})
+	require.ErrorIs(t, err, ErrPrimaryHost)
+	_, err = r.SaveDomain(ctx, models.Domain{Host: "go brand"})
+	require.ErrorIs(t, err, ErrInvalidHost)
+
+	// an unknown host is remembered, saving it through the registry forgets that
+	_, err = r.GetDomain(ctx, "go.brand.com")
+	require.ErrorIs(t, err, storage.ErrDomainNotFound)
+
+	_, err = r.SaveDomain(ctx, models.Domain{Host: "Go.Brand.com", DefaultURL: "https://brand.com"})
+	require.NoError(t, err)
+
+	d, err := r.GetDomain(ctx, "go.brand.com")
+	require.NoError(t, err)
+	require.Equal(t, "https://brand.com", d.DefaultURL)
+
+	// changes of other instances are seen once the cache ttl passes
+	_, err = store.UpdateDomain(ctx, models.Domain{Host: "go.brand.com", DefaultURL: "https://brand.com/new"})
+	require.NoError(t, err)
+	d, err = r.GetDomain(ctx, "go.brand.com")
+	require.NoError(t, err)
+	require.Equal(t, "https://brand.com", d.DefaultURL)
+
+	// changes through the registry at once
+	_, err = r.UpdateDomain(ctx, models.Domain{Host: "go.brand.com", NotFoundURL: "https://brand.com/404"})
+	require.NoError(t, err)
+	d, err = r.GetDomain(ctx, "go.brand.com")
+	require.NoError(t, err)
+	require.Equal(t, "https://brand.com/404", d.NotFoundURL)
+
+	require.NoError(t, r.DeleteDomain(ctx, "go.brand.com"))
+	_, err = r.GetDomain(ctx, "go.brand.com")
+	require.ErrorIs(t, err, storage.ErrDomainNotFound)
+}
+
+func TestMiddleware(t *testing.T) {
+	store := storage.NewMemory()
+	_, err := store.SaveDomain(context.Background(), models.Domain{Host: "go.brand.com"})
+	require.NoError(t, err)
+
+	var (
+		gotHost, gotAlias string
+		gotDomain         models.Domain
+		custom            bool
+	)
+
+	router := chi.NewRouter()
+	router.With(Middleware(slogdiscard.NewDiscardLogger(), store)).Get("/{alias}", func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotAlias = chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
+		gotDomain, custom = FromContext(r.Context())
+	})
+
+	cases := []struct {
+		name       string
+		host       string
+		path       string
+		wantCode   int
+		wantHost   string
+		wantAlias  string
+		wantCustom bool
+	}{
+		{name: "Primary domain", host: "sho.rt", path: "/promo", wantCode: http.StatusOK, wantAlias: "promo"},
+		{name: "Custom domain", host: "Go.Brand.com:443", path: "/promo", wantCode: http.StatusOK, wantHost: "go.brand.com", wantAlias: "promo", wantCustom: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotHost, gotAlias, gotDomain, custom = "", "", models.Domain{}, false
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Host = tc.host
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+			require.Equal(t, tc.wantHost, gotHost)
+			require.Equal(t, tc.wantAlias, gotAlias)
+			require.Equal(t, tc.wantCustom, custom)
+			if tc.wantCustom {
+				require.Equal(t, "go.brand.com", gotDomain.Host)
+			}
+		})
+	}
+}
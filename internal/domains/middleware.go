@@ -0,0 +1,74 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"net/http"
+)
+
+type ctxKey struct{}
+
+// WithDomain returns ctx of a request sent to the custom domain d
+func WithDomain(ctx context.Context, d models.Domain) context.Context {
+	return context.WithValue(ctx, ctxKey{}, d)
+}
+
+// FromContext returns the custom domain a request was sent to, false for the primary domain
+func FromContext(ctx context.Context) (models.Domain, bool) {
+	d, ok := ctx.Value(ctxKey{}).(models.Domain)
+
+	return d, ok
+}
+
+// Finder finds the domain served at a host
+type Finder interface {
+	GetDomain(ctx context.Context, host string) (models.Domain, error)
+}
+
+// Middleware serves requests to a custom domain from its links: the domain
+// goes to the context and to the "domain" URL parameter, the handlers look
+// the alias up on it. Requests to any other host are served by the primary
+// domain, which never reaches the links of custom ones.
+func Middleware(log *slog.Logger, domains Finder) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(slog.String("component", "middleware/domains"))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, err := Host(r.Host)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			d, err := domains.GetDomain(r.Context(), host)
+			if errors.Is(err, storage.ErrDomainNotFound) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to find domain",
+					slog.String("host", host),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+					sl.Err(err),
+				)
+				resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+				return
+			}
+
+			// URLParam returns the last value added for a key
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				rctx.URLParams.Add("domain", d.Host)
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithDomain(r.Context(), d)))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type ExpiredDeleter interface {
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Reaper periodically purges expired links and idempotency keys.
+// Redirects check expiry on their own, so a late purge never serves an expired link.
+type Reaper struct {
+	log      *slog.Logger
+	deleter  ExpiredDeleter
+	interval time.Duration
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReaper starts a reaper that purges with deleter every interval,
+// interval must be positive
+func NewReaper(log *slog.Logger, deleter ExpiredDeleter, interval time.Duration) (*Reaper, error) {
+	const op = "expiry.NewReaper"
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("%s: reap interval must be positive", op)
+	}
+
+	r := &Reaper{
+		log:      log.With(slog.String("component", "expiry/reaper")),
+		deleter:  deleter,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// Close stops the reaper and waits for a running purge to finish
+func (r *Reaper) Close(ctx context.Context) error {
+	r.closeOnce.Do(func() { close(r.stop) })
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Reaper) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.reap()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Reaper) reap() {
+	now := time.Now()
+
+	deleted, err := r.deleter.DeleteExpired(context.Background(), now)
+	if err != nil {
+		r.log.Error("failed to delete expired links", sl.Err(err))
+	} else if deleted > 0 {
+		r.log.Info("expired links deleted", slog.Int64("count", deleted))
+	}
+
+	// lookups skip expired keys as well, a failed purge only keeps the rows longer
+	deleted, err = r.deleter.DeleteExpiredIdempotencyKeys(context.Background(), now)
+	if err != nil {
+		r.log.Error("failed to delete expired idempotency keys", sl.Err(err))
+	} else if deleted > 0 {
+		r.log.Info("expired idempotency keys deleted", slog.Int64("count", deleted))
+	}
+}
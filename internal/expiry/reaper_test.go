@@ -0,0 +1,51 @@
+package expiry
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type expiredDeleterStub struct {
+	calls    atomic.Int64
+	keyCalls atomic.Int64
+}
+
+func (s *expiredDeleterStub) DeleteExpired(_ context.Context, _ time.Time) (int64, error) {
+	s.calls.Add(1)
+	return 1, nil
+}
+
+func (s *expiredDeleterStub) DeleteExpiredIdempotencyKeys(_ context.Context, _ time.Time) (int64, error) {
+	s.keyCalls.Add(1)
+	return 1, nil
+}
+
+func TestReaper(t *testing.T) {
+	deleter := &expiredDeleterStub{}
+
+	reaper, err := NewReaper(slogdiscard.NewDiscardLogger(), deleter, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return deleter.calls.Load() >= 2 && deleter.keyCalls.Load() >= 2
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, reaper.Close(context.Background()))
+
+	// nothing runs after close
+	calls := deleter.calls.Load()
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, calls, deleter.calls.Load())
+}
+
+func TestNewReaperInvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		reaper, err := NewReaper(slogdiscard.NewDiscardLogger(), &expiredDeleterStub{}, interval)
+		require.Error(t, err)
+		require.Nil(t, reaper)
+	}
+}
@@ -1,12 +1,13 @@
 package deleteURL
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
-	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
 	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
 	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
 	"github.com/lostmyescape/url-shortener/internal/storage"
@@ -19,64 +20,94 @@ type Response struct {
 	Alias string
 }
 
+//go:generate mockery --name=URLDeleter --dir=. --output=./mocks --filename=url_deleter_mock.go --outpkg=mocks
 type URLDeleter interface {
-	DeleteURL(alias string) error
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+	DeleteURL(ctx context.Context, domain, alias string) error
 }
 
-func New(log *slog.Logger, delete URLDeleter) http.HandlerFunc {
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// New deletes a link if the policy lets the user delete it
+func New(log *slog.Logger, delete URLDeleter, policy Authorizer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.deleteURL.deleteURL"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
-		alias := chi.URLParam(r, "alias")
+		domain, alias := chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
 
 		if alias == "" {
-			log.Error("alias is empty")
-			NewJSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+			log.ErrorContext(r.Context(), "alias is empty")
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+
+			return
+		}
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		url, err := delete.GetUrl(r.Context(), domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.InfoContext(r.Context(), "alias not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get url", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("unexpected error"))
+
+			return
+		}
+
+		err = policy.Authorize(r.Context(), user, authz.ActionDelete, authz.LinkOf(url))
+		if errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(r.Context(), "user may not delete the url",
+				slog.Int64("user_id", user.ID),
+				slog.Int64("owner_id", url.UserID),
+			)
+			resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
 
 			return
 		}
 
 		// delete url
-		err := delete.DeleteURL(alias)
+		err = delete.DeleteURL(r.Context(), domain, alias)
 
 		switch {
 		case err == nil:
-			log.Info("url deleted")
+			log.InfoContext(r.Context(), "url deleted")
 			responseOk(w, r, alias)
 		case errors.Is(err, storage.ErrAliasNotFound):
-			log.Error("alias not found", sl.Err(err))
-			NewJSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
+			log.ErrorContext(r.Context(), "alias not found", sl.Err(err))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
 		default:
-			log.Error("unexpected error", sl.Err(err))
-			NewJSON(w, r, http.StatusInternalServerError, resp.Error("unexpected error"))
+			log.ErrorContext(r.Context(), "unexpected error", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("unexpected error"))
 		}
 	}
 }
 
-func NewJSON(w http.ResponseWriter, _ *http.Request, status int, v interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	enc.SetEscapeHTML(true)
-
-	if err := enc.Encode(v); err != nil {
-		w.WriteHeader(status)
-		fmt.Fprintf(w, `{"error": "failed to encode response"}`)
-		return
-	}
-
-	w.WriteHeader(status)
-	buf.WriteTo(w)
-}
-
 func responseOk(w http.ResponseWriter, r *http.Request, alias string) {
-	NewJSON(w, r, http.StatusOK, Response{
+	resp.JSON(w, r, http.StatusOK, Response{
 		Response: resp.OK(),
 		Alias:    alias,
 	})
@@ -0,0 +1,121 @@
+package deleteURL
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/deleteURL/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeleteHandler(t *testing.T) {
+	const ownerID = 7
+
+	cases := []struct {
+		name       string
+		user       *auth.User
+		getError   error
+		authzError error
+		wantDelete bool
+		respError  string
+		wantCode   int
+	}{
+		{
+			name:       "Owner",
+			user:       &auth.User{ID: ownerID},
+			wantDelete: true,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Service account",
+			user:       &auth.User{Service: true},
+			wantDelete: true,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Allowed by the policy",
+			user:       &auth.User{ID: 1},
+			wantDelete: true,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Other user",
+			user:       &auth.User{ID: 8},
+			authzError: authz.ErrForbidden,
+			respError:  "forbidden",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "SSO unavailable",
+			user:       &auth.User{ID: 8},
+			authzError: errors.New("connection refused"),
+			respError:  "failed to check permissions",
+			wantCode:   http.StatusInternalServerError,
+		},
+		{
+			name:      "Alias not found",
+			user:      &auth.User{ID: ownerID},
+			getError:  storage.ErrURLNotFound,
+			respError: "alias not found",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "Unauthenticated",
+			respError: "unauthorized",
+			wantCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlDeleterMock := mocks.NewURLDeleter(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			if tc.user != nil {
+				urlDeleterMock.On("GetUrl", mock.Anything, "", "google").
+					Return(models.URL{Alias: "google", URL: "https://google.com", UserID: ownerID}, tc.getError).
+					Once()
+			}
+			if tc.user != nil && tc.getError == nil {
+				authorizerMock.On("Authorize", mock.Anything, *tc.user, authz.ActionDelete, authz.Resource{Owner: ownerID}).
+					Return(tc.authzError).
+					Once()
+			}
+			if tc.wantDelete {
+				urlDeleterMock.On("DeleteURL", mock.Anything, "", "google").
+					Return(nil).
+					Once()
+			}
+
+			r := chi.NewRouter()
+			r.Delete("/url/{alias}", New(slogdiscard.NewDiscardLogger(), urlDeleterMock, authorizerMock))
+
+			req := httptest.NewRequest(http.MethodDelete, "/url/google", nil)
+			if tc.user != nil {
+				req = req.WithContext(auth.WithUser(context.Background(), *tc.user))
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds every check, a hanging dependency is a failing one
+const checkTimeout = 2 * time.Second
+
+// Check fails when its dependency can't serve requests
+type Check func(ctx context.Context) error
+
+//go:generate mockery --name=ShutdownState --dir=. --output=./mocks --filename=shutdown_state_mock.go --outpkg=mocks
+type ShutdownState interface {
+	Stopping() bool
+}
+
+type Response struct {
+	resp.Response
+	Checks map[string]resp.Response `json:"checks,omitempty"`
+}
+
+// Liveness answers as long as the process serves requests at all
+func Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, resp.OK())
+	}
+}
+
+// Readiness runs every check at once and answers 503 with the failed ones
+// if any of them fails, or right away once the service is shutting down
+// so that no new requests are routed to it.
+func Readiness(log *slog.Logger, state ShutdownState, checks map[string]Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.health.Readiness"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		if state.Stopping() {
+			writeJSON(w, r, http.StatusServiceUnavailable, Response{Response: resp.Error("shutting down")})
+
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		var (
+			mu     sync.Mutex
+			wg     sync.WaitGroup
+			failed int
+		)
+
+		results := make(map[string]resp.Response, len(checks))
+
+		for name, check := range checks {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				result := resp.OK()
+				if err := check(ctx); err != nil {
+					log.WarnContext(r.Context(), "dependency is not ready", slog.String("dependency", name), sl.Err(err))
+					// the probe is open to anyone, the details stay in the log
+					result = resp.Error("unavailable")
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				results[name] = result
+				if result.Status != resp.StatusOk {
+					failed++
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if failed > 0 {
+			writeJSON(w, r, http.StatusServiceUnavailable, Response{
+				Response: resp.Error(fmt.Sprintf("%d dependency(ies) not ready", failed)),
+				Checks:   results,
+			})
+
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, Response{Response: resp.OK(), Checks: results})
+	}
+}
+
+// writeJSON answers like resp.JSON, probes must see the current state
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Cache-Control", "no-store")
+	resp.JSON(w, r, status, v)
+}
@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/health/mocks"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLiveness(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Liveness().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, `{"status": "OK"}`, rr.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	hanging := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	cases := []struct {
+		name       string
+		stopping   bool
+		checks     map[string]Check
+		respError  string
+		wantChecks map[string]resp.Response
+		wantCode   int
+	}{
+		{
+			name:   "Ready",
+			checks: map[string]Check{"storage": ok, "sso": ok},
+			wantChecks: map[string]resp.Response{
+				"storage": resp.OK(),
+				"sso":     resp.OK(),
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "Dependency fails",
+			checks: map[string]Check{
+				"storage":    ok,
+				"migrations": func(context.Context) error { return errors.New("2 pending migration(s)") },
+			},
+			respError: "1 dependency(ies) not ready",
+			wantChecks: map[string]resp.Response{
+				"storage":    resp.OK(),
+				"migrations": resp.Error("unavailable"),
+			},
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:      "Dependency hangs",
+			checks:    map[string]Check{"sso": hanging},
+			respError: "1 dependency(ies) not ready",
+			wantChecks: map[string]resp.Response{
+				"sso": resp.Error("unavailable"),
+			},
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:      "Shutting down",
+			stopping:  true,
+			checks:    map[string]Check{"storage": ok},
+			respError: "shutting down",
+			wantCode:  http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			shutdownStateMock := mocks.NewShutdownState(t)
+			shutdownStateMock.On("Stopping").Return(tc.stopping).Once()
+
+			handler := Readiness(slogdiscard.NewDiscardLogger(), shutdownStateMock, tc.checks)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			require.Equal(t, tc.wantCode, rr.Code)
+			require.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+
+			var response Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, tc.respError, response.Error)
+			require.Equal(t, tc.wantChecks, response.Checks)
+		})
+	}
+}
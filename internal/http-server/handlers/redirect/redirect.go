@@ -1,78 +1,303 @@
 package redirect
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/domains"
 	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
 	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/lib/page"
+	"github.com/lostmyescape/url-shortener/internal/preview"
 	"github.com/lostmyescape/url-shortener/internal/storage"
 	"log/slog"
 	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
 )
 
 //go:generate mockery --name=URLSearcher --dir=. --output=./mocks --filename=URLSearcher.go --outpkg=mocks
 type URLSearcher interface {
-	GetUrl(alias string) (string, error)
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
 }
 
-func Redirect(log *slog.Logger, searchUrl URLSearcher) http.HandlerFunc {
+//go:generate mockery --name=ClickTracker --dir=. --output=./mocks --filename=ClickTracker.go --outpkg=mocks
+type ClickTracker interface {
+	Track(r *http.Request, domain, alias string)
+}
+
+//go:generate mockery --name=PageFetcher --dir=. --output=./mocks --filename=PageFetcher.go --outpkg=mocks
+type PageFetcher interface {
+	Fetch(ctx context.Context, rawURL string) (preview.Page, error)
+}
+
+// previewParam asks for the preview page instead of the redirect
+const previewParam = "preview"
+
+// Redirect sends the client to the destination of an alias with the redirect
+// type of the link. Permanent redirects may be cached for permanentMaxAge,
+// but never past the expiry of the link, temporary ones aren't cached.
+// Links with the interstitial flag and requests with ?preview=1 get the
+// preview page instead, only the interstitial page counts as a click.
+func Redirect(
+	log *slog.Logger,
+	searchUrl URLSearcher,
+	clicks ClickTracker,
+	pages PageFetcher,
+	permanentMaxAge time.Duration,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.redirect.redirect"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
-		alias := chi.URLParam(r, "alias")
-
-		// validate request
-		if alias == "" {
-			log.Error("alias is empty")
-			NewJSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+		now := time.Now()
 
+		url, ok := find(w, r, log, searchUrl, now)
+		if !ok {
 			return
 		}
 
-		// trying to get an url
-		url, err := searchUrl.GetUrl(alias)
-		if errors.Is(err, storage.ErrURLNotFound) {
-			log.Info("URL not found", slog.String("alias", alias))
-			NewJSON(w, r, http.StatusNotFound, resp.Error("URL not found"))
+		log.InfoContext(r.Context(), "got url", slog.String("url", url.URL))
+
+		rawQuery := r.URL.RawQuery
+		previewed := r.URL.Query().Get(previewParam) == "1"
+		if previewed {
+			rawQuery = withoutParam(rawQuery, previewParam)
+		} else {
+			clicks.Track(r, chi.URLParam(r, "domain"), chi.URLParam(r, "alias"))
+		}
+
+		if previewed || url.Interstitial {
+			renderPreview(w, r, log, pages, url, Destination(url, rawQuery))
 
 			return
 		}
 
-		if err != nil {
-			log.Error("failed searching URL", sl.Err(err))
-			NewJSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+		code := url.RedirectType
+		if !models.ValidRedirectType(code) {
+			code = models.DefaultRedirectType
+		}
+
+		w.Header().Set("Cache-Control", CacheControl(url, code, permanentMaxAge, now))
+		http.Redirect(w, r, Destination(url, rawQuery), code)
+	}
+}
+
+// Preview shows the preview page of an alias, served at /{alias}+
+func Preview(log *slog.Logger, searchUrl URLSearcher, pages PageFetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.redirect.Preview"
 
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		url, ok := find(w, r, log, searchUrl, time.Now())
+		if !ok {
 			return
 		}
 
-		log.Info("got url", slog.String("url", url))
+		renderPreview(w, r, log, pages, url, Destination(url, r.URL.RawQuery))
+	}
+}
+
+// find loads the link of the alias in the URL, if there is no live one
+// it responds itself and returns false
+func find(w http.ResponseWriter, r *http.Request, log *slog.Logger, searchUrl URLSearcher, now time.Time) (models.URL, bool) {
+	domain, alias := chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
 
-		http.Redirect(w, r, url, http.StatusFound)
+	// validate request
+	if alias == "" {
+		log.ErrorContext(r.Context(), "alias is empty")
+		resp.JSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+
+		return models.URL{}, false
+	}
+
+	// trying to get an url
+	url, err := searchUrl.GetUrl(r.Context(), domain, alias)
+	if errors.Is(err, storage.ErrURLNotFound) {
+		log.InfoContext(r.Context(), "URL not found", slog.String("alias", alias))
+		if d, ok := domains.FromContext(r.Context()); ok {
+			domainNotFound(w, r, log, d, http.StatusNotFound)
+		} else {
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("URL not found"))
+		}
+
+		return models.URL{}, false
 	}
+
+	if err != nil {
+		log.ErrorContext(r.Context(), "failed searching URL", sl.Err(err))
+		resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+		return models.URL{}, false
+	}
+
+	if url.Expired(now) {
+		log.InfoContext(r.Context(), "URL expired", slog.String("alias", alias), slog.Time("expires_at", *url.ExpiresAt))
+		if d, ok := domains.FromContext(r.Context()); ok {
+			domainNotFound(w, r, log, d, http.StatusGone)
+		} else {
+			resp.JSON(w, r, http.StatusGone, resp.Error("URL expired"))
+		}
+
+		return models.URL{}, false
+	}
+
+	return url, true
 }
 
-func NewJSON(w http.ResponseWriter, _ *http.Request, status int, v interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+// Root answers the root of a domain, custom domains may redirect it to their default URL
+func Root(log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.redirect.Root"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		d, ok := domains.FromContext(r.Context())
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if d.DefaultURL == "" {
+			domainNotFound(w, r, log, d, http.StatusNotFound)
+			return
+		}
+
+		// the default URL may change at any time
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, d.DefaultURL, http.StatusFound)
+	}
+}
 
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	enc.SetEscapeHTML(true)
+// domainNotFound answers a request for a missing or expired link of the
+// custom domain d: it redirects to the not found URL of the domain or
+// shows the not found page with status
+func domainNotFound(w http.ResponseWriter, r *http.Request, log *slog.Logger, d models.Domain, status int) {
+	w.Header().Set("Cache-Control", "no-store")
 
-	if err := enc.Encode(v); err != nil {
-		w.WriteHeader(status)
-		fmt.Fprintf(w, `{"error": "failed to encode response"}`)
+	if d.NotFoundURL != "" {
+		http.Redirect(w, r, d.NotFoundURL, http.StatusFound)
 		return
 	}
 
-	w.WriteHeader(status)
-	buf.WriteTo(w)
+	if err := page.Render(w, status, "not_found", page.NotFound{Host: d.Host, Path: r.URL.Path}); err != nil {
+		log.ErrorContext(r.Context(), "failed to render not found page", sl.Err(err))
+		resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+	}
+}
+
+// renderPreview shows where u leads, the title and the favicon are best effort
+func renderPreview(
+	w http.ResponseWriter,
+	r *http.Request,
+	log *slog.Logger,
+	pages PageFetcher,
+	u models.URL,
+	destination string,
+) {
+	data := page.Preview{
+		Alias:        strings.TrimPrefix(models.AliasPath(chi.URLParam(r, "alias")), "/"),
+		Destination:  destination,
+		Interstitial: u.Interstitial,
+	}
+
+	if dest, err := neturl.Parse(destination); err == nil {
+		data.Host = dest.Host
+	}
+
+	meta, err := pages.Fetch(r.Context(), u.URL)
+	if err != nil {
+		log.InfoContext(r.Context(), "failed to fetch preview", slog.String("url", u.URL), sl.Err(err))
+	}
+	data.Title, data.Favicon = meta.Title, meta.Favicon
+
+	// the page reflects the link as it is now
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := page.Render(w, http.StatusOK, "preview", data); err != nil {
+		log.ErrorContext(r.Context(), "failed to render preview", sl.Err(err))
+		resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+	}
+}
+
+// withoutParam drops key from rawQuery and keeps the rest as it is written
+func withoutParam(rawQuery, key string) string {
+	var kept []string
+	for _, part := range strings.Split(rawQuery, "&") {
+		name, _, _ := strings.Cut(part, "=")
+		if unescaped, err := neturl.QueryUnescape(name); err == nil && unescaped == key || part == "" {
+			continue
+		}
+		kept = append(kept, part)
+	}
+
+	return strings.Join(kept, "&")
+}
+
+// Destination returns where u redirects a request with rawQuery: the query
+// is appended if the link passes it on, then the UTM parameters of the link
+// that neither the destination nor the query set
+func Destination(u models.URL, rawQuery string) string {
+	if !u.PassQuery {
+		rawQuery = ""
+	}
+
+	utm := u.UTM.Params()
+	if rawQuery == "" && len(utm) == 0 {
+		return u.URL
+	}
+
+	dest, err := neturl.Parse(u.URL)
+	if err != nil {
+		return u.URL
+	}
+
+	// the destination and the passed query are kept as they are written
+	set := dest.Query()
+	passed, _ := neturl.ParseQuery(rawQuery)
+
+	for key := range utm {
+		if set.Has(key) || passed.Has(key) {
+			utm.Del(key)
+		}
+	}
+
+	var parts []string
+	for _, part := range []string{dest.RawQuery, rawQuery, utm.Encode()} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	dest.RawQuery = strings.Join(parts, "&")
+
+	return dest.String()
+}
+
+// CacheControl returns the Cache-Control header of a redirect of u with code
+func CacheControl(u models.URL, code int, permanentMaxAge time.Duration, now time.Time) string {
+	maxAge := permanentMaxAge
+	if u.ExpiresAt != nil {
+		maxAge = min(maxAge, u.ExpiresAt.Sub(now))
+	}
+
+	if !models.PermanentRedirect(code) || maxAge < time.Second {
+		return "no-store"
+	}
+
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
 }
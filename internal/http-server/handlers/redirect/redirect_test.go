@@ -1,20 +1,31 @@
 package redirect
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/domains"
 	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/redirect/mocks"
 	"github.com/lostmyescape/url-shortener/internal/lib/api"
+	"github.com/lostmyescape/url-shortener/internal/lib/api/response"
 	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/preview"
 	"github.com/lostmyescape/url-shortener/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"html"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestRedirectHandler(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
 	cases := []struct {
 		name      string
 		alias     string
@@ -23,6 +34,7 @@ func TestRedirectHandler(t *testing.T) {
 		mockError error
 		wantCode  int
 		mockURL   string
+		expiresAt *time.Time
 	}{
 		{
 			name:     "Success",
@@ -44,6 +56,14 @@ func TestRedirectHandler(t *testing.T) {
 			wantCode:  http.StatusNotFound,
 			mockError: storage.ErrURLNotFound,
 		},
+		{
+			name:      "URL expired",
+			alias:     "expired",
+			respError: "URL expired",
+			wantCode:  http.StatusGone,
+			mockURL:   "https://google.com",
+			expiresAt: &past,
+		},
 		{
 			name:      "GetURL error",
 			alias:     "test_alias",
@@ -58,18 +78,41 @@ func TestRedirectHandler(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 			urlSearcherMock := mocks.NewURLSearcher(t)
+			clickTrackerMock := mocks.NewClickTracker(t)
 
-			if tc.mockError != nil {
-				urlSearcherMock.On("GetUrl", tc.alias).
-					Return("", tc.mockError).
+			switch {
+			case tc.alias == "":
+				// handler rejects the request before searching
+			case tc.mockError != nil:
+				urlSearcherMock.On("GetUrl", mock.Anything, "", tc.alias).
+					Return(models.URL{}, tc.mockError).
+					Once()
+			default:
+				urlSearcherMock.On("GetUrl", mock.Anything, "", tc.alias).
+					Return(models.URL{Alias: tc.alias, URL: tc.mockURL, ExpiresAt: tc.expiresAt}, nil).
 					Once()
-			} else {
-				urlSearcherMock.On("GetUrl", tc.alias).
-					Return(tc.mockURL, nil).
+			}
+
+			if tc.wantCode == http.StatusFound {
+				clickTrackerMock.On("Track", mock.Anything, "", tc.alias).
+					Return().
 					Once()
 			}
 
-			handler := Redirect(slogdiscard.NewDiscardLogger(), urlSearcherMock)
+			handler := Redirect(slogdiscard.NewDiscardLogger(), urlSearcherMock, clickTrackerMock, mocks.NewPageFetcher(t), time.Hour)
+
+			if tc.wantCode != http.StatusFound {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, requestWithAlias(tc.alias))
+
+				require.Equal(t, tc.wantCode, rr.Code)
+
+				var resp response.Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				require.Equal(t, tc.respError, resp.Error)
+
+				return
+			}
 
 			r := chi.NewRouter()
 			r.Get("/{alias}", handler)
@@ -84,3 +127,290 @@ func TestRedirectHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRedirectHandlerOptions(t *testing.T) {
+	urlSearcherMock := mocks.NewURLSearcher(t)
+	urlSearcherMock.On("GetUrl", mock.Anything, "", "sale").Return(models.URL{
+		Alias:        "sale",
+		URL:          "https://shop.example.com/sale?lang=en",
+		RedirectType: http.StatusPermanentRedirect,
+		PassQuery:    true,
+		UTM:          models.UTM{Source: "shortener", Campaign: "spring"},
+	}, nil).Once()
+
+	clickTrackerMock := mocks.NewClickTracker(t)
+	clickTrackerMock.On("Track", mock.Anything, "", "sale").Return().Once()
+
+	handler := Redirect(slogdiscard.NewDiscardLogger(), urlSearcherMock, clickTrackerMock, mocks.NewPageFetcher(t), time.Hour)
+
+	req := requestWithAlias("sale")
+	req.URL.RawQuery = "ref=tw&utm_source=twitter"
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusPermanentRedirect, rr.Code)
+	require.Equal(t, "https://shop.example.com/sale?lang=en&ref=tw&utm_source=twitter&utm_campaign=spring", rr.Header().Get("Location"))
+	require.Equal(t, "public, max-age=3600", rr.Header().Get("Cache-Control"))
+}
+
+func TestPreview(t *testing.T) {
+	const favicon = "data:image/png;base64,iVBORw0KGgo="
+
+	cases := []struct {
+		name      string
+		path      string
+		url       models.URL
+		wantClick bool
+		wantDest  string
+		wantText  []string
+	}{
+		{
+			name:     "Plus suffix",
+			path:     "/docs+",
+			url:      models.URL{URL: "https://example.com/docs"},
+			wantDest: "https://example.com/docs",
+			wantText: []string{"/docs leads to", "Example Docs", "Continue to example.com"},
+		},
+		{
+			name:     "Preview parameter",
+			path:     "/docs?preview=1&ref=tw",
+			url:      models.URL{URL: "https://example.com/docs", PassQuery: true},
+			wantDest: "https://example.com/docs?ref=tw",
+			wantText: []string{"Example Docs"},
+		},
+		{
+			name:      "Interstitial",
+			path:      "/docs",
+			url:       models.URL{URL: "https://example.com/docs", Interstitial: true, RedirectType: http.StatusMovedPermanently},
+			wantClick: true,
+			wantDest:  "https://example.com/docs",
+			wantText:  []string{"You are leaving for another site"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			urlSearcherMock := mocks.NewURLSearcher(t)
+			urlSearcherMock.On("GetUrl", mock.Anything, "", "docs").Return(tc.url, nil).Once()
+
+			clickTrackerMock := mocks.NewClickTracker(t)
+			if tc.wantClick {
+				clickTrackerMock.On("Track", mock.Anything, "", "docs").Return().Once()
+			}
+
+			pageFetcherMock := mocks.NewPageFetcher(t)
+			pageFetcherMock.On("Fetch", mock.Anything, tc.url.URL).
+				Return(preview.Page{Title: "Example Docs", Favicon: favicon}, nil).
+				Once()
+
+			log := slogdiscard.NewDiscardLogger()
+
+			r := chi.NewRouter()
+			r.Get("/{alias}", Redirect(log, urlSearcherMock, clickTrackerMock, pageFetcherMock, time.Hour))
+			r.Get("/{alias}+", Preview(log, urlSearcherMock, pageFetcherMock))
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+			require.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+
+			body := rr.Body.String()
+			require.Contains(t, body, `href="`+html.EscapeString(tc.wantDest)+`"`)
+			require.Contains(t, body, `src="`+favicon+`"`)
+			for _, text := range tc.wantText {
+				require.Contains(t, body, text)
+			}
+		})
+	}
+}
+
+func TestPreviewFetchFails(t *testing.T) {
+	urlSearcherMock := mocks.NewURLSearcher(t)
+	urlSearcherMock.On("GetUrl", mock.Anything, "", "docs").
+		Return(models.URL{URL: "https://example.com/<docs>"}, nil).
+		Once()
+
+	pageFetcherMock := mocks.NewPageFetcher(t)
+	pageFetcherMock.On("Fetch", mock.Anything, "https://example.com/<docs>").
+		Return(preview.Page{}, errors.New("timeout")).
+		Once()
+
+	rr := httptest.NewRecorder()
+	Preview(slogdiscard.NewDiscardLogger(), urlSearcherMock, pageFetcherMock).ServeHTTP(rr, requestWithAlias("docs"))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	// the host stands in for the title, the destination is escaped
+	require.Contains(t, rr.Body.String(), "<h1>example.com</h1>")
+	require.NotContains(t, rr.Body.String(), "<docs>")
+	require.NotContains(t, rr.Body.String(), "<img")
+}
+
+func TestDomainNotFound(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	urlSearcherMock := mocks.NewURLSearcher(t)
+	urlSearcherMock.On("GetUrl", mock.Anything, "go.brand.com", "missing").Return(models.URL{}, storage.ErrURLNotFound)
+	urlSearcherMock.On("GetUrl", mock.Anything, "go.brand.com", "expired").
+		Return(models.URL{URL: "https://brand.com", ExpiresAt: &past}, nil)
+
+	handler := Redirect(slogdiscard.NewDiscardLogger(), urlSearcherMock, mocks.NewClickTracker(t), mocks.NewPageFetcher(t), time.Hour)
+
+	request := func(alias string, d models.Domain) *http.Request {
+		req := requestWithAlias(alias)
+		chi.RouteContext(req.Context()).URLParams.Add("domain", d.Host)
+
+		return req.WithContext(domains.WithDomain(req.Context(), d))
+	}
+
+	// the not found page of the domain
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, request("missing", models.Domain{Host: "go.brand.com"}))
+	require.Equal(t, http.StatusNotFound, rr.Code)
+	require.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	require.Contains(t, rr.Body.String(), "go.brand.com/missing")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, request("expired", models.Domain{Host: "go.brand.com"}))
+	require.Equal(t, http.StatusGone, rr.Code)
+	require.Contains(t, rr.Body.String(), "Link not found")
+
+	// or its not found URL
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, request("missing", models.Domain{Host: "go.brand.com", NotFoundURL: "https://brand.com/404"}))
+	require.Equal(t, http.StatusFound, rr.Code)
+	require.Equal(t, "https://brand.com/404", rr.Header().Get("Location"))
+	require.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+}
+
+func TestRoot(t *testing.T) {
+	handler := Root(slogdiscard.NewDiscardLogger())
+
+	cases := []struct {
+		name     string
+		domain   *models.Domain
+		wantCode int
+		wantURL  string
+	}{
+		{name: "Primary domain", wantCode: http.StatusNotFound},
+		{name: "Default URL", domain: &models.Domain{Host: "go.brand.com", DefaultURL: "https://brand.com"}, wantCode: http.StatusFound, wantURL: "https://brand.com"},
+		{name: "No default URL", domain: &models.Domain{Host: "go.brand.com"}, wantCode: http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.domain != nil {
+				req = req.WithContext(domains.WithDomain(req.Context(), *tc.domain))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+			require.Equal(t, tc.wantURL, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestWithoutParam(t *testing.T) {
+	require.Equal(t, "ref=tw&q=a%20b", withoutParam("preview=1&ref=tw&q=a%20b", "preview"))
+	require.Equal(t, "", withoutParam("preview=1", "preview"))
+	require.Equal(t, "previews=2", withoutParam("previews=2&pre%76iew=1", "preview"))
+}
+
+func TestDestination(t *testing.T) {
+	cases := []struct {
+		name     string
+		url      models.URL
+		rawQuery string
+		want     string
+	}{
+		{
+			name:     "Query isn't passed",
+			url:      models.URL{URL: "https://google.com/search?q=go"},
+			rawQuery: "q=rust",
+			want:     "https://google.com/search?q=go",
+		},
+		{
+			name:     "Query passed",
+			url:      models.URL{URL: "https://google.com/search", PassQuery: true},
+			rawQuery: "q=go&hl=en",
+			want:     "https://google.com/search?q=go&hl=en",
+		},
+		{
+			name:     "Query appended",
+			url:      models.URL{URL: "https://google.com/search?hl=en#top", PassQuery: true},
+			rawQuery: "q=go",
+			want:     "https://google.com/search?hl=en&q=go#top",
+		},
+		{
+			name: "UTM added",
+			url:  models.URL{URL: "https://shop.example.com", UTM: models.UTM{Source: "mail", Medium: "email", Campaign: "spring sale"}},
+			want: "https://shop.example.com?utm_campaign=spring+sale&utm_medium=email&utm_source=mail",
+		},
+		{
+			name: "UTM of the destination kept",
+			url:  models.URL{URL: "https://shop.example.com/?utm_source=ads", UTM: models.UTM{Source: "mail"}},
+			want: "https://shop.example.com/?utm_source=ads",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, Destination(tc.url, tc.rawQuery))
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	soon := now.Add(10 * time.Minute)
+	past := now.Add(-time.Second)
+
+	cases := []struct {
+		name   string
+		url    models.URL
+		code   int
+		maxAge time.Duration
+		want   string
+	}{
+		{name: "Found", code: http.StatusFound, maxAge: time.Hour, want: "no-store"},
+		{name: "Temporary", code: http.StatusTemporaryRedirect, maxAge: time.Hour, want: "no-store"},
+		{name: "Moved permanently", code: http.StatusMovedPermanently, maxAge: time.Hour, want: "public, max-age=3600"},
+		{name: "Permanent", code: http.StatusPermanentRedirect, maxAge: 24 * time.Hour, want: "public, max-age=86400"},
+		{name: "Caching off", code: http.StatusMovedPermanently, want: "no-store"},
+		{
+			name:   "Until expiry",
+			url:    models.URL{ExpiresAt: &soon},
+			code:   http.StatusMovedPermanently,
+			maxAge: time.Hour,
+			want:   "public, max-age=600",
+		},
+		{
+			name:   "Expired",
+			url:    models.URL{ExpiresAt: &past},
+			code:   http.StatusMovedPermanently,
+			maxAge: time.Hour,
+			want:   "no-store",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, CacheControl(tc.url, tc.code, tc.maxAge, now))
+		})
+	}
+}
+
+// requestWithAlias builds a request as if chi had matched /{alias}
+func requestWithAlias(alias string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("alias", alias)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+alias, nil)
+
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
@@ -0,0 +1,730 @@
+package batch
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxItems is the most links one request may create or delete
+	maxItems     = 1000
+	maxBodyBytes = 10 << 20
+	// checkWorkers is how many URLs of a batch are checked against the URL policy at once
+	checkWorkers = 16
+)
+
+type Response struct {
+	resp.Response
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Results   []Result `json:"results"`
+}
+
+// Result is the outcome of one item, Index is its position in the request
+type Result struct {
+	resp.Response
+	Index     int        `json:"index"`
+	Domain    string     `json:"domain,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// DeleteRequest lists aliases of one domain, the primary one if Domain is empty
+type DeleteRequest struct {
+	Domain  string   `json:"domain,omitempty"`
+	Aliases []string `json:"aliases" validate:"required,min=1"`
+}
+
+//go:generate mockery --name=URLBatchSaver --dir=. --output=./mocks --filename=url_batch_saver_mock.go --outpkg=mocks
+type URLBatchSaver interface {
+	SaveURLs(ctx context.Context, urls []models.URL, unique bool) ([]error, error)
+}
+
+//go:generate mockery --name=URLFinder --dir=. --output=./mocks --filename=url_finder_mock.go --outpkg=mocks
+type URLFinder interface {
+	FindURL(ctx context.Context, rawURL, domain string, userID int64, team string, now time.Time) (models.URL, error)
+}
+
+//go:generate mockery --name=AliasGenerator --dir=. --output=./mocks --filename=alias_generator_mock.go --outpkg=mocks
+type AliasGenerator interface {
+	Generate(ctx context.Context) (alias string, id int64, err error)
+}
+
+//go:generate mockery --name=AliasRules --dir=. --output=./mocks --filename=alias_rules_mock.go --outpkg=mocks
+type AliasRules interface {
+	Team(team string) (string, error)
+	Custom(alias string) (string, error)
+	Generated(alias string) error
+}
+
+//go:generate mockery --name=URLChecker --dir=. --output=./mocks --filename=url_checker_mock.go --outpkg=mocks
+type URLChecker interface {
+	Check(ctx context.Context, rawURL string) error
+}
+
+//go:generate mockery --name=Charger --dir=. --output=./mocks --filename=charger_mock.go --outpkg=mocks
+type Charger interface {
+	Charge(w http.ResponseWriter, r *http.Request, n int) int
+}
+
+//go:generate mockery --name=URLBatchDeleter --dir=. --output=./mocks --filename=url_batch_deleter_mock.go --outpkg=mocks
+type URLBatchDeleter interface {
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+	DeleteURLs(ctx context.Context, domain string, aliases []string, userID *int64) ([]string, error)
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// NewSave creates links in bulk from a JSON array of save requests or from a CSV
+// upload (text/csv body or a multipart "file" field) with the columns url, alias,
+// expires_at, ttl, team, domain, redirect_type, pass_query, interstitial and utm_source,
+// utm_medium, utm_campaign, utm_term, utm_content, the header row is required
+// and other columns are ignored.
+// Every item gets its own result, a failed item doesn't fail the others.
+// Items whose generated alias was taken are saved again with new aliases.
+// Items in the namespace of a team fail unless the policy lets the user create links there.
+// Items whose url already has a link are handled as duplicates says, like save.New
+// does, an item repeating the url of an earlier one is a duplicate of it.
+// Every valid item takes a token of the create rate limit from limiter, the
+// items left without one fail, the request is answered 429 if none got one.
+func NewSave(
+	log *slog.Logger,
+	saver URLBatchSaver,
+	finder URLFinder,
+	duplicates string,
+	aliases AliasGenerator,
+	rules AliasRules,
+	checker URLChecker,
+	policy Authorizer,
+	customDomains save.DomainFinder,
+	limiter Charger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.batch.NewSave"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+		reqs, rowErrs, err := decodeSave(r)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+
+			return
+		}
+
+		if len(reqs) == 0 || len(reqs) > maxItems {
+			log.ErrorContext(r.Context(), "invalid batch size", slog.Int("size", len(reqs)))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(fmt.Sprintf("batch must have from 1 to %d items", maxItems)))
+
+			return
+		}
+
+		// links saved by the service account have no owner
+		user, _ := auth.UserFromContext(r.Context())
+
+		now := time.Now()
+		validate := validator.New()
+		results := make([]Result, len(reqs))
+		teams := make([]string, len(reqs))
+		hosts := make([]string, len(reqs)) // custom domains
+
+		var (
+			urls  []models.URL
+			index []int // position in reqs of every url
+		)
+
+		for i, req := range reqs {
+			results[i] = Result{Index: i, URL: req.URL}
+
+			if rowErrs[i] != nil {
+				results[i].Response = resp.Error(rowErrs[i].Error())
+				continue
+			}
+
+			if err := validate.Struct(req); err != nil {
+				var validateErr validator.ValidationErrors
+				errors.As(err, &validateErr)
+
+				results[i].Response = resp.ValidationError(validateErr)
+				continue
+			}
+
+			expiresAt, err := save.Expiry(req, now)
+			if err != nil {
+				results[i].Response = resp.Error(err.Error())
+				continue
+			}
+
+			if err := save.CheckRedirectType(req.RedirectType); err != nil {
+				results[i].Response = resp.Error(err.Error())
+				continue
+			}
+
+			team, custom, err := save.CheckAlias(rules, req)
+			if err != nil {
+				results[i].Response = save.AliasError(err)
+				continue
+			}
+			teams[i] = team
+
+			hosts[i], err = save.CheckDomain(r.Context(), customDomains, policy, user, req.Domain)
+			if err != nil {
+				log.WarnContext(r.Context(), "domain rejected", slog.Int("index", i), slog.String("domain", req.Domain), sl.Err(err))
+				_, results[i].Response = save.DomainError(err)
+				continue
+			}
+
+			if err := save.CheckTeam(r.Context(), policy, user, team); err != nil {
+				log.WarnContext(r.Context(), "team rejected", slog.Int("index", i), slog.String("team", team), sl.Err(err))
+				_, results[i].Response = save.TeamError(err)
+				continue
+			}
+
+			u := save.Link(req, expiresAt)
+			u.Domain, u.Alias, u.UserID = hosts[i], models.TeamAlias(team, custom), user.ID
+			urls = append(urls, u)
+			index = append(index, i)
+		}
+
+		taken := limiter.Charge(w, r, len(urls))
+		if taken == 0 && len(urls) > 0 {
+			log.WarnContext(r.Context(), "rate limit exceeded", slog.Int("items", len(urls)))
+
+			return
+		}
+		for _, i := range index[taken:] {
+			results[i].Response = resp.Error("too many requests")
+		}
+		urls, index = urls[:taken], index[:taken]
+
+		urls, index = allowed(r.Context(), log, checker, urls, index, results)
+
+		urls, index, repeats, err := unique(r.Context(), finder, duplicates, reqs, urls, index, results, now)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to find existing urls", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URLs"))
+
+			return
+		}
+
+		// pending are positions in urls still to save, at first all of them
+		pending := make([]int, len(urls))
+		for j := range pending {
+			pending[j] = j
+		}
+
+		for attempt := 1; len(pending) > 0; attempt++ {
+			var (
+				chunk  []models.URL
+				saving []int // position in urls of every url of chunk
+				retry  []int
+			)
+
+			for _, j := range pending {
+				u := urls[j]
+				// if alias is empty, generate a new alias
+				if reqs[index[j]].Alias == "" {
+					generated, id, err := aliases.Generate(r.Context())
+					if err != nil {
+						log.ErrorContext(r.Context(), "failed to generate alias", sl.Err(err))
+						resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URLs"))
+
+						return
+					}
+
+					// a reserved or profane alias is skipped like a taken one
+					if err := rules.Generated(generated); err != nil {
+						if attempt < save.AliasAttempts {
+							retry = append(retry, j)
+						} else {
+							_, results[index[j]].Response = save.StorageError(err)
+						}
+
+						continue
+					}
+
+					u.Alias, u.ID = models.TeamAlias(teams[index[j]], generated), id
+				}
+
+				chunk = append(chunk, u)
+				saving = append(saving, j)
+			}
+
+			if len(chunk) == 0 {
+				pending = retry
+				continue
+			}
+
+			errs, err := saver.SaveURLs(r.Context(), chunk, duplicates != models.DuplicatesAllow)
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to add urls", sl.Err(err))
+				resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URLs"))
+
+				return
+			}
+
+			for k, j := range saving {
+				result := &results[index[j]]
+
+				// a generated alias may be taken by a custom one, try the next
+				generated := reqs[index[j]].Alias == ""
+				if generated && errors.Is(errs[k], storage.ErrAliasExists) && attempt < save.AliasAttempts {
+					retry = append(retry, j)
+					continue
+				}
+
+				// a concurrent save of the url came first, it is answered like one found before
+				if errors.Is(errs[k], storage.ErrURLExists) && duplicates == models.DuplicatesIdempotent {
+					var alias string
+					if !generated {
+						alias = chunk[k].Alias
+					}
+
+					existing, found, err := save.Duplicate(r.Context(), finder, duplicates, chunk[k].URL, chunk[k].Domain, chunk[k].UserID, models.TeamOf(chunk[k].Alias), alias, now)
+					if found {
+						result.Response = resp.OK()
+						result.Domain = existing.Domain
+						result.Alias = existing.Alias
+						result.ExpiresAt = existing.ExpiresAt
+
+						continue
+					}
+					if err != nil && !errors.Is(err, storage.ErrURLExists) {
+						log.ErrorContext(r.Context(), "failed to find existing url", sl.Err(err))
+						errs[k] = err
+					}
+				}
+
+				if errs[k] != nil {
+					_, result.Response = save.StorageError(errs[k])
+					continue
+				}
+
+				result.Response = resp.OK()
+				result.Domain = chunk[k].Domain
+				result.Alias = chunk[k].Alias
+				result.ExpiresAt = chunk[k].ExpiresAt
+			}
+
+			pending = retry
+		}
+
+		for i, first := range repeats {
+			results[i].Response, results[i].Domain, results[i].Alias, results[i].ExpiresAt =
+				results[first].Response, results[first].Domain, results[first].Alias, results[first].ExpiresAt
+		}
+
+		response := Response{Response: resp.OK(), Results: results}
+		for _, result := range results {
+			if result.Status == resp.StatusOk {
+				response.Succeeded++
+			} else {
+				response.Failed++
+			}
+		}
+
+		log.InfoContext(r.Context(), "urls added", slog.Int("succeeded", response.Succeeded), slog.Int("failed", response.Failed))
+
+		resp.JSON(w, r, http.StatusOK, response)
+	}
+}
+
+// allowed drops the urls the URL policy rejects and sets their results,
+// the lookups it may take for every url are made concurrently
+func allowed(
+	ctx context.Context,
+	log *slog.Logger,
+	checker URLChecker,
+	urls []models.URL,
+	index []int,
+	results []Result,
+) ([]models.URL, []int) {
+	errs := make([]error, len(urls))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, checkWorkers)
+
+	for j, u := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			errs[j] = checker.Check(ctx, u.URL)
+		}()
+	}
+
+	wg.Wait()
+
+	var (
+		keptURLs  []models.URL
+		keptIndex []int
+	)
+
+	for j, err := range errs {
+		if err != nil {
+			log.ErrorContext(ctx, "url rejected", slog.Int("index", index[j]), sl.Err(err))
+			_, results[index[j]].Response = save.PolicyError(err)
+
+			continue
+		}
+
+		keptURLs = append(keptURLs, urls[j])
+		keptIndex = append(keptIndex, index[j])
+	}
+
+	return keptURLs, keptIndex
+}
+
+// unique drops the urls that already have a link as mode says and sets their
+// results. A url listed again in the same namespace on the same domain is
+// dropped as well, the returned repeats map the position in reqs of such an
+// item to the first one.
+// The storage checks the kept urls again as it saves them, a url saved by
+// a concurrent request meanwhile fails there.
+func unique(
+	ctx context.Context,
+	finder URLFinder,
+	mode string,
+	reqs []save.Request,
+	urls []models.URL,
+	index []int,
+	results []Result,
+	now time.Time,
+) ([]models.URL, []int, map[int]int, error) {
+	if mode == models.DuplicatesAllow {
+		return urls, index, nil, nil
+	}
+
+	var (
+		keptURLs  []models.URL
+		keptIndex []int
+		repeats   = make(map[int]int)
+		firsts    = make(map[[3]string]int)
+	)
+
+	for j, u := range urls {
+		i := index[j]
+
+		// the alias asked for, generated ones aren't known yet
+		var alias string
+		if reqs[i].Alias != "" {
+			alias = u.Alias
+		}
+
+		// aliases are stored with their team by now, generated ones are empty in it
+		team := models.TeamOf(u.Alias)
+		if first, ok := firsts[[3]string{u.Domain, team, u.URL}]; ok {
+			if mode == models.DuplicatesReject || alias != "" && alias != urls[first].Alias {
+				_, results[i].Response = save.StorageError(storage.ErrURLExists)
+			} else {
+				repeats[i] = index[first]
+			}
+
+			continue
+		}
+		firsts[[3]string{u.Domain, team, u.URL}] = j
+
+		existing, found, err := save.Duplicate(ctx, finder, mode, u.URL, u.Domain, u.UserID, team, alias, now)
+		if errors.Is(err, storage.ErrURLExists) {
+			_, results[i].Response = save.StorageError(err)
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if found {
+			results[i].Response = resp.OK()
+			results[i].Domain = existing.Domain
+			results[i].Alias = existing.Alias
+			results[i].ExpiresAt = existing.ExpiresAt
+
+			continue
+		}
+
+		keptURLs = append(keptURLs, u)
+		keptIndex = append(keptIndex, i)
+	}
+
+	return keptURLs, keptIndex, repeats, nil
+}
+
+// NewDelete deletes links of one domain in bulk, each one if the policy lets the user delete it.
+// Aliases that don't exist or that the user may not delete are reported as not found.
+func NewDelete(log *slog.Logger, deleter URLBatchDeleter, policy Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.batch.NewDelete"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		var req DeleteRequest
+
+		err := render.DecodeJSON(http.MaxBytesReader(w, r.Body, maxBodyBytes), &req)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid request body"))
+
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validateErr validator.ValidationErrors
+			errors.As(err, &validateErr)
+
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.ValidationError(validateErr))
+
+			return
+		}
+
+		if len(req.Aliases) > maxItems {
+			log.ErrorContext(r.Context(), "invalid batch size", slog.Int("size", len(req.Aliases)))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(fmt.Sprintf("batch must have from 1 to %d items", maxItems)))
+
+			return
+		}
+
+		domain := strings.ToLower(req.Domain)
+
+		allowed, err := deletable(r.Context(), log, deleter, policy, user, domain, req.Aliases)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+
+		deleted, err := deleter.DeleteURLs(r.Context(), domain, allowed, nil)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to delete urls", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("unexpected error"))
+
+			return
+		}
+
+		gone := make(map[string]struct{}, len(deleted))
+		for _, alias := range deleted {
+			gone[alias] = struct{}{}
+		}
+
+		response := Response{Response: resp.OK(), Results: make([]Result, len(req.Aliases))}
+		for i, alias := range req.Aliases {
+			result := Result{Index: i, Response: resp.Error("alias not found")}
+
+			// an alias listed twice is deleted by its first occurrence
+			if _, ok := gone[alias]; ok {
+				delete(gone, alias)
+				result.Response = resp.OK()
+				response.Succeeded++
+			} else {
+				response.Failed++
+			}
+			result.Domain, result.Alias = domain, alias
+
+			response.Results[i] = result
+		}
+
+		log.InfoContext(r.Context(), "urls deleted", slog.Int("succeeded", response.Succeeded), slog.Int("failed", response.Failed))
+
+		resp.JSON(w, r, http.StatusOK, response)
+	}
+}
+
+// deletable returns the aliases of links on domain user may delete, once each.
+// Roles that can't be resolved allow only the links of the user, they need none.
+func deletable(ctx context.Context, log *slog.Logger, deleter URLBatchDeleter, policy Authorizer, user auth.User, domain string, aliases []string) ([]string, error) {
+	allowed := make([]string, 0, len(aliases))
+	seen := make(map[string]struct{}, len(aliases))
+
+	for _, alias := range aliases {
+		if _, ok := seen[alias]; ok {
+			continue
+		}
+		seen[alias] = struct{}{}
+
+		u, err := deleter.GetUrl(ctx, domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = policy.Authorize(ctx, user, authz.ActionDelete, authz.LinkOf(u))
+		if err != nil && !errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(ctx, "failed to resolve roles, taken for a user without any",
+				slog.Int64("user_id", user.ID),
+				slog.String("alias", alias),
+				sl.Err(err),
+			)
+		}
+		if err != nil {
+			continue
+		}
+
+		allowed = append(allowed, alias)
+	}
+
+	return allowed, nil
+}
+
+// decodeSave reads the items of a batch, rowErrs holds the errors of CSV rows that couldn't be parsed
+func decodeSave(r *http.Request) (reqs []save.Request, rowErrs []error, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "text/csv":
+		return decodeCSV(r.Body)
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, nil, errors.New("multipart request has no file field")
+		}
+		defer func() { _ = file.Close() }()
+
+		return decodeCSV(file)
+	default:
+		if err := render.DecodeJSON(r.Body, &reqs); err != nil {
+			return nil, nil, errors.New("invalid request body")
+		}
+
+		return reqs, make([]error, len(reqs)), nil
+	}
+}
+
+func decodeCSV(body io.Reader) ([]save.Request, []error, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.New("invalid csv: no header row")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, nil, errors.New("invalid csv: no url column")
+	}
+
+	var (
+		reqs    []save.Request
+		rowErrs []error
+	)
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid csv: %w", err)
+		}
+		if len(reqs) == maxItems {
+			return nil, nil, fmt.Errorf("batch must have from 1 to %d items", maxItems)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return record[i]
+			}
+			return ""
+		}
+
+		req := save.Request{URL: field("url"), Alias: field("alias"), Team: field("team"), TTL: field("ttl")}
+		req.Domain = field("domain")
+
+		var rowErr error
+		if raw := field("expires_at"); raw != "" {
+			expiresAt, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				rowErr = errors.New("field expires_at is not a valid RFC3339 time")
+			}
+			req.ExpiresAt = &expiresAt
+		}
+
+		if raw := field("redirect_type"); raw != "" {
+			code, err := strconv.Atoi(raw)
+			if err != nil {
+				rowErr = errors.New("field redirect_type must be one of 301, 302, 307, 308")
+			}
+			req.RedirectType = code
+		}
+
+		if raw := field("pass_query"); raw != "" {
+			passQuery, err := strconv.ParseBool(raw)
+			if err != nil {
+				rowErr = errors.New("field pass_query must be true or false")
+			}
+			req.PassQuery = passQuery
+		}
+
+		if raw := field("interstitial"); raw != "" {
+			interstitial, err := strconv.ParseBool(raw)
+			if err != nil {
+				rowErr = errors.New("field interstitial must be true or false")
+			}
+			req.Interstitial = interstitial
+		}
+
+		utm := save.UTM{
+			Source:   field("utm_source"),
+			Medium:   field("utm_medium"),
+			Campaign: field("utm_campaign"),
+			Term:     field("utm_term"),
+			Content:  field("utm_content"),
+		}
+		if utm != (save.UTM{}) {
+			req.UTM = &utm
+		}
+
+		reqs = append(reqs, req)
+		rowErrs = append(rowErrs, rowErr)
+	}
+
+	return reqs, rowErrs, nil
+}
@@ -0,0 +1,583 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/alias"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/batch/mocks"
+	savemocks "github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSaveHandler(t *testing.T) {
+	const csvBody = "url,alias,ttl\n" +
+		"https://google.com,google,\n" +
+		"https://yandex.ru,ya,24h\n" +
+		"invalid_url,bad,\n" +
+		"https://bing.com,,\n"
+
+	multipartBody := func() (string, []byte) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		fw, err := mw.CreateFormFile("file", "links.csv")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(csvBody))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		return mw.FormDataContentType(), buf.Bytes()
+	}
+	multipartType, multipartData := multipartBody()
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        []byte
+		saveErrs    []error
+		saveError   error
+		rejected    string // the URL policy rejects it
+		team        string // the policy is asked about creating links in it
+		authzError  error
+		duplicates  string            // models.DuplicatesAllow if empty
+		existing    map[string]string // aliases of the live links to urls
+		wantResults []resp.Response
+		wantDomains map[int]string // domains of the results, the primary one if missing
+		respError   string
+		wantCode    int
+	}{
+		{
+			name:     "JSON",
+			body:     []byte(`[{"url": "https://google.com", "alias": "google"}, {"url": "https://yandex.ru", "alias": "ya", "ttl": "24h"}, {"url": "invalid_url", "alias": "bad"}, {"url": "https://bing.com"}]`),
+			saveErrs: []error{nil, storage.ErrAliasExists, nil},
+			wantResults: []resp.Response{
+				{Status: resp.StatusOk, Alias: "google"},
+				{Status: resp.StatusError, Error: "alias already exists"},
+				{Status: resp.StatusError, Error: "field URL is not a valid URL"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:        "CSV",
+			contentType: "text/csv",
+			body:        []byte(csvBody),
+			saveErrs:    []error{storage.ErrURLExists, nil, nil},
+			wantResults: []resp.Response{
+				{Status: resp.StatusError, Error: "URL already exists"},
+				{Status: resp.StatusOk, Alias: "ya"},
+				{Status: resp.StatusError, Error: "field URL is not a valid URL"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:        "CSV upload",
+			contentType: multipartType,
+			body:        multipartData,
+			saveErrs:    []error{nil, nil, nil},
+			wantResults: []resp.Response{
+				{Status: resp.StatusOk, Alias: "google"},
+				{Status: resp.StatusOk, Alias: "ya"},
+				{Status: resp.StatusError, Error: "field URL is not a valid URL"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Rejected by URL policy",
+			body:     []byte(`[{"url": "https://google.com", "alias": "google"}, {"url": "ftp://files.example.com", "alias": "files"}, {"url": "https://bing.com"}]`),
+			saveErrs: []error{nil, nil},
+			rejected: "ftp://files.example.com",
+			wantResults: []resp.Response{
+				{Status: resp.StatusOk, Alias: "google"},
+				{Status: resp.StatusError, Error: "field URL must use one of the schemes http, https"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Alias rules",
+			body:     []byte(`[{"url": "https://google.com", "alias": "url"}, {"url": "https://yandex.ru", "alias": "spring", "team": "sales"}, {"url": "https://bing.com"}]`),
+			saveErrs: []error{nil, nil},
+			team:     "sales",
+			wantResults: []resp.Response{
+				{Status: resp.StatusError, Error: "field Alias is reserved"},
+				{Status: resp.StatusOk, Alias: "sales/spring"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Custom domains",
+			body:     []byte(`[{"url": "https://google.com", "alias": "promo", "domain": "go.brand.com"}, {"url": "https://yandex.ru", "alias": "promo", "domain": "other.com"}, {"url": "https://ya.ru", "domain": "their.brand.com"}, {"url": "https://bing.com"}]`),
+			saveErrs: []error{nil, nil},
+			wantResults: []resp.Response{
+				{Status: resp.StatusOk, Alias: "promo"},
+				{Status: resp.StatusError, Error: "field domain is not a known domain"},
+				{Status: resp.StatusError, Error: "only the owner of the domain may create links on it"},
+				{Status: resp.StatusOk},
+			},
+			wantDomains: map[int]string{0: "go.brand.com"},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:       "Not a member of the team",
+			body:       []byte(`[{"url": "https://yandex.ru", "alias": "spring", "team": "sales"}, {"url": "https://bing.com"}]`),
+			saveErrs:   []error{nil},
+			team:       "sales",
+			authzError: authz.ErrForbidden,
+			wantResults: []resp.Response{
+				{Status: resp.StatusError, Error: "only members of the team may create links in its namespace"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "Existing links returned",
+			body:       []byte(`[{"url": "https://google.com"}, {"url": "https://yandex.ru", "alias": "ya"}, {"url": "https://yandex.ru"}, {"url": "https://bing.com"}]`),
+			saveErrs:   []error{nil, nil},
+			duplicates: models.DuplicatesIdempotent,
+			existing:   map[string]string{"https://google.com": "goog"},
+			wantResults: []resp.Response{
+				{Status: resp.StatusOk, Alias: "goog"},
+				{Status: resp.StatusOk, Alias: "ya"},
+				{Status: resp.StatusOk, Alias: "ya"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "Duplicates rejected",
+			body:       []byte(`[{"url": "https://google.com", "alias": "google"}, {"url": "https://yandex.ru", "alias": "ya"}, {"url": "https://yandex.ru", "alias": "ya2"}, {"url": "https://bing.com"}]`),
+			saveErrs:   []error{nil, nil},
+			duplicates: models.DuplicatesReject,
+			existing:   map[string]string{"https://google.com": "goog"},
+			wantResults: []resp.Response{
+				{Status: resp.StatusError, Error: "URL already exists"},
+				{Status: resp.StatusOk, Alias: "ya"},
+				{Status: resp.StatusError, Error: "URL already exists"},
+				{Status: resp.StatusOk},
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:        "CSV without url column",
+			contentType: "text/csv",
+			body:        []byte("alias\ngoogle\n"),
+			respError:   "invalid csv: no url column",
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:      "Empty batch",
+			body:      []byte(`[]`),
+			respError: "batch must have from 1 to 1000 items",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid body",
+			body:      []byte(`{"url": "https://google.com"}`),
+			respError: "invalid request body",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Storage error",
+			body:      []byte(`[{"url": "https://google.com", "alias": "google"}]`),
+			saveError: errors.New("unexpected error"),
+			respError: "failed to add URLs",
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlBatchSaverMock := mocks.NewURLBatchSaver(t)
+			unique := tc.duplicates != "" && tc.duplicates != models.DuplicatesAllow
+
+			if tc.saveErrs != nil || tc.saveError != nil {
+				urlBatchSaverMock.On("SaveURLs", mock.Anything, mock.MatchedBy(func(urls []models.URL) bool {
+					for _, u := range urls {
+						if u.Alias == "" || u.UserID != 7 {
+							return false
+						}
+					}
+					return tc.saveError != nil || len(urls) == len(tc.saveErrs)
+				}), unique).
+					Return(tc.saveErrs, tc.saveError).
+					Once()
+			}
+
+			// the last link of the JSON and CSV bodies has no alias
+			aliasGeneratorMock := mocks.NewAliasGenerator(t)
+			if tc.saveErrs != nil {
+				aliasGeneratorMock.On("Generate", mock.Anything).Return("Ab3dE6", int64(0), nil).Once()
+			}
+
+			urlCheckerMock := mocks.NewURLChecker(t)
+			if tc.rejected != "" {
+				urlCheckerMock.On("Check", mock.Anything, tc.rejected).Return(&urlpolicy.Violation{
+					Rule:    urlpolicy.RuleScheme,
+					Message: "field URL must use one of the schemes http, https",
+				}).Once()
+			}
+			urlCheckerMock.On("Check", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			authorizerMock := mocks.NewAuthorizer(t)
+			if tc.team != "" {
+				authorizerMock.On("Authorize", mock.Anything, auth.User{ID: 7}, authz.ActionCreate, authz.Resource{Team: tc.team}).
+					Return(tc.authzError).
+					Once()
+			}
+
+			domainFinderMock := savemocks.NewDomainFinder(t)
+			domainFinderMock.On("GetDomain", mock.Anything, "go.brand.com").Return(models.Domain{Host: "go.brand.com", UserID: 7}, nil).Maybe()
+			domainFinderMock.On("GetDomain", mock.Anything, "their.brand.com").Return(models.Domain{Host: "their.brand.com", UserID: 8}, nil).Maybe()
+			authorizerMock.On("Authorize", mock.Anything, auth.User{ID: 7}, authz.ActionUseDomain, authz.Resource{Owner: 7}).Return(nil).Maybe()
+			authorizerMock.On("Authorize", mock.Anything, auth.User{ID: 7}, authz.ActionUseDomain, authz.Resource{Owner: 8}).Return(authz.ErrForbidden).Maybe()
+			domainFinderMock.On("GetDomain", mock.Anything, "other.com").Return(models.Domain{}, storage.ErrDomainNotFound).Maybe()
+
+			duplicates, urlFinderMock := tc.duplicates, mocks.NewURLFinder(t)
+			if duplicates == "" {
+				duplicates = models.DuplicatesAllow
+			}
+			for url, alias := range tc.existing {
+				urlFinderMock.On("FindURL", mock.Anything, url, "", int64(7), "", mock.AnythingOfType("time.Time")).
+					Return(models.URL{URL: url, Alias: alias}, nil).
+					Once()
+			}
+			urlFinderMock.On("FindURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				Return(models.URL{}, storage.ErrURLNotFound).
+				Maybe()
+
+			handler := NewSave(slogdiscard.NewDiscardLogger(), urlBatchSaverMock, urlFinderMock, duplicates, aliasGeneratorMock, newRules(t), urlCheckerMock, authorizerMock, domainFinderMock, unlimited(t))
+
+			req := httptest.NewRequest(http.MethodPost, "/url/batch", bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			req = req.WithContext(auth.WithUser(context.Background(), auth.User{ID: 7}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var response Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, tc.respError, response.Error)
+
+			if tc.wantResults == nil {
+				return
+			}
+
+			require.Len(t, response.Results, len(tc.wantResults))
+			for i, want := range tc.wantResults {
+				got := response.Results[i]
+				require.Equal(t, i, got.Index)
+				require.Equal(t, want.Status, got.Status, i)
+				require.Equal(t, want.Error, got.Error, i)
+				require.Equal(t, tc.wantDomains[i], got.Domain, i)
+
+				switch {
+				case want.Alias != "":
+					require.Equal(t, want.Alias, got.Alias, i)
+				case want.Status == resp.StatusOk:
+					require.NotEmpty(t, got.Alias, i)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveHandlerGeneratedAliases(t *testing.T) {
+	urlBatchSaverMock := mocks.NewURLBatchSaver(t)
+	aliasGeneratorMock := mocks.NewAliasGenerator(t)
+
+	aliasGeneratorMock.On("Generate", mock.Anything).Return("gen1", int64(11), nil).Once()
+	aliasGeneratorMock.On("Generate", mock.Anything).Return("gen2", int64(12), nil).Once()
+	aliasGeneratorMock.On("Generate", mock.Anything).Return("gen3", int64(13), nil).Once()
+	aliasGeneratorMock.On("Generate", mock.Anything).Return("gen4", int64(14), nil).Once()
+
+	// gen1 is reserved, it is skipped without saving
+	aliasRulesMock := mocks.NewAliasRules(t)
+	aliasRulesMock.On("Team", "").Return("", nil).Times(3)
+	aliasRulesMock.On("Custom", "google").Return("google", nil).Once()
+	aliasRulesMock.On("Generated", "gen1").Return(errors.New("field Alias is reserved")).Once()
+	aliasRulesMock.On("Generated", mock.Anything).Return(nil).Times(3)
+
+	// the custom alias isn't retried, the generated ones are saved again with their new ids
+	urlBatchSaverMock.On("SaveURLs", mock.Anything, []models.URL{
+		{URL: "https://google.com", Alias: "google"},
+		{ID: 12, URL: "https://bing.com", Alias: "gen2"},
+	}, false).Return([]error{storage.ErrAliasExists, storage.ErrAliasExists}, nil).Once()
+	urlBatchSaverMock.On("SaveURLs", mock.Anything, []models.URL{
+		{ID: 13, URL: "https://yandex.ru", Alias: "gen3"},
+		{ID: 14, URL: "https://bing.com", Alias: "gen4"},
+	}, false).Return([]error{nil, nil}, nil).Once()
+
+	urlCheckerMock := mocks.NewURLChecker(t)
+	urlCheckerMock.On("Check", mock.Anything, mock.Anything).Return(nil).Times(3)
+
+	handler := NewSave(slogdiscard.NewDiscardLogger(), urlBatchSaverMock, mocks.NewURLFinder(t), models.DuplicatesAllow, aliasGeneratorMock, aliasRulesMock, urlCheckerMock, mocks.NewAuthorizer(t), savemocks.NewDomainFinder(t), unlimited(t))
+
+	body := `[{"url": "https://google.com", "alias": "google"}, {"url": "https://yandex.ru"}, {"url": "https://bing.com"}]`
+	req := httptest.NewRequest(http.MethodPost, "/url/batch", strings.NewReader(body))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response Response
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Equal(t, 2, response.Succeeded)
+	require.Equal(t, 1, response.Failed)
+	require.Equal(t, "alias already exists", response.Results[0].Error)
+	require.Equal(t, "gen3", response.Results[1].Alias)
+	require.Equal(t, "gen4", response.Results[2].Alias)
+}
+
+func TestSaveHandlerRateLimit(t *testing.T) {
+	body := `[{"url": "https://google.com", "alias": "google"}, {"url": "not a url"}, {"url": "https://ya.ru", "alias": "ya"}, {"url": "https://bing.com", "alias": "bing"}]`
+
+	t.Run("Tokens for some items", func(t *testing.T) {
+		// the invalid item takes no token, the last valid one gets none
+		chargerMock := mocks.NewCharger(t)
+		chargerMock.On("Charge", mock.Anything, mock.Anything, 3).Return(2).Once()
+
+		urlBatchSaverMock := mocks.NewURLBatchSaver(t)
+		urlBatchSaverMock.On("SaveURLs", mock.Anything, []models.URL{
+			{URL: "https://google.com", Alias: "google"},
+			{URL: "https://ya.ru", Alias: "ya"},
+		}, false).Return([]error{nil, nil}, nil).Once()
+
+		urlCheckerMock := mocks.NewURLChecker(t)
+		urlCheckerMock.On("Check", mock.Anything, mock.Anything).Return(nil).Times(2)
+
+		handler := NewSave(slogdiscard.NewDiscardLogger(), urlBatchSaverMock, mocks.NewURLFinder(t), models.DuplicatesAllow, mocks.NewAliasGenerator(t), newRules(t), urlCheckerMock, mocks.NewAuthorizer(t), savemocks.NewDomainFinder(t), chargerMock)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/url/batch", strings.NewReader(body)))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response Response
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		require.Equal(t, 2, response.Succeeded)
+		require.Equal(t, 2, response.Failed)
+		require.Equal(t, "field URL is not a valid URL", response.Results[1].Error)
+		require.Equal(t, "too many requests", response.Results[3].Error)
+	})
+
+	t.Run("No tokens", func(t *testing.T) {
+		// the limiter answers the request itself
+		chargerMock := mocks.NewCharger(t)
+		chargerMock.On("Charge", mock.Anything, mock.Anything, 3).Return(func(w http.ResponseWriter, _ *http.Request, _ int) int {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return 0
+		}).Once()
+
+		handler := NewSave(slogdiscard.NewDiscardLogger(), mocks.NewURLBatchSaver(t), mocks.NewURLFinder(t), models.DuplicatesAllow, mocks.NewAliasGenerator(t), newRules(t), mocks.NewURLChecker(t), mocks.NewAuthorizer(t), savemocks.NewDomainFinder(t), chargerMock)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/url/batch", strings.NewReader(body)))
+
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	})
+}
+
+func TestDeleteHandler(t *testing.T) {
+	const userID = 7
+
+	// links are saved under google, ya and promo of go.brand.com, the policy
+	// lets the user delete the own ones only
+	links := map[[2]string]models.URL{
+		{"", "google"}:            {Alias: "google", UserID: userID},
+		{"", "ya"}:                {Alias: "ya", UserID: 8},
+		{"go.brand.com", "promo"}: {Domain: "go.brand.com", Alias: "promo", UserID: userID},
+	}
+
+	cases := []struct {
+		name        string
+		body        string
+		user        *auth.User
+		forbidden   []string
+		authzErr    error
+		wantDomain  string
+		wantDeleted []string
+		deleted     []string
+		wantFailed  []string
+		respError   string
+		wantCode    int
+	}{
+		{
+			name:        "Own links",
+			body:        `{"aliases": ["google", "ya", "google", "missing"]}`,
+			user:        &auth.User{ID: userID},
+			forbidden:   []string{"ya"},
+			wantDeleted: []string{"google"},
+			deleted:     []string{"google"},
+			wantFailed:  []string{"ya", "google", "missing"},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "Links of a custom domain",
+			body:        `{"domain": "Go.Brand.com", "aliases": ["promo", "google"]}`,
+			user:        &auth.User{ID: userID},
+			wantDomain:  "go.brand.com",
+			wantDeleted: []string{"promo"},
+			deleted:     []string{"promo"},
+			wantFailed:  []string{"google"},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "Every link allowed",
+			body:        `{"aliases": ["google", "ya"]}`,
+			user:        &auth.User{ID: 1},
+			wantDeleted: []string{"google", "ya"},
+			deleted:     []string{"google", "ya"},
+			wantCode:    http.StatusOK,
+		},
+		{
+			// links the policy can't decide on are kept
+			name:        "Policy fails",
+			body:        `{"aliases": ["google"]}`,
+			user:        &auth.User{ID: userID},
+			authzErr:    errors.New("sso is down"),
+			wantDeleted: []string{},
+			deleted:     []string{},
+			wantFailed:  []string{"google"},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:      "No aliases",
+			body:      `{"aliases": []}`,
+			user:      &auth.User{Service: true},
+			respError: "field Aliases is not a valid",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Unauthenticated",
+			body:      `{"aliases": ["google"]}`,
+			respError: "unauthorized",
+			wantCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlBatchDeleterMock := mocks.NewURLBatchDeleter(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			urlBatchDeleterMock.On("GetUrl", mock.Anything, tc.wantDomain, mock.AnythingOfType("string")).
+				Return(
+					func(_ context.Context, domain, alias string) models.URL { return links[[2]string{domain, alias}] },
+					func(_ context.Context, domain, alias string) error {
+						if _, ok := links[[2]string{domain, alias}]; !ok {
+							return storage.ErrURLNotFound
+						}
+						return nil
+					},
+				).
+				Maybe()
+			authorizerMock.On("Authorize", mock.Anything, mock.Anything, authz.ActionDelete, mock.AnythingOfType("authz.Resource")).
+				Return(func(_ context.Context, _ auth.User, _ authz.Action, res authz.Resource) error {
+					if tc.authzErr != nil {
+						return tc.authzErr
+					}
+					if res.Owner != userID && len(tc.forbidden) > 0 {
+						return authz.ErrForbidden
+					}
+					return nil
+				}).
+				Maybe()
+			if tc.deleted != nil {
+				urlBatchDeleterMock.On("DeleteURLs", mock.Anything, tc.wantDomain, tc.wantDeleted, (*int64)(nil)).
+					Return(tc.deleted, nil).
+					Once()
+			}
+
+			handler := NewDelete(slogdiscard.NewDiscardLogger(), urlBatchDeleterMock, authorizerMock)
+
+			req := httptest.NewRequest(http.MethodDelete, "/url/batch", bytes.NewReader([]byte(tc.body)))
+			if tc.user != nil {
+				req = req.WithContext(auth.WithUser(context.Background(), *tc.user))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var response Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, tc.respError, response.Error)
+
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+
+			var failed []string
+			for _, result := range response.Results {
+				require.Equal(t, tc.wantDomain, result.Domain)
+				if result.Status != resp.StatusOk {
+					require.Equal(t, "alias not found", result.Error)
+					failed = append(failed, result.Alias)
+				}
+			}
+			require.Equal(t, tc.wantFailed, failed)
+			require.Equal(t, len(tc.deleted), response.Succeeded)
+		})
+	}
+}
+
+// newRules returns the default alias rules with namespaces enabled
+// and the "url" route reserved
+func newRules(t *testing.T) *alias.Rules {
+	t.Helper()
+
+	rules, err := alias.NewRules(config.AliasRules{
+		MinLength:       1,
+		MaxLength:       64,
+		ProfanityFilter: true,
+		Namespaces:      true,
+	})
+	require.NoError(t, err)
+
+	rules.Reserve("url")
+
+	return rules
+}
+
+// unlimited gives every item of a batch a token
+func unlimited(t *testing.T) *mocks.Charger {
+	t.Helper()
+
+	chargerMock := mocks.NewCharger(t)
+	chargerMock.On("Charge", mock.Anything, mock.Anything, mock.AnythingOfType("int")).
+		Return(func(_ http.ResponseWriter, _ *http.Request, n int) int { return n }).
+		Maybe()
+
+	return chargerMock
+}
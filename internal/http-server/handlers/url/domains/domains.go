@@ -0,0 +1,352 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	customdomains "github.com/lostmyescape/url-shortener/internal/domains"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type CreateRequest struct {
+	Host string `json:"host" validate:"required"`
+	UpdateRequest
+}
+
+// UpdateRequest replaces both URLs of a domain, an empty one is cleared
+type UpdateRequest struct {
+	// DefaultURL is where the root of the domain redirects
+	DefaultURL string `json:"default_url,omitempty" validate:"omitempty,url"`
+	// NotFoundURL is where missing and expired links of the domain redirect,
+	// without it they get the not found page
+	NotFoundURL string `json:"not_found_url,omitempty" validate:"omitempty,url"`
+}
+
+type Domain struct {
+	Host        string    `json:"host"`
+	DefaultURL  string    `json:"default_url,omitempty"`
+	NotFoundURL string    `json:"not_found_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Response struct {
+	resp.Response
+	Domain Domain `json:"domain"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Domains []Domain `json:"domains"`
+}
+
+//go:generate mockery --name=DomainSaver --dir=. --output=./mocks --filename=domain_saver_mock.go --outpkg=mocks
+type DomainSaver interface {
+	SaveDomain(ctx context.Context, d models.Domain) (int64, error)
+}
+
+//go:generate mockery --name=DomainLister --dir=. --output=./mocks --filename=domain_lister_mock.go --outpkg=mocks
+type DomainLister interface {
+	ListDomains(ctx context.Context) ([]models.Domain, error)
+}
+
+//go:generate mockery --name=DomainUpdater --dir=. --output=./mocks --filename=domain_updater_mock.go --outpkg=mocks
+type DomainUpdater interface {
+	UpdateDomain(ctx context.Context, d models.Domain) (models.Domain, error)
+}
+
+//go:generate mockery --name=DomainDeleter --dir=. --output=./mocks --filename=domain_deleter_mock.go --outpkg=mocks
+type DomainDeleter interface {
+	DeleteDomain(ctx context.Context, host string) error
+}
+
+//go:generate mockery --name=URLChecker --dir=. --output=./mocks --filename=url_checker_mock.go --outpkg=mocks
+type URLChecker interface {
+	Check(ctx context.Context, rawURL string) error
+}
+
+// NewCreate adds a custom domain, its DNS must point at the service already
+func NewCreate(log *slog.Logger, saver DomainSaver, urlChecker URLChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.domains.NewCreate"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		var req CreateRequest
+		if !decode(w, r, log, &req) || !checkURLs(w, r, log, urlChecker, req.Host, req.UpdateRequest) {
+			return
+		}
+
+		d := models.Domain{
+			Host:        req.Host,
+			DefaultURL:  req.DefaultURL,
+			NotFoundURL: req.NotFoundURL,
+			UserID:      user.ID,
+			CreatedAt:   time.Now().UTC().Truncate(time.Microsecond),
+		}
+
+		id, err := saver.SaveDomain(r.Context(), d)
+		switch {
+		case errors.Is(err, customdomains.ErrInvalidHost):
+			log.InfoContext(r.Context(), "invalid host", slog.String("host", req.Host))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("field host is not a valid host name"))
+
+			return
+		case errors.Is(err, customdomains.ErrPrimaryHost):
+			log.InfoContext(r.Context(), "primary host", slog.String("host", req.Host))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("field host is the primary domain"))
+
+			return
+		case errors.Is(err, storage.ErrDomainExists):
+			log.InfoContext(r.Context(), "domain already exists", slog.String("host", req.Host))
+			resp.JSON(w, r, http.StatusConflict, resp.Error("domain already exists"))
+
+			return
+		case err != nil:
+			log.ErrorContext(r.Context(), "failed to save domain", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add domain"))
+
+			return
+		}
+
+		// the saver normalizes the host
+		d.Host, _ = customdomains.Host(d.Host)
+
+		log.InfoContext(r.Context(), "domain added", slog.Int64("id", id), slog.String("host", d.Host), slog.Int64("user_id", user.ID))
+
+		resp.JSON(w, r, http.StatusCreated, Response{Response: resp.OK(), Domain: domainOf(d)})
+	}
+}
+
+// NewList returns every custom domain
+func NewList(log *slog.Logger, lister DomainLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.domains.NewList"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		domains, err := lister.ListDomains(r.Context())
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to list domains", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		response := ListResponse{Response: resp.OK(), Domains: make([]Domain, 0, len(domains))}
+		for _, d := range domains {
+			response.Domains = append(response.Domains, domainOf(d))
+		}
+
+		resp.JSON(w, r, http.StatusOK, response)
+	}
+}
+
+// NewUpdate replaces the default and the not found URL of the domain {host}
+func NewUpdate(log *slog.Logger, updater DomainUpdater, urlChecker URLChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.domains.NewUpdate"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		host, ok := hostParam(w, r, log)
+		if !ok {
+			return
+		}
+
+		var req UpdateRequest
+		if !decode(w, r, log, &req) || !checkURLs(w, r, log, urlChecker, host, req) {
+			return
+		}
+
+		d, err := updater.UpdateDomain(r.Context(), models.Domain{
+			Host:        host,
+			DefaultURL:  req.DefaultURL,
+			NotFoundURL: req.NotFoundURL,
+		})
+		if errors.Is(err, storage.ErrDomainNotFound) {
+			log.InfoContext(r.Context(), "domain not found", slog.String("host", host))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("domain not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to update domain", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to update domain"))
+
+			return
+		}
+
+		log.InfoContext(r.Context(), "domain updated", slog.String("host", host))
+
+		resp.JSON(w, r, http.StatusOK, Response{Response: resp.OK(), Domain: domainOf(d)})
+	}
+}
+
+// NewDelete removes the domain {host}, its links are kept but aren't served
+// until the domain is added again
+func NewDelete(log *slog.Logger, deleter DomainDeleter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.domains.NewDelete"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		host, ok := hostParam(w, r, log)
+		if !ok {
+			return
+		}
+
+		err := deleter.DeleteDomain(r.Context(), host)
+		if errors.Is(err, storage.ErrDomainNotFound) {
+			log.InfoContext(r.Context(), "domain not found", slog.String("host", host))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("domain not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to delete domain", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to delete domain"))
+
+			return
+		}
+
+		log.InfoContext(r.Context(), "domain deleted", slog.String("host", host))
+
+		resp.JSON(w, r, http.StatusOK, resp.OK())
+	}
+}
+
+// hostParam returns the normalized {host} URL parameter. URLFormat takes the
+// last label of a host for a file extension, it is put back.
+func hostParam(w http.ResponseWriter, r *http.Request, log *slog.Logger) (string, bool) {
+	raw := chi.URLParam(r, "host")
+	if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); format != "" {
+		raw += "." + format
+	}
+
+	host, err := customdomains.Host(raw)
+	if err != nil {
+		log.InfoContext(r.Context(), "invalid host", slog.String("host", raw))
+		resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid host"))
+
+		return "", false
+	}
+
+	return host, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, req any) bool {
+	if err := render.DecodeJSON(r.Body, req); err != nil {
+		log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+		resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid request body"))
+
+		return false
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		var validateErr validator.ValidationErrors
+		errors.As(err, &validateErr)
+
+		log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+		resp.JSON(w, r, http.StatusBadRequest, resp.ValidationError(validateErr))
+
+		return false
+	}
+
+	return true
+}
+
+// checkURLs applies the URL policy of links to the URLs of the domain
+// served at host. The policy knows the registered domains only, a domain
+// being added could redirect to itself without the check of its own host.
+func checkURLs(w http.ResponseWriter, r *http.Request, log *slog.Logger, urlChecker URLChecker, host string, req UpdateRequest) bool {
+	host, _ = customdomains.Host(host)
+
+	for _, u := range []struct{ field, url string }{
+		{"DefaultURL", req.DefaultURL},
+		{"NotFoundURL", req.NotFoundURL},
+	} {
+		if u.url == "" {
+			continue
+		}
+
+		err := urlChecker.Check(r.Context(), u.url)
+		if err == nil && host != "" && pointsTo(u.url, host) {
+			err = &urlpolicy.Violation{Rule: urlpolicy.RuleLoop, Message: "field URL must not point to the domain itself"}
+		}
+		if err == nil {
+			continue
+		}
+
+		var violation *urlpolicy.Violation
+		if errors.As(err, &violation) {
+			log.InfoContext(r.Context(), "url rejected by policy", slog.String("url", u.url), slog.String("rule", violation.Rule))
+			resp.JSON(w, r, http.StatusBadRequest, resp.FieldErrors(resp.FieldError{
+				Field:   u.field,
+				Rule:    violation.Rule,
+				Message: violation.Message,
+			}))
+
+			return false
+		}
+
+		log.ErrorContext(r.Context(), "failed to check url", sl.Err(err))
+		resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check URL"))
+
+		return false
+	}
+
+	return true
+}
+
+// pointsTo reports whether rawURL is a link to host
+func pointsTo(rawURL, host string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	urlHost, err := customdomains.Host(u.Hostname())
+
+	return err == nil && urlHost == host
+}
+
+func domainOf(d models.Domain) Domain {
+	return Domain{
+		Host:        d.Host,
+		DefaultURL:  d.DefaultURL,
+		NotFoundURL: d.NotFoundURL,
+		CreatedAt:   d.CreatedAt,
+	}
+}
@@ -0,0 +1,229 @@
+package domains
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	customdomains "github.com/lostmyescape/url-shortener/internal/domains"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/domains/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var admin = auth.User{ID: 42}
+
+func TestCreate(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		checkError error
+		saveError  error
+		respError  string
+		wantCode   int
+		wantHost   string
+	}{
+		{
+			name:     "Success",
+			body:     `{"host":"Go.Brand.com","default_url":"https://brand.com","not_found_url":"https://brand.com/404"}`,
+			wantCode: http.StatusCreated,
+			wantHost: "go.brand.com",
+		},
+		{
+			name:      "Empty host",
+			body:      `{"default_url":"https://brand.com"}`,
+			respError: "field Host is a required field",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid default URL",
+			body:      `{"host":"go.brand.com","default_url":"brand"}`,
+			respError: "field DefaultURL is not a valid URL",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:       "URL rejected by policy",
+			body:       `{"host":"go.brand.com","not_found_url":"https://evil.example"}`,
+			checkError: &urlpolicy.Violation{Rule: "blocked_domain", Message: "domain is blocked"},
+			respError:  "domain is blocked",
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:      "URL to the domain itself",
+			body:      `{"host":"Go.Brand.com","default_url":"https://go.brand.com./promo"}`,
+			respError: "field URL must not point to the domain itself",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid host",
+			body:      `{"host":"go brand"}`,
+			saveError: customdomains.ErrInvalidHost,
+			respError: "field host is not a valid host name",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Primary host",
+			body:      `{"host":"sho.rt"}`,
+			saveError: customdomains.ErrPrimaryHost,
+			respError: "field host is the primary domain",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Domain exists",
+			body:      `{"host":"go.brand.com"}`,
+			saveError: storage.ErrDomainExists,
+			respError: "domain already exists",
+			wantCode:  http.StatusConflict,
+		},
+		{
+			name:      "Save fails",
+			body:      `{"host":"go.brand.com"}`,
+			saveError: errors.New("database is down"),
+			respError: "failed to add domain",
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			saverMock := mocks.NewDomainSaver(t)
+			checkerMock := mocks.NewURLChecker(t)
+
+			checkerMock.On("Check", mock.Anything, mock.AnythingOfType("string")).Return(tc.checkError).Maybe()
+			if tc.wantCode == http.StatusCreated || tc.saveError != nil {
+				saverMock.On("SaveDomain", mock.Anything, mock.MatchedBy(func(d models.Domain) bool {
+					return d.UserID == admin.ID && !d.CreatedAt.IsZero()
+				})).Return(int64(1), tc.saveError).Once()
+			}
+
+			handler := NewCreate(slogdiscard.NewDiscardLogger(), saverMock, checkerMock)
+
+			req := httptest.NewRequest(http.MethodPost, "/url/domains", bytes.NewReader([]byte(tc.body)))
+			req = req.WithContext(auth.WithUser(req.Context(), admin))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var body Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			require.Equal(t, tc.respError, body.Error)
+
+			if tc.wantCode == http.StatusCreated {
+				require.Equal(t, tc.wantHost, body.Domain.Host)
+				require.Equal(t, "https://brand.com", body.Domain.DefaultURL)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	listerMock := mocks.NewDomainLister(t)
+	listerMock.On("ListDomains", mock.Anything).Return([]models.Domain{
+		{ID: 1, Host: "go.brand.com", DefaultURL: "https://brand.com", UserID: 42, CreatedAt: created},
+	}, nil).Once()
+
+	handler := NewList(slogdiscard.NewDiscardLogger(), listerMock)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/url/domains", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var body ListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.Equal(t, []Domain{{Host: "go.brand.com", DefaultURL: "https://brand.com", CreatedAt: created}}, body.Domains)
+}
+
+func TestUpdate(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		body        string
+		updateError error
+		respError   string
+		wantCode    int
+	}{
+		{name: "Success", path: "/url/domains/Go.Brand.com", body: `{"default_url":"https://brand.com/new"}`, wantCode: http.StatusOK},
+		{
+			name:        "Not found",
+			path:        "/url/domains/go.brand.com",
+			body:        `{}`,
+			updateError: storage.ErrDomainNotFound,
+			respError:   "domain not found",
+			wantCode:    http.StatusNotFound,
+		},
+		{name: "Invalid host", path: "/url/domains/go_brand.com", body: `{}`, respError: "invalid host", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			updaterMock := mocks.NewDomainUpdater(t)
+			checkerMock := mocks.NewURLChecker(t)
+
+			checkerMock.On("Check", mock.Anything, mock.AnythingOfType("string")).Return(nil).Maybe()
+			if tc.wantCode != http.StatusBadRequest {
+				updaterMock.On("UpdateDomain", mock.Anything, mock.MatchedBy(func(d models.Domain) bool {
+					return d.Host == "go.brand.com"
+				})).Return(models.Domain{Host: "go.brand.com", DefaultURL: "https://brand.com/new"}, tc.updateError).Once()
+			}
+
+			// the router strips ".com" like the one of the service does
+			r := chi.NewRouter()
+			r.Use(middleware.URLFormat)
+			r.Put("/url/domains/{host}", NewUpdate(slogdiscard.NewDiscardLogger(), updaterMock, checkerMock))
+
+			req := httptest.NewRequest(http.MethodPut, tc.path, bytes.NewReader([]byte(tc.body)))
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var body Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			require.Equal(t, tc.respError, body.Error)
+
+			if tc.wantCode == http.StatusOK {
+				require.Equal(t, "https://brand.com/new", body.Domain.DefaultURL)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	deleterMock := mocks.NewDomainDeleter(t)
+	deleterMock.On("DeleteDomain", mock.Anything, "go.brand.com").Return(nil).Once()
+	deleterMock.On("DeleteDomain", mock.Anything, "old.brand.com").Return(storage.ErrDomainNotFound).Once()
+
+	r := chi.NewRouter()
+	r.Use(middleware.URLFormat)
+	r.Delete("/url/domains/{host}", NewDelete(slogdiscard.NewDiscardLogger(), deleterMock))
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/url/domains/go.brand.com", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/url/domains/old.brand.com", nil))
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
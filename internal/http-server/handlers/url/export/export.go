@@ -0,0 +1,251 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// pageSize is the number of links read from storage at once
+const pageSize = 1000
+
+// Link is a line of the NDJSON export
+type Link struct {
+	Domain       string     `json:"domain,omitempty"`
+	Alias        string     `json:"alias"`
+	URL          string     `json:"url"`
+	UserID       int64      `json:"user_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Clicks       int64      `json:"clicks"`
+	RedirectType int        `json:"redirect_type"`
+	PassQuery    bool       `json:"pass_query,omitempty"`
+	UTM          *save.UTM  `json:"utm,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+}
+
+// csvHeader is also accepted by the CSV import of POST /url/batch
+var csvHeader = []string{
+	"alias", "url", "user_id", "created_at", "expires_at", "clicks", "redirect_type", "pass_query",
+	"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "interstitial", "domain",
+}
+
+//go:generate mockery --name=URLLister --dir=. --output=./mocks --filename=url_lister_mock.go --outpkg=mocks
+type URLLister interface {
+	ListURLs(ctx context.Context, filter models.URLFilter) (models.URLPage, error)
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// New streams links as CSV (default) or NDJSON, selected by the format query parameter.
+// Users export their own links, the ones the policy lets list anyone's export every
+// link or the links of the user given in the owner query parameter.
+func New(log *slog.Logger, lister URLLister, policy Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.export.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "":
+			format = FormatCSV
+		case FormatCSV, FormatNDJSON:
+		default:
+			log.ErrorContext(r.Context(), "invalid format", slog.String("format", format))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("field format must be csv or ndjson"))
+
+			return
+		}
+
+		filter := models.URLFilter{SortBy: models.SortByCreated, Limit: pageSize}
+
+		if raw := r.URL.Query().Get("owner"); raw != "" {
+			owner, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid owner", sl.Err(err))
+				resp.JSON(w, r, http.StatusBadRequest, resp.Error("field owner is not a valid user id"))
+
+				return
+			}
+			filter.UserID = &owner
+		}
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		owner, err := authz.Owner(r.Context(), log, policy, user, authz.ActionList, filter.UserID)
+		if errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(r.Context(), "user may export only own links", slog.Int64("user_id", user.ID))
+			resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+		filter.UserID = owner
+
+		// the first page is read before anything is written so a storage
+		// failure can still be answered with a proper error
+		page, err := lister.ListURLs(r.Context(), filter)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to list urls", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		var enc encoder
+		if format == FormatNDJSON {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc = &ndjsonEncoder{enc: json.NewEncoder(w)}
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			enc = newCSVEncoder(w)
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+
+		flusher, _ := w.(http.Flusher)
+
+		var exported int
+		for {
+			for _, u := range page.URLs {
+				if err := enc.Encode(u); err != nil {
+					log.ErrorContext(r.Context(), "failed to write link", sl.Err(err))
+					return
+				}
+			}
+			exported += len(page.URLs)
+
+			// send every page as soon as it is read
+			if err := enc.Flush(); err != nil {
+				log.ErrorContext(r.Context(), "failed to write links", sl.Err(err))
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			if page.Next == nil {
+				break
+			}
+
+			filter.After = page.Next
+
+			page, err = lister.ListURLs(r.Context(), filter)
+			if err != nil {
+				// the status is already sent, the client gets a truncated file
+				log.ErrorContext(r.Context(), "failed to list urls", slog.Int("exported", exported), sl.Err(err))
+				return
+			}
+		}
+
+		log.InfoContext(r.Context(), "urls exported", slog.Int("count", exported), slog.String("format", format))
+	}
+}
+
+type encoder interface {
+	Encode(u models.URL) error
+	Flush() error
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(u models.URL) error {
+	return e.enc.Encode(Link{
+		Domain:       u.Domain,
+		Alias:        u.Alias,
+		URL:          u.URL,
+		UserID:       u.UserID,
+		CreatedAt:    u.CreatedAt,
+		ExpiresAt:    u.ExpiresAt,
+		Clicks:       u.Clicks,
+		RedirectType: u.RedirectType,
+		PassQuery:    u.PassQuery,
+		UTM:          save.UTMOf(u.UTM),
+		Interstitial: u.Interstitial,
+	})
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w http.ResponseWriter) *csvEncoder {
+	e := &csvEncoder{w: csv.NewWriter(w)}
+	// a write error is buffered and reported by Flush
+	_ = e.w.Write(csvHeader)
+
+	return e
+}
+
+func (e *csvEncoder) Encode(u models.URL) error {
+	var expiresAt string
+	if u.ExpiresAt != nil {
+		expiresAt = u.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	return e.w.Write([]string{
+		u.Alias,
+		u.URL,
+		strconv.FormatInt(u.UserID, 10),
+		u.CreatedAt.UTC().Format(time.RFC3339),
+		expiresAt,
+		strconv.FormatInt(u.Clicks, 10),
+		strconv.Itoa(u.RedirectType),
+		strconv.FormatBool(u.PassQuery),
+		u.UTM.Source,
+		u.UTM.Medium,
+		u.UTM.Campaign,
+		u.UTM.Term,
+		u.UTM.Content,
+		strconv.FormatBool(u.Interstitial),
+		u.Domain,
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
@@ -0,0 +1,159 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/export/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportHandler(t *testing.T) {
+	const userID = 7
+
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := models.URLPage{
+		URLs: []models.URL{{ID: 1, Alias: "google", URL: "https://google.com", UserID: userID, CreatedAt: createdAt, RedirectType: 302}},
+		Next: &models.URLCursor{ID: 1, CreatedAt: createdAt},
+	}
+	second := models.URLPage{
+		URLs: []models.URL{{
+			ID: 2, Domain: "go.brand.com", Alias: "ya", URL: "https://yandex.ru", UserID: userID, CreatedAt: createdAt, Clicks: 3, RedirectType: 301,
+			PassQuery: true, UTM: models.UTM{Source: "mail", Campaign: "spring"},
+		}},
+	}
+
+	cases := []struct {
+		name      string
+		query     string
+		user      *auth.User
+		authzErr  error
+		wantOwner *int64
+		listError error
+		wantLines []string
+		respError string
+		wantCode  int
+	}{
+		{
+			name:      "CSV of own links",
+			user:      &auth.User{ID: userID},
+			authzErr:  authz.ErrForbidden,
+			wantOwner: ptr(int64(userID)),
+			wantLines: []string{
+				"alias,url,user_id,created_at,expires_at,clicks,redirect_type,pass_query," +
+					"utm_source,utm_medium,utm_campaign,utm_term,utm_content,interstitial,domain",
+				"google,https://google.com,7,2025-03-01T12:00:00Z,,0,302,false,,,,,,false,",
+				"ya,https://yandex.ru,7,2025-03-01T12:00:00Z,,3,301,true,mail,,spring,,,false,go.brand.com",
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "NDJSON of every link",
+			query: "?format=ndjson",
+			user:  &auth.User{Service: true},
+			wantLines: []string{
+				`{"alias":"google","url":"https://google.com","user_id":7,"created_at":"2025-03-01T12:00:00Z","clicks":0,"redirect_type":302}`,
+				`{"domain":"go.brand.com","alias":"ya","url":"https://yandex.ru","user_id":7,"created_at":"2025-03-01T12:00:00Z","clicks":3,"redirect_type":301,` +
+					`"pass_query":true,"utm":{"source":"mail","campaign":"spring"}}`,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "Other user",
+			query:     "?owner=8",
+			user:      &auth.User{ID: userID},
+			authzErr:  authz.ErrForbidden,
+			respError: "forbidden",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:      "Invalid format",
+			query:     "?format=xml",
+			user:      &auth.User{Service: true},
+			respError: "field format must be csv or ndjson",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Storage error",
+			user:      &auth.User{Service: true},
+			listError: errors.New("unexpected error"),
+			respError: "internal error",
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlListerMock := mocks.NewURLLister(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			authorizerMock.On("Authorize", mock.Anything, *tc.user, authz.ActionList, mock.AnythingOfType("authz.Resource")).
+				Return(tc.authzErr).
+				Maybe()
+
+			ownedBy := func(f models.URLFilter) bool {
+				if tc.wantOwner == nil {
+					return f.UserID == nil
+				}
+				return f.UserID != nil && *f.UserID == *tc.wantOwner
+			}
+
+			if tc.listError != nil {
+				urlListerMock.On("ListURLs", mock.Anything, mock.Anything).
+					Return(models.URLPage{}, tc.listError).
+					Once()
+			}
+			if tc.wantLines != nil {
+				urlListerMock.On("ListURLs", mock.Anything, mock.MatchedBy(func(f models.URLFilter) bool {
+					return ownedBy(f) && f.After == nil
+				})).Return(first, nil).Once()
+				urlListerMock.On("ListURLs", mock.Anything, mock.MatchedBy(func(f models.URLFilter) bool {
+					return ownedBy(f) && f.After != nil && f.After.ID == 1
+				})).Return(second, nil).Once()
+			}
+
+			handler := New(slogdiscard.NewDiscardLogger(), urlListerMock, authorizerMock)
+
+			req := httptest.NewRequest(http.MethodGet, "/url/export"+tc.query, nil)
+			req = req.WithContext(auth.WithUser(context.Background(), *tc.user))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			if tc.wantCode != http.StatusOK {
+				var response resp.Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				require.Equal(t, tc.respError, response.Error)
+
+				return
+			}
+
+			var lines []string
+			scanner := bufio.NewScanner(rr.Body)
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			require.Equal(t, tc.wantLines, lines)
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
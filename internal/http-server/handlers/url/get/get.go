@@ -0,0 +1,127 @@
+package get
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/api/etag"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type Response struct {
+	resp.Response
+	Domain       string     `json:"domain,omitempty"`
+	URL          string     `json:"url,omitempty"`
+	UserID       int64      `json:"user_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	PassQuery    bool       `json:"pass_query,omitempty"`
+	UTM          *save.UTM  `json:"utm,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	Revision     int64      `json:"revision,omitempty"`
+}
+
+//go:generate mockery --name=URLGetter --dir=. --output=./mocks --filename=url_getter_mock.go --outpkg=mocks
+type URLGetter interface {
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// New returns a link with its ETag to send back in If-Match on update.
+// The link is read with getter, which must not be cached, so the ETag is current.
+// The link is shown to whoever the policy lets update it.
+func New(log *slog.Logger, getter URLGetter, policy Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.get.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		domain, alias := chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
+		if alias == "" {
+			log.ErrorContext(r.Context(), "alias is empty")
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+
+			return
+		}
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		url, err := getter.GetUrl(r.Context(), domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.InfoContext(r.Context(), "alias not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get url", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("unexpected error"))
+
+			return
+		}
+
+		err = policy.Authorize(r.Context(), user, authz.ActionUpdate, authz.LinkOf(url))
+		if errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(r.Context(), "user may not view the url",
+				slog.Int64("user_id", user.ID),
+				slog.Int64("owner_id", url.UserID),
+			)
+			resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+
+		responseOk(w, r, url)
+	}
+}
+
+func responseOk(w http.ResponseWriter, r *http.Request, u models.URL) {
+	w.Header().Set("ETag", etag.Of(u.Revision))
+
+	response := Response{
+		Response:     resp.OK(),
+		Domain:       u.Domain,
+		URL:          u.URL,
+		UserID:       u.UserID,
+		CreatedAt:    u.CreatedAt,
+		ExpiresAt:    u.ExpiresAt,
+		RedirectType: u.RedirectType,
+		PassQuery:    u.PassQuery,
+		UTM:          save.UTMOf(u.UTM),
+		Interstitial: u.Interstitial,
+		Revision:     u.Revision,
+	}
+	response.Alias = u.Alias
+
+	resp.JSON(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,108 @@
+package get
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/get/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetHandler(t *testing.T) {
+	const ownerID = 7
+
+	link := models.URL{Alias: "google", URL: "https://google.com", UserID: ownerID, RedirectType: 301, Revision: 4}
+
+	cases := []struct {
+		name      string
+		user      *auth.User
+		getError  error
+		forbidden bool
+		respError string
+		wantCode  int
+	}{
+		{
+			name:     "Owner",
+			user:     &auth.User{ID: ownerID},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "Other user",
+			user:      &auth.User{ID: 8},
+			forbidden: true,
+			respError: "forbidden",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:      "Alias not found",
+			user:      &auth.User{ID: ownerID},
+			getError:  storage.ErrURLNotFound,
+			respError: "alias not found",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "Unauthenticated",
+			respError: "unauthorized",
+			wantCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlGetterMock := mocks.NewURLGetter(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			if tc.user != nil {
+				urlGetterMock.On("GetUrl", mock.Anything, "", "google").
+					Return(link, tc.getError).
+					Once()
+			}
+			if tc.user != nil && tc.getError == nil {
+				var authzError error
+				if tc.forbidden {
+					authzError = authz.ErrForbidden
+				}
+				authorizerMock.On("Authorize", mock.Anything, *tc.user, authz.ActionUpdate, authz.Resource{Owner: ownerID}).
+					Return(authzError).
+					Once()
+			}
+
+			r := chi.NewRouter()
+			r.Get("/url/{alias}", New(slogdiscard.NewDiscardLogger(), urlGetterMock, authorizerMock))
+
+			req := httptest.NewRequest(http.MethodGet, "/url/google", nil)
+			if tc.user != nil {
+				req = req.WithContext(auth.WithUser(context.Background(), *tc.user))
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+
+			if tc.wantCode == http.StatusOK {
+				require.Equal(t, `"4"`, rr.Header().Get("ETag"))
+				require.Equal(t, int64(4), resp.Revision)
+				require.Equal(t, "google", resp.Alias)
+				require.Equal(t, "https://google.com", resp.URL)
+				require.Equal(t, 301, resp.RedirectType)
+			}
+		})
+	}
+}
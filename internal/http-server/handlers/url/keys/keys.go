@@ -0,0 +1,298 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/lostmyescape/url-shortener/internal/apikey"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CreateRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// Scopes are one or more of models.Scopes
+	Scopes []string `json:"scopes"`
+	// ExpiresAt and TTL work like the ones of a link, a key without them never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+}
+
+// Key describes an API key, the key itself is only returned on creation
+type Key struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateResponse struct {
+	resp.Response
+	// Key is the secret to send in X-API-Key or as a Bearer token, it can't be shown again
+	Key    string `json:"key"`
+	APIKey Key    `json:"api_key"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Keys []Key `json:"keys"`
+}
+
+type RevokeResponse struct {
+	resp.Response
+	APIKey Key `json:"api_key"`
+}
+
+//go:generate mockery --name=KeySaver --dir=. --output=./mocks --filename=key_saver_mock.go --outpkg=mocks
+type KeySaver interface {
+	SaveAPIKey(ctx context.Context, k models.APIKey) (int64, error)
+}
+
+//go:generate mockery --name=KeyLister --dir=. --output=./mocks --filename=key_lister_mock.go --outpkg=mocks
+type KeyLister interface {
+	ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+}
+
+//go:generate mockery --name=KeyRevoker --dir=. --output=./mocks --filename=key_revoker_mock.go --outpkg=mocks
+type KeyRevoker interface {
+	RevokeAPIKey(ctx context.Context, id int64, userID *int64, at time.Time) (models.APIKey, error)
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// NewCreate issues a key acting as the caller, keys of the service account
+// may manage every link like the shared basic auth pair does
+func NewCreate(log *slog.Logger, saver KeySaver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.keys.NewCreate"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		user, ok := manager(w, r, log)
+		if !ok {
+			return
+		}
+
+		var req CreateRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid request body"))
+
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validateErr validator.ValidationErrors
+			errors.As(err, &validateErr)
+
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.ValidationError(validateErr))
+
+			return
+		}
+
+		if err := checkScopes(req.Scopes); err != nil {
+			log.ErrorContext(r.Context(), "invalid scopes", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+
+			return
+		}
+
+		expiresAt, err := save.Expiry(save.Request{ExpiresAt: req.ExpiresAt, TTL: req.TTL}, time.Now())
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid expiry", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+
+			return
+		}
+
+		// the order of the scopes doesn't matter, a scope listed twice is kept once
+		scopes := slices.Compact(slices.Sorted(slices.Values(req.Scopes)))
+
+		key, k, err := apikey.New(req.Name, scopes, user.ID, expiresAt)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to generate api key", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to create api key"))
+
+			return
+		}
+		k.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+		k.ID, err = saver.SaveAPIKey(r.Context(), k)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to save api key", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to create api key"))
+
+			return
+		}
+
+		log.InfoContext(r.Context(), "api key created", slog.Int64("key_id", k.ID), slog.Int64("user_id", user.ID), slog.Any("scopes", scopes))
+
+		resp.JSON(w, r, http.StatusCreated, CreateResponse{Response: resp.OK(), Key: key, APIKey: keyOf(k)})
+	}
+}
+
+// NewList returns the keys of the caller, revoked and expired ones included
+func NewList(log *slog.Logger, lister KeyLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.keys.NewList"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		user, ok := manager(w, r, log)
+		if !ok {
+			return
+		}
+
+		keys, err := lister.ListAPIKeys(r.Context(), user.ID)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to list api keys", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		response := ListResponse{Response: resp.OK(), Keys: make([]Key, 0, len(keys))}
+		for _, k := range keys {
+			response.Keys = append(response.Keys, keyOf(k))
+		}
+
+		resp.JSON(w, r, http.StatusOK, response)
+	}
+}
+
+// NewRevoke revokes the key {id}, users may revoke only their own keys
+// unless the policy lets them revoke anyone's
+func NewRevoke(log *slog.Logger, revoker KeyRevoker, policy Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.keys.NewRevoke"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		user, ok := manager(w, r, log)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			log.ErrorContext(r.Context(), "invalid key id", slog.String("id", chi.URLParam(r, "id")))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid key id"))
+
+			return
+		}
+
+		owner, err := authz.Owner(r.Context(), log, policy, user, authz.ActionRevokeKey, nil)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+
+		k, err := revoker.RevokeAPIKey(r.Context(), id, owner, time.Now())
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			log.InfoContext(r.Context(), "api key not found", slog.Int64("key_id", id))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("api key not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to revoke api key", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		log.InfoContext(r.Context(), "api key revoked", slog.Int64("key_id", id), slog.Int64("user_id", user.ID))
+
+		resp.JSON(w, r, http.StatusOK, RevokeResponse{Response: resp.OK(), APIKey: keyOf(k)})
+	}
+}
+
+// manager returns the caller if it may manage keys, a key can't
+// manage keys or it could issue itself scopes it doesn't have
+func manager(w http.ResponseWriter, r *http.Request, log *slog.Logger) (auth.User, bool) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		log.ErrorContext(r.Context(), "no authenticated user")
+		resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+		return auth.User{}, false
+	}
+
+	if user.KeyID != 0 {
+		log.WarnContext(r.Context(), "api key used to manage api keys", slog.Int64("key_id", user.KeyID))
+		resp.JSON(w, r, http.StatusForbidden, resp.Error("api keys can't manage api keys"))
+
+		return auth.User{}, false
+	}
+
+	return user, true
+}
+
+// checkScopes requires at least one scope and only known ones
+func checkScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("field scopes must list at least one of %s", strings.Join(models.Scopes, ", "))
+	}
+
+	for _, scope := range scopes {
+		if !models.ValidScope(scope) {
+			return fmt.Errorf("field scopes: unknown scope %q, scopes are %s", scope, strings.Join(models.Scopes, ", "))
+		}
+	}
+
+	return nil
+}
+
+func keyOf(k models.APIKey) Key {
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return Key{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     scopes,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
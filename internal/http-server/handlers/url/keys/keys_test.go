@@ -0,0 +1,264 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/apikey"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/keys/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var (
+	sso     = auth.User{ID: 42}
+	service = auth.User{Service: true}
+	byKey   = auth.User{ID: 42, KeyID: 7, Scopes: []string{models.ScopeLinksWrite}}
+)
+
+func TestCreate(t *testing.T) {
+	cases := []struct {
+		name      string
+		user      auth.User
+		body      string
+		saveError error
+		respError string
+		wantCode  int
+		wantOwner int64
+	}{
+		{
+			name:      "Success",
+			user:      sso,
+			body:      `{"name":"deploy","scopes":["stats:read","links:write","stats:read"],"ttl":"720h"}`,
+			wantCode:  http.StatusCreated,
+			wantOwner: 42,
+		},
+		{
+			name:     "Service account key",
+			user:     service,
+			body:     `{"name":"cron","scopes":["links:delete"]}`,
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:      "Unknown scope",
+			user:      sso,
+			body:      `{"name":"deploy","scopes":["links:admin"]}`,
+			respError: `field scopes: unknown scope "links:admin", scopes are links:read, links:write, links:delete, stats:read`,
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "No scopes",
+			user:      sso,
+			body:      `{"name":"deploy","scopes":[]}`,
+			respError: "field scopes must list at least one of links:read, links:write, links:delete, stats:read",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Expiry in the past",
+			user:      sso,
+			body:      `{"name":"deploy","scopes":["stats:read"],"expires_at":"2020-01-01T00:00:00Z"}`,
+			respError: "field expires_at must be in the future",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Key can't create keys",
+			user:      byKey,
+			body:      `{"name":"deploy","scopes":["stats:read"]}`,
+			respError: "api keys can't manage api keys",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:      "Save fails",
+			user:      sso,
+			body:      `{"name":"deploy","scopes":["stats:read"]}`,
+			saveError: errors.New("database is down"),
+			respError: "failed to create api key",
+			wantCode:  http.StatusInternalServerError,
+			wantOwner: 42,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			saverMock := mocks.NewKeySaver(t)
+
+			var saved models.APIKey
+			if tc.wantCode == http.StatusCreated || tc.saveError != nil {
+				saverMock.On("SaveAPIKey", mock.Anything, mock.AnythingOfType("models.APIKey")).
+					Run(func(args mock.Arguments) { saved = args.Get(1).(models.APIKey) }).
+					Return(int64(3), tc.saveError).Once()
+			}
+
+			handler := NewCreate(slogdiscard.NewDiscardLogger(), saverMock)
+
+			req := httptest.NewRequest(http.MethodPost, "/url/keys", bytes.NewReader([]byte(tc.body)))
+			req = req.WithContext(auth.WithUser(req.Context(), tc.user))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			if tc.wantCode != http.StatusCreated {
+				var body resp.Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				require.Equal(t, tc.respError, body.Error)
+
+				return
+			}
+
+			var body CreateResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+
+			require.True(t, apikey.IsKey(body.Key))
+			require.Equal(t, apikey.Hash(body.Key), saved.Hash)
+			require.Equal(t, tc.wantOwner, saved.UserID)
+			require.Equal(t, int64(3), body.APIKey.ID)
+			require.Equal(t, saved.Prefix, body.APIKey.Prefix)
+			require.Equal(t, saved.Scopes, body.APIKey.Scopes)
+		})
+	}
+}
+
+func TestCreateNormalizesScopes(t *testing.T) {
+	saverMock := mocks.NewKeySaver(t)
+	saverMock.On("SaveAPIKey", mock.Anything, mock.MatchedBy(func(k models.APIKey) bool {
+		return k.ExpiresAt != nil && k.ExpiresAt.After(time.Now().Add(719*time.Hour))
+	})).Return(int64(1), nil).Once()
+
+	handler := NewCreate(slogdiscard.NewDiscardLogger(), saverMock)
+
+	req := httptest.NewRequest(http.MethodPost, "/url/keys",
+		bytes.NewReader([]byte(`{"name":"deploy","scopes":["stats:read","links:write","stats:read"],"ttl":"720h"}`)))
+	req = req.WithContext(auth.WithUser(req.Context(), sso))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var body CreateResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.Equal(t, []string{models.ScopeLinksWrite, models.ScopeStatsRead}, body.APIKey.Scopes)
+}
+
+func TestList(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	listerMock := mocks.NewKeyLister(t)
+	listerMock.On("ListAPIKeys", mock.Anything, int64(42)).Return([]models.APIKey{
+		{ID: 2, Name: "ci", Prefix: "usk_abcdef", Hash: "secret hash", CreatedAt: created, RevokedAt: &created},
+		{ID: 1, Name: "deploy", Prefix: "usk_ghijkl", Scopes: []string{models.ScopeStatsRead}, CreatedAt: created},
+	}, nil).Once()
+
+	handler := NewList(slogdiscard.NewDiscardLogger(), listerMock)
+
+	req := httptest.NewRequest(http.MethodGet, "/url/keys", nil)
+	req = req.WithContext(auth.WithUser(req.Context(), sso))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotContains(t, rr.Body.String(), "secret hash")
+
+	var body ListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.Equal(t, []Key{
+		{ID: 2, Name: "ci", Prefix: "usk_abcdef", Scopes: []string{}, CreatedAt: created, RevokedAt: &created},
+		{ID: 1, Name: "deploy", Prefix: "usk_ghijkl", Scopes: []string{models.ScopeStatsRead}, CreatedAt: created},
+	}, body.Keys)
+
+	// a key can't list keys
+	req = httptest.NewRequest(http.MethodGet, "/url/keys", nil)
+	req = req.WithContext(auth.WithUser(req.Context(), byKey))
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestRevoke(t *testing.T) {
+	owner := int64(42)
+
+	cases := []struct {
+		name        string
+		user        auth.User
+		id          string
+		allowed     bool
+		wantOwner   *int64
+		revokeError error
+		respError   string
+		wantCode    int
+	}{
+		{name: "Owner", user: sso, id: "3", wantOwner: &owner, wantCode: http.StatusOK},
+		{name: "Admin", user: sso, id: "3", allowed: true, wantCode: http.StatusOK},
+		{name: "Service account", user: service, id: "3", allowed: true, wantCode: http.StatusOK},
+		{
+			name:        "Not found",
+			user:        sso,
+			id:          "3",
+			wantOwner:   &owner,
+			revokeError: storage.ErrAPIKeyNotFound,
+			respError:   "api key not found",
+			wantCode:    http.StatusNotFound,
+		},
+		{name: "Invalid id", user: sso, id: "abc", respError: "invalid key id", wantCode: http.StatusBadRequest},
+		{name: "Key can't revoke keys", user: byKey, id: "3", respError: "api keys can't manage api keys", wantCode: http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			revokerMock := mocks.NewKeyRevoker(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			validRequest := tc.wantCode != http.StatusBadRequest && tc.wantCode != http.StatusForbidden
+			if validRequest {
+				authzErr := authz.ErrForbidden
+				if tc.allowed {
+					authzErr = nil
+				}
+				authorizerMock.On("Authorize", mock.Anything, tc.user, authz.ActionRevokeKey, authz.Resource{}).Return(authzErr).Once()
+			}
+			if validRequest {
+				revokerMock.On("RevokeAPIKey", mock.Anything, int64(3), tc.wantOwner, mock.AnythingOfType("time.Time")).
+					Return(models.APIKey{ID: 3, UserID: 42}, tc.revokeError).Once()
+			}
+
+			r := chi.NewRouter()
+			r.Delete("/url/keys/{id}", NewRevoke(slogdiscard.NewDiscardLogger(), revokerMock, authorizerMock))
+
+			req := httptest.NewRequest(http.MethodDelete, "/url/keys/"+tc.id, nil)
+			req = req.WithContext(auth.WithUser(req.Context(), tc.user))
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var body RevokeResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			require.Equal(t, tc.respError, body.Error)
+
+			if tc.wantCode == http.StatusOK {
+				require.Equal(t, int64(3), body.APIKey.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package list
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Response struct {
+	resp.Response
+	URLs       []URL  `json:"urls"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type URL struct {
+	Domain    string     `json:"domain,omitempty"`
+	Alias     string     `json:"alias"`
+	URL       string     `json:"url"`
+	UserID    int64      `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Clicks    int64      `json:"clicks"`
+}
+
+//go:generate mockery --name=URLLister --dir=. --output=./mocks --filename=url_lister_mock.go --outpkg=mocks
+type URLLister interface {
+	ListURLs(ctx context.Context, filter models.URLFilter) (models.URLPage, error)
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// New lists links page by page.
+// Query parameters: owner, alias_prefix, domain, short_domain (empty for the primary
+// domain), created_from, created_to (RFC3339), sort (created or clicks), order
+// (asc or desc), limit and cursor from the previous page.
+// Users see only their own links unless the policy lets them list anyone's.
+func New(log *slog.Logger, lister URLLister, policy Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.list.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid query", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+
+			return
+		}
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		filter.UserID, err = authz.Owner(r.Context(), log, policy, user, authz.ActionList, filter.UserID)
+		if errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(r.Context(), "user may list only own links", slog.Int64("user_id", user.ID))
+			resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+
+		page, err := lister.ListURLs(r.Context(), filter)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to list urls", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		responseOk(w, r, page, filter)
+	}
+}
+
+func parseFilter(query url.Values) (models.URLFilter, error) {
+	filter := models.URLFilter{
+		AliasPrefix: query.Get("alias_prefix"),
+		Domain:      query.Get("domain"),
+		SortBy:      models.SortByCreated,
+		Desc:        true,
+		Limit:       defaultLimit,
+	}
+
+	if raw := query.Get("owner"); raw != "" {
+		owner, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return filter, errors.New("field owner is not a valid user id")
+		}
+		filter.UserID = &owner
+	}
+
+	// links of every domain are listed unless one is asked for
+	if query.Has("short_domain") {
+		host := strings.ToLower(query.Get("short_domain"))
+		filter.ShortDomain = &host
+	}
+
+	for name, dst := range map[string]*time.Time{
+		"created_from": &filter.CreatedFrom,
+		"created_to":   &filter.CreatedTo,
+	} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return filter, fmt.Errorf("field %s is not a valid RFC3339 time", name)
+			}
+			*dst = t
+		}
+	}
+
+	switch sortBy := query.Get("sort"); sortBy {
+	case "":
+	case models.SortByCreated, models.SortByClicks:
+		filter.SortBy = sortBy
+	default:
+		return filter, errors.New("field sort must be created or clicks")
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Desc = false
+	default:
+		return filter, errors.New("field order must be asc or desc")
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return filter, fmt.Errorf("field limit must be between 1 and %d", maxLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		after, err := decodeCursor(raw, filter)
+		if err != nil {
+			return filter, errors.New("invalid cursor")
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
+
+// cursor is serialized into the opaque next_cursor value.
+// It remembers the ordering so it can't be reused with a different one.
+type cursor struct {
+	SortBy    string    `json:"s"`
+	Desc      bool      `json:"d"`
+	ID        int64     `json:"i"`
+	CreatedAt time.Time `json:"c"`
+	Clicks    int64     `json:"n"`
+}
+
+func encodeCursor(c *models.URLCursor, filter models.URLFilter) string {
+	raw, _ := json.Marshal(cursor{
+		SortBy:    filter.SortBy,
+		Desc:      filter.Desc,
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		Clicks:    c.Clicks,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(raw string, filter models.URLFilter) (*models.URLCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+
+	if c.SortBy != filter.SortBy || c.Desc != filter.Desc {
+		return nil, errors.New("cursor of a different ordering")
+	}
+
+	return &models.URLCursor{ID: c.ID, CreatedAt: c.CreatedAt, Clicks: c.Clicks}, nil
+}
+
+func responseOk(w http.ResponseWriter, r *http.Request, page models.URLPage, filter models.URLFilter) {
+	urls := make([]URL, 0, len(page.URLs))
+	for _, u := range page.URLs {
+		urls = append(urls, URL{
+			Domain:    u.Domain,
+			Alias:     u.Alias,
+			URL:       u.URL,
+			UserID:    u.UserID,
+			CreatedAt: u.CreatedAt,
+			ExpiresAt: u.ExpiresAt,
+			Clicks:    u.Clicks,
+		})
+	}
+
+	var next string
+	if page.Next != nil {
+		next = encodeCursor(page.Next, filter)
+	}
+
+	resp.JSON(w, r, http.StatusOK, Response{
+		Response:   resp.OK(),
+		URLs:       urls,
+		NextCursor: next,
+	})
+}
@@ -0,0 +1,211 @@
+package list
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/list/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListHandler(t *testing.T) {
+	const userID = 7
+
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	page := models.URLPage{
+		URLs: []models.URL{{ID: 3, Domain: "go.brand.com", Alias: "google", URL: "https://google.com", UserID: userID, CreatedAt: createdAt, Clicks: 5}},
+		Next: &models.URLCursor{ID: 3, CreatedAt: createdAt, Clicks: 5},
+	}
+	next := encodeCursor(page.Next, models.URLFilter{SortBy: models.SortByCreated, Desc: true})
+
+	cases := []struct {
+		name       string
+		query      string
+		user       *auth.User
+		authzErr   error
+		wantFilter *models.URLFilter
+		listError  error
+		respError  string
+		wantCode   int
+	}{
+		{
+			name:     "Own links by default",
+			user:     &auth.User{ID: userID},
+			authzErr: authz.ErrForbidden,
+			wantFilter: &models.URLFilter{
+				UserID: ptr(int64(userID)), SortBy: models.SortByCreated, Desc: true, Limit: defaultLimit,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "Filters and sort",
+			query: "?owner=7&alias_prefix=go&domain=google.com&created_from=2024-01-01T00:00:00Z&sort=clicks&order=asc&limit=10",
+			user:  &auth.User{ID: userID},
+			wantFilter: &models.URLFilter{
+				UserID:      ptr(int64(userID)),
+				AliasPrefix: "go",
+				Domain:      "google.com",
+				CreatedFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				SortBy:      models.SortByClicks,
+				Limit:       10,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "Links of a domain",
+			query: "?short_domain=Go.Brand.com",
+			user:  &auth.User{Service: true},
+			wantFilter: &models.URLFilter{
+				ShortDomain: ptr("go.brand.com"), SortBy: models.SortByCreated, Desc: true, Limit: defaultLimit,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "Links of the primary domain",
+			query: "?short_domain=",
+			user:  &auth.User{Service: true},
+			wantFilter: &models.URLFilter{
+				ShortDomain: ptr(""), SortBy: models.SortByCreated, Desc: true, Limit: defaultLimit,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "Next page",
+			query: "?cursor=" + next,
+			user:  &auth.User{Service: true},
+			wantFilter: &models.URLFilter{
+				SortBy: models.SortByCreated, Desc: true, Limit: defaultLimit, After: page.Next,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "Admin lists other user",
+			query: "?owner=8",
+			user:  &auth.User{ID: 1},
+			wantFilter: &models.URLFilter{
+				UserID: ptr(int64(8)), SortBy: models.SortByCreated, Desc: true, Limit: defaultLimit,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "Other user",
+			query:     "?owner=8",
+			user:      &auth.User{ID: userID},
+			authzErr:  authz.ErrForbidden,
+			respError: "forbidden",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			// reading one's own links needs no roles
+			name:     "SSO unavailable",
+			user:     &auth.User{ID: userID},
+			authzErr: errors.New("connection refused"),
+			wantFilter: &models.URLFilter{
+				UserID: ptr(int64(userID)), SortBy: models.SortByCreated, Desc: true, Limit: defaultLimit,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "SSO unavailable for other user",
+			query:     "?owner=8",
+			user:      &auth.User{ID: 1},
+			authzErr:  errors.New("connection refused"),
+			respError: "failed to check permissions",
+			wantCode:  http.StatusInternalServerError,
+		},
+		{
+			name:      "Cursor of another sort",
+			query:     "?sort=clicks&cursor=" + next,
+			user:      &auth.User{Service: true},
+			respError: "invalid cursor",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid limit",
+			query:     "?limit=1000",
+			user:      &auth.User{Service: true},
+			respError: "field limit must be between 1 and 200",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid sort",
+			query:     "?sort=alias",
+			user:      &auth.User{Service: true},
+			respError: "field sort must be created or clicks",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name: "Storage error",
+			user: &auth.User{Service: true},
+			wantFilter: &models.URLFilter{
+				SortBy: models.SortByCreated, Desc: true, Limit: defaultLimit,
+			},
+			listError: errors.New("unexpected error"),
+			respError: "internal error",
+			wantCode:  http.StatusInternalServerError,
+		},
+		{
+			name:      "Unauthenticated",
+			respError: "unauthorized",
+			wantCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlListerMock := mocks.NewURLLister(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			if tc.user != nil {
+				authorizerMock.On("Authorize", mock.Anything, *tc.user, authz.ActionList, mock.AnythingOfType("authz.Resource")).
+					Return(tc.authzErr).
+					Maybe()
+			}
+			if tc.wantFilter != nil {
+				urlListerMock.On("ListURLs", mock.Anything, *tc.wantFilter).
+					Return(page, tc.listError).
+					Once()
+			}
+
+			handler := New(slogdiscard.NewDiscardLogger(), urlListerMock, authorizerMock)
+
+			req := httptest.NewRequest(http.MethodGet, "/url"+tc.query, nil)
+			if tc.user != nil {
+				req = req.WithContext(auth.WithUser(context.Background(), *tc.user))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+
+			if tc.wantCode == http.StatusOK {
+				require.Len(t, resp.URLs, 1)
+				require.Equal(t, "go.brand.com", resp.URLs[0].Domain)
+				require.Equal(t, "google", resp.URLs[0].Alias)
+				require.Equal(t, int64(5), resp.URLs[0].Clicks)
+				require.NotEmpty(t, resp.NextCursor)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
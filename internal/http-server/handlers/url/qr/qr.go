@@ -0,0 +1,177 @@
+package qr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/qrcode"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:generate mockery --name=URLGetter --dir=. --output=./mocks --filename=url_getter_mock.go --outpkg=mocks
+type URLGetter interface {
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+}
+
+//go:generate mockery --name=CodeGenerator --dir=. --output=./mocks --filename=code_generator_mock.go --outpkg=mocks
+type CodeGenerator interface {
+	Generate(content string, opts qrcode.Options) ([]byte, error)
+}
+
+// maxAge is how long clients may keep a code, it only depends on the alias
+const maxAge = 24 * time.Hour
+
+var contentTypes = map[string]string{
+	qrcode.FormatPNG: "image/png",
+	qrcode.FormatSVG: "image/svg+xml",
+}
+
+// New returns the QR code of the short URL of an alias, baseURL is where the
+// service is publicly served. Query parameters: format (png or svg, or the
+// extension of the path like /qr.svg), size in pixels, level (L, M, Q or H),
+// margin in modules, fg and bg as hex colors.
+func New(log *slog.Logger, urls URLGetter, codes CodeGenerator, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.qr.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		domain, alias := chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
+		if alias == "" {
+			log.ErrorContext(r.Context(), "alias is empty")
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+
+			return
+		}
+
+		opts, err := Options(r)
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid options", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+
+			return
+		}
+
+		u, err := urls.GetUrl(r.Context(), domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.InfoContext(r.Context(), "URL not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("URL not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get url", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		if u.Expired(time.Now()) {
+			log.InfoContext(r.Context(), "URL expired", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusGone, resp.Error("URL expired"))
+
+			return
+		}
+
+		img, err := codes.Generate(ShortURL(baseURL, domain, alias), opts)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to generate qr code", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to generate QR code"))
+
+			return
+		}
+
+		filename := strings.ReplaceAll(alias, "/", "-") + "." + opts.Format
+
+		w.Header().Set("Content-Type", contentTypes[opts.Format])
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(img)
+	}
+}
+
+// ShortURL is the public address of alias on domain, links of a custom
+// domain are served at its host with the scheme of baseURL
+func ShortURL(baseURL, domain, alias string) string {
+	if domain != "" {
+		if u, err := neturl.Parse(baseURL); err == nil {
+			baseURL = u.Scheme + "://" + domain
+		}
+	}
+
+	return strings.TrimSuffix(baseURL, "/") + models.AliasPath(alias)
+}
+
+// Options reads the code options of the request, missing ones are the defaults
+func Options(r *http.Request) (qrcode.Options, error) {
+	query := r.URL.Query()
+	opts := qrcode.DefaultOptions()
+
+	opts.Format = query.Get("format")
+	if opts.Format == "" {
+		opts.Format, _ = r.Context().Value(middleware.URLFormatCtxKey).(string)
+	}
+	opts.Format = strings.ToLower(opts.Format)
+	if opts.Format == "" {
+		opts.Format = qrcode.FormatPNG
+	}
+	if _, ok := contentTypes[opts.Format]; !ok {
+		return qrcode.Options{}, errors.New("field format must be png or svg")
+	}
+
+	if raw := query.Get("size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < qrcode.MinSize || size > qrcode.MaxSize {
+			return qrcode.Options{}, fmt.Errorf("field size must be between %d and %d", qrcode.MinSize, qrcode.MaxSize)
+		}
+		opts.Size = size
+	}
+
+	if raw := query.Get("level"); raw != "" {
+		opts.Level = strings.ToUpper(raw)
+		if !qrcode.ValidLevel(opts.Level) {
+			return qrcode.Options{}, errors.New("field level must be one of L, M, Q, H")
+		}
+	}
+
+	if raw := query.Get("margin"); raw != "" {
+		margin, err := strconv.Atoi(raw)
+		if err != nil || margin < 0 || margin > qrcode.MaxMargin {
+			return qrcode.Options{}, fmt.Errorf("field margin must be between 0 and %d", qrcode.MaxMargin)
+		}
+		opts.Margin = margin
+	}
+
+	if raw := query.Get("fg"); raw != "" {
+		fg, err := qrcode.ParseColor(raw)
+		if err != nil {
+			return qrcode.Options{}, fmt.Errorf("field fg: %w", err)
+		}
+		opts.Foreground = fg
+	}
+
+	if raw := query.Get("bg"); raw != "" {
+		bg, err := qrcode.ParseColor(raw)
+		if err != nil {
+			return qrcode.Options{}, fmt.Errorf("field bg: %w", err)
+		}
+		opts.Background = bg
+	}
+
+	return opts, nil
+}
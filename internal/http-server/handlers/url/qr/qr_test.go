@@ -0,0 +1,169 @@
+package qr
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/qr/mocks"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/qrcode"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQRHandler(t *testing.T) {
+	const baseURL = "https://sho.rt/"
+
+	past := time.Now().Add(-time.Minute)
+
+	with := func(change func(o *qrcode.Options)) *qrcode.Options {
+		o := qrcode.DefaultOptions()
+		change(&o)
+		return &o
+	}
+
+	cases := []struct {
+		name        string
+		path        string
+		url         models.URL
+		getError    error
+		wantContent string
+		wantOpts    *qrcode.Options
+		genError    error
+		wantType    string
+		respError   string
+		wantCode    int
+	}{
+		{
+			name:        "Default PNG",
+			path:        "/url/google/qr",
+			wantContent: "https://sho.rt/google",
+			wantOpts:    with(func(o *qrcode.Options) {}),
+			wantType:    "image/png",
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "SVG with options",
+			path:        "/url/google/qr?format=svg&size=512&level=h&margin=0&fg=%23112233&bg=ffffff00",
+			wantContent: "https://sho.rt/google",
+			wantOpts: with(func(o *qrcode.Options) {
+				o.Format = qrcode.FormatSVG
+				o.Size = 512
+				o.Level = "H"
+				o.Margin = 0
+				o.Foreground = color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+				o.Background = color.NRGBA{R: 0xff, G: 0xff, B: 0xff}
+			}),
+			wantType: "image/svg+xml",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:        "Format from the extension",
+			path:        "/url/google/qr.svg",
+			wantContent: "https://sho.rt/google",
+			wantOpts:    with(func(o *qrcode.Options) { o.Format = qrcode.FormatSVG }),
+			wantType:    "image/svg+xml",
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "Team alias",
+			path:        "/url/t/sales/spring/qr",
+			wantContent: "https://sho.rt/t/sales/spring",
+			wantOpts:    with(func(o *qrcode.Options) {}),
+			wantType:    "image/png",
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "Custom domain",
+			path:        "/url/d/go.brand.com/promo/qr",
+			wantContent: "https://go.brand.com/promo",
+			wantOpts:    with(func(o *qrcode.Options) {}),
+			wantType:    "image/png",
+			wantCode:    http.StatusOK,
+		},
+		{name: "Unknown format", path: "/url/google/qr?format=gif", respError: "field format must be png or svg", wantCode: http.StatusBadRequest},
+		{name: "Size too small", path: "/url/google/qr?size=10", respError: "field size must be between 64 and 2048", wantCode: http.StatusBadRequest},
+		{name: "Unknown level", path: "/url/google/qr?level=X", respError: "field level must be one of L, M, Q, H", wantCode: http.StatusBadRequest},
+		{name: "Negative margin", path: "/url/google/qr?margin=-1", respError: "field margin must be between 0 and 16", wantCode: http.StatusBadRequest},
+		{name: "Invalid color", path: "/url/google/qr?fg=red", respError: `field fg: "red" is not a hex color like 000000`, wantCode: http.StatusBadRequest},
+		{
+			name:      "Not found",
+			path:      "/url/google/qr",
+			getError:  storage.ErrURLNotFound,
+			respError: "URL not found",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "Expired",
+			path:      "/url/google/qr",
+			url:       models.URL{ExpiresAt: &past},
+			respError: "URL expired",
+			wantCode:  http.StatusGone,
+		},
+		{
+			name:        "Generator fails",
+			path:        "/url/google/qr",
+			wantContent: "https://sho.rt/google",
+			wantOpts:    with(func(o *qrcode.Options) {}),
+			genError:    errors.New("data too long"),
+			respError:   "failed to generate QR code",
+			wantCode:    http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlGetterMock := mocks.NewURLGetter(t)
+			codeGeneratorMock := mocks.NewCodeGenerator(t)
+
+			if tc.wantCode != http.StatusBadRequest {
+				urlGetterMock.On("GetUrl", mock.Anything, mock.Anything, mock.Anything).Return(tc.url, tc.getError).Once()
+			}
+			if tc.wantOpts != nil {
+				codeGeneratorMock.On("Generate", tc.wantContent, *tc.wantOpts).Return([]byte("image"), tc.genError).Once()
+			}
+
+			handler := New(slogdiscard.NewDiscardLogger(), urlGetterMock, codeGeneratorMock, baseURL)
+
+			r := chi.NewRouter()
+			r.Use(middleware.URLFormat)
+			r.Get("/url/{alias}/qr", handler)
+			// the aliasparam middleware stores team aliases like this
+			r.Get("/url/t/{team}/{name}/qr", func(w http.ResponseWriter, r *http.Request) {
+				rctx := chi.RouteContext(r.Context())
+				rctx.URLParams.Add("alias", models.TeamAlias(rctx.URLParam("team"), rctx.URLParam("name")))
+				handler(w, r)
+			})
+			r.Get("/url/d/{domain}/{alias}/qr", handler)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			if tc.wantCode != http.StatusOK {
+				var body resp.Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				require.Equal(t, tc.respError, body.Error)
+
+				return
+			}
+
+			require.Equal(t, tc.wantType, rr.Header().Get("Content-Type"))
+			require.Equal(t, "private, max-age=86400", rr.Header().Get("Cache-Control"))
+			require.Equal(t, "image", rr.Body.String())
+		})
+	}
+}
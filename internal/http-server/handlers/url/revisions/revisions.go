@@ -0,0 +1,149 @@
+package revisions
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/api/etag"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type Response struct {
+	resp.Response
+	Revisions []Revision `json:"revisions"`
+}
+
+type Revision struct {
+	Revision     int64      `json:"revision"`
+	URL          string     `json:"url"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RedirectType int        `json:"redirect_type"`
+	PassQuery    bool       `json:"pass_query,omitempty"`
+	UTM          *save.UTM  `json:"utm,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	ChangedBy    int64      `json:"changed_by"`
+	ChangedAt    time.Time  `json:"changed_at"`
+}
+
+//go:generate mockery --name=RevisionsGetter --dir=. --output=./mocks --filename=revisions_getter_mock.go --outpkg=mocks
+type RevisionsGetter interface {
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+	URLRevisions(ctx context.Context, domain, alias string) ([]models.URLRevision, error)
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// New returns the history of a link, newest first.
+// The ETag header carries the current revision to send back in If-Match on update.
+// The history is shown to whoever the policy lets update the link.
+func New(log *slog.Logger, getter RevisionsGetter, policy Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.revisions.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		domain, alias := chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
+		if alias == "" {
+			log.ErrorContext(r.Context(), "alias is empty")
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+
+			return
+		}
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		url, err := getter.GetUrl(r.Context(), domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.InfoContext(r.Context(), "alias not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get url", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("unexpected error"))
+
+			return
+		}
+
+		err = policy.Authorize(r.Context(), user, authz.ActionUpdate, authz.LinkOf(url))
+		if errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(r.Context(), "user may not view the history of the url",
+				slog.Int64("user_id", user.ID),
+				slog.Int64("owner_id", url.UserID),
+			)
+			resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+
+		revisions, err := getter.URLRevisions(r.Context(), domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.InfoContext(r.Context(), "alias not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get revisions", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		w.Header().Set("ETag", etag.Of(url.Revision))
+		responseOk(w, r, alias, revisions)
+	}
+}
+
+func responseOk(w http.ResponseWriter, r *http.Request, alias string, revisions []models.URLRevision) {
+	response := Response{
+		Response:  resp.OK(),
+		Revisions: make([]Revision, 0, len(revisions)),
+	}
+	response.Alias = alias
+
+	for _, rev := range revisions {
+		response.Revisions = append(response.Revisions, Revision{
+			Revision:     rev.Revision,
+			URL:          rev.URL,
+			ExpiresAt:    rev.ExpiresAt,
+			RedirectType: rev.RedirectType,
+			PassQuery:    rev.PassQuery,
+			UTM:          save.UTMOf(rev.UTM),
+			Interstitial: rev.Interstitial,
+			ChangedBy:    rev.ChangedBy,
+			ChangedAt:    rev.ChangedAt,
+		})
+	}
+
+	resp.JSON(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,126 @@
+package revisions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/revisions/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRevisionsHandler(t *testing.T) {
+	const ownerID = 7
+
+	changedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	history := []models.URLRevision{
+		{Revision: 2, URL: "https://google.com", RedirectType: 301, ChangedBy: ownerID, ChangedAt: changedAt.Add(time.Hour)},
+		{Revision: 1, URL: "https://gogle.com", RedirectType: 302, ChangedBy: ownerID, ChangedAt: changedAt},
+	}
+
+	cases := []struct {
+		name          string
+		user          *auth.User
+		getError      error
+		forbidden     bool
+		wantRevisions bool
+		respError     string
+		wantCode      int
+	}{
+		{
+			name:          "Owner",
+			user:          &auth.User{ID: ownerID},
+			wantRevisions: true,
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:          "Allowed by the policy",
+			user:          &auth.User{ID: 1},
+			wantRevisions: true,
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:      "Other user",
+			user:      &auth.User{ID: 8},
+			forbidden: true,
+			respError: "forbidden",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:      "Alias not found",
+			user:      &auth.User{ID: ownerID},
+			getError:  storage.ErrURLNotFound,
+			respError: "alias not found",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "Unauthenticated",
+			respError: "unauthorized",
+			wantCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			revisionsGetterMock := mocks.NewRevisionsGetter(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			if tc.user != nil {
+				revisionsGetterMock.On("GetUrl", mock.Anything, "", "google").
+					Return(models.URL{Alias: "google", URL: "https://google.com", UserID: ownerID, Revision: 2}, tc.getError).
+					Once()
+			}
+			if tc.user != nil && tc.getError == nil {
+				var authzError error
+				if tc.forbidden {
+					authzError = authz.ErrForbidden
+				}
+				authorizerMock.On("Authorize", mock.Anything, *tc.user, authz.ActionUpdate, authz.Resource{Owner: ownerID}).
+					Return(authzError).
+					Once()
+			}
+			if tc.wantRevisions {
+				revisionsGetterMock.On("URLRevisions", mock.Anything, "", "google").
+					Return(history, nil).
+					Once()
+			}
+
+			r := chi.NewRouter()
+			r.Get("/url/{alias}/revisions", New(slogdiscard.NewDiscardLogger(), revisionsGetterMock, authorizerMock))
+
+			req := httptest.NewRequest(http.MethodGet, "/url/google/revisions", nil)
+			if tc.user != nil {
+				req = req.WithContext(auth.WithUser(context.Background(), *tc.user))
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+
+			if tc.wantRevisions {
+				require.Equal(t, `"2"`, rr.Header().Get("ETag"))
+				require.Len(t, resp.Revisions, 2)
+				require.Equal(t, int64(2), resp.Revisions[0].Revision)
+				require.Equal(t, 301, resp.Revisions[0].RedirectType)
+				require.Equal(t, "https://gogle.com", resp.Revisions[1].URL)
+			}
+		})
+	}
+}
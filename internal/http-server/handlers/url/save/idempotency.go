@@ -0,0 +1,219 @@
+package save
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader carries a key chosen by the client, retries of a request reuse it
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed from an earlier request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// MaxIdempotencyKeyLength fits UUIDs and job ids with room to spare
+	MaxIdempotencyKeyLength = 255
+	// maxBodyBytes bounds the body read to hash it, a link is far smaller
+	maxBodyBytes = 1 << 20
+)
+
+//go:generate mockery --name=IdempotencyKeys --dir=. --output=./mocks --filename=idempotency_keys_mock.go --outpkg=mocks
+type IdempotencyKeys interface {
+	SaveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, owner, key string, now time.Time) (models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, k models.IdempotencyKey) error
+	DeleteIdempotencyKey(ctx context.Context, owner, key string) error
+}
+
+// Idempotent makes retries of the next handler with the same Idempotency-Key header safe.
+// The first response is kept for ttl with the hash of the request body and is
+// replayed to requests with the same key and body. Another body gets 422, a
+// retry while the first request is in progress 409. A 5xx or a 429 response
+// isn't kept, so the request may be retried. Keys of different clients don't clash,
+// requests without the header, or any request with a zero ttl, go straight to next.
+// It goes after the authentication and before the rate limit, a replay costs no quota.
+func Idempotent(log *slog.Logger, keys IdempotencyKeys, ttl time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || ttl <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			const op = "handlers.url.save.Idempotent"
+
+			log := log.With(
+				slog.String("op", op),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+			)
+
+			if len(key) > MaxIdempotencyKeyLength {
+				log.InfoContext(r.Context(), "idempotency key is too long", slog.Int("length", len(key)))
+				resp.JSON(w, r, http.StatusBadRequest, resp.Error(
+					fmt.Sprintf("%s header must be at most %d characters long", IdempotencyKeyHeader, MaxIdempotencyKeyLength),
+				))
+
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to read request body", sl.Err(err))
+				resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid request body"))
+
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			user, _ := auth.UserFromContext(r.Context())
+			now := time.Now()
+
+			k := models.IdempotencyKey{
+				Owner:       idempotencyOwner(user),
+				Key:         key,
+				RequestHash: requestHash(body),
+				CreatedAt:   now.UTC().Truncate(time.Microsecond),
+				ExpiresAt:   now.Add(ttl).UTC().Truncate(time.Microsecond),
+			}
+
+			err = keys.SaveIdempotencyKey(r.Context(), k)
+			if errors.Is(err, storage.ErrIdempotencyKeyExists) {
+				if replay(w, r, log, keys, k, now) {
+					return
+				}
+
+				// the first request failed and released the key in the meantime, this one runs instead
+				err = keys.SaveIdempotencyKey(r.Context(), k)
+			}
+			if errors.Is(err, storage.ErrIdempotencyKeyExists) {
+				log.InfoContext(r.Context(), "idempotency key taken again")
+				resp.JSON(w, r, http.StatusConflict, resp.Error("request with the same Idempotency-Key is in progress"))
+
+				return
+			}
+			if err != nil {
+				log.ErrorContext(r.Context(), "failed to save idempotency key", sl.Err(err))
+				resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URL"))
+
+				return
+			}
+
+			// the response is kept even if the client gave up waiting for it
+			ctx := context.WithoutCancel(r.Context())
+			rec := &recorder{ResponseWriter: w}
+			finished := false
+
+			defer func() {
+				if finished && rec.status == 0 {
+					rec.status = http.StatusOK
+				}
+				if finished && rec.status < http.StatusInternalServerError && rec.status != http.StatusTooManyRequests {
+					k.Status, k.Body = rec.status, rec.body.Bytes()
+
+					err := keys.CompleteIdempotencyKey(ctx, k)
+					if err == nil {
+						return
+					}
+
+					log.ErrorContext(r.Context(), "failed to store response of idempotency key", sl.Err(err))
+				}
+
+				// a retry runs the request again instead of waiting for the key to expire
+				if err := keys.DeleteIdempotencyKey(ctx, k.Owner, k.Key); err != nil {
+					log.ErrorContext(r.Context(), "failed to release idempotency key", sl.Err(err))
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+			finished = true
+		})
+	}
+}
+
+// replay answers a request whose key k is taken with the stored response,
+// it answers nothing and returns false if the key was released meanwhile
+func replay(w http.ResponseWriter, r *http.Request, log *slog.Logger, keys IdempotencyKeys, k models.IdempotencyKey, now time.Time) bool {
+	stored, err := keys.GetIdempotencyKey(r.Context(), k.Owner, k.Key, now)
+	switch {
+	case errors.Is(err, storage.ErrIdempotencyKeyNotFound):
+		log.InfoContext(r.Context(), "idempotency key released")
+
+		return false
+	case err != nil:
+		log.ErrorContext(r.Context(), "failed to get idempotency key", sl.Err(err))
+		resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URL"))
+	case stored.RequestHash != k.RequestHash:
+		log.InfoContext(r.Context(), "idempotency key reused with another request")
+		resp.JSON(w, r, http.StatusUnprocessableEntity, resp.Error("Idempotency-Key was used with another request"))
+	case stored.Pending():
+		log.InfoContext(r.Context(), "idempotency key in progress")
+		resp.JSON(w, r, http.StatusConflict, resp.Error("request with the same Idempotency-Key is in progress"))
+	default:
+		log.InfoContext(r.Context(), "response replayed", slog.Int("status", stored.Status))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+
+	return true
+}
+
+// idempotencyOwner scopes keys like rate limits: scripts with keys of the
+// service account don't share their keys either
+func idempotencyOwner(user auth.User) string {
+	switch {
+	case user.Service && user.KeyID != 0:
+		return "key:" + strconv.FormatInt(user.KeyID, 10)
+	case user.Service:
+		return "service"
+	default:
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+}
+
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// recorder passes a response through and keeps a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
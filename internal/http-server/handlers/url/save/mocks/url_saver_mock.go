@@ -2,27 +2,32 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	models "github.com/lostmyescape/url-shortener/internal/domain/models"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // URLSaver is an autogenerated mock type for the URLSaver type
 type URLSaver struct {
 	mock.Mock
 }
 
-// SaveURL provides a mock function with given fields: urlToSave, alias
-func (_m *URLSaver) SaveURL(urlToSave string, alias string) (int64, error) {
-	ret := _m.Called(urlToSave, alias)
+// SaveURL provides a mock function with given fields: ctx, u, unique
+func (_m *URLSaver) SaveURL(ctx context.Context, u models.URL, unique bool) (int64, error) {
+	ret := _m.Called(ctx, u, unique)
 
 	var r0 int64
-	if rf, ok := ret.Get(0).(func(string, string) int64); ok {
-		r0 = rf(urlToSave, alias)
+	if rf, ok := ret.Get(0).(func(context.Context, models.URL, bool) int64); ok {
+		r0 = rf(ctx, u, unique)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, string) error); ok {
-		r1 = rf(urlToSave, alias)
+	if rf, ok := ret.Get(1).(func(context.Context, models.URL, bool) error); ok {
+		r1 = rf(ctx, u, unique)
 	} else {
 		r1 = ret.Error(1)
 	}
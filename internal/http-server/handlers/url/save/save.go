@@ -1,43 +1,134 @@
 package save
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
-	"fmt"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/lostmyescape/url-shortener/internal/alias"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/domains"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
 	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
 	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
-	"github.com/lostmyescape/url-shortener/internal/lib/random"
 	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
 	"log/slog"
 	"net/http"
+	"time"
 )
 
 type Request struct {
 	URL   string `json:"url" validate:"required,url"`
 	Alias string `json:"alias,omitempty"`
+	// Team puts the alias in the namespace of a team, the link is served at /t/{team}/{alias}
+	Team string `json:"team,omitempty"`
+	// Domain is the custom domain the link is served at, the primary one if empty
+	Domain    string     `json:"domain,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// TTL is a duration like "72h", it is an alternative to ExpiresAt
+	TTL string `json:"ttl,omitempty"`
+	// RedirectType is 301, 302, 307 or 308, 302 if empty
+	RedirectType int `json:"redirect_type,omitempty"`
+	// PassQuery appends the query of the redirect request to the destination
+	PassQuery bool `json:"pass_query,omitempty"`
+	UTM       *UTM `json:"utm,omitempty"`
+	// Interstitial shows a preview page with the destination instead of redirecting
+	Interstitial bool `json:"interstitial,omitempty"`
+}
+
+// UTM are the utm_* parameters added to the destination on redirect,
+// the ones the destination sets itself are kept
+type UTM struct {
+	Source   string `json:"source,omitempty" validate:"max=256"`
+	Medium   string `json:"medium,omitempty" validate:"max=256"`
+	Campaign string `json:"campaign,omitempty" validate:"max=256"`
+	Term     string `json:"term,omitempty" validate:"max=256"`
+	Content  string `json:"content,omitempty" validate:"max=256"`
+}
+
+// UTMOf returns the UTM of a link for a response, nil if it has none
+func UTMOf(utm models.UTM) *UTM {
+	if utm == (models.UTM{}) {
+		return nil
+	}
+
+	out := UTM(utm)
+
+	return &out
 }
 
 type Response struct {
 	resp.Response
-	Alias string `json:"alias,omitempty"`
+	// Domain is the custom domain of the link, empty for the primary one
+	Domain    string     `json:"domain,omitempty"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 //go:generate mockery --name=URLSaver --dir=. --output=./mocks --filename=url_saver_mock.go --outpkg=mocks
 type URLSaver interface {
-	SaveURL(urlToSave string, alias string) (int64, error)
+	SaveURL(ctx context.Context, u models.URL, unique bool) (int64, error)
+}
+
+//go:generate mockery --name=URLFinder --dir=. --output=./mocks --filename=url_finder_mock.go --outpkg=mocks
+type URLFinder interface {
+	FindURL(ctx context.Context, rawURL, domain string, userID int64, team string, now time.Time) (models.URL, error)
 }
 
-const aliasLength = 6
+//go:generate mockery --name=AliasGenerator --dir=. --output=./mocks --filename=alias_generator_mock.go --outpkg=mocks
+type AliasGenerator interface {
+	Generate(ctx context.Context) (alias string, id int64, err error)
+}
+
+//go:generate mockery --name=URLChecker --dir=. --output=./mocks --filename=url_checker_mock.go --outpkg=mocks
+type URLChecker interface {
+	Check(ctx context.Context, rawURL string) error
+}
+
+//go:generate mockery --name=AliasRules --dir=. --output=./mocks --filename=alias_rules_mock.go --outpkg=mocks
+type AliasRules interface {
+	Team(team string) (string, error)
+	Custom(alias string) (string, error)
+	Generated(alias string) error
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+//go:generate mockery --name=DomainFinder --dir=. --output=./mocks --filename=domain_finder_mock.go --outpkg=mocks
+type DomainFinder interface {
+	GetDomain(ctx context.Context, host string) (models.Domain, error)
+}
 
-func New(log *slog.Logger, urlSaver URLSaver) http.HandlerFunc {
+// AliasAttempts is how many generated aliases are tried before giving up on a collision
+const AliasAttempts = 5
+
+// New saves a link, the policy decides who may save links in the namespace of a team.
+// A url that already has a link is saved again, rejected or answered with
+// that link as duplicates, one of the models.Duplicates* modes, says. Unless
+// duplicates is models.DuplicatesAllow the storage checks it again as it saves,
+// so of concurrent saves of a url only one gets through.
+// Idempotent in front of it makes retries with an Idempotency-Key header safe.
+func New(
+	log *slog.Logger,
+	urlSaver URLSaver,
+	finder URLFinder,
+	duplicates string,
+	aliases AliasGenerator,
+	rules AliasRules,
+	urls URLChecker,
+	policy Authorizer,
+	customDomains DomainFinder,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.url.save.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
@@ -47,75 +138,378 @@ func New(log *slog.Logger, urlSaver URLSaver) http.HandlerFunc {
 		// decode body
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
-			log.Error("failed to decode request body", sl.Err(err))
-			NewJSON(w, r, http.StatusBadRequest, resp.Error("invalid request body"))
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid request body"))
 
 			return
 		}
 
-		log.Info("request body decoded", slog.Any("request", req))
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
 
 		// validator for errors struct
 		if err := validator.New().Struct(req); err != nil {
 			var validateErr validator.ValidationErrors
 			errors.As(err, &validateErr)
 
-			log.Error("invalid request", sl.Err(err))
-			NewJSON(w, r, http.StatusBadRequest, resp.ValidationError(validateErr))
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.ValidationError(validateErr))
 
 			return
 		}
 
-		// if alias is empty, generate a new alias
-		alias := req.Alias
-		if alias == "" {
-			alias = random.NewRandomString(aliasLength)
+		expiresAt, err := Expiry(req, time.Now())
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid expiry", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+
+			return
 		}
 
-		id, err := urlSaver.SaveURL(req.URL, alias)
+		if err := CheckRedirectType(req.RedirectType); err != nil {
+			log.ErrorContext(r.Context(), "invalid redirect type", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
 
+			return
+		}
+
+		team, custom, err := CheckAlias(rules, req)
 		if err != nil {
-			switch {
-			case errors.Is(err, storage.ErrURLExists):
-				log.Error("URL already exists", sl.Err(err))
-				NewJSON(w, r, http.StatusConflict, resp.Error("URL already exists"))
-				return
-			case errors.Is(err, storage.ErrAliasExists):
-				log.Error("alias already exists", sl.Err(err))
-				NewJSON(w, r, http.StatusConflict, resp.Error("alias already exists"))
-				return
-			default:
-				log.Error("failed to add error")
-				NewJSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URL"))
+			log.ErrorContext(r.Context(), "alias rejected", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, AliasError(err))
+
+			return
+		}
+
+		// links saved by the service account have no owner
+		user, _ := auth.UserFromContext(r.Context())
+
+		domain, err := CheckDomain(r.Context(), customDomains, policy, user, req.Domain)
+		if err != nil {
+			log.WarnContext(r.Context(), "domain rejected", slog.String("domain", req.Domain), slog.Int64("user_id", user.ID), sl.Err(err))
+			status, body := DomainError(err)
+			resp.JSON(w, r, status, body)
+
+			return
+		}
+
+		if err := CheckTeam(r.Context(), policy, user, team); err != nil {
+			log.WarnContext(r.Context(), "team rejected", slog.String("team", team), slog.Int64("user_id", user.ID), sl.Err(err))
+			status, body := TeamError(err)
+			resp.JSON(w, r, status, body)
+
+			return
+		}
+
+		if err := urls.Check(r.Context(), req.URL); err != nil {
+			log.ErrorContext(r.Context(), "url rejected", sl.Err(err))
+			status, body := PolicyError(err)
+			resp.JSON(w, r, status, body)
+
+			return
+		}
+
+		existing, found, err := Duplicate(r.Context(), finder, duplicates, req.URL, domain, user.ID, team, aliasOf(team, custom), time.Now())
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to add url", sl.Err(err))
+			status, body := StorageError(err)
+			resp.JSON(w, r, status, body)
+
+			return
+		}
+		if found {
+			log.InfoContext(r.Context(), "existing link returned", slog.String("alias", existing.Alias))
+			responseOk(w, r, existing.Domain, existing.Alias, existing.ExpiresAt)
+
+			return
+		}
+
+		var (
+			alias = custom
+			id    int64
+		)
+
+		for attempt := 1; ; attempt++ {
+			// if alias is empty, generate a new alias
+			if custom == "" {
+				alias, id, err = aliases.Generate(r.Context())
+				if err != nil {
+					log.ErrorContext(r.Context(), "failed to generate alias", sl.Err(err))
+					resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URL"))
+
+					return
+				}
+
+				// a reserved or profane alias is skipped like a taken one
+				if err := rules.Generated(alias); err != nil {
+					if attempt < AliasAttempts {
+						log.InfoContext(r.Context(), "generated alias is rejected", slog.String("alias", alias), sl.Err(err))
+						continue
+					}
+
+					log.ErrorContext(r.Context(), "failed to generate alias", sl.Err(err))
+					resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to add URL"))
+
+					return
+				}
+			}
+
+			u := Link(req, expiresAt)
+			u.ID, u.Domain, u.Alias, u.UserID = id, domain, models.TeamAlias(team, alias), user.ID
+
+			id, err = urlSaver.SaveURL(r.Context(), u, duplicates != models.DuplicatesAllow)
+
+			// a generated alias may be taken by a custom one, try the next
+			if custom == "" && errors.Is(err, storage.ErrAliasExists) && attempt < AliasAttempts {
+				log.InfoContext(r.Context(), "generated alias is taken", slog.String("alias", alias))
+				continue
+			}
+
+			break
+		}
+
+		// a concurrent save of the url came first, it is answered like one found before
+		if errors.Is(err, storage.ErrURLExists) && duplicates == models.DuplicatesIdempotent {
+			existing, found, findErr := Duplicate(r.Context(), finder, duplicates, req.URL, domain, user.ID, team, aliasOf(team, custom), time.Now())
+			if found {
+				log.InfoContext(r.Context(), "existing link returned", slog.String("alias", existing.Alias))
+				responseOk(w, r, existing.Domain, existing.Alias, existing.ExpiresAt)
+
 				return
 			}
+			if findErr != nil {
+				err = findErr
+			}
+		}
+
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to add url", sl.Err(err))
+			status, body := StorageError(err)
+			resp.JSON(w, r, status, body)
 
+			return
 		}
-		log.Info("url added", slog.Int64("id", id))
-		responseOk(w, r, alias)
+		log.InfoContext(r.Context(), "url added", slog.Int64("id", id))
+		responseOk(w, r, domain, models.TeamAlias(team, alias), expiresAt)
 	}
 }
 
-func NewJSON(w http.ResponseWriter, _ *http.Request, status int, v interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+func responseOk(w http.ResponseWriter, r *http.Request, domain, alias string, expiresAt *time.Time) {
+	resp.JSON(w, r, http.StatusOK, Response{
+		Response:  resp.OK(),
+		Domain:    domain,
+		Alias:     alias,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// StorageError maps an error of SaveURL to the response status and body
+func StorageError(err error) (int, resp.Response) {
+	switch {
+	case errors.Is(err, storage.ErrURLExists):
+		return http.StatusConflict, resp.Error("URL already exists")
+	case errors.Is(err, storage.ErrAliasExists):
+		return http.StatusConflict, resp.Error("alias already exists")
+	default:
+		return http.StatusInternalServerError, resp.Error("failed to add URL")
+	}
+}
+
+// Duplicate looks for a live link to rawURL on domain as mode says: none is
+// looked for with models.DuplicatesAllow, an existing one is storage.ErrURLExists
+// with models.DuplicatesReject and is returned with models.DuplicatesIdempotent,
+// unless alias is set and the existing link has another one. Only the links
+// in the namespace of team count, or the ones of userID if team is empty, so
+// links of others are neither returned nor told about.
+func Duplicate(
+	ctx context.Context,
+	finder URLFinder,
+	mode string,
+	rawURL string,
+	domain string,
+	userID int64,
+	team string,
+	alias string,
+	now time.Time,
+) (models.URL, bool, error) {
+	if mode == models.DuplicatesAllow {
+		return models.URL{}, false, nil
+	}
+
+	existing, err := finder.FindURL(ctx, rawURL, domain, userID, team, now)
+	if errors.Is(err, storage.ErrURLNotFound) {
+		return models.URL{}, false, nil
+	}
+	if err != nil {
+		return models.URL{}, false, err
+	}
 
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	enc.SetEscapeHTML(true)
+	if mode == models.DuplicatesReject || alias != "" && alias != existing.Alias {
+		return models.URL{}, false, storage.ErrURLExists
+	}
+
+	return existing, true, nil
+}
 
-	if err := enc.Encode(v); err != nil {
-		w.WriteHeader(status)
-		fmt.Fprintf(w, `{"error": "failed to encode response"}`)
-		return
+// aliasOf returns the alias a custom alias is stored under, empty for generated ones
+func aliasOf(team, custom string) string {
+	if custom == "" {
+		return ""
 	}
 
-	w.WriteHeader(status)
-	buf.WriteTo(w)
+	return models.TeamAlias(team, custom)
 }
 
-func responseOk(w http.ResponseWriter, r *http.Request, alias string) {
-	NewJSON(w, r, http.StatusOK, Response{
-		Response: resp.OK(),
-		Alias:    alias,
-	})
+// PolicyError maps an error of URLChecker to the response status and body
+func PolicyError(err error) (int, resp.Response) {
+	var violation *urlpolicy.Violation
+	if errors.As(err, &violation) {
+		return http.StatusBadRequest, resp.FieldErrors(resp.FieldError{
+			Field:   "URL",
+			Rule:    violation.Rule,
+			Message: violation.Message,
+		})
+	}
+
+	return http.StatusInternalServerError, resp.Error("failed to check URL")
+}
+
+// CheckRedirectType accepts the redirect status codes a link may use, 0 is the default one
+func CheckRedirectType(code int) error {
+	if code != 0 && !models.ValidRedirectType(code) {
+		return errors.New("field redirect_type must be one of 301, 302, 307, 308")
+	}
+
+	return nil
+}
+
+// Link returns the link req asks for, without an alias and an owner
+func Link(req Request, expiresAt *time.Time) models.URL {
+	u := models.URL{
+		URL:          req.URL,
+		ExpiresAt:    expiresAt,
+		RedirectType: req.RedirectType,
+		PassQuery:    req.PassQuery,
+		Interstitial: req.Interstitial,
+	}
+
+	if req.UTM != nil {
+		u.UTM = models.UTM(*req.UTM)
+	}
+
+	return u
+}
+
+// CheckTeam asks policy whether user may create links in the namespace of team, anyone may outside namespaces
+func CheckTeam(ctx context.Context, policy Authorizer, user auth.User, team string) error {
+	if team == "" {
+		return nil
+	}
+
+	return policy.Authorize(ctx, user, authz.ActionCreate, authz.Resource{Team: team})
+}
+
+// TeamError is the response to an error of CheckTeam
+func TeamError(err error) (int, resp.Response) {
+	if errors.Is(err, authz.ErrForbidden) {
+		return http.StatusForbidden, resp.Error("only members of the team may create links in its namespace")
+	}
+
+	return http.StatusInternalServerError, resp.Error("failed to check permissions")
+}
+
+// CheckAlias checks the team and the custom alias of req against rules
+// and returns them as they are stored, custom is empty if none was given
+func CheckAlias(rules AliasRules, req Request) (team string, custom string, err error) {
+	team, err = rules.Team(req.Team)
+	if err != nil {
+		return "", "", err
+	}
+
+	if req.Alias == "" {
+		return team, "", nil
+	}
+
+	custom, err = rules.Custom(req.Alias)
+	if err != nil {
+		return "", "", err
+	}
+
+	return team, custom, nil
+}
+
+// CheckDomain returns the host of the custom domain a link is saved on, empty for the
+// primary domain, if policy lets user create links on it
+func CheckDomain(ctx context.Context, finder DomainFinder, policy Authorizer, user auth.User, domain string) (string, error) {
+	if domain == "" {
+		return "", nil
+	}
+
+	host, err := domains.Host(domain)
+	if err != nil {
+		return "", err
+	}
+
+	d, err := finder.GetDomain(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	if err := policy.Authorize(ctx, user, authz.ActionUseDomain, authz.DomainOf(d)); err != nil {
+		return "", err
+	}
+
+	return d.Host, nil
+}
+
+// DomainError is the response to an error of CheckDomain
+func DomainError(err error) (int, resp.Response) {
+	if errors.Is(err, domains.ErrInvalidHost) || errors.Is(err, storage.ErrDomainNotFound) {
+		return http.StatusBadRequest, resp.Error("field domain is not a known domain")
+	}
+	if errors.Is(err, authz.ErrForbidden) {
+		return http.StatusForbidden, resp.Error("only the owner of the domain may create links on it")
+	}
+
+	return http.StatusInternalServerError, resp.Error("failed to check domain")
+}
+
+// AliasError maps an error of AliasRules to the response body, the status is always 400
+func AliasError(err error) resp.Response {
+	var violation *alias.Violation
+	if errors.As(err, &violation) {
+		return resp.FieldErrors(resp.FieldError{
+			Field:   violation.Field,
+			Rule:    violation.Rule,
+			Message: violation.Message,
+		})
+	}
+
+	return resp.Error(err.Error())
+}
+
+// Expiry resolves expires_at or ttl of req into an absolute time, nil means the link never expires
+func Expiry(req Request, now time.Time) (*time.Time, error) {
+	switch {
+	case req.ExpiresAt != nil && req.TTL != "":
+		return nil, errors.New("only one of expires_at and ttl can be set")
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return nil, errors.New("field expires_at must be in the future")
+		}
+
+		expiresAt := req.ExpiresAt.UTC()
+
+		return &expiresAt, nil
+	case req.TTL != "":
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, errors.New("field ttl must be a positive duration like 24h")
+		}
+
+		expiresAt := now.Add(ttl).UTC()
+
+		return &expiresAt, nil
+	}
+
+	return nil, nil
 }
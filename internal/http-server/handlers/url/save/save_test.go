@@ -2,26 +2,54 @@ package save
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/alias"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
 	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
 	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
 	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSaveHandler(t *testing.T) {
 	cases := []struct {
-		name      string
-		alias     string
-		url       string
-		respError string
-		mockError error
-		wantCode  int
+		name       string
+		alias      string
+		team       string
+		domain     string
+		lookupHost string // the custom domain is looked up by this host
+		url        string
+		redirect   int
+		ttl        string
+		expiresAt  string
+		respError  string
+		mockError  error
+		checkError error
+		authzError error
+		lookupErr  error
+		domainErr  error  // of the authorization to create links on the domain
+		duplicates string // models.DuplicatesAllow if empty
+		existing   string // alias of the live link to url, if there is one
+		wantRule   string
+		wantField  string
+		wantDomain string
+		wantAlias  string
+		wantCode   int
+		wantExpiry bool
+		userID     int64
 	}{
 		{
 			name:     "Success",
@@ -58,12 +86,253 @@ func TestSaveHandler(t *testing.T) {
 			wantCode:  http.StatusInternalServerError,
 		},
 		{
-			name:      "URL already exists",
+			name:     "Owned by user",
+			alias:    "mine",
+			url:      "https://google.com",
+			userID:   42,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "TTL",
+			alias:      "temp",
+			url:        "https://google.com",
+			ttl:        "24h",
+			wantCode:   http.StatusOK,
+			wantExpiry: true,
+		},
+		{
+			name:       "Expires at",
+			alias:      "temp",
+			url:        "https://google.com",
+			expiresAt:  time.Now().Add(time.Hour).Format(time.RFC3339),
+			wantCode:   http.StatusOK,
+			wantExpiry: true,
+		},
+		{
+			name:      "Invalid TTL",
+			alias:     "temp",
 			url:       "https://google.com",
-			alias:     "go",
-			wantCode:  http.StatusConflict,
-			respError: "URL already exists",
-			mockError: storage.ErrURLExists,
+			ttl:       "-1h",
+			respError: "field ttl must be a positive duration like 24h",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Expires at in the past",
+			alias:     "temp",
+			url:       "https://google.com",
+			expiresAt: time.Now().Add(-time.Hour).Format(time.RFC3339),
+			respError: "field expires_at must be in the future",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Both TTL and expires at",
+			alias:     "temp",
+			url:       "https://google.com",
+			ttl:       "1h",
+			expiresAt: time.Now().Add(time.Hour).Format(time.RFC3339),
+			respError: "only one of expires_at and ttl can be set",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:  "Rejected by URL policy",
+			url:   "ftp://example.com/file",
+			alias: "file",
+			checkError: &urlpolicy.Violation{
+				Rule:    urlpolicy.RuleScheme,
+				Message: "field URL must use one of the schemes http, https",
+			},
+			respError: "field URL must use one of the schemes http, https",
+			wantRule:  urlpolicy.RuleScheme,
+			wantField: "URL",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:       "URL policy fails",
+			url:        "https://google.com",
+			alias:      "google",
+			checkError: errors.New("reputation service is down"),
+			respError:  "failed to check URL",
+			wantCode:   http.StatusInternalServerError,
+		},
+		{
+			name:     "Permanent redirect",
+			alias:    "perm",
+			url:      "https://google.com",
+			redirect: http.StatusPermanentRedirect,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "Invalid redirect type",
+			alias:     "see-other",
+			url:       "https://google.com",
+			redirect:  http.StatusSeeOther,
+			respError: "field redirect_type must be one of 301, 302, 307, 308",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Reserved alias",
+			url:       "https://google.com",
+			alias:     "url",
+			respError: "field Alias is reserved",
+			wantRule:  alias.RuleReserved,
+			wantField: "Alias",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Alias with a slash",
+			url:       "https://google.com",
+			alias:     "a/b",
+			respError: `field Alias has the invalid character '/'`,
+			wantRule:  alias.RuleCharset,
+			wantField: "Alias",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Too long alias",
+			url:       "https://google.com",
+			alias:     strings.Repeat("a", 65),
+			respError: "field Alias must be from 1 to 64 characters long",
+			wantRule:  alias.RuleLength,
+			wantField: "Alias",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Profane alias",
+			url:       "https://google.com",
+			alias:     "sh1t-happens",
+			respError: "field Alias contains a profane word",
+			wantRule:  alias.RuleProfanity,
+			wantField: "Alias",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Team alias",
+			url:       "https://google.com",
+			alias:     "spring",
+			team:      "sales",
+			wantAlias: "sales/spring",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:       "Custom domain",
+			url:        "https://google.com",
+			alias:      "promo",
+			domain:     "Go.Brand.com",
+			lookupHost: "go.brand.com",
+			wantDomain: "go.brand.com",
+			wantAlias:  "promo",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Team alias on a custom domain",
+			url:        "https://google.com",
+			alias:      "spring",
+			team:       "sales",
+			domain:     "go.brand.com",
+			lookupHost: "go.brand.com",
+			wantDomain: "go.brand.com",
+			wantAlias:  "sales/spring",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Unknown domain",
+			url:        "https://google.com",
+			alias:      "promo",
+			domain:     "other.com",
+			lookupHost: "other.com",
+			lookupErr:  storage.ErrDomainNotFound,
+			respError:  "field domain is not a known domain",
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "Domain of another user",
+			url:        "https://google.com",
+			alias:      "promo",
+			domain:     "go.brand.com",
+			lookupHost: "go.brand.com",
+			userID:     8,
+			domainErr:  authz.ErrForbidden,
+			respError:  "only the owner of the domain may create links on it",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:      "Invalid domain",
+			url:       "https://google.com",
+			alias:     "promo",
+			domain:    "https://brand.com",
+			respError: "field domain is not a known domain",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:       "Not a member of the team",
+			url:        "https://google.com",
+			alias:      "spring",
+			team:       "sales",
+			userID:     7,
+			authzError: authz.ErrForbidden,
+			respError:  "only members of the team may create links in its namespace",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "SSO unavailable",
+			url:        "https://google.com",
+			alias:      "spring",
+			team:       "sales",
+			authzError: errors.New("connection refused"),
+			respError:  "failed to check permissions",
+			wantCode:   http.StatusInternalServerError,
+		},
+		{
+			name:      "Invalid team",
+			url:       "https://google.com",
+			alias:     "spring",
+			team:      "sales/eu",
+			respError: `field Team has the invalid character '/'`,
+			wantRule:  alias.RuleCharset,
+			wantField: "Team",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:       "URL already exists",
+			url:        "https://google.com",
+			alias:      "go",
+			duplicates: models.DuplicatesReject,
+			existing:   "goog",
+			wantCode:   http.StatusConflict,
+			respError:  "URL already exists",
+		},
+		{
+			name:       "New URL where duplicates are rejected",
+			url:        "https://google.com",
+			alias:      "go",
+			duplicates: models.DuplicatesReject,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Existing link returned",
+			url:        "https://google.com",
+			duplicates: models.DuplicatesIdempotent,
+			existing:   "goog",
+			wantAlias:  "goog",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Existing link with the same alias",
+			url:        "https://google.com",
+			alias:      "goog",
+			duplicates: models.DuplicatesIdempotent,
+			existing:   "goog",
+			wantAlias:  "goog",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Existing link with another alias",
+			url:        "https://google.com",
+			alias:      "go",
+			duplicates: models.DuplicatesIdempotent,
+			existing:   "goog",
+			wantCode:   http.StatusConflict,
+			respError:  "URL already exists",
 		},
 	}
 
@@ -82,27 +351,92 @@ func TestSaveHandler(t *testing.T) {
 
 			// мок настраиваться только если:
 			// ожидается успешный ответ или задана ошибка для мока
-			if tc.respError == "" || tc.mockError != nil {
-				// мок ожидать вызова SaveURL с аргументами tc.url и любым string
-				urlSaverMock.On("SaveURL", tc.url, mock.AnythingOfType("string")).
+			if (tc.respError == "" || tc.mockError != nil) && tc.existing == "" {
+				// мок ожидать вызова SaveURL с url из tc.url и любым alias
+				urlSaverMock.On("SaveURL", mock.Anything, mock.MatchedBy(func(u models.URL) bool {
+					return u.URL == tc.url && u.Domain == tc.wantDomain && u.Alias != "" && u.UserID == tc.userID &&
+						(tc.wantAlias == "" || u.Alias == tc.wantAlias) && u.RedirectType == tc.redirect &&
+						(u.ExpiresAt != nil) == tc.wantExpiry
+				}), tc.duplicates != "" && tc.duplicates != models.DuplicatesAllow).
 					Return(int64(1), tc.mockError). // возвращает 1 и ошибку
 					Once()                          // метод вызывается только один раз
 			}
 
+			// the policy is asked about urls that passed validation
+			urlCheckerMock := mocks.NewURLChecker(t)
+			if tc.respError == "" || tc.mockError != nil || tc.checkError != nil || tc.existing != "" {
+				urlCheckerMock.On("Check", mock.Anything, tc.url).Return(tc.checkError).Once()
+			}
+
+			duplicates, urlFinderMock := tc.duplicates, mocks.NewURLFinder(t)
+			if duplicates == "" {
+				duplicates = models.DuplicatesAllow
+			} else {
+				existing, err := models.URL{Alias: tc.existing, URL: tc.url}, error(nil)
+				if tc.existing == "" {
+					err = storage.ErrURLNotFound
+				}
+				urlFinderMock.On("FindURL", mock.Anything, tc.url, "", tc.userID, tc.team, mock.AnythingOfType("time.Time")).
+					Return(existing, err).
+					Once()
+			}
+
+			aliasGeneratorMock := mocks.NewAliasGenerator(t)
+			if tc.alias == "" && tc.existing == "" {
+				aliasGeneratorMock.On("Generate", mock.Anything).
+					Return("Ab3dE6", int64(0), nil).
+					Once()
+			}
+
+			// only links in the namespace of a team or on a custom domain ask the authorization policy
+			authorizerMock := mocks.NewAuthorizer(t)
+			if tc.lookupHost != "" && tc.lookupErr == nil {
+				authorizerMock.On("Authorize", mock.Anything, auth.User{ID: tc.userID}, authz.ActionUseDomain, authz.Resource{Owner: 7}).
+					Return(tc.domainErr).
+					Once()
+			}
+			if tc.team != "" && tc.wantField != "Team" && tc.lookupErr == nil && tc.domainErr == nil {
+				authorizerMock.On("Authorize", mock.Anything, auth.User{ID: tc.userID}, authz.ActionCreate, authz.Resource{Team: tc.team}).
+					Return(tc.authzError).
+					Once()
+			}
+
+			domainFinderMock := mocks.NewDomainFinder(t)
+			if tc.lookupHost != "" {
+				domainFinderMock.On("GetDomain", mock.Anything, tc.lookupHost).
+					Return(models.Domain{Host: tc.lookupHost, UserID: 7}, tc.lookupErr).
+					Once()
+			}
+
 			// создание хендлера: принимает заглушку и мок
-			handler := New(slogdiscard.NewDiscardLogger(), urlSaverMock)
+			handler := New(slogdiscard.NewDiscardLogger(), urlSaverMock, urlFinderMock, duplicates, aliasGeneratorMock, newRules(t), urlCheckerMock, authorizerMock, domainFinderMock)
 
 			// тело запроса в JSON
-			bodyBytes, err := json.Marshal(map[string]string{
-				"url":   tc.url,
-				"alias": tc.alias,
-			})
+			reqBody := map[string]any{
+				"url":    tc.url,
+				"alias":  tc.alias,
+				"team":   tc.team,
+				"domain": tc.domain,
+				"ttl":    tc.ttl,
+			}
+			if tc.expiresAt != "" {
+				reqBody["expires_at"] = tc.expiresAt
+			}
+			if tc.redirect != 0 {
+				reqBody["redirect_type"] = tc.redirect
+			}
+
+			bodyBytes, err := json.Marshal(reqBody)
 			require.NoError(t, err)
 
 			// создает POST запрос к /save
 			req, err := http.NewRequest(http.MethodPost, "/save", bytes.NewReader(bodyBytes))
 			require.NoError(t, err)
 
+			if tc.userID != 0 {
+				req = req.WithContext(auth.WithUser(req.Context(), auth.User{ID: tc.userID}))
+			}
+
 			// Запись ответа:
 			// 1. запись ответа сервера
 			rr := httptest.NewRecorder()
@@ -119,6 +453,346 @@ func TestSaveHandler(t *testing.T) {
 			require.NoError(t, json.Unmarshal([]byte(body), &resp))
 			// смотрим что ошибка, которую вернул хендлер == ошибке которая определена в тест кейсе
 			require.Equal(t, tc.respError, resp.Error)
+			require.Equal(t, tc.wantExpiry, resp.ExpiresAt != nil)
+			require.Equal(t, tc.wantDomain, resp.Domain)
+
+			if tc.wantAlias != "" {
+				require.Equal(t, tc.wantAlias, resp.Alias)
+			}
+
+			if tc.wantRule != "" {
+				require.Len(t, resp.Details, 1)
+				require.Equal(t, tc.wantField, resp.Details[0].Field)
+				require.Equal(t, tc.wantRule, resp.Details[0].Rule)
+			}
+		})
+	}
+}
+
+func TestSaveHandlerGeneratedAlias(t *testing.T) {
+	cases := []struct {
+		name      string
+		rejected  int // generated aliases rejected by the alias rules
+		taken     int // generated aliases that are already taken
+		genError  error
+		wantAlias string
+		respError string
+		wantCode  int
+	}{
+		{
+			name:      "First alias",
+			wantAlias: "alias1",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "Retry on collision",
+			taken:     2,
+			wantAlias: "alias3",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "Every attempt collides",
+			taken:     AliasAttempts,
+			respError: "alias already exists",
+			wantCode:  http.StatusConflict,
+		},
+		{
+			name:      "Skip reserved alias",
+			rejected:  1,
+			taken:     1,
+			wantAlias: "alias3",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "Every alias rejected",
+			rejected:  AliasAttempts,
+			respError: "failed to add URL",
+			wantCode:  http.StatusInternalServerError,
+		},
+		{
+			name:      "Generator error",
+			genError:  errors.New("unexpected error"),
+			respError: "failed to add URL",
+			wantCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlSaverMock := mocks.NewURLSaver(t)
+			aliasGeneratorMock := mocks.NewAliasGenerator(t)
+
+			aliasRulesMock := mocks.NewAliasRules(t)
+			aliasRulesMock.On("Team", "").Return("", nil).Once()
+
+			if tc.genError != nil {
+				aliasGeneratorMock.On("Generate", mock.Anything).Return("", int64(0), tc.genError).Once()
+			}
+
+			attempts := min(tc.rejected+tc.taken+1, AliasAttempts)
+			for i := 1; tc.genError == nil && i <= attempts; i++ {
+				generated, id := fmt.Sprintf("alias%d", i), int64(i)
+				aliasGeneratorMock.On("Generate", mock.Anything).Return(generated, id, nil).Once()
+
+				if i <= tc.rejected {
+					aliasRulesMock.On("Generated", generated).Return(errors.New("field Alias is reserved")).Once()
+					continue
+				}
+				aliasRulesMock.On("Generated", generated).Return(nil).Once()
+
+				var err error
+				if i <= tc.rejected+tc.taken {
+					err = storage.ErrAliasExists
+				}
+
+				// the reserved id is saved along with the alias derived from it
+				urlSaverMock.On("SaveURL", mock.Anything, mock.MatchedBy(func(u models.URL) bool {
+					return u.Alias == generated && u.ID == id
+				}), false).Return(id, err).Once()
+			}
+
+			urlCheckerMock := mocks.NewURLChecker(t)
+			urlCheckerMock.On("Check", mock.Anything, "https://google.com").Return(nil).Once()
+
+			handler := New(slogdiscard.NewDiscardLogger(), urlSaverMock, mocks.NewURLFinder(t), models.DuplicatesAllow, aliasGeneratorMock, aliasRulesMock, urlCheckerMock, mocks.NewAuthorizer(t), mocks.NewDomainFinder(t))
+
+			req := httptest.NewRequest(http.MethodPost, "/url", strings.NewReader(`{"url": "https://google.com"}`))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+			require.Equal(t, tc.wantAlias, resp.Alias)
 		})
 	}
 }
+
+func TestSaveHandlerDuplicateRace(t *testing.T) {
+	cases := []struct {
+		name       string
+		duplicates string
+		wantAlias  string
+		respError  string
+		wantCode   int
+	}{
+		{name: "Rejected", duplicates: models.DuplicatesReject, respError: "URL already exists", wantCode: http.StatusConflict},
+		{name: "Idempotent", duplicates: models.DuplicatesIdempotent, wantAlias: "goog", wantCode: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// nothing is found before the save, a concurrent request saves the url first
+			urlFinderMock := mocks.NewURLFinder(t)
+			urlFinderMock.On("FindURL", mock.Anything, "https://google.com", "", int64(7), "", mock.AnythingOfType("time.Time")).
+				Return(models.URL{}, storage.ErrURLNotFound).
+				Once()
+			if tc.duplicates == models.DuplicatesIdempotent {
+				urlFinderMock.On("FindURL", mock.Anything, "https://google.com", "", int64(7), "", mock.AnythingOfType("time.Time")).
+					Return(models.URL{Alias: "goog", URL: "https://google.com"}, nil).
+					Once()
+			}
+
+			urlSaverMock := mocks.NewURLSaver(t)
+			urlSaverMock.On("SaveURL", mock.Anything, mock.AnythingOfType("models.URL"), true).
+				Return(int64(0), storage.ErrURLExists).
+				Once()
+
+			aliasGeneratorMock := mocks.NewAliasGenerator(t)
+			aliasGeneratorMock.On("Generate", mock.Anything).Return("Ab3dE6", int64(0), nil).Once()
+
+			urlCheckerMock := mocks.NewURLChecker(t)
+			urlCheckerMock.On("Check", mock.Anything, "https://google.com").Return(nil).Once()
+
+			handler := New(slogdiscard.NewDiscardLogger(), urlSaverMock, urlFinderMock, tc.duplicates, aliasGeneratorMock, newRules(t), urlCheckerMock, mocks.NewAuthorizer(t), mocks.NewDomainFinder(t))
+
+			req := httptest.NewRequest(http.MethodPost, "/url", strings.NewReader(`{"url": "https://google.com"}`))
+			req = req.WithContext(auth.WithUser(req.Context(), auth.User{ID: 7}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+			require.Equal(t, tc.wantAlias, resp.Alias)
+		})
+	}
+}
+
+func TestSaveHandlerIdempotencyKey(t *testing.T) {
+	const first = `{"url": "https://google.com", "alias": "job"}`
+
+	keys := storage.NewMemory()
+
+	// the key of a request still in progress
+	require.NoError(t, keys.SaveIdempotencyKey(context.Background(), models.IdempotencyKey{
+		Owner:       "user:7",
+		Key:         "running",
+		RequestHash: requestHash([]byte(first)),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}))
+
+	urlSaverMock := mocks.NewURLSaver(t)
+	urlSaverMock.On("SaveURL", mock.Anything, mock.MatchedBy(func(u models.URL) bool { return u.Alias == "job" }), false).
+		Return(int64(1), nil).
+		Once()
+	// the first save of retry fails, the key is released for the next attempt
+	urlSaverMock.On("SaveURL", mock.Anything, mock.MatchedBy(func(u models.URL) bool { return u.Alias == "retry" }), false).
+		Return(int64(0), errors.New("database is down")).
+		Once()
+	urlSaverMock.On("SaveURL", mock.Anything, mock.MatchedBy(func(u models.URL) bool { return u.Alias == "retry" }), false).
+		Return(int64(2), nil).
+		Once()
+
+	urlCheckerMock := mocks.NewURLChecker(t)
+	urlCheckerMock.On("Check", mock.Anything, "https://google.com").Return(nil)
+
+	handler := Idempotent(slogdiscard.NewDiscardLogger(), keys, time.Hour)(New(slogdiscard.NewDiscardLogger(), urlSaverMock, mocks.NewURLFinder(t), models.DuplicatesAllow,
+		mocks.NewAliasGenerator(t), newRules(t), urlCheckerMock, mocks.NewAuthorizer(t), mocks.NewDomainFinder(t)))
+
+	cases := []struct {
+		name         string
+		key          string
+		body         string
+		wantCode     int
+		wantBody     string
+		wantReplayed bool
+	}{
+		{name: "First request", key: "job-1", body: first, wantCode: http.StatusOK, wantBody: `{"status":"OK","alias":"job"}`},
+		{name: "Replay", key: "job-1", body: first, wantCode: http.StatusOK, wantBody: `{"status":"OK","alias":"job"}`, wantReplayed: true},
+		{
+			name:     "Another body",
+			key:      "job-1",
+			body:     `{"url": "https://google.com", "alias": "job2"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `{"status":"Error","error":"Idempotency-Key was used with another request"}`,
+		},
+		{
+			name:     "In progress",
+			key:      "running",
+			body:     first,
+			wantCode: http.StatusConflict,
+			wantBody: `{"status":"Error","error":"request with the same Idempotency-Key is in progress"}`,
+		},
+		{
+			name:     "Failed request",
+			key:      "job-2",
+			body:     `{"url": "https://google.com", "alias": "retry"}`,
+			wantCode: http.StatusInternalServerError,
+			wantBody: `{"status":"Error","error":"failed to add URL"}`,
+		},
+		{name: "Retry of a failed request", key: "job-2", body: `{"url": "https://google.com", "alias": "retry"}`, wantCode: http.StatusOK, wantBody: `{"status":"OK","alias":"retry"}`},
+		{
+			name:     "Body too large",
+			key:      "job-3",
+			body:     `{"url": "https://google.com", "alias": "` + strings.Repeat("a", maxBodyBytes) + `"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"Error","error":"invalid request body"}`,
+		},
+		{
+			name:     "Key too long",
+			key:      strings.Repeat("k", MaxIdempotencyKeyLength+1),
+			body:     first,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"status":"Error","error":"Idempotency-Key header must be at most 255 characters long"}`,
+		},
+	}
+
+	// the cases run in order, every one sees the keys of the ones before
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/url", strings.NewReader(tc.body))
+			req.Header.Set(IdempotencyKeyHeader, tc.key)
+			req = req.WithContext(auth.WithUser(req.Context(), auth.User{ID: 7}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+			require.JSONEq(t, tc.wantBody, rr.Body.String())
+			require.Equal(t, tc.wantReplayed, rr.Header().Get(IdempotentReplayedHeader) == "true")
+		})
+	}
+}
+
+func TestIdempotentReleasedKey(t *testing.T) {
+	keysMock := mocks.NewIdempotencyKeys(t)
+
+	// the first request fails and releases the key between the save and the lookup of this one
+	keysMock.On("SaveIdempotencyKey", mock.Anything, mock.AnythingOfType("models.IdempotencyKey")).
+		Return(storage.ErrIdempotencyKeyExists).
+		Once()
+	keysMock.On("GetIdempotencyKey", mock.Anything, "user:7", "job-1", mock.AnythingOfType("time.Time")).
+		Return(models.IdempotencyKey{}, storage.ErrIdempotencyKeyNotFound).
+		Once()
+	keysMock.On("SaveIdempotencyKey", mock.Anything, mock.AnythingOfType("models.IdempotencyKey")).
+		Return(nil).
+		Once()
+	keysMock.On("CompleteIdempotencyKey", mock.Anything, mock.MatchedBy(func(k models.IdempotencyKey) bool {
+		return k.Status == http.StatusOK
+	})).Return(nil).Once()
+
+	handler := Idempotent(slogdiscard.NewDiscardLogger(), keysMock, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/url", strings.NewReader(`{"url": "https://google.com"}`))
+	req.Header.Set(IdempotencyKeyHeader, "job-1")
+	req = req.WithContext(auth.WithUser(req.Context(), auth.User{ID: 7}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestIdempotentRateLimited(t *testing.T) {
+	limited := true
+	handler := Idempotent(slogdiscard.NewDiscardLogger(), storage.NewMemory(), time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// a rate limited request isn't replayed, its retry runs once the limit allows
+	for _, wantCode := range []int{http.StatusTooManyRequests, http.StatusOK, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/url", strings.NewReader(`{"url": "https://google.com"}`))
+		req.Header.Set(IdempotencyKeyHeader, "job-1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, wantCode, rr.Code)
+		limited = false
+	}
+}
+
+// newRules returns the default alias rules with namespaces enabled
+// and the "url" route reserved
+func newRules(t *testing.T) *alias.Rules {
+	t.Helper()
+
+	rules, err := alias.NewRules(config.AliasRules{
+		MinLength:       1,
+		MaxLength:       64,
+		ProfanityFilter: true,
+		Namespaces:      true,
+	})
+	require.NoError(t, err)
+
+	rules.Reserve("url")
+
+	return rules
+}
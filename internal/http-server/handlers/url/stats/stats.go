@@ -0,0 +1,186 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type Response struct {
+	resp.Response
+	Domain         string    `json:"domain,omitempty"`
+	Alias          string    `json:"alias,omitempty"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	Total          int64     `json:"total"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+	Buckets        []Bucket  `json:"buckets"`
+}
+
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+//go:generate mockery --name=StatsGetter --dir=. --output=./mocks --filename=stats_getter_mock.go --outpkg=mocks
+type StatsGetter interface {
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+	URLStats(ctx context.Context, domain, alias string, from, to time.Time, bucket string) (models.Stats, error)
+}
+
+// defaultWindow is used when the request has no from parameter
+const defaultWindow = 7 * 24 * time.Hour
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// New returns totals, unique visitors and clicks per hour or day for an alias
+// to whoever the policy lets view its stats.
+// Query parameters: from, to (RFC3339) and bucket (hour or day, day by default).
+func New(log *slog.Logger, statsGetter StatsGetter, policy Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.stats.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		domain, alias := chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
+		if alias == "" {
+			log.ErrorContext(r.Context(), "alias is empty")
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+
+			return
+		}
+
+		query := r.URL.Query()
+
+		to := time.Now().UTC()
+		if raw := query.Get("to"); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid to parameter", sl.Err(err))
+				resp.JSON(w, r, http.StatusBadRequest, resp.Error("field to is not a valid RFC3339 time"))
+
+				return
+			}
+			to = parsed
+		}
+
+		from := to.Add(-defaultWindow)
+		if raw := query.Get("from"); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				log.ErrorContext(r.Context(), "invalid from parameter", sl.Err(err))
+				resp.JSON(w, r, http.StatusBadRequest, resp.Error("field from is not a valid RFC3339 time"))
+
+				return
+			}
+			from = parsed
+		}
+
+		if !from.Before(to) {
+			log.ErrorContext(r.Context(), "invalid time range", slog.Time("from", from), slog.Time("to", to))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("from must be before to"))
+
+			return
+		}
+
+		bucket := query.Get("bucket")
+		if bucket == "" {
+			bucket = models.BucketDay
+		}
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		url, err := statsGetter.GetUrl(r.Context(), domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.InfoContext(r.Context(), "URL not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("URL not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get url", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		err = policy.Authorize(r.Context(), user, authz.ActionViewStats, authz.LinkOf(url))
+		if errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(r.Context(), "user may not view the stats of the url",
+				slog.Int64("user_id", user.ID),
+				slog.Int64("owner_id", url.UserID),
+			)
+			resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+
+		stats, err := statsGetter.URLStats(r.Context(), domain, alias, from, to, bucket)
+		switch {
+		case err == nil:
+		case errors.Is(err, storage.ErrInvalidBucket):
+			log.ErrorContext(r.Context(), "invalid bucket", slog.String("bucket", bucket))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("field bucket must be hour or day"))
+
+			return
+		case errors.Is(err, storage.ErrURLNotFound):
+			log.InfoContext(r.Context(), "URL not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("URL not found"))
+
+			return
+		default:
+			log.ErrorContext(r.Context(), "failed to get stats", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("internal error"))
+
+			return
+		}
+
+		responseOk(w, r, stats)
+	}
+}
+
+func responseOk(w http.ResponseWriter, r *http.Request, stats models.Stats) {
+	buckets := make([]Bucket, 0, len(stats.Buckets))
+	for _, b := range stats.Buckets {
+		buckets = append(buckets, Bucket{Start: b.Start, Count: b.Count})
+	}
+
+	resp.JSON(w, r, http.StatusOK, Response{
+		Response:       resp.OK(),
+		Domain:         stats.Domain,
+		Alias:          stats.Alias,
+		From:           stats.From,
+		To:             stats.To,
+		Total:          stats.Total,
+		UniqueVisitors: stats.UniqueVisitors,
+		Buckets:        buckets,
+	})
+}
@@ -0,0 +1,171 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/stats/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatsHandler(t *testing.T) {
+	const ownerID = 7
+
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		alias      string
+		query      string
+		user       *auth.User
+		getError   error
+		authzError error
+		wantBucket string
+		mockStats  models.Stats
+		mockError  error
+		respError  string
+		wantCode   int
+		wantTotal  int64
+	}{
+		{
+			name:       "Success",
+			alias:      "google",
+			query:      "?from=2025-03-01T00:00:00Z&to=2025-03-02T00:00:00Z&bucket=hour",
+			wantBucket: models.BucketHour,
+			mockStats: models.Stats{
+				Alias:          "google",
+				Total:          3,
+				UniqueVisitors: 2,
+				Buckets:        []models.StatsBucket{{Start: day, Count: 3}},
+			},
+			wantCode:  http.StatusOK,
+			wantTotal: 3,
+		},
+		{
+			name:       "Default window",
+			alias:      "google",
+			wantBucket: models.BucketDay,
+			mockStats:  models.Stats{Alias: "google"},
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:      "Invalid from",
+			alias:     "google",
+			query:     "?from=yesterday",
+			respError: "field from is not a valid RFC3339 time",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "From after to",
+			alias:     "google",
+			query:     "?from=2025-03-02T00:00:00Z&to=2025-03-01T00:00:00Z",
+			respError: "from must be before to",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid bucket",
+			alias:      "google",
+			query:      "?bucket=week",
+			wantBucket: "week",
+			mockError:  storage.ErrInvalidBucket,
+			respError:  "field bucket must be hour or day",
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:      "URL not found",
+			alias:     "missing",
+			getError:  storage.ErrURLNotFound,
+			respError: "URL not found",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:       "Forbidden",
+			alias:      "google",
+			authzError: authz.ErrForbidden,
+			respError:  "forbidden",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "SSO unavailable",
+			alias:      "google",
+			authzError: errors.New("connection refused"),
+			respError:  "failed to check permissions",
+			wantCode:   http.StatusInternalServerError,
+		},
+		{
+			name:      "Unauthenticated",
+			alias:     "google",
+			user:      &auth.User{},
+			respError: "unauthorized",
+			wantCode:  http.StatusUnauthorized,
+		},
+		{
+			name:       "Storage error",
+			alias:      "google",
+			wantBucket: models.BucketDay,
+			mockError:  errors.New("unexpected error"),
+			respError:  "internal error",
+			wantCode:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			statsGetterMock := mocks.NewStatsGetter(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			// the zero user stands for a request without one
+			user := auth.User{ID: ownerID}
+			if tc.user != nil {
+				user = *tc.user
+			}
+
+			checked := tc.wantBucket != "" || tc.getError != nil || tc.authzError != nil
+			if checked && user.ID != 0 {
+				statsGetterMock.On("GetUrl", mock.Anything, "", tc.alias).
+					Return(models.URL{Alias: tc.alias, UserID: ownerID}, tc.getError).
+					Once()
+			}
+			if checked && user.ID != 0 && tc.getError == nil {
+				authorizerMock.On("Authorize", mock.Anything, user, authz.ActionViewStats, authz.Resource{Owner: ownerID}).
+					Return(tc.authzError).
+					Once()
+			}
+			if tc.wantBucket != "" {
+				statsGetterMock.On("URLStats", mock.Anything, "", tc.alias, mock.Anything, mock.Anything, tc.wantBucket).
+					Return(tc.mockStats, tc.mockError).
+					Once()
+			}
+
+			r := chi.NewRouter()
+			r.Get("/url/{alias}/stats", New(slogdiscard.NewDiscardLogger(), statsGetterMock, authorizerMock))
+
+			req := httptest.NewRequest(http.MethodGet, "/url/"+tc.alias+"/stats"+tc.query, nil)
+			if user.ID != 0 {
+				req = req.WithContext(auth.WithUser(req.Context(), user))
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+			require.Equal(t, tc.wantTotal, resp.Total)
+		})
+	}
+}
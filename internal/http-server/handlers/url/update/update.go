@@ -0,0 +1,319 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/save"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/api/etag"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Request changes a link. With PATCH missing fields keep their values,
+// with PUT they are reset: no expiry, the default redirect type, no query
+// passthrough, no UTM parameters and no interstitial page.
+type Request struct {
+	URL *string `json:"url,omitempty" validate:"omitempty,url"`
+	// ExpiresAt set to null removes the expiry on PATCH
+	ExpiresAt NullableTime `json:"expires_at"`
+	// TTL is a duration like "72h", it is an alternative to ExpiresAt
+	TTL          string `json:"ttl,omitempty"`
+	RedirectType *int   `json:"redirect_type,omitempty"`
+	PassQuery    *bool  `json:"pass_query,omitempty"`
+	// UTM replaces every UTM parameter of the link, {} removes them
+	UTM          *save.UTM `json:"utm,omitempty"`
+	Interstitial *bool     `json:"interstitial,omitempty"`
+}
+
+// NullableTime tells an explicit null apart from a missing field
+type NullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+
+	if string(data) == "null" {
+		t.Value = nil
+		return nil
+	}
+
+	var value time.Time
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	t.Value = &value
+
+	return nil
+}
+
+type Response struct {
+	resp.Response
+	URL          string     `json:"url,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	PassQuery    bool       `json:"pass_query,omitempty"`
+	UTM          *save.UTM  `json:"utm,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	Revision     int64      `json:"revision,omitempty"`
+}
+
+//go:generate mockery --name=URLGetter --dir=. --output=./mocks --filename=url_getter_mock.go --outpkg=mocks
+type URLGetter interface {
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+}
+
+//go:generate mockery --name=URLUpdater --dir=. --output=./mocks --filename=url_updater_mock.go --outpkg=mocks
+type URLUpdater interface {
+	UpdateURL(ctx context.Context, u models.URL, revision int64, changedBy int64, unique bool) (models.URL, error)
+}
+
+//go:generate mockery --name=URLChecker --dir=. --output=./mocks --filename=url_checker_mock.go --outpkg=mocks
+type URLChecker interface {
+	Check(ctx context.Context, rawURL string) error
+}
+
+//go:generate mockery --name=Authorizer --dir=. --output=./mocks --filename=authorizer_mock.go --outpkg=mocks
+type Authorizer interface {
+	Authorize(ctx context.Context, user auth.User, action authz.Action, res authz.Resource) error
+}
+
+// New retargets a link with PATCH or PUT.
+// The request must carry If-Match with the ETag of the link, a stale one
+// answers 412 so concurrent edits don't overwrite each other. The link is
+// read with getter, which must not be cached: a stale revision would answer
+// 412 and an old ETag to every retry.
+// The policy decides who may update the link.
+// A new destination has to pass the URL policy like a saved one, unless
+// duplicates is models.DuplicatesAllow it must not have a link on the domain yet,
+// a link can't be answered instead of an update, so idempotent rejects too.
+func New(log *slog.Logger, getter URLGetter, updater URLUpdater, duplicates string, policy Authorizer, checker URLChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.update.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		domain, alias := chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
+		if alias == "" {
+			log.ErrorContext(r.Context(), "alias is empty")
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("alias is empty"))
+
+			return
+		}
+
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			log.ErrorContext(r.Context(), "no authenticated user")
+			resp.JSON(w, r, http.StatusUnauthorized, resp.Error("unauthorized"))
+
+			return
+		}
+
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			log.ErrorContext(r.Context(), "If-Match header is missing")
+			resp.JSON(w, r, http.StatusPreconditionRequired, resp.Error("If-Match header is required"))
+
+			return
+		}
+
+		var req Request
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to decode request body", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error("invalid request body"))
+
+			return
+		}
+
+		log.InfoContext(r.Context(), "request body decoded", slog.Any("request", req))
+
+		if err := validator.New().Struct(req); err != nil {
+			var validateErr validator.ValidationErrors
+			errors.As(err, &validateErr)
+
+			log.ErrorContext(r.Context(), "invalid request", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.ValidationError(validateErr))
+
+			return
+		}
+
+		current, err := getter.GetUrl(r.Context(), domain, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.InfoContext(r.Context(), "alias not found", slog.String("alias", alias))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to get url", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("unexpected error"))
+
+			return
+		}
+
+		err = policy.Authorize(r.Context(), user, authz.ActionUpdate, authz.LinkOf(current))
+		if errors.Is(err, authz.ErrForbidden) {
+			log.WarnContext(r.Context(), "user may not update the url",
+				slog.Int64("user_id", user.ID),
+				slog.Int64("owner_id", current.UserID),
+			)
+			resp.JSON(w, r, http.StatusForbidden, resp.Error("forbidden"))
+
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "failed to check permissions", slog.Int64("user_id", user.ID), sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check permissions"))
+
+			return
+		}
+
+		if !etag.Match(ifMatch, current.Revision) {
+			log.InfoContext(r.Context(), "stale If-Match", slog.String("if_match", ifMatch), slog.Int64("revision", current.Revision))
+			w.Header().Set("ETag", etag.Of(current.Revision))
+			resp.JSON(w, r, http.StatusPreconditionFailed, resp.Error("link was changed, fetch it again"))
+
+			return
+		}
+
+		next, err := apply(current, req, r.Method == http.MethodPut, time.Now())
+		if err != nil {
+			log.ErrorContext(r.Context(), "invalid update", sl.Err(err))
+			resp.JSON(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+
+			return
+		}
+
+		if next.URL != current.URL {
+			if err := checker.Check(r.Context(), next.URL); err != nil {
+				log.ErrorContext(r.Context(), "url rejected", sl.Err(err))
+				status, body := save.PolicyError(err)
+				resp.JSON(w, r, status, body)
+
+				return
+			}
+		}
+
+		updated, err := updater.UpdateURL(r.Context(), next, current.Revision, user.ID, duplicates != models.DuplicatesAllow)
+
+		switch {
+		case err == nil:
+			log.InfoContext(r.Context(), "url updated", slog.Int64("revision", updated.Revision))
+			responseOk(w, r, updated)
+		case errors.Is(err, storage.ErrRevisionMismatch):
+			log.InfoContext(r.Context(), "url changed concurrently", sl.Err(err))
+			resp.JSON(w, r, http.StatusPreconditionFailed, resp.Error("link was changed, fetch it again"))
+		case errors.Is(err, storage.ErrURLNotFound):
+			log.InfoContext(r.Context(), "alias not found", sl.Err(err))
+			resp.JSON(w, r, http.StatusNotFound, resp.Error("alias not found"))
+		case errors.Is(err, storage.ErrURLExists):
+			log.InfoContext(r.Context(), "url already exists", slog.String("url", next.URL))
+			resp.JSON(w, r, http.StatusConflict, resp.Error("URL already exists"))
+		default:
+			log.ErrorContext(r.Context(), "failed to update url", sl.Err(err))
+			resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to update URL"))
+		}
+	}
+}
+
+// apply returns current changed by req, replace resets the fields req doesn't set
+func apply(current models.URL, req Request, replace bool, now time.Time) (models.URL, error) {
+	next := current
+
+	if replace {
+		if req.URL == nil {
+			return models.URL{}, errors.New("field URL is a required field")
+		}
+		next.ExpiresAt = nil
+		next.RedirectType = models.DefaultRedirectType
+		next.PassQuery = false
+		next.UTM = models.UTM{}
+		next.Interstitial = false
+	} else if req.URL == nil && !req.ExpiresAt.Set && req.TTL == "" && req.RedirectType == nil &&
+		req.PassQuery == nil && req.UTM == nil && req.Interstitial == nil {
+		return models.URL{}, errors.New("nothing to update")
+	}
+
+	if req.URL != nil {
+		next.URL = *req.URL
+	}
+
+	switch {
+	case req.ExpiresAt.Set && req.TTL != "":
+		return models.URL{}, errors.New("only one of expires_at and ttl can be set")
+	case req.ExpiresAt.Value != nil:
+		if !req.ExpiresAt.Value.After(now) {
+			return models.URL{}, errors.New("field expires_at must be in the future")
+		}
+
+		expiresAt := req.ExpiresAt.Value.UTC()
+		next.ExpiresAt = &expiresAt
+	case req.ExpiresAt.Set:
+		next.ExpiresAt = nil
+	case req.TTL != "":
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return models.URL{}, errors.New("field ttl must be a positive duration like 24h")
+		}
+
+		expiresAt := now.Add(ttl).UTC()
+		next.ExpiresAt = &expiresAt
+	}
+
+	if req.RedirectType != nil {
+		if !models.ValidRedirectType(*req.RedirectType) {
+			return models.URL{}, errors.New("field redirect_type must be one of 301, 302, 307, 308")
+		}
+		next.RedirectType = *req.RedirectType
+	}
+
+	if req.PassQuery != nil {
+		next.PassQuery = *req.PassQuery
+	}
+
+	if req.UTM != nil {
+		next.UTM = models.UTM(*req.UTM)
+	}
+
+	if req.Interstitial != nil {
+		next.Interstitial = *req.Interstitial
+	}
+
+	return next, nil
+}
+
+func responseOk(w http.ResponseWriter, r *http.Request, u models.URL) {
+	w.Header().Set("ETag", etag.Of(u.Revision))
+
+	response := Response{
+		Response:     resp.OK(),
+		URL:          u.URL,
+		ExpiresAt:    u.ExpiresAt,
+		RedirectType: u.RedirectType,
+		PassQuery:    u.PassQuery,
+		UTM:          save.UTMOf(u.UTM),
+		Interstitial: u.Interstitial,
+		Revision:     u.Revision,
+	}
+	response.Alias = u.Alias
+
+	resp.JSON(w, r, http.StatusOK, response)
+}
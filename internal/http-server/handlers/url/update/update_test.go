@@ -0,0 +1,322 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/authz"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/handlers/url/update/mocks"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateHandler(t *testing.T) {
+	const ownerID = 7
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	current := models.URL{
+		ID:           1,
+		Alias:        "google",
+		URL:          "https://gogle.com",
+		UserID:       ownerID,
+		ExpiresAt:    &expiresAt,
+		RedirectType: models.DefaultRedirectType,
+		Revision:     3,
+	}
+
+	with := func(change func(u *models.URL)) *models.URL {
+		u := current
+		change(&u)
+		return &u
+	}
+
+	cases := []struct {
+		name        string
+		method      string
+		body        string
+		ifMatch     string
+		user        *auth.User
+		noGet       bool
+		getError    error
+		forbidden   bool
+		wantUpdate  *models.URL
+		updateError error
+		rejected    string // the URL policy rejects it
+		respError   string
+		wantCode    int
+	}{
+		{
+			name:       "Patch url",
+			method:     http.MethodPatch,
+			body:       `{"url": "https://google.com"}`,
+			ifMatch:    `"3"`,
+			user:       &auth.User{ID: ownerID},
+			wantUpdate: with(func(u *models.URL) { u.URL = "https://google.com" }),
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Patch removes expiry",
+			method:     http.MethodPatch,
+			body:       `{"expires_at": null, "redirect_type": 301}`,
+			ifMatch:    `"3"`,
+			user:       &auth.User{ID: ownerID},
+			wantUpdate: with(func(u *models.URL) { u.ExpiresAt = nil; u.RedirectType = 301 }),
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:    "Patch redirect options",
+			method:  http.MethodPatch,
+			body:    `{"pass_query": true, "utm": {"source": "mail", "campaign": "spring"}, "interstitial": true}`,
+			ifMatch: `"3"`,
+			user:    &auth.User{ID: ownerID},
+			wantUpdate: with(func(u *models.URL) {
+				u.PassQuery = true
+				u.UTM = models.UTM{Source: "mail", Campaign: "spring"}
+				u.Interstitial = true
+			}),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "UTM too long",
+			method:    http.MethodPatch,
+			body:      `{"utm": {"source": "` + strings.Repeat("a", 257) + `"}}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: ownerID},
+			noGet:     true,
+			respError: "field Source must be at most 256 characters long",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:    "Put resets missing fields",
+			method:  http.MethodPut,
+			body:    `{"url": "https://google.com"}`,
+			ifMatch: `*`,
+			user:    &auth.User{Service: true},
+			wantUpdate: with(func(u *models.URL) {
+				u.URL = "https://google.com"
+				u.ExpiresAt = nil
+			}),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "Allowed by the policy",
+			method:     http.MethodPatch,
+			body:       `{"url": "https://google.com"}`,
+			ifMatch:    `"3"`,
+			user:       &auth.User{ID: 1},
+			wantUpdate: with(func(u *models.URL) { u.URL = "https://google.com" }),
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:      "Other user",
+			method:    http.MethodPatch,
+			body:      `{"url": "https://google.com"}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: 8},
+			forbidden: true,
+			respError: "forbidden",
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:      "Stale If-Match",
+			method:    http.MethodPatch,
+			body:      `{"url": "https://google.com"}`,
+			ifMatch:   `"2"`,
+			user:      &auth.User{ID: ownerID},
+			respError: "link was changed, fetch it again",
+			wantCode:  http.StatusPreconditionFailed,
+		},
+		{
+			name:        "Concurrent update",
+			method:      http.MethodPatch,
+			body:        `{"url": "https://google.com"}`,
+			ifMatch:     `"3"`,
+			user:        &auth.User{ID: ownerID},
+			wantUpdate:  with(func(u *models.URL) { u.URL = "https://google.com" }),
+			updateError: storage.ErrRevisionMismatch,
+			respError:   "link was changed, fetch it again",
+			wantCode:    http.StatusPreconditionFailed,
+		},
+		{
+			name:        "URL of another link",
+			method:      http.MethodPatch,
+			body:        `{"url": "https://yandex.ru"}`,
+			ifMatch:     `"3"`,
+			user:        &auth.User{ID: ownerID},
+			wantUpdate:  with(func(u *models.URL) { u.URL = "https://yandex.ru" }),
+			updateError: storage.ErrURLExists,
+			respError:   "URL already exists",
+			wantCode:    http.StatusConflict,
+		},
+		{
+			name:      "Missing If-Match",
+			method:    http.MethodPatch,
+			body:      `{"url": "https://google.com"}`,
+			user:      &auth.User{ID: ownerID},
+			respError: "If-Match header is required",
+			noGet:     true,
+			wantCode:  http.StatusPreconditionRequired,
+		},
+		{
+			name:      "Put without url",
+			method:    http.MethodPut,
+			body:      `{"ttl": "1h"}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: ownerID},
+			respError: "field URL is a required field",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Empty patch",
+			method:    http.MethodPatch,
+			body:      `{}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: ownerID},
+			respError: "nothing to update",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid redirect type",
+			method:    http.MethodPatch,
+			body:      `{"redirect_type": 200}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: ownerID},
+			respError: "field redirect_type must be one of 301, 302, 307, 308",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid url",
+			method:    http.MethodPatch,
+			body:      `{"url": "not a url"}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: ownerID},
+			respError: "field URL is not a valid URL",
+			noGet:     true,
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Alias not found",
+			method:    http.MethodPatch,
+			body:      `{"url": "https://google.com"}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: ownerID},
+			getError:  storage.ErrURLNotFound,
+			respError: "alias not found",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:        "Storage error",
+			method:      http.MethodPatch,
+			body:        `{"url": "https://google.com"}`,
+			ifMatch:     `"3"`,
+			user:        &auth.User{ID: ownerID},
+			wantUpdate:  with(func(u *models.URL) { u.URL = "https://google.com" }),
+			updateError: errors.New("unexpected error"),
+			respError:   "failed to update URL",
+			wantCode:    http.StatusInternalServerError,
+		},
+		{
+			name:      "Rejected by URL policy",
+			method:    http.MethodPatch,
+			body:      `{"url": "http://169.254.169.254/latest"}`,
+			ifMatch:   `"3"`,
+			user:      &auth.User{ID: ownerID},
+			rejected:  "http://169.254.169.254/latest",
+			respError: "field URL points to the non-public address 169.254.169.254",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Unauthenticated",
+			method:    http.MethodPatch,
+			body:      `{"url": "https://google.com"}`,
+			ifMatch:   `"3"`,
+			respError: "unauthorized",
+			noGet:     true,
+			wantCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			urlGetterMock := mocks.NewURLGetter(t)
+			urlUpdaterMock := mocks.NewURLUpdater(t)
+			authorizerMock := mocks.NewAuthorizer(t)
+
+			if !tc.noGet {
+				urlGetterMock.On("GetUrl", mock.Anything, "", "google").
+					Return(current, tc.getError).
+					Once()
+			}
+			if !tc.noGet && tc.getError == nil {
+				var authzError error
+				if tc.forbidden {
+					authzError = authz.ErrForbidden
+				}
+				authorizerMock.On("Authorize", mock.Anything, *tc.user, authz.ActionUpdate, authz.LinkOf(current)).
+					Return(authzError).
+					Once()
+			}
+			if tc.wantUpdate != nil {
+				updated := *tc.wantUpdate
+				updated.Revision++
+
+				urlUpdaterMock.On("UpdateURL", mock.Anything, *tc.wantUpdate, current.Revision, tc.user.ID, true).
+					Return(updated, tc.updateError).
+					Once()
+			}
+
+			// only a new destination is checked
+			urlCheckerMock := mocks.NewURLChecker(t)
+			switch {
+			case tc.rejected != "":
+				urlCheckerMock.On("Check", mock.Anything, tc.rejected).Return(&urlpolicy.Violation{
+					Rule:    urlpolicy.RulePrivateAddress,
+					Message: tc.respError,
+				}).Once()
+			case tc.wantUpdate != nil && tc.wantUpdate.URL != current.URL:
+				urlCheckerMock.On("Check", mock.Anything, mock.AnythingOfType("string")).Return(nil).Once()
+			}
+
+			r := chi.NewRouter()
+			r.Method(tc.method, "/url/{alias}", New(slogdiscard.NewDiscardLogger(), urlGetterMock, urlUpdaterMock, models.DuplicatesReject, authorizerMock, urlCheckerMock))
+
+			req := httptest.NewRequest(tc.method, "/url/google", bytes.NewReader([]byte(tc.body)))
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			if tc.user != nil {
+				req = req.WithContext(auth.WithUser(context.Background(), *tc.user))
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.respError, resp.Error)
+
+			if tc.wantCode == http.StatusOK {
+				require.Equal(t, `"4"`, rr.Header().Get("ETag"))
+				require.Equal(t, int64(4), resp.Revision)
+				require.Equal(t, tc.wantUpdate.URL, resp.URL)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package aliasparam
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"net/http"
+	"strings"
+)
+
+// URLSearcher finds the link saved under an alias on a domain
+type URLSearcher interface {
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+}
+
+// New rewrites the "alias" URL parameter into the alias the link is stored
+// under: the "team" parameter of /t/{team}/{alias} routes becomes its
+// namespace and fold applies the case policy. The "domain" parameter of
+// /d/{domain}/... routes, or of the domains middleware, is lowercased. The
+// handlers after it read both with chi.URLParam as before.
+//
+// Links saved before the case policy folded aliases keep their case, so if
+// no link is saved under the folded alias but one is under the alias as it
+// was asked for, that one is served.
+func New(fold func(string) string, urls URLSearcher) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rctx := chi.RouteContext(r.Context())
+			if rctx == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			team := rctx.URLParam("team")
+			alias := rctx.URLParam("alias")
+			// hosts are case-insensitive whatever the case policy
+			domain := strings.ToLower(rctx.URLParam("domain"))
+
+			folded := models.TeamAlias(fold(team), fold(alias))
+			if exact := models.TeamAlias(team, alias); exact != folded && saved(r.Context(), urls, domain, exact, folded) {
+				folded = exact
+			}
+
+			// URLParam returns the last value added for a key
+			rctx.URLParams.Add("domain", domain)
+			rctx.URLParams.Add("alias", folded)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// saved reports whether a link is saved under exact on domain but none under
+// folded, a failed lookup leaves the folded alias to the handler to fail on
+func saved(ctx context.Context, urls URLSearcher, domain, exact, folded string) bool {
+	if _, err := urls.GetUrl(ctx, domain, folded); !errors.Is(err, storage.ErrURLNotFound) {
+		return false
+	}
+
+	_, err := urls.GetUrl(ctx, domain, exact)
+
+	return err == nil
+}
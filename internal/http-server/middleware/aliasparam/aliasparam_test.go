@@ -0,0 +1,83 @@
+package aliasparam
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name       string
+		path       string
+		fold       func(string) string
+		wantDomain string
+		wantAlias  string
+	}{
+		{name: "Plain", path: "/Promo", fold: keep, wantAlias: "Promo"},
+		{name: "Team", path: "/t/sales/spring", fold: keep, wantAlias: "sales/spring"},
+		{name: "Team subroute", path: "/t/sales/spring/stats", fold: keep, wantAlias: "sales/spring"},
+		{name: "Folded", path: "/t/Sales/Spring", fold: strings.ToLower, wantAlias: "sales/spring"},
+		{name: "Domain", path: "/d/Go.Brand.com/Promo", fold: keep, wantDomain: "go.brand.com", wantAlias: "Promo"},
+		{name: "Team of a domain", path: "/d/go.brand.com/t/sales/spring/stats", fold: keep, wantDomain: "go.brand.com", wantAlias: "sales/spring"},
+		{name: "Saved before folding", path: "/Legacy", fold: strings.ToLower, wantAlias: "Legacy"},
+		{name: "Folded saved too", path: "/Both", fold: strings.ToLower, wantAlias: "both"},
+		{name: "Saved nowhere", path: "/Missing", fold: strings.ToLower, wantAlias: "missing"},
+		{name: "Team saved before folding", path: "/d/Go.Brand.com/t/Sales/Spring", fold: strings.ToLower, wantDomain: "go.brand.com", wantAlias: "Sales/Spring"},
+		{name: "Saved on another domain", path: "/d/go.brand.com/Legacy", fold: strings.ToLower, wantDomain: "go.brand.com", wantAlias: "legacy"},
+	}
+
+	saved := urlsStub{
+		{"", "Legacy"}:                   true,
+		{"", "Both"}:                     true,
+		{"", "both"}:                     true,
+		{"go.brand.com", "Sales/Spring"}: true,
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var domain, alias string
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				domain, alias = chi.URLParam(r, "domain"), chi.URLParam(r, "alias")
+			}
+
+			links := func(r chi.Router) {
+				r.Use(New(tc.fold, saved))
+				r.Get("/", handler)
+				r.Get("/stats", handler)
+			}
+
+			router := chi.NewRouter()
+			router.Route("/{alias}", links)
+			router.Route("/t/{team}/{alias}", links)
+			router.Route("/d/{domain}/{alias}", links)
+			router.Route("/d/{domain}/t/{team}/{alias}", links)
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			require.Equal(t, tc.wantDomain, domain)
+			require.Equal(t, tc.wantAlias, alias)
+		})
+	}
+}
+
+func keep(s string) string {
+	return s
+}
+
+// urlsStub has links saved under the domains and aliases it holds
+type urlsStub map[[2]string]bool
+
+func (u urlsStub) GetUrl(_ context.Context, domain, alias string) (models.URL, error) {
+	if !u[[2]string{domain, alias}] {
+		return models.URL{}, storage.ErrURLNotFound
+	}
+
+	return models.URL{Domain: domain, Alias: alias}, nil
+}
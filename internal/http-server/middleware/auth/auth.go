@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostmyescape/url-shortener/internal/apikey"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// User is the authenticated caller
+type User struct {
+	ID    int64
+	Email string
+	// Teams are the teams claim of the token, used by authz if the SSO service doesn't keep memberships
+	Teams []string
+	// Service marks the legacy shared basic auth account, it may manage every link
+	Service bool
+	// KeyID is the API key the request was authenticated by, 0 for other credentials
+	KeyID int64
+	// Scopes limit what a request authenticated by an API key may do
+	Scopes []string
+}
+
+// Can reports whether the user may do what scope allows, only API keys are limited
+func (u User) Can(scope string) bool {
+	return u.KeyID == 0 || slices.Contains(u.Scopes, scope)
+}
+
+//go:generate mockery --name=KeyAuthenticator --dir=. --output=./mocks --filename=key_authenticator_mock.go --outpkg=mocks
+type KeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (models.APIKey, error)
+}
+
+type ctxKey struct{}
+
+// WithUser returns a copy of ctx carrying user
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, ctxKey{}, user)
+}
+
+// UserFromContext returns the user set by the auth middleware
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(ctxKey{}).(User)
+	return user, ok
+}
+
+// New authenticates requests by a JWT issued by the SSO service and signed with appSecret
+// or by an API key, sent as a Bearer token or in the X-API-Key header.
+// The shared basic auth pair is still accepted as the service account
+// so existing scripts keep working, an empty basicUser or basicPassword disables it
+// and nil keys disable keys.
+func New(log *slog.Logger, appSecret string, basicUser, basicPassword string, keys KeyAuthenticator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/auth"),
+		)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			log := log.With(slog.String("request_id", middleware.GetReqID(r.Context())))
+
+			if key, ok := apiKey(r); ok && keys != nil {
+				k, err := keys.Authenticate(r.Context(), key)
+				if errors.Is(err, apikey.ErrInvalidKey) {
+					log.WarnContext(r.Context(), "invalid api key", sl.Err(err))
+					unauthorized(w, r, err.Error())
+
+					return
+				}
+				if err != nil {
+					log.ErrorContext(r.Context(), "failed to check api key", sl.Err(err))
+					resp.JSON(w, r, http.StatusInternalServerError, resp.Error("failed to check api key"))
+
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), userOf(k))))
+				return
+			}
+
+			if token, ok := bearerToken(r); ok {
+				user, err := ParseToken(token, appSecret)
+				if err != nil {
+					log.WarnContext(r.Context(), "invalid token", sl.Err(err))
+					unauthorized(w, r, "invalid token")
+
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+				return
+			}
+
+			if user, password, ok := r.BasicAuth(); ok && basicUser != "" && basicPassword != "" {
+				if !equal(user, basicUser) || !equal(password, basicPassword) {
+					log.WarnContext(r.Context(), "invalid basic auth credentials")
+					unauthorized(w, r, "invalid credentials")
+
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), User{Service: true})))
+				return
+			}
+
+			unauthorized(w, r, "unauthorized")
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// ParseToken validates an SSO token and returns its user
+func ParseToken(token string, appSecret string) (User, error) {
+	// an empty secret would accept tokens signed by anyone
+	if appSecret == "" {
+		return User{}, fmt.Errorf("%w: app secret is not configured", ErrInvalidToken)
+	}
+
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(appSecret), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return User{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	uid, ok := claims["uid"].(float64)
+	if !ok || uid <= 0 {
+		return User{}, fmt.Errorf("%w: missing uid claim", ErrInvalidToken)
+	}
+
+	email, _ := claims["email"].(string)
+
+	// teams is optional, tokens of an SSO service that doesn't know teams have none
+	var teams []string
+	if raw, ok := claims["teams"].([]any); ok {
+		for _, team := range raw {
+			if team, ok := team.(string); ok && team != "" {
+				teams = append(teams, team)
+			}
+		}
+	}
+
+	return User{ID: int64(uid), Email: email, Teams: teams}, nil
+}
+
+// RequireScope lets only users that Can scope through
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "unauthorized")
+				return
+			}
+
+			if !user.Can(scope) {
+				resp.JSON(w, r, http.StatusForbidden, resp.Error(fmt.Sprintf("api key lacks scope %s", scope)))
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// userOf returns the user an API key acts as, keys without an owner act as
+// the service account. A key has no teams claim, so it reaches the links of
+// the teams of its owner only if the SSO service keeps memberships.
+func userOf(k models.APIKey) User {
+	return User{ID: k.UserID, Service: k.UserID == 0, KeyID: k.ID, Scopes: k.Scopes}
+}
+
+// apiKey returns the key of r from X-API-Key or a Bearer token with the key prefix
+func apiKey(r *http.Request) (string, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, true
+	}
+
+	if token, ok := bearerToken(r); ok && apikey.IsKey(token) {
+		return token, true
+	}
+
+	return "", false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="url-shortener"`)
+	resp.JSON(w, r, http.StatusUnauthorized, resp.Error(msg))
+}
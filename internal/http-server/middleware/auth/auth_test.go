@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostmyescape/url-shortener/internal/apikey"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth/mocks"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const secret = "test-secret"
+
+const (
+	userKey    = "usk_user"
+	serviceKey = "usk_service"
+	revokedKey = "usk_revoked"
+	brokenKey  = "usk_broken"
+)
+
+func token(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+
+	return signed
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	valid := jwt.MapClaims{"uid": 42, "email": "user@example.com", "exp": time.Now().Add(time.Hour).Unix()}
+
+	cases := []struct {
+		name          string
+		authorization string
+		basicUser     string
+		basicPassword string
+		apiKey        string
+		wantCode      int
+		wantUser      User
+	}{
+		{
+			name:          "Valid token",
+			authorization: "Bearer " + token(t, secret, valid),
+			wantCode:      http.StatusOK,
+			wantUser:      User{ID: 42, Email: "user@example.com"},
+		},
+		{
+			name: "Token with teams",
+			authorization: "Bearer " + token(t, secret, jwt.MapClaims{
+				"uid": 42, "teams": []any{"sales", 7, ""}, "exp": time.Now().Add(time.Hour).Unix(),
+			}),
+			wantCode: http.StatusOK,
+			wantUser: User{ID: 42, Teams: []string{"sales"}},
+		},
+		{
+			name:          "Wrong secret",
+			authorization: "Bearer " + token(t, "other", valid),
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Expired token",
+			authorization: "Bearer " + token(t, secret, jwt.MapClaims{"uid": 42, "exp": time.Now().Add(-time.Hour).Unix()}),
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Token without expiry",
+			authorization: "Bearer " + token(t, secret, jwt.MapClaims{"uid": 42}),
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Token without uid",
+			authorization: "Bearer " + token(t, secret, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}),
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Basic auth",
+			basicUser:     "lostmyescape",
+			basicPassword: "asdfg",
+			wantCode:      http.StatusOK,
+			wantUser:      User{Service: true},
+		},
+		{
+			name:          "Wrong basic auth password",
+			basicUser:     "lostmyescape",
+			basicPassword: "wrong",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "API key as a Bearer token",
+			authorization: "Bearer " + userKey,
+			wantCode:      http.StatusOK,
+			wantUser:      User{ID: 42, KeyID: 1, Scopes: []string{models.ScopeLinksWrite}},
+		},
+		{
+			name:     "API key header",
+			apiKey:   serviceKey,
+			wantCode: http.StatusOK,
+			wantUser: User{Service: true, KeyID: 2, Scopes: []string{models.ScopeStatsRead}},
+		},
+		{
+			name:     "Revoked API key",
+			apiKey:   revokedKey,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Unknown API key header",
+			apiKey:   "nonsense",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "API key check fails",
+			apiKey:   brokenKey,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "No credentials",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	keys := mocks.NewKeyAuthenticator(t)
+	keys.On("Authenticate", mock.Anything, userKey).
+		Return(models.APIKey{ID: 1, UserID: 42, Scopes: []string{models.ScopeLinksWrite}}, nil)
+	keys.On("Authenticate", mock.Anything, serviceKey).
+		Return(models.APIKey{ID: 2, Scopes: []string{models.ScopeStatsRead}}, nil)
+	keys.On("Authenticate", mock.Anything, revokedKey).Return(models.APIKey{}, apikey.ErrKeyRevoked)
+	keys.On("Authenticate", mock.Anything, "nonsense").Return(models.APIKey{}, apikey.ErrInvalidKey)
+	keys.On("Authenticate", mock.Anything, brokenKey).Return(models.APIKey{}, errors.New("database is down"))
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotUser User
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, ok := UserFromContext(r.Context())
+				require.True(t, ok)
+				gotUser = user
+			})
+
+			handler := New(slogdiscard.NewDiscardLogger(), secret, "lostmyescape", "asdfg", keys)(next)
+
+			req := httptest.NewRequest(http.MethodPost, "/url", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+			if tc.basicUser != "" {
+				req.SetBasicAuth(tc.basicUser, tc.basicPassword)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+			require.Equal(t, tc.wantUser, gotUser)
+
+			if tc.wantCode == http.StatusUnauthorized {
+				require.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	cases := []struct {
+		name     string
+		user     *User
+		wantCode int
+	}{
+		{name: "SSO user", user: &User{ID: 42}, wantCode: http.StatusOK},
+		{name: "Service account", user: &User{Service: true}, wantCode: http.StatusOK},
+		{name: "Key with the scope", user: &User{ID: 42, KeyID: 1, Scopes: []string{models.ScopeStatsRead}}, wantCode: http.StatusOK},
+		{name: "Key without the scope", user: &User{ID: 42, KeyID: 1, Scopes: []string{models.ScopeLinksWrite}}, wantCode: http.StatusForbidden},
+		{name: "No user", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := RequireScope(models.ScopeStatsRead)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/url/google/stats", nil)
+			if tc.user != nil {
+				req = req.WithContext(WithUser(req.Context(), *tc.user))
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package etag
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Of returns the ETag of a link at revision
+func Of(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// Match reports whether an If-Match header value matches revision.
+// If-Match uses the strong comparison, so weak tags never match.
+func Match(ifMatch string, revision int64) bool {
+	tag := Of(revision)
+
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
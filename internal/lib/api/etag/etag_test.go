@@ -0,0 +1,25 @@
+package etag
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		ifMatch string
+		want    bool
+	}{
+		{ifMatch: `"3"`, want: true},
+		{ifMatch: `"1", "3"`, want: true},
+		{ifMatch: `*`, want: true},
+		{ifMatch: `"2"`, want: false},
+		{ifMatch: `W/"3"`, want: false},
+		{ifMatch: `3`, want: false},
+		{ifMatch: ``, want: false},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, Match(tc.ifMatch, 3), tc.ifMatch)
+	}
+}
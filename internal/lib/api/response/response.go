@@ -1,8 +1,11 @@
 package response
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/go-playground/validator/v10"
+	"net/http"
 	"strings"
 )
 
@@ -15,6 +18,15 @@ type Response struct {
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
 	Alias  string `json:"alias,omitempty"`
+	// Details tells the rule every rejected field broke
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError is a field of a request rejected by Rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 const (
@@ -37,21 +49,57 @@ func Error(msg string) Response {
 
 // ValidationError validate request
 func ValidationError(errs validator.ValidationErrors) Response {
-	var errMsgs []string
+	fieldErrs := make([]FieldError, 0, len(errs))
 
 	for _, err := range errs {
+		fieldErr := FieldError{Field: err.Field(), Rule: err.ActualTag()}
+
 		switch err.ActualTag() {
 		case "required":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is a required field", err.Field()))
+			fieldErr.Message = fmt.Sprintf("field %s is a required field", err.Field())
 		case "url":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid URL", err.Field()))
+			fieldErr.Message = fmt.Sprintf("field %s is not a valid URL", err.Field())
+		case "max":
+			fieldErr.Message = fmt.Sprintf("field %s must be at most %s characters long", err.Field(), err.Param())
 		default:
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid", err.Field()))
+			fieldErr.Message = fmt.Sprintf("field %s is not a valid", err.Field())
 		}
+
+		fieldErrs = append(fieldErrs, fieldErr)
+	}
+
+	return FieldErrors(fieldErrs...)
+}
+
+// FieldErrors rejects a request for errs, Error joins their messages
+func FieldErrors(errs ...FieldError) Response {
+	errMsgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		errMsgs = append(errMsgs, err.Message)
 	}
 
 	return Response{
-		Status: StatusError,
-		Error:  strings.Join(errMsgs, ", "),
+		Status:  StatusError,
+		Error:   strings.Join(errMsgs, ", "),
+		Details: errs,
+	}
+}
+
+// JSON writes v with status. v is encoded before anything is written, so a
+// value that can't be encoded is answered with 500 and a JSON error instead.
+func JSON(w http.ResponseWriter, _ *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(true)
+
+	if err := enc.Encode(v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, `{"status":"Error","error":"failed to encode response"}`)
+		return
 	}
+
+	w.WriteHeader(status)
+	buf.WriteTo(w)
 }
@@ -0,0 +1,29 @@
+package response
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	JSON(rr, nil, http.StatusCreated, Error("<taken>"))
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var body Response
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.Equal(t, Error("<taken>"), body)
+
+	// a value that can't be encoded isn't answered with the status asked for
+	rr = httptest.NewRecorder()
+	JSON(rr, nil, http.StatusOK, map[string]any{"f": func() {}})
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.Equal(t, Error("failed to encode response"), body)
+}
@@ -0,0 +1,20 @@
+package route
+
+import (
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// Unmatched stands for the route of requests no route matched, so random
+// paths don't add metric series or span names
+const Unmatched = "unmatched"
+
+// Pattern returns the chi route pattern of r like /url/{alias}. It's known
+// only once r was routed, so it has to be called after the router served r.
+func Pattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+
+	return Unmatched
+}
@@ -0,0 +1,133 @@
+// Package lru is a bounded in-memory cache whose entries may expire
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache holds up to size entries and evicts the least recently used one, it
+// is safe for concurrent use
+type Cache[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is the most recently used
+	items map[K]*list.Element
+
+	now func() time.Time
+}
+
+type item[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time // zero never expires
+}
+
+// New creates a Cache of size entries, a nil now is time.Now
+func New[K comparable, V any](size int, now func() time.Time) *Cache[K, V] {
+	if size < 1 {
+		size = 1
+	}
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Cache[K, V]{
+		size:  size,
+		order: list.New(),
+		items: make(map[K]*list.Element),
+		now:   now,
+	}
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	it := el.Value.(*item[K, V])
+	if !it.expiresAt.IsZero() && !c.now().Before(it.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, key)
+
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return it.value, true
+}
+
+// Set stores value for ttl, zero ttl keeps it until it is evicted
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, ttl)
+}
+
+// Add stores value for ttl like Set unless key has a value that hasn't
+// expired, it reports whether value was stored
+func (c *Cache[K, V]) Add(key K, value V, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		it := el.Value.(*item[K, V])
+		if it.expiresAt.IsZero() || c.now().Before(it.expiresAt) {
+			return false
+		}
+	}
+
+	c.set(key, value, ttl)
+
+	return true
+}
+
+func (c *Cache[K, V]) set(key K, value V, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		it := el.Value.(*item[K, V])
+		it.value, it.expiresAt = value, expiresAt
+		c.order.MoveToFront(el)
+
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&item[K, V]{key: key, value: value, expiresAt: expiresAt})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*item[K, V]).key)
+	}
+}
+
+// Delete drops key, it does nothing if key isn't cached
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
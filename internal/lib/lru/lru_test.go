@@ -0,0 +1,63 @@
+package lru
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := New[string, int](2, func() time.Time { return now })
+
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, 0)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	// b is the least recently used
+	c.Set("c", 3, 0)
+	_, ok = c.Get("b")
+	require.False(t, ok)
+	require.Equal(t, 2, c.Len())
+
+	c.Set("c", 4, 0)
+	v, _ = c.Get("c")
+	require.Equal(t, 4, v)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 1, c.Len())
+
+	// no ttl never expires
+	now = now.Add(24 * time.Hour)
+	_, ok = c.Get("c")
+	require.True(t, ok)
+
+	c.Delete("c")
+	c.Delete("missing")
+	_, ok = c.Get("c")
+	require.False(t, ok)
+	require.Equal(t, 0, c.Len())
+}
+
+func TestCacheAdd(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := New[string, int](2, func() time.Time { return now })
+
+	require.True(t, c.Add("a", 1, time.Minute))
+	require.False(t, c.Add("a", 2, time.Minute))
+
+	v, _ := c.Get("a")
+	require.Equal(t, 1, v)
+
+	// an expired value is replaced
+	now = now.Add(time.Minute)
+	require.True(t, c.Add("a", 3, 0))
+
+	v, _ = c.Get("a")
+	require.Equal(t, 3, v)
+}
@@ -0,0 +1,52 @@
+// Package page renders the HTML pages of the service from embedded templates
+package page
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed templates/*.html
+var files embed.FS
+
+var templates = template.Must(template.ParseFS(files, "templates/*.html"))
+
+// contentPolicy lets pages use their inline style and data URI images only
+const contentPolicy = "default-src 'none'; img-src data:; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'"
+
+// Preview is the data of the "preview" page
+type Preview struct {
+	Alias       string
+	Destination string
+	Host        string
+	Title       string
+	// Favicon is a data URI, the page shows no icon if it's empty
+	Favicon template.URL
+	// Interstitial warns that the visitor is about to leave
+	Interstitial bool
+}
+
+// NotFound is the data of the "not_found" page of a custom domain
+type NotFound struct {
+	Host string
+	Path string
+}
+
+// Render writes the page name with data as the response with status,
+// nothing is written if the template fails
+func Render(w http.ResponseWriter, status int, name string, data any) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", contentPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+
+	return err
+}
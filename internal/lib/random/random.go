@@ -1,20 +1,26 @@
 package random
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"math/big"
 )
 
-// NewRandomString generates random string with given size
-func NewRandomString(size int) string {
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+// Alphabet is the default set of characters, letters and digits
+const Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ" + "abcdefghijklmnopqrstuvwxyz" + "0123456789"
 
-	chars := []rune("ABCDEFGHIJKLMOPORSTUVWXYZ" + "abcdefghijklmoprstuvwxyz" + "0123456789")
+// String generates a string of size characters picked from alphabet with crypto/rand
+func String(alphabet string, size int) (string, error) {
+	chars := []rune(alphabet)
+	n := big.NewInt(int64(len(chars)))
 
 	b := make([]rune, size)
 	for i := range b {
-		b[i] = chars[rnd.Intn(len(chars))]
+		idx, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[idx.Int64()]
 	}
 
-	return string(b)
+	return string(b), nil
 }
@@ -5,7 +5,7 @@ import (
 	"testing"
 )
 
-func TestNewRandomString(t *testing.T) {
+func TestStringSize(t *testing.T) {
 	tests := []struct {
 		name string
 		size int
@@ -33,8 +33,10 @@ func TestNewRandomString(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			str1 := NewRandomString(tt.size)
-			str2 := NewRandomString(tt.size)
+			str1, err := String(Alphabet, tt.size)
+			assert.NoError(t, err)
+			str2, err := String(Alphabet, tt.size)
+			assert.NoError(t, err)
 
 			assert.Len(t, str1, tt.size)
 			assert.Len(t, str2, tt.size)
@@ -44,3 +46,31 @@ func TestNewRandomString(t *testing.T) {
 	}
 
 }
+
+func TestString(t *testing.T) {
+	const alphabet = "ab"
+
+	seen := make(map[rune]bool)
+	for i := 0; i < 10; i++ {
+		str, err := String(alphabet, 20)
+		assert.NoError(t, err)
+		assert.Len(t, str, 20)
+
+		for _, c := range str {
+			assert.Contains(t, alphabet, string(c))
+			seen[c] = true
+		}
+	}
+
+	assert.Len(t, seen, len(alphabet))
+}
+
+func TestAlphabet(t *testing.T) {
+	seen := make(map[rune]bool)
+	for _, c := range Alphabet {
+		assert.False(t, seen[c], "duplicate %q", c)
+		seen[c] = true
+	}
+
+	assert.Len(t, seen, 62)
+}
@@ -0,0 +1,104 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver finds the address of the client behind the trusted proxies
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New trusts the proxies at the given addresses or CIDRs, with none
+// the forwarding headers are ignored since anyone could set them
+func New(trustedProxies []string) (*Resolver, error) {
+	const op = "realip.New"
+
+	trusted := make([]netip.Prefix, 0, len(trustedProxies))
+
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+
+	return &Resolver{trusted: trusted}, nil
+}
+
+// ClientIP is the peer address of r, or when the peer is a trusted proxy,
+// the last address in X-Forwarded-For that isn't one (X-Real-IP if there
+// is no X-Forwarded-For)
+func (res *Resolver) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !res.isTrusted(peer) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	if len(hops) == 0 {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return addr.Unmap().String()
+		}
+
+		return host
+	}
+
+	// every proxy appends the address it got the request from,
+	// the ones before the last untrusted hop may be forged
+	client := host
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+
+		client = addr.Unmap().String()
+		if !res.isTrusted(addr) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (res *Resolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+package realip
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	res, err := New([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "Direct client",
+			remoteAddr: "203.0.113.7:5000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Untrusted peer can't forge",
+			remoteAddr: "203.0.113.7:5000",
+			forwarded:  []string{"1.1.1.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Trusted proxy",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Chain of proxies",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"1.1.1.1, 198.51.100.1, 192.168.1.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Several headers",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"1.1.1.1", "198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Only proxies",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"10.0.0.5, 10.0.0.6"},
+			want:       "10.0.0.5",
+		},
+		{
+			name:       "Garbage hop",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  []string{"198.51.100.1, unknown"},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "192.168.1.1:5000",
+			realIP:     "198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "IPv6",
+			remoteAddr: "[2001:db8::1]:5000",
+			want:       "2001:db8::1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, header := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", header)
+			}
+			if tc.realIP != "" {
+				req.Header.Set("X-Real-IP", tc.realIP)
+			}
+
+			require.Equal(t, tc.want, res.ClientIP(req))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, err := New([]string{"10.0.0.0/33"})
+	require.Error(t, err)
+
+	_, err = New([]string{"proxy.local"})
+	require.Error(t, err)
+
+	res, err := New(nil)
+	require.NoError(t, err)
+	require.Empty(t, res.trusted)
+}
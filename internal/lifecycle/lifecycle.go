@@ -0,0 +1,92 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Closer releases a resource, it has to return once ctx is done
+type Closer func(ctx context.Context) error
+
+// Manager stops the service in order: closers run in the reverse order
+// they were added, so a resource is closed only after everything started
+// later, which may still use it, is closed.
+type Manager struct {
+	log *slog.Logger
+
+	mu      sync.Mutex
+	closers []closer
+	once    sync.Once
+	// stopping is set as soon as Shutdown begins
+	stopping atomic.Bool
+}
+
+type closer struct {
+	name    string
+	timeout time.Duration
+	close   Closer
+}
+
+func New(log *slog.Logger) *Manager {
+	return &Manager{log: log.With(slog.String("component", "lifecycle"))}
+}
+
+// Add registers close of the resource name, it gets timeout to finish
+func (m *Manager) Add(name string, timeout time.Duration, close Closer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closers = append(m.closers, closer{name: name, timeout: timeout, close: close})
+}
+
+// Shutdown runs every closer, even after one of them fails, and returns
+// their errors. Calls after the first one do nothing.
+func (m *Manager) Shutdown() error {
+	var errs []error
+
+	m.once.Do(func() {
+		m.stopping.Store(true)
+
+		m.mu.Lock()
+		closers := m.closers
+		m.closers = nil
+		m.mu.Unlock()
+
+		for i := len(closers) - 1; i >= 0; i-- {
+			if err := m.run(closers[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// Stopping reports whether Shutdown has begun
+func (m *Manager) Stopping() bool {
+	return m.stopping.Load()
+}
+
+func (m *Manager) run(c closer) error {
+	log := m.log.With(slog.String("resource", c.name))
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	if err := c.close(ctx); err != nil {
+		log.Error("failed to close", sl.Err(err))
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+
+	log.Info("closed", slog.Duration("took", time.Since(start)))
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	m := New(slogdiscard.NewDiscardLogger())
+
+	var closed []string
+	add := func(name string, err error) {
+		m.Add(name, time.Second, func(context.Context) error {
+			closed = append(closed, name)
+			return err
+		})
+	}
+
+	add("sso client", nil)
+	m.Add("readiness", time.Second, func(context.Context) error {
+		require.True(t, m.Stopping())
+		return nil
+	})
+	add("storage", errors.New("connection reset"))
+	add("click recorder", nil)
+
+	// a closer that doesn't finish in time is cut off by its own timeout only
+	m.Add("http server", 10*time.Millisecond, func(ctx context.Context) error {
+		closed = append(closed, "http server")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	require.False(t, m.Stopping())
+
+	err := m.Shutdown()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "storage: connection reset")
+	require.Equal(t, []string{"http server", "click recorder", "storage", "sso client"}, closed)
+
+	require.NoError(t, m.Shutdown())
+	require.Len(t, closed, 4)
+}
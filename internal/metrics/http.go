@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/lib/api/route"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware counts requests and their latency by the chi route pattern
+// like /url/{alias}, it has to be used on the top router
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		defer func() {
+			status := ww.Status()
+
+			// Recoverer in front answers 500 once the panic reaches it
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// the pattern is known once the request was routed
+			route := route.Pattern(r)
+
+			labels := []string{route, r.Method, strconv.Itoa(status)}
+			m.httpRequests.WithLabelValues(labels...).Inc()
+			m.httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
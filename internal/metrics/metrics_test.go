@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/lib/api/route"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/storage/storagetest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Route("/url", func(r chi.Router) {
+		r.Delete("/{alias}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+	})
+	router.Get("/{alias}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://google.com", http.StatusFound)
+	})
+
+	for _, path := range []string{"/google", "/yandex"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/url/google", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/b/c", nil))
+
+	require.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/{alias}", "GET", "302")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/url/{alias}", "DELETE", "403")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues(route.Unmatched, "GET", "404")))
+	require.Equal(t, 3, testutil.CollectAndCount(m.httpDuration))
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	m := New()
+
+	router := chi.NewRouter()
+	router.Use(middleware.Recoverer)
+	router.Use(m.Middleware)
+	router.Get("/{alias}", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/google", nil))
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/{alias}", "GET", "500")))
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+
+	s := m.WrapStorage(storage.NewMemory())
+
+	_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, false)
+	require.NoError(t, err)
+
+	_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, false)
+	require.ErrorIs(t, err, storage.ErrAliasExists)
+
+	_, err = s.GetUrl(ctx, "", "missing")
+	require.ErrorIs(t, err, storage.ErrURLNotFound)
+
+	// conflicts and missing links are answers, not failures
+	require.Equal(t, 2, testutil.CollectAndCount(m.storageDuration))
+	require.Zero(t, testutil.CollectAndCount(m.storageErrors))
+
+	require.Error(t, m.WrapStorage(storagetest.Failing{}).SaveClicks(ctx, nil))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.storageErrors.WithLabelValues("SaveClicks")))
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	m := New()
+	interceptor := m.UnaryClientInterceptor()
+
+	invoker := func(err error) grpc.UnaryInvoker {
+		return func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+			return err
+		}
+	}
+
+	const method = "/auth.Auth/IsAdmin"
+	ctx := context.Background()
+
+	require.NoError(t, interceptor(ctx, method, nil, nil, nil, invoker(nil)))
+	require.Error(t, interceptor(ctx, method, nil, nil, nil, invoker(status.Error(codes.Unavailable, "down"))))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(m.grpcCalls.WithLabelValues(method, "OK")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.grpcCalls.WithLabelValues(method, "Unavailable")))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ObserveCache("hit")
+	m.ObserveCache("hit")
+	m.ObserveCache("miss")
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	body := rr.Body.String()
+	require.Contains(t, body, `url_shortener_cache_lookups_total{result="hit"} 2`)
+	require.Contains(t, body, `url_shortener_cache_lookups_total{result="miss"} 1`)
+	require.Contains(t, body, "go_goroutines")
+}
@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"time"
+)
+
+// Storage times every call to another storage. It doesn't embed it,
+// so a method added to storage.Storage can't go unmeasured.
+type Storage struct {
+	next storage.Storage
+	m    *Metrics
+}
+
+// WrapStorage measures next, it goes below the cache to time the database only
+func (m *Metrics) WrapStorage(next storage.Storage) *Storage {
+	return &Storage{next: next, m: m}
+}
+
+// observe records a call of method started at start that ended with err
+func (s *Storage) observe(method string, start time.Time, err error) {
+	s.m.storageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+	if storage.Failed(err) {
+		s.m.storageErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (s *Storage) SaveURL(ctx context.Context, u models.URL, unique bool) (id int64, err error) {
+	defer func(start time.Time) { s.observe("SaveURL", start, err) }(time.Now())
+
+	return s.next.SaveURL(ctx, u, unique)
+}
+
+func (s *Storage) SaveURLs(ctx context.Context, urls []models.URL, unique bool) (errs []error, err error) {
+	defer func(start time.Time) { s.observe("SaveURLs", start, err) }(time.Now())
+
+	return s.next.SaveURLs(ctx, urls, unique)
+}
+
+func (s *Storage) NextURLID(ctx context.Context) (id int64, err error) {
+	defer func(start time.Time) { s.observe("NextURLID", start, err) }(time.Now())
+
+	return s.next.NextURLID(ctx)
+}
+
+func (s *Storage) GetUrl(ctx context.Context, domain, alias string) (u models.URL, err error) {
+	defer func(start time.Time) { s.observe("GetUrl", start, err) }(time.Now())
+
+	return s.next.GetUrl(ctx, domain, alias)
+}
+
+func (s *Storage) FindURL(ctx context.Context, rawURL, domain string, userID int64, team string, now time.Time) (u models.URL, err error) {
+	defer func(start time.Time) { s.observe("FindURL", start, err) }(time.Now())
+
+	return s.next.FindURL(ctx, rawURL, domain, userID, team, now)
+}
+
+func (s *Storage) ListURLs(ctx context.Context, filter models.URLFilter) (page models.URLPage, err error) {
+	defer func(start time.Time) { s.observe("ListURLs", start, err) }(time.Now())
+
+	return s.next.ListURLs(ctx, filter)
+}
+
+func (s *Storage) UpdateURL(ctx context.Context, u models.URL, revision int64, changedBy int64, unique bool) (updated models.URL, err error) {
+	defer func(start time.Time) { s.observe("UpdateURL", start, err) }(time.Now())
+
+	return s.next.UpdateURL(ctx, u, revision, changedBy, unique)
+}
+
+func (s *Storage) URLRevisions(ctx context.Context, domain, alias string) (revisions []models.URLRevision, err error) {
+	defer func(start time.Time) { s.observe("URLRevisions", start, err) }(time.Now())
+
+	return s.next.URLRevisions(ctx, domain, alias)
+}
+
+func (s *Storage) DeleteURL(ctx context.Context, domain, alias string) (err error) {
+	defer func(start time.Time) { s.observe("DeleteURL", start, err) }(time.Now())
+
+	return s.next.DeleteURL(ctx, domain, alias)
+}
+
+func (s *Storage) DeleteURLs(ctx context.Context, domain string, aliases []string, userID *int64) (deleted []string, err error) {
+	defer func(start time.Time) { s.observe("DeleteURLs", start, err) }(time.Now())
+
+	return s.next.DeleteURLs(ctx, domain, aliases, userID)
+}
+
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time) (deleted int64, err error) {
+	defer func(start time.Time) { s.observe("DeleteExpired", start, err) }(time.Now())
+
+	return s.next.DeleteExpired(ctx, now)
+}
+
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) (err error) {
+	defer func(start time.Time) { s.observe("SaveClicks", start, err) }(time.Now())
+
+	return s.next.SaveClicks(ctx, clicks)
+}
+
+func (s *Storage) URLStats(ctx context.Context, domain, alias string, from, to time.Time, bucket string) (stats models.Stats, err error) {
+	defer func(start time.Time) { s.observe("URLStats", start, err) }(time.Now())
+
+	return s.next.URLStats(ctx, domain, alias, from, to, bucket)
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, k models.APIKey) (id int64, err error) {
+	defer func(start time.Time) { s.observe("SaveAPIKey", start, err) }(time.Now())
+
+	return s.next.SaveAPIKey(ctx, k)
+}
+
+func (s *Storage) APIKeyByHash(ctx context.Context, hash string) (k models.APIKey, err error) {
+	defer func(start time.Time) { s.observe("APIKeyByHash", start, err) }(time.Now())
+
+	return s.next.APIKeyByHash(ctx, hash)
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, userID int64) (keys []models.APIKey, err error) {
+	defer func(start time.Time) { s.observe("ListAPIKeys", start, err) }(time.Now())
+
+	return s.next.ListAPIKeys(ctx, userID)
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64, userID *int64, at time.Time) (k models.APIKey, err error) {
+	defer func(start time.Time) { s.observe("RevokeAPIKey", start, err) }(time.Now())
+
+	return s.next.RevokeAPIKey(ctx, id, userID, at)
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, id int64, at time.Time) (err error) {
+	defer func(start time.Time) { s.observe("TouchAPIKey", start, err) }(time.Now())
+
+	return s.next.TouchAPIKey(ctx, id, at)
+}
+
+func (s *Storage) SaveDomain(ctx context.Context, d models.Domain) (id int64, err error) {
+	defer func(start time.Time) { s.observe("SaveDomain", start, err) }(time.Now())
+
+	return s.next.SaveDomain(ctx, d)
+}
+
+func (s *Storage) GetDomain(ctx context.Context, host string) (d models.Domain, err error) {
+	defer func(start time.Time) { s.observe("GetDomain", start, err) }(time.Now())
+
+	return s.next.GetDomain(ctx, host)
+}
+
+func (s *Storage) ListDomains(ctx context.Context) (domains []models.Domain, err error) {
+	defer func(start time.Time) { s.observe("ListDomains", start, err) }(time.Now())
+
+	return s.next.ListDomains(ctx)
+}
+
+func (s *Storage) UpdateDomain(ctx context.Context, d models.Domain) (updated models.Domain, err error) {
+	defer func(start time.Time) { s.observe("UpdateDomain", start, err) }(time.Now())
+
+	return s.next.UpdateDomain(ctx, d)
+}
+
+func (s *Storage) DeleteDomain(ctx context.Context, host string) (err error) {
+	defer func(start time.Time) { s.observe("DeleteDomain", start, err) }(time.Now())
+
+	return s.next.DeleteDomain(ctx, host)
+}
+
+func (s *Storage) SaveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (err error) {
+	defer func(start time.Time) { s.observe("SaveIdempotencyKey", start, err) }(time.Now())
+
+	return s.next.SaveIdempotencyKey(ctx, k)
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, owner, key string, now time.Time) (k models.IdempotencyKey, err error) {
+	defer func(start time.Time) { s.observe("GetIdempotencyKey", start, err) }(time.Now())
+
+	return s.next.GetIdempotencyKey(ctx, owner, key, now)
+}
+
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (err error) {
+	defer func(start time.Time) { s.observe("CompleteIdempotencyKey", start, err) }(time.Now())
+
+	return s.next.CompleteIdempotencyKey(ctx, k)
+}
+
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, owner, key string) (err error) {
+	defer func(start time.Time) { s.observe("DeleteIdempotencyKey", start, err) }(time.Now())
+
+	return s.next.DeleteIdempotencyKey(ctx, owner, key)
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (deleted int64, err error) {
+	defer func(start time.Time) { s.observe("DeleteExpiredIdempotencyKeys", start, err) }(time.Now())
+
+	return s.next.DeleteExpiredIdempotencyKeys(ctx, now)
+}
+
+// Ping isn't timed, health probes would drown the real calls
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.next.Ping(ctx)
+}
+
+func (s *Storage) PendingMigrations(ctx context.Context) (int, error) {
+	return s.next.PendingMigrations(ctx)
+}
+
+func (s *Storage) Close() error {
+	return s.next.Close()
+}
@@ -0,0 +1,292 @@
+// Package preview fetches the title and the favicon of link destinations
+// for the preview page and caches them in memory
+package preview
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/lib/lru"
+	"github.com/lostmyescape/url-shortener/internal/urlpolicy"
+	"golang.org/x/net/html"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxPageSize is how much of a page is read looking for its head
+	maxPageSize = 512 << 10
+	maxIconSize = 64 << 10
+	// maxTitleLength is in runes, longer titles are cut
+	maxTitleLength = 200
+	maxRedirects   = 5
+	// failedTTL is how long a destination that couldn't be fetched isn't tried again
+	failedTTL = time.Minute
+	userAgent = "url-shortener-preview/1.0"
+)
+
+// Page is what the preview shows about a destination, empty fields are unknown
+type Page struct {
+	Title string
+	// Favicon is a data URI of the icon, the visitor's browser never contacts the destination for it
+	Favicon template.URL
+}
+
+// Fetcher loads pages over HTTP, every destination is fetched at most once per TTL
+type Fetcher struct {
+	client  *http.Client
+	timeout time.Duration
+	ttl     time.Duration
+	cache   *lru.Cache[string, Page]
+}
+
+// New creates a Fetcher, a nil client is replaced with one that only
+// connects to public addresses
+func New(cfg config.Preview, client *http.Client) *Fetcher {
+	if client == nil {
+		client = publicClient(cfg.Timeout)
+	}
+
+	return &Fetcher{
+		client:  client,
+		timeout: cfg.Timeout,
+		ttl:     cfg.CacheTTL,
+		cache:   lru.New[string, Page](cfg.CacheSize, nil),
+	}
+}
+
+// Fetch returns the page of rawURL. The error tells why a fresh fetch failed,
+// the page is still usable then and the failure is cached for a short time.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Page, error) {
+	if page, ok := f.cache.Get(rawURL); ok {
+		return page, nil
+	}
+
+	// a visitor that goes away doesn't fail the fetch for the next ones
+	ctx = context.WithoutCancel(ctx)
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	page, err := f.fetch(ctx, rawURL)
+
+	// zero ttl keeps pages until they are evicted, failures are always retried
+	ttl := f.ttl
+	if err != nil && (ttl <= 0 || ttl > failedTTL) {
+		ttl = failedTTL
+	}
+	f.cache.Set(rawURL, page, ttl)
+
+	return page, err
+}
+
+func (f *Fetcher) fetch(ctx context.Context, rawURL string) (Page, error) {
+	const op = "preview.Fetch"
+
+	res, err := f.get(ctx, rawURL, "text/html,application/xhtml+xml")
+	if err != nil {
+		return Page{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer res.Body.Close()
+
+	var (
+		page Page
+		icon = "/favicon.ico"
+	)
+
+	if typ := mediaType(res); typ == "text/html" || typ == "application/xhtml+xml" {
+		title, href := parseHead(io.LimitReader(res.Body, maxPageSize))
+		page.Title = truncate(title, maxTitleLength)
+		if href != "" {
+			icon = href
+		}
+	}
+
+	// relative links are resolved against the page after its redirects
+	iconURL, err := res.Request.URL.Parse(icon)
+	if err != nil {
+		return page, fmt.Errorf("%s: favicon: %w", op, err)
+	}
+
+	page.Favicon, err = f.icon(ctx, iconURL.String())
+	if err != nil {
+		return page, fmt.Errorf("%s: favicon: %w", op, err)
+	}
+
+	return page, nil
+}
+
+// icon downloads an image and returns it as a data URI
+func (f *Fetcher) icon(ctx context.Context, rawURL string) (template.URL, error) {
+	res, err := f.get(ctx, rawURL, "image/*")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxIconSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxIconSize {
+		return "", fmt.Errorf("icon is larger than %d bytes", maxIconSize)
+	}
+
+	typ := mediaType(res)
+	if !strings.HasPrefix(typ, "image/") {
+		typ, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	if !strings.HasPrefix(typ, "image/") {
+		return "", fmt.Errorf("icon is %s, not an image", typ)
+	}
+
+	return template.URL("data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(body)), nil
+}
+
+func (f *Fetcher) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", accept)
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s responded with %d", rawURL, res.StatusCode)
+	}
+
+	return res, nil
+}
+
+// parseHead returns the title and the href of the first icon link of a page,
+// it stops at the body
+func parseHead(r io.Reader) (title, icon string) {
+	z := html.NewTokenizer(r)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return title, icon
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				return title, icon
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+
+			switch string(name) {
+			case "body":
+				return title, icon
+			case "title":
+				if title == "" && z.Next() == html.TextToken {
+					title = strings.Join(strings.Fields(string(z.Text())), " ")
+				}
+			case "link":
+				var rel, href string
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+
+					switch string(key) {
+					case "rel":
+						rel = strings.ToLower(string(val))
+					case "href":
+						href = strings.TrimSpace(string(val))
+					}
+				}
+
+				if icon == "" && href != "" && isIconRel(rel) {
+					icon = href
+				}
+			}
+		}
+	}
+}
+
+// isIconRel matches rel="icon" and the legacy rel="shortcut icon"
+func isIconRel(rel string) bool {
+	for _, token := range strings.Fields(rel) {
+		if token == "icon" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mediaType(res *http.Response) string {
+	typ, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return typ
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n-1]) + "…"
+}
+
+// errNotPublic is returned for a connection to a private address, the
+// destination passed the URL policy when it was saved but its host may
+// resolve elsewhere by now
+var errNotPublic = errors.New("address is not public")
+
+// publicClient follows a few redirects and refuses to connect to addresses
+// that aren't public, whatever the host names resolve to
+func publicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !urlpolicy.IsPublic(addr) {
+				return fmt.Errorf("%s: %w", host, errNotPublic)
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would connect on our behalf and skip the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+}
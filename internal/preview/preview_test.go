@@ -0,0 +1,140 @@
+package preview
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/lib/lru"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pngHeader is enough for http.DetectContentType to see a PNG
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestFetch(t *testing.T) {
+	var pageHits atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/docs", func(w http.ResponseWriter, _ *http.Request) {
+		pageHits.Add(1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<!doctype html><html><head>
+<title>
+  Getting   started &amp; more
+</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="Shortcut Icon" href="static/icon.png">
+</head><body><title>not this one</title></body></html>`))
+	})
+	mux.HandleFunc("/static/icon.png", func(w http.ResponseWriter, _ *http.Request) {
+		// no Content-Type, it is sniffed
+		w.Header()["Content-Type"] = nil
+		_, _ = w.Write(pngHeader)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/docs", http.StatusFound)
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("<title>not html</title>"))
+	})
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/x-icon")
+		_, _ = w.Write([]byte("ico"))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	f := New(config.Preview{Timeout: time.Second, CacheTTL: time.Hour, CacheSize: 10}, server.Client())
+	ctx := context.Background()
+
+	wantIcon := template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader))
+
+	page, err := f.Fetch(ctx, server.URL+"/docs")
+	require.NoError(t, err)
+	require.Equal(t, Page{Title: "Getting started & more", Favicon: wantIcon}, page)
+
+	// served from the cache
+	page, err = f.Fetch(ctx, server.URL+"/docs")
+	require.NoError(t, err)
+	require.Equal(t, "Getting started & more", page.Title)
+	require.Equal(t, int32(1), pageHits.Load())
+
+	// the icon is resolved against the page the redirect ended on
+	page, err = f.Fetch(ctx, server.URL+"/moved")
+	require.NoError(t, err)
+	require.Equal(t, wantIcon, page.Favicon)
+
+	page, err = f.Fetch(ctx, server.URL+"/plain")
+	require.NoError(t, err)
+	require.Equal(t, Page{Favicon: "data:image/x-icon;base64," + template.URL(base64.StdEncoding.EncodeToString([]byte("ico")))}, page)
+
+	page, err = f.Fetch(ctx, server.URL+"/broken")
+	require.Error(t, err)
+	require.Equal(t, Page{}, page)
+
+	// the failure is cached too
+	_, err = f.Fetch(ctx, server.URL+"/broken")
+	require.NoError(t, err)
+}
+
+func TestFetchExpires(t *testing.T) {
+	var hits atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/favicon.ico" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<title>" + strings.Repeat("a", maxTitleLength+10) + "</title>"))
+	}))
+	t.Cleanup(server.Close)
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	f := New(config.Preview{CacheTTL: time.Hour, CacheSize: 1}, server.Client())
+	f.cache = lru.New[string, Page](1, func() time.Time { return now })
+
+	ctx := context.Background()
+
+	// a missing favicon is an error, the title is kept
+	page, err := f.Fetch(ctx, server.URL+"/a")
+	require.Error(t, err)
+	require.Len(t, []rune(page.Title), maxTitleLength)
+
+	now = now.Add(failedTTL)
+	_, _ = f.Fetch(ctx, server.URL+"/a")
+	require.Equal(t, int32(2), hits.Load())
+
+	// the cache holds one page
+	_, _ = f.Fetch(ctx, server.URL+"/b")
+	_, _ = f.Fetch(ctx, server.URL+"/a")
+	require.Equal(t, int32(4), hits.Load())
+}
+
+func TestPublicClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<title>internal</title>"))
+	}))
+	t.Cleanup(server.Close)
+
+	f := New(config.Preview{Timeout: time.Second, CacheTTL: time.Hour}, nil)
+
+	page, err := f.Fetch(context.Background(), server.URL)
+	require.ErrorIs(t, err, errNotPublic)
+	require.Equal(t, Page{}, page)
+	require.False(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,233 @@
+// Package qrcode renders QR codes as PNG or SVG images
+package qrcode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/lib/lru"
+	goqrcode "github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+const (
+	DefaultSize = 256
+	MinSize     = 64
+	MaxSize     = 2048
+	// DefaultMargin is the quiet zone the QR specification asks for
+	DefaultMargin = 4
+	MaxMargin     = 16
+	DefaultLevel  = "M"
+)
+
+// levels maps the error correction levels to the share of the code that may be damaged
+var levels = map[string]goqrcode.RecoveryLevel{
+	"L": goqrcode.Low,     // 7%
+	"M": goqrcode.Medium,  // 15%
+	"Q": goqrcode.High,    // 25%
+	"H": goqrcode.Highest, // 30%
+}
+
+var (
+	Black = color.NRGBA{A: 0xff}
+	White = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// Options of a code, DefaultOptions are the ones of a plain code
+type Options struct {
+	Format string
+	// Size is the width and height of the image in pixels
+	Size int
+	// Level is the error correction level: L, M, Q or H
+	Level string
+	// Margin is the quiet zone around the code in modules
+	Margin     int
+	Foreground color.NRGBA
+	Background color.NRGBA
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       DefaultSize,
+		Level:      DefaultLevel,
+		Margin:     DefaultMargin,
+		Foreground: Black,
+		Background: White,
+	}
+}
+
+// ValidLevel reports whether level is an error correction level
+func ValidLevel(level string) bool {
+	_, ok := levels[level]
+	return ok
+}
+
+// ParseColor reads a hex color: rgb, rrggbb or rrggbbaa with an optional #
+func ParseColor(s string) (color.NRGBA, error) {
+	raw := strings.TrimPrefix(s, "#")
+	if len(raw) == 3 {
+		raw = string([]byte{raw[0], raw[0], raw[1], raw[1], raw[2], raw[2]})
+	}
+	if len(raw) == 6 {
+		raw += "ff"
+	}
+
+	b, err := hex.DecodeString(raw)
+	if err != nil || len(b) != 4 {
+		return color.NRGBA{}, fmt.Errorf("%q is not a hex color like 000000", s)
+	}
+
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: b[3]}, nil
+}
+
+// Render encodes content as a QR code image
+func Render(content string, opts Options) ([]byte, error) {
+	const op = "qrcode.Render"
+
+	level, ok := levels[opts.Level]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown error correction level %q", op, opts.Level)
+	}
+
+	code, err := goqrcode.New(content, level)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// the margin is drawn here, it may be narrower than the built-in one
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	switch opts.Format {
+	case FormatPNG:
+		b, err := renderPNG(modules, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return b, nil
+	case FormatSVG:
+		return renderSVG(modules, opts), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown format %q", op, opts.Format)
+	}
+}
+
+// renderPNG scales every module to the same whole number of pixels, the code
+// is centered if the size isn't a multiple of the modules
+func renderPNG(modules [][]bool, opts Options) ([]byte, error) {
+	n := len(modules) + 2*opts.Margin
+	size := max(opts.Size, n)
+	scale := size / n
+	offset := (size-n*scale)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{opts.Background, opts.Foreground})
+
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+
+			for py := offset + y*scale; py < offset+(y+1)*scale; py++ {
+				for px := offset + x*scale; px < offset+(x+1)*scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderSVG draws a module per unit of the view box, runs of dark modules
+// in a row are one rectangle of the path
+func renderSVG(modules [][]bool, opts Options) []byte {
+	n := len(modules) + 2*opts.Margin
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, n, n,
+	)
+
+	if opts.Background.A > 0 {
+		fmt.Fprintf(&b, `<rect width="%d" height="%d"%s/>`, n, n, fill(opts.Background))
+	}
+
+	fmt.Fprintf(&b, `<path%s d="`, fill(opts.Foreground))
+	for y, row := range modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", x+opts.Margin, y+opts.Margin, run, run)
+			// the module after the run is light
+			x += run
+		}
+	}
+	b.WriteString(`"/></svg>` + "\n")
+
+	return b.Bytes()
+}
+
+func fill(c color.NRGBA) string {
+	attr := fmt.Sprintf(` fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xff {
+		attr += fmt.Sprintf(` fill-opacity="%.3g"`, float64(c.A)/0xff)
+	}
+
+	return attr
+}
+
+// Generator renders codes and keeps the latest ones, the same content and
+// options always give the same image
+type Generator struct {
+	cache *lru.Cache[key, []byte]
+}
+
+type key struct {
+	content string
+	opts    Options
+}
+
+// NewGenerator keeps up to cacheSize images
+func NewGenerator(cacheSize int) *Generator {
+	return &Generator{cache: lru.New[key, []byte](cacheSize, nil)}
+}
+
+// Generate returns the image of content, it must not be modified
+func (g *Generator) Generate(content string, opts Options) ([]byte, error) {
+	k := key{content: content, opts: opts}
+	if img, ok := g.cache.Get(k); ok {
+		return img, nil
+	}
+
+	img, err := Render(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	g.cache.Set(k, img, 0)
+
+	return img, nil
+}
@@ -0,0 +1,130 @@
+package qrcode
+
+import (
+	"bytes"
+	goqrcode "github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/require"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRenderPNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 300
+	opts.Foreground = color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+	b, err := Render("https://sho.rt/google", opts)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, 300, img.Bounds().Dx())
+	require.Equal(t, 300, img.Bounds().Dy())
+
+	// version 2 is 25 modules, with the margin 33 of 9 pixels, centered
+	require.Equal(t, color.NRGBAModel.Convert(img.At(0, 0)), White)
+	offset := (300-33*9)/2 + 4*9
+	require.Equal(t, color.NRGBAModel.Convert(img.At(offset, offset)), opts.Foreground)
+	require.Equal(t, color.NRGBAModel.Convert(img.At(offset-1, offset-1)), White)
+}
+
+// TestRenderPNGMatchesLibrary compares the modules with the image of the
+// encoder itself, its default border is the default margin
+func TestRenderPNGMatchesLibrary(t *testing.T) {
+	const content = "https://sho.rt/t/sales/spring"
+
+	code, err := goqrcode.New(content, goqrcode.Highest)
+	require.NoError(t, err)
+	n := len(code.Bitmap())
+	want := code.Image(n * 5)
+
+	opts := DefaultOptions()
+	opts.Level = "H"
+	opts.Size = n * 5
+
+	b, err := Render(content, opts)
+	require.NoError(t, err)
+
+	got, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, want.Bounds(), got.Bounds())
+
+	for y := 0; y < n*5; y++ {
+		for x := 0; x < n*5; x++ {
+			wr, _, _, _ := want.At(x, y).RGBA()
+			gr, _, _, _ := got.At(x, y).RGBA()
+			require.Equal(t, wr, gr, "pixel %d,%d", x, y)
+		}
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Format = FormatSVG
+	opts.Margin = 0
+	opts.Background = color.NRGBA{}
+
+	b, err := Render("https://sho.rt/google", opts)
+	require.NoError(t, err)
+
+	svg := string(b)
+	require.Contains(t, svg, `width="256" height="256" viewBox="0 0 25 25"`)
+	require.NotContains(t, svg, "<rect")
+	// the top row starts with a finder pattern of 7 modules
+	require.Contains(t, svg, `<path fill="#000000" d="M0 0h7v1h-7z`)
+}
+
+func TestRenderErrors(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Level = "X"
+	_, err := Render("https://sho.rt/google", opts)
+	require.Error(t, err)
+
+	_, err = Render(strings.Repeat("a", 8000), DefaultOptions())
+	require.Error(t, err)
+}
+
+func TestParseColor(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{in: "000", want: Black},
+		{in: "#FFFFFF", want: White},
+		{in: "1a2b3c80", want: color.NRGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0x80}},
+		{in: "red", wantErr: true},
+		{in: "12345", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseColor(tc.in)
+		if tc.wantErr {
+			require.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, got)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	g := NewGenerator(10)
+
+	first, err := g.Generate("https://sho.rt/google", DefaultOptions())
+	require.NoError(t, err)
+
+	second, err := g.Generate("https://sho.rt/google", DefaultOptions())
+	require.NoError(t, err)
+	// the same image is served from the cache
+	require.Same(t, &first[0], &second[0])
+
+	other := DefaultOptions()
+	other.Level = "H"
+	third, err := g.Generate("https://sho.rt/google", other)
+	require.NoError(t, err)
+	require.NotEqual(t, first, third)
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	resp "github.com/lostmyescape/url-shortener/internal/lib/api/response"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/sl"
+	"github.com/lostmyescape/url-shortener/internal/lib/realip"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policies, a client has a bucket for each
+const (
+	PolicyCreate   = "create"
+	PolicyRedirect = "redirect"
+)
+
+// Limiter rejects the requests of clients that ran out of tokens
+type Limiter struct {
+	log      *slog.Logger
+	store    Store
+	resolver *realip.Resolver
+}
+
+// NewLimiter limits with the buckets in store, a nil store limits nothing
+func NewLimiter(log *slog.Logger, store Store, resolver *realip.Resolver) *Limiter {
+	return &Limiter{
+		log:      log.With(slog.String("component", "ratelimit")),
+		store:    store,
+		resolver: resolver,
+	}
+}
+
+// Middleware limits requests by policy. A client is the authenticated user
+// when it runs after the auth middleware, the client address otherwise.
+// Every response tells the state of the bucket in the RateLimit-* headers,
+// a request without a token is answered with 429 and Retry-After.
+// The request is let through if the store fails.
+func (l *Limiter) Middleware(policy string, limit Limit) func(next http.Handler) http.Handler {
+	c := l.Charger(policy, limit)
+
+	return func(next http.Handler) http.Handler {
+		if l.store == nil || limit.Unlimited() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.Charge(w, r, 1) == 0 {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Charger takes tokens of one policy for requests that count as several,
+// like the items of a batch
+type Charger struct {
+	limiter *Limiter
+	policy  string
+	limit   Limit
+}
+
+// Charger charges the buckets of policy, clients are told apart like Middleware does
+func (l *Limiter) Charger(policy string, limit Limit) *Charger {
+	return &Charger{limiter: l, policy: policy, limit: limit}
+}
+
+// Charge takes up to n tokens from the client of r and returns how many it
+// took, n if nothing is limited or the store fails. It sets the RateLimit-*
+// headers, if it took none of n > 0 it answers 429 with Retry-After.
+func (c *Charger) Charge(w http.ResponseWriter, r *http.Request, n int) int {
+	l := c.limiter
+	if l.store == nil || c.limit.Unlimited() || n <= 0 {
+		return n
+	}
+
+	key := c.policy + ":" + l.clientKey(r)
+
+	res, err := l.store.Take(r.Context(), key, c.limit, n)
+	if err != nil {
+		l.log.ErrorContext(r.Context(), "failed to take a token",
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("policy", c.policy),
+			sl.Err(err),
+		)
+
+		return n
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", c.limit.Requests, ceilSeconds(c.limit.Period), c.limit.Burst))
+	h.Set("RateLimit-Limit", strconv.Itoa(c.limit.Burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+	if !res.Allowed {
+		l.log.WarnContext(r.Context(), "rate limit exceeded",
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("key", key),
+			slog.Int("asked", n),
+			slog.Int("taken", res.Taken),
+		)
+
+		h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+	}
+
+	if res.Taken == 0 {
+		resp.JSON(w, r, http.StatusTooManyRequests, resp.Error("too many requests"))
+	}
+
+	return res.Taken
+}
+
+// clientKey identifies the client of r
+func (l *Limiter) clientKey(r *http.Request) string {
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		// scripts with keys of the service account don't share a limit
+		if user.Service && user.KeyID != 0 {
+			return "key:" + strconv.FormatInt(user.KeyID, 10)
+		}
+		if user.Service {
+			return "service"
+		}
+
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+
+	return "ip:" + l.resolver.ClientIP(r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"math"
+	"time"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+	StoreNone   = "none"
+)
+
+// Limit is a token bucket holding up to Burst tokens that refills
+// with Requests tokens per Period, every request takes one and every
+// item of a batch request one too
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// LimitFrom converts a configured limit, the burst defaults to Requests
+func LimitFrom(cfg config.Limit) (Limit, error) {
+	const op = "ratelimit.LimitFrom"
+
+	if cfg.Requests < 0 || cfg.Burst < 0 {
+		return Limit{}, fmt.Errorf("%s: requests and burst can't be negative", op)
+	}
+	if cfg.Requests > 0 && cfg.Period <= 0 {
+		return Limit{}, fmt.Errorf("%s: period must be positive", op)
+	}
+
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = cfg.Requests
+	}
+
+	return Limit{Requests: cfg.Requests, Period: cfg.Period, Burst: burst}, nil
+}
+
+// Unlimited tells that the limit lets every request through
+func (l Limit) Unlimited() bool {
+	return l.Requests == 0
+}
+
+// perSecond is the refill rate in tokens per second
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the state of a bucket after a request tried to take tokens
+type Result struct {
+	// Allowed tells that every token asked for was taken
+	Allowed bool
+	// Taken is the number of tokens taken, fewer than asked for if the bucket ran out
+	Taken     int
+	Remaining int
+	// RetryAfter is when the next token is there, zero if the request was allowed
+	RetryAfter time.Duration
+	// Reset is when the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps the buckets by key
+type Store interface {
+	// Take takes up to n tokens from the bucket of key
+	Take(ctx context.Context, key string, limit Limit, n int) (Result, error)
+	Close() error
+}
+
+// NewStore returns the store selected by cfg.Store, nil for "none"
+func NewStore(cfg config.RateLimit) (Store, error) {
+	const op = "ratelimit.NewStore"
+
+	switch cfg.Store {
+	case StoreMemory, "":
+		return NewMemory(), nil
+	case StoreRedis:
+		store, err := NewRedis(cfg.Redis)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return store, nil
+	case StoreNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown store %q", op, cfg.Store)
+	}
+}
+
+// bucket is the state of a token bucket, tokens is fractional between refills
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// take refills b up to now and takes up to n whole tokens from it
+func (b *bucket) take(limit Limit, now time.Time, n int) Result {
+	b.refill(limit, now)
+
+	taken := min(n, int(math.Floor(b.tokens)))
+	b.tokens -= float64(taken)
+
+	return result(limit, b.tokens, taken, n)
+}
+
+func (b *bucket) refill(limit Limit, now time.Time) {
+	if elapsed := now.Sub(b.at); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed.Seconds()*limit.perSecond())
+		b.at = now
+	}
+}
+
+// result describes a bucket left with tokens after taken of n were taken
+func result(limit Limit, tokens float64, taken, n int) Result {
+	rate := limit.perSecond()
+
+	res := Result{
+		Allowed:   taken == n,
+		Taken:     taken,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / rate),
+	}
+	if !res.Allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,283 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/http-server/middleware/auth"
+	"github.com/lostmyescape/url-shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/lostmyescape/url-shortener/internal/lib/realip"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stores returns every store with a clock the test moves
+func stores(t *testing.T, now *time.Time) map[string]Store {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+
+	redis, err := NewRedis(config.Redis{Address: server.Addr(), KeyPrefix: "test:"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = redis.Close() })
+	redis.now = func() time.Time { return *now }
+
+	memory := NewMemory()
+	memory.now = func() time.Time { return *now }
+
+	return map[string]Store{
+		"memory": memory,
+		"redis":  redis,
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// 2 tokens a second, 3 at once
+	limit := Limit{Requests: 2, Period: time.Second, Burst: 3}
+
+	for name, s := range stores(t, &now) {
+		t.Run(name, func(t *testing.T) {
+			for i := 2; i >= 0; i-- {
+				res, err := s.Take(ctx, "client", limit, 1)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+				require.Equal(t, i, res.Remaining)
+			}
+
+			res, err := s.Take(ctx, "client", limit, 1)
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+			require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+			require.Equal(t, 1500*time.Millisecond, res.Reset)
+
+			// another client has its own bucket
+			res, err = s.Take(ctx, "other", limit, 1)
+			require.NoError(t, err)
+			require.True(t, res.Allowed)
+
+			now = now.Add(750 * time.Millisecond)
+
+			res, err = s.Take(ctx, "client", limit, 1)
+			require.NoError(t, err)
+			require.True(t, res.Allowed)
+			require.Equal(t, 0, res.Remaining)
+
+			// the bucket doesn't fill up beyond the burst
+			now = now.Add(time.Hour)
+
+			for i := 0; i < 3; i++ {
+				res, err = s.Take(ctx, "client", limit, 1)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+			}
+
+			res, err = s.Take(ctx, "client", limit, 1)
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+		})
+	}
+}
+
+func TestStoreTakeMany(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	limit := Limit{Requests: 2, Period: time.Second, Burst: 3}
+
+	for name, s := range stores(t, &now) {
+		t.Run(name, func(t *testing.T) {
+			res, err := s.Take(ctx, "client", limit, 2)
+			require.NoError(t, err)
+			require.True(t, res.Allowed)
+			require.Equal(t, 2, res.Taken)
+			require.Equal(t, 1, res.Remaining)
+
+			// only what is left is taken
+			res, err = s.Take(ctx, "client", limit, 5)
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+			require.Equal(t, 1, res.Taken)
+			require.Equal(t, 0, res.Remaining)
+			require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+			res, err = s.Take(ctx, "client", limit, 1)
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+			require.Zero(t, res.Taken)
+		})
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	limit := Limit{Requests: 1, Period: time.Minute, Burst: 1}
+
+	_, _ = m.Take(ctx, "a", limit, 1)
+	_, _ = m.Take(ctx, "b", Limit{Requests: 1, Period: time.Hour, Burst: 1}, 1)
+	require.Equal(t, 2, m.Len())
+
+	now = now.Add(2 * time.Minute)
+
+	// a is full again and dropped, b is still refilling
+	_, _ = m.Take(ctx, "c", limit, 1)
+	require.Equal(t, 2, m.Len())
+}
+
+func TestLimitFrom(t *testing.T) {
+	t.Parallel()
+
+	limit, err := LimitFrom(config.Limit{Requests: 10, Period: time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, Limit{Requests: 10, Period: time.Minute, Burst: 10}, limit)
+
+	limit, err = LimitFrom(config.Limit{})
+	require.NoError(t, err)
+	require.True(t, limit.Unlimited())
+
+	_, err = LimitFrom(config.Limit{Requests: 10})
+	require.Error(t, err)
+
+	_, err = LimitFrom(config.Limit{Requests: -1, Period: time.Minute})
+	require.Error(t, err)
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit, int) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func (failingStore) Close() error {
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	resolver, err := realip.New([]string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	limit := Limit{Requests: 1, Period: time.Minute, Burst: 2}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	serve := func(h http.Handler, remoteAddr, forwardedFor string, user *auth.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/url", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if user != nil {
+			req = req.WithContext(auth.WithUser(req.Context(), *user))
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("Limited by address", func(t *testing.T) {
+		t.Parallel()
+
+		h := NewLimiter(slogdiscard.NewDiscardLogger(), NewMemory(), resolver).Middleware(PolicyRedirect, limit)(ok)
+
+		rr := serve(h, "10.0.0.1:1234", "203.0.113.7", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		require.Equal(t, "1;w=60;burst=2", rr.Header().Get("RateLimit-Policy"))
+		require.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+		require.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "60", rr.Header().Get("RateLimit-Reset"))
+
+		rr = serve(h, "10.0.0.1:1234", "203.0.113.7", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		require.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+		rr = serve(h, "10.0.0.1:1234", "203.0.113.7", nil)
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		require.Equal(t, "60", rr.Header().Get("Retry-After"))
+		require.JSONEq(t, `{"status":"Error","error":"too many requests"}`, rr.Body.String())
+
+		// the same proxy forwards another client
+		rr = serve(h, "10.0.0.1:1234", "203.0.113.8", nil)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("Limited by user", func(t *testing.T) {
+		t.Parallel()
+
+		h := NewLimiter(slogdiscard.NewDiscardLogger(), NewMemory(), resolver).Middleware(PolicyCreate, limit)(ok)
+		user := &auth.User{ID: 42}
+
+		for _, addr := range []string{"203.0.113.7:1", "203.0.113.8:1"} {
+			require.Equal(t, http.StatusNoContent, serve(h, addr, "", user).Code)
+		}
+		require.Equal(t, http.StatusTooManyRequests, serve(h, "203.0.113.9:1", "", user).Code)
+
+		require.Equal(t, http.StatusNoContent, serve(h, "203.0.113.9:1", "", &auth.User{ID: 43}).Code)
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		t.Parallel()
+
+		for _, l := range []*Limiter{
+			NewLimiter(slogdiscard.NewDiscardLogger(), nil, resolver),
+			NewLimiter(slogdiscard.NewDiscardLogger(), NewMemory(), resolver),
+		} {
+			h := l.Middleware(PolicyCreate, Limit{})(ok)
+
+			for i := 0; i < 5; i++ {
+				rr := serve(h, "203.0.113.7:1", "", nil)
+				require.Equal(t, http.StatusNoContent, rr.Code)
+				require.Empty(t, rr.Header().Get("RateLimit-Limit"))
+			}
+		}
+	})
+
+	t.Run("Charged per item", func(t *testing.T) {
+		t.Parallel()
+
+		c := NewLimiter(slogdiscard.NewDiscardLogger(), NewMemory(), resolver).Charger(PolicyCreate, limit)
+		user := auth.WithUser(context.Background(), auth.User{ID: 42})
+
+		charge := func(n int) (int, *httptest.ResponseRecorder) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/url/batch", nil).WithContext(user)
+
+			return c.Charge(rr, req, n), rr
+		}
+
+		// a batch of 3 gets the 2 tokens of the burst
+		taken, rr := charge(3)
+		require.Equal(t, 2, taken)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+		taken, rr = charge(1)
+		require.Zero(t, taken)
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	})
+
+	t.Run("Store fails", func(t *testing.T) {
+		t.Parallel()
+
+		h := NewLimiter(slogdiscard.NewDiscardLogger(), failingStore{}, resolver).Middleware(PolicyCreate, limit)(ok)
+
+		require.Equal(t, http.StatusNoContent, serve(h, "203.0.113.7:1", "", nil).Code)
+	})
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/redis/go-redis/v9"
+	"math"
+	"strconv"
+	"time"
+)
+
+// takeScript refills and takes up to ARGV[5] tokens from the bucket in one
+// step, so the instances sharing it can't both take its last token. It is a hash of
+// the tokens left and the time in milliseconds they were counted at,
+// it expires once it would be full anyway.
+var takeScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local n = tonumber(ARGV[5])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(state[1]) or burst
+local at = tonumber(state[2]) or now
+
+if now > at then
+	tokens = math.min(burst, tokens + (now - at) / 1000 * rate)
+	at = now
+end
+
+local taken = math.min(n, math.floor(tokens))
+tokens = tokens - taken
+
+redis.call('HSET', KEYS[1], 'tokens', string.format('%.6f', tokens), 'at', string.format('%d', at))
+redis.call('PEXPIRE', KEYS[1], ttl)
+
+return {taken, string.format('%.6f', tokens)}
+`)
+
+// Redis keeps the buckets shared by every instance of the service
+// under KeyPrefix + "ratelimit:" + key
+type Redis struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+func NewRedis(cfg config.Redis) (*Redis, error) {
+	const op = "ratelimit.NewRedis"
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Redis{client: client, prefix: cfg.KeyPrefix + "ratelimit:", now: time.Now}, nil
+}
+
+func (s *Redis) Take(ctx context.Context, key string, limit Limit, n int) (Result, error) {
+	const op = "ratelimit.Redis.Take"
+
+	ttl := int64(math.Ceil(float64(limit.Burst) / limit.perSecond() * 1000))
+
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Burst,
+		strconv.FormatFloat(limit.perSecond(), 'f', -1, 64),
+		s.now().UnixMilli(),
+		max(ttl, 1),
+		n,
+	).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("%s: unexpected reply %v", op, values)
+	}
+
+	taken, _ := values[0].(int64)
+	raw, _ := values[1].(string)
+
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result(limit, tokens, int(taken), n), nil
+}
+
+func (s *Redis) Close() error {
+	return s.client.Close()
+}
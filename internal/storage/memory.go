@@ -0,0 +1,634 @@
+package storage
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps urls in process memory.
+// Nothing survives a restart, it is meant for local runs and tests.
+type Memory struct {
+	mu     sync.RWMutex
+	lastID int64
+	urls   map[link]models.URL
+	clicks map[link][]models.Click
+	// revisions are kept oldest first
+	revisions    map[link][]models.URLRevision
+	keys         map[int64]models.APIKey
+	lastKeyID    int64
+	domains      map[string]models.Domain // keyed by host
+	lastDomainID int64
+	// idempotencyKeys are keyed by owner and key
+	idempotencyKeys map[[2]string]models.IdempotencyKey
+}
+
+// link names a url by its alias on its domain, aliases are unique per domain
+type link struct {
+	domain, alias string
+}
+
+func linkOf(u models.URL) link {
+	return link{domain: u.Domain, alias: u.Alias}
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		urls:      make(map[link]models.URL),
+		clicks:    make(map[link][]models.Click),
+		revisions: make(map[link][]models.URLRevision),
+		keys:      make(map[int64]models.APIKey),
+		domains:   make(map[string]models.Domain),
+
+		idempotencyKeys: make(map[[2]string]models.IdempotencyKey),
+	}
+}
+
+func (m *Memory) SaveURL(_ context.Context, u models.URL, unique bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if unique && m.find(u.URL, u.Domain, ownerOf(u), "", createdAt(u)) != nil {
+		return 0, ErrURLExists
+	}
+
+	return m.save(u)
+}
+
+func (m *Memory) SaveURLs(_ context.Context, urls []models.URL, unique bool) ([]error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := createdAt(models.URL{})
+	seen := make(map[string]bool)
+
+	errs := make([]error, len(urls))
+	for i, u := range urls {
+		if unique {
+			key := urlKey(u.URL, u.Domain, ownerOf(u))
+			if seen[key] || m.find(u.URL, u.Domain, ownerOf(u), "", now) != nil {
+				errs[i] = ErrURLExists
+				continue
+			}
+			seen[key] = true
+		}
+
+		_, errs[i] = m.save(u)
+	}
+
+	return errs, nil
+}
+
+// save stores u, m.mu must be held
+func (m *Memory) save(u models.URL) (int64, error) {
+	if _, ok := m.urls[linkOf(u)]; ok {
+		return 0, ErrAliasExists
+	}
+
+	if u.ID == 0 {
+		m.lastID++
+		u.ID = m.lastID
+	}
+	m.lastID = max(m.lastID, u.ID)
+	u.CreatedAt = createdAt(u)
+	u.Clicks = 0
+	u.RedirectType = redirectType(u)
+	u.Revision = 1
+
+	m.urls[linkOf(u)] = u
+	m.revisions[linkOf(u)] = []models.URLRevision{revisionOf(u, u.UserID, u.CreatedAt)}
+
+	return u.ID, nil
+}
+
+func (m *Memory) NextURLID(_ context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+
+	return m.lastID, nil
+}
+
+func (m *Memory) GetUrl(_ context.Context, domain, alias string) (models.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.urls[link{domain: domain, alias: alias}]
+	if !ok {
+		return models.URL{}, ErrURLNotFound
+	}
+
+	return u, nil
+}
+
+func (m *Memory) FindURL(_ context.Context, rawURL, domain string, userID int64, team string, now time.Time) (models.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := m.find(rawURL, domain, ownerOfFind(userID, team), "", now)
+	if found == nil {
+		return models.URL{}, ErrURLNotFound
+	}
+
+	return *found, nil
+}
+
+// find returns the oldest link of o to rawURL on domain but except that
+// is live at now, nil if there is none. m.mu must be held.
+func (m *Memory) find(rawURL, domain string, o owner, except string, now time.Time) *models.URL {
+	var found *models.URL
+	for _, u := range m.urls {
+		if u.URL != rawURL || u.Domain != domain || ownerOf(u) != o || u.Alias == except || u.Expired(now) {
+			continue
+		}
+		if found == nil || u.ID < found.ID {
+			found = &u
+		}
+	}
+
+	return found
+}
+
+func (m *Memory) ListURLs(_ context.Context, filter models.URLFilter) (models.URLPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// key orders links the same way the sql backends do: by the sort column, then by id
+	key := func(u models.URL) (int64, int64) {
+		if filter.SortBy == models.SortByClicks {
+			return u.Clicks, u.ID
+		}
+		return u.CreatedAt.UnixNano(), u.ID
+	}
+	less := func(a, b models.URL) bool {
+		av, aid := key(a)
+		bv, bid := key(b)
+		if av != bv {
+			return (av < bv) != filter.Desc
+		}
+		if aid != bid {
+			return (aid < bid) != filter.Desc
+		}
+		return false
+	}
+
+	var cursor *models.URL
+	if filter.After != nil {
+		cursor = &models.URL{ID: filter.After.ID, CreatedAt: filter.After.CreatedAt, Clicks: filter.After.Clicks}
+	}
+
+	var urls []models.URL
+	for _, u := range m.urls {
+		switch {
+		case filter.UserID != nil && u.UserID != *filter.UserID:
+		case !strings.HasPrefix(u.Alias, filter.AliasPrefix):
+		case filter.Domain != "" && targetHost(u.URL) != strings.ToLower(filter.Domain):
+		case filter.ShortDomain != nil && u.Domain != *filter.ShortDomain:
+		case !filter.CreatedFrom.IsZero() && u.CreatedAt.Before(filter.CreatedFrom):
+		case !filter.CreatedTo.IsZero() && !u.CreatedAt.Before(filter.CreatedTo):
+		case cursor != nil && !less(*cursor, u):
+		default:
+			urls = append(urls, u)
+		}
+	}
+
+	sort.Slice(urls, func(i, j int) bool { return less(urls[i], urls[j]) })
+
+	var page models.URLPage
+	if len(urls) > filter.Limit {
+		urls = urls[:filter.Limit]
+		page.Next = models.CursorOf(urls[len(urls)-1])
+	}
+	page.URLs = urls
+
+	return page, nil
+}
+
+func (m *Memory) UpdateURL(_ context.Context, u models.URL, revision int64, changedBy int64, unique bool) (models.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.urls[linkOf(u)]
+	if !ok {
+		return models.URL{}, ErrURLNotFound
+	}
+	if current.Revision != revision {
+		return models.URL{}, ErrRevisionMismatch
+	}
+
+	changedAt := time.Now().UTC().Truncate(time.Microsecond)
+	if unique && u.URL != current.URL && m.find(u.URL, u.Domain, ownerOf(current), u.Alias, changedAt) != nil {
+		return models.URL{}, ErrURLExists
+	}
+
+	current.URL = u.URL
+	current.ExpiresAt = u.ExpiresAt
+	current.RedirectType = redirectType(u)
+	current.PassQuery = u.PassQuery
+	current.UTM = u.UTM
+	current.Interstitial = u.Interstitial
+	current.Revision++
+	m.urls[linkOf(u)] = current
+
+	m.revisions[linkOf(u)] = append(m.revisions[linkOf(u)], revisionOf(current, changedBy, changedAt))
+
+	return current, nil
+}
+
+func (m *Memory) URLRevisions(_ context.Context, domain, alias string) ([]models.URLRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l := link{domain: domain, alias: alias}
+	if _, ok := m.urls[l]; !ok {
+		return nil, ErrURLNotFound
+	}
+
+	stored := m.revisions[l]
+	revisions := make([]models.URLRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+
+	return revisions, nil
+}
+
+func revisionOf(u models.URL, changedBy int64, changedAt time.Time) models.URLRevision {
+	return models.URLRevision{
+		Revision:     u.Revision,
+		URL:          u.URL,
+		ExpiresAt:    u.ExpiresAt,
+		RedirectType: u.RedirectType,
+		PassQuery:    u.PassQuery,
+		UTM:          u.UTM,
+		Interstitial: u.Interstitial,
+		ChangedBy:    changedBy,
+		ChangedAt:    changedAt,
+	}
+}
+
+func (m *Memory) DeleteURL(_ context.Context, domain, alias string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := link{domain: domain, alias: alias}
+	if _, ok := m.urls[l]; !ok {
+		return ErrAliasNotFound
+	}
+
+	m.delete(l)
+
+	return nil
+}
+
+func (m *Memory) DeleteURLs(_ context.Context, domain string, aliases []string, userID *int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted []string
+	for _, alias := range aliases {
+		l := link{domain: domain, alias: alias}
+		u, ok := m.urls[l]
+		if !ok || (userID != nil && u.UserID != *userID) {
+			continue
+		}
+
+		m.delete(l)
+		deleted = append(deleted, alias)
+	}
+
+	return deleted, nil
+}
+
+func (m *Memory) DeleteExpired(_ context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for l, u := range m.urls {
+		if u.Expired(now) {
+			m.delete(l)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// delete removes l with everything attached to it, m.mu must be held
+func (m *Memory) delete(l link) {
+	delete(m.urls, l)
+	delete(m.clicks, l)
+	delete(m.revisions, l)
+}
+
+func (m *Memory) SaveClicks(_ context.Context, clicks []models.Click) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range clicks {
+		l := link{domain: c.Domain, alias: c.Alias}
+		u, ok := m.urls[l]
+		if !ok {
+			continue
+		}
+
+		m.clicks[l] = append(m.clicks[l], c)
+
+		u.Clicks++
+		m.urls[l] = u
+	}
+
+	return nil
+}
+
+func (m *Memory) URLStats(_ context.Context, domain, alias string, from, to time.Time, bucket string) (models.Stats, error) {
+	var trunc func(t time.Time) time.Time
+
+	switch bucket {
+	case models.BucketHour:
+		trunc = func(t time.Time) time.Time { return t.Truncate(time.Hour) }
+	case models.BucketDay:
+		trunc = func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+	default:
+		return models.Stats{}, ErrInvalidBucket
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l := link{domain: domain, alias: alias}
+	if _, ok := m.urls[l]; !ok {
+		return models.Stats{}, ErrURLNotFound
+	}
+
+	from, to = from.UTC(), to.UTC()
+	stats := models.Stats{Domain: domain, Alias: alias, From: from, To: to}
+
+	visitors := make(map[string]struct{})
+	counts := make(map[time.Time]int64)
+
+	for _, c := range m.clicks[l] {
+		at := c.ClickedAt.UTC()
+		if at.Before(from) || !at.Before(to) {
+			continue
+		}
+
+		stats.Total++
+		visitors[c.VisitorID] = struct{}{}
+		counts[trunc(at)]++
+	}
+
+	stats.UniqueVisitors = int64(len(visitors))
+
+	for start, count := range counts {
+		stats.Buckets = append(stats.Buckets, models.StatsBucket{Start: start, Count: count})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Start.Before(stats.Buckets[j].Start)
+	})
+
+	return stats, nil
+}
+
+func (m *Memory) SaveAPIKey(_ context.Context, k models.APIKey) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastKeyID++
+	k.ID = m.lastKeyID
+	k.CreatedAt = apiKeyCreatedAt(k)
+	k.Scopes = slices.Clone(k.Scopes)
+	m.keys[k.ID] = k
+
+	return k.ID, nil
+}
+
+func (m *Memory) APIKeyByHash(_ context.Context, hash string) (models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+
+	return models.APIKey{}, ErrAPIKeyNotFound
+}
+
+func (m *Memory) ListAPIKeys(_ context.Context, userID int64) ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, k := range m.keys {
+		if k.UserID == userID {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+
+	return keys, nil
+}
+
+func (m *Memory) RevokeAPIKey(_ context.Context, id int64, userID *int64, at time.Time) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.keys[id]
+	if !ok || (userID != nil && k.UserID != *userID) {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+
+	if k.RevokedAt == nil {
+		at = at.UTC()
+		k.RevokedAt = &at
+		m.keys[id] = k
+	}
+
+	return k, nil
+}
+
+func (m *Memory) TouchAPIKey(_ context.Context, id int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+
+	at = at.UTC()
+	k.LastUsedAt = &at
+	m.keys[id] = k
+
+	return nil
+}
+
+func (m *Memory) SaveDomain(_ context.Context, d models.Domain) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.domains[d.Host]; ok {
+		return 0, ErrDomainExists
+	}
+
+	m.lastDomainID++
+	d.ID = m.lastDomainID
+	d.CreatedAt = domainCreatedAt(d)
+	m.domains[d.Host] = d
+
+	return d.ID, nil
+}
+
+func (m *Memory) GetDomain(_ context.Context, host string) (models.Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.domains[host]
+	if !ok {
+		return models.Domain{}, ErrDomainNotFound
+	}
+
+	return d, nil
+}
+
+func (m *Memory) ListDomains(_ context.Context) ([]models.Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	domains := []models.Domain{}
+	for _, d := range m.domains {
+		domains = append(domains, d)
+	}
+
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+
+	return domains, nil
+}
+
+func (m *Memory) UpdateDomain(_ context.Context, d models.Domain) (models.Domain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.domains[d.Host]
+	if !ok {
+		return models.Domain{}, ErrDomainNotFound
+	}
+
+	current.DefaultURL, current.NotFoundURL = d.DefaultURL, d.NotFoundURL
+	m.domains[d.Host] = current
+
+	return current, nil
+}
+
+func (m *Memory) DeleteDomain(_ context.Context, host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.domains[host]; !ok {
+		return ErrDomainNotFound
+	}
+
+	delete(m.domains, host)
+
+	return nil
+}
+
+func (m *Memory) SaveIdempotencyKey(_ context.Context, k models.IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k.CreatedAt = idempotencyKeyCreatedAt(k)
+	k.ExpiresAt = k.ExpiresAt.UTC().Truncate(time.Microsecond)
+
+	id := [2]string{k.Owner, k.Key}
+	if current, ok := m.idempotencyKeys[id]; ok && !current.Expired(k.CreatedAt) {
+		return ErrIdempotencyKeyExists
+	}
+
+	k.Status, k.Body = 0, nil
+	m.idempotencyKeys[id] = k
+
+	return nil
+}
+
+func (m *Memory) GetIdempotencyKey(_ context.Context, owner, key string, now time.Time) (models.IdempotencyKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ok := m.idempotencyKeys[[2]string{owner, key}]
+	if !ok || k.Expired(now) {
+		return models.IdempotencyKey{}, ErrIdempotencyKeyNotFound
+	}
+
+	k.Body = slices.Clone(k.Body)
+
+	return k, nil
+}
+
+func (m *Memory) CompleteIdempotencyKey(_ context.Context, k models.IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := [2]string{k.Owner, k.Key}
+	current, ok := m.idempotencyKeys[id]
+	if !ok || !current.Pending() {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	current.Status, current.Body = k.Status, slices.Clone(k.Body)
+	m.idempotencyKeys[id] = current
+
+	return nil
+}
+
+func (m *Memory) DeleteIdempotencyKey(_ context.Context, owner, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := [2]string{owner, key}
+	if current, ok := m.idempotencyKeys[id]; !ok || !current.Pending() {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	delete(m.idempotencyKeys, id)
+
+	return nil
+}
+
+func (m *Memory) DeleteExpiredIdempotencyKeys(_ context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, k := range m.idempotencyKeys {
+		if k.Expired(now) {
+			delete(m.idempotencyKeys, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Ping always succeeds, there is no database behind memory
+func (m *Memory) Ping(_ context.Context) error {
+	return nil
+}
+
+// PendingMigrations is always 0, memory has no schema
+func (m *Memory) PendingMigrations(_ context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
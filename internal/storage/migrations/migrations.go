@@ -0,0 +1,288 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var ErrNoApplied = errors.New("no applied migrations")
+
+// Migration is a pair of <version>_<name>.up.sql / .down.sql files
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New loads the migrations embedded for dialect (postgres or sqlite)
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	const op = "migrations.New"
+
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order and returns the applied ones,
+// it is the only method that creates the schema_migrations table
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	const op = "migrations.Up"
+
+	_, err := m.db.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version BIGINT PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at TIMESTAMP NOT NULL
+    )`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, mg := range pending {
+		if err := m.apply(ctx, mg.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations(version, name, applied_at) VALUES ($1, $2, $3)`,
+				mg.Version, mg.Name, time.Now().UTC(),
+			)
+			return err
+		}); err != nil {
+			return pending[:i], fmt.Errorf("%s: %04d_%s: %w", op, mg.Version, mg.Name, err)
+		}
+	}
+
+	return pending, nil
+}
+
+// Down rolls back the latest applied migration
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	const op = "migrations.Down"
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return Migration{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mg := m.migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+
+		if err := m.apply(ctx, mg.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mg.Version)
+			return err
+		}); err != nil {
+			return Migration{}, fmt.Errorf("%s: %04d_%s: %w", op, mg.Version, mg.Name, err)
+		}
+
+		return mg, nil
+	}
+
+	return Migration{}, ErrNoApplied
+}
+
+// Status lists every known migration with the time it was applied, if it was
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	const op = "migrations.Status"
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		st := Status{Version: mg.Version, Name: mg.Name}
+		if at, ok := applied[mg.Version]; ok {
+			st.AppliedAt = &at
+		}
+		statuses = append(statuses, st)
+	}
+
+	return statuses, nil
+}
+
+// Pending returns migrations that are not applied yet, it only reads the
+// database so it is safe for health checks and read-only replicas
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	const op = "migrations.Pending"
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var pending []Migration
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; !ok {
+			pending = append(pending, mg)
+		}
+	}
+
+	return pending, nil
+}
+
+// apply runs script and the bookkeeping statement in one transaction
+func (m *Migrator) apply(ctx context.Context, script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if err := record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applied returns applied versions with their timestamps,
+// none if schema_migrations wasn't created yet
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	applied := make(map[int64]time.Time)
+
+	exists, err := m.tableExists(ctx)
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version int64
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// tableExists reports whether schema_migrations exists without touching it
+func (m *Migrator) tableExists(ctx context.Context) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`
+	if m.dialect == "postgres" {
+		query = `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	}
+
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("unknown dialect %q: %w", dialect, err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+
+		base, direction, ok := cutDirection(name)
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name %q", name)
+		}
+
+		rawVersion, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name %q", name)
+		}
+
+		version, err := strconv.ParseInt(rawVersion, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version in %q: %w", name, err)
+		}
+
+		body, err := files.ReadFile(path.Join(dialect, name))
+		if err != nil {
+			return nil, err
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: title}
+			byVersion[version] = mg
+		}
+
+		if direction == "up" {
+			mg.Up = string(body)
+		} else {
+			mg.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == "" || mg.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", mg.Version, mg.Name)
+		}
+		migrations = append(migrations, *mg)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func cutDirection(name string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		if base, ok := strings.CutSuffix(name, "."+direction+".sql"); ok {
+			return base, direction, true
+		}
+	}
+
+	return "", "", false
+}
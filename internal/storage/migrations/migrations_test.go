@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrations.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	m, err := New(db, "sqlite")
+	require.NoError(t, err)
+
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, pending)
+
+	// reading the status never creates the bookkeeping table
+	var tables int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'`).Scan(&tables))
+	require.Zero(t, tables)
+
+	_, err = m.Down(ctx)
+	require.ErrorIs(t, err, ErrNoApplied)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, pending, applied)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, st := range statuses {
+		require.NotNil(t, st.AppliedAt, "migration %d", st.Version)
+	}
+
+	// running up again is a no-op
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	// roll everything back, newest first
+	for i := len(pending) - 1; i >= 0; i-- {
+		mg, err := m.Down(ctx)
+		require.NoError(t, err)
+		require.Equal(t, pending[i].Version, mg.Version)
+	}
+
+	_, err = m.Down(ctx)
+	require.ErrorIs(t, err, ErrNoApplied)
+
+	pending, err = m.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, len(statuses))
+}
+
+func TestLoad(t *testing.T) {
+	versions := make(map[string][]int64)
+
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		migrations, err := load(dialect)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+
+		for i, mg := range migrations {
+			if i > 0 {
+				require.Less(t, migrations[i-1].Version, mg.Version)
+			}
+			versions[dialect] = append(versions[dialect], mg.Version)
+		}
+	}
+
+	// every schema change has to be written for both dialects
+	require.Equal(t, versions["postgres"], versions["sqlite"])
+
+	_, err := load("oracle")
+	require.Error(t, err)
+}
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_url_target_host;
+DROP INDEX IF EXISTS idx_url_click_count;
+DROP INDEX IF EXISTS idx_url_created_at;
+ALTER TABLE url DROP COLUMN IF EXISTS click_count;
+ALTER TABLE url DROP COLUMN IF EXISTS target_host;
+ALTER TABLE url DROP COLUMN IF EXISTS created_at;
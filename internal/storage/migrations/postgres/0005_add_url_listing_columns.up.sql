@@ -0,0 +1,11 @@
+-- the real creation time of existing links is unknown, they get the migration time
+ALTER TABLE url ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE url ADD COLUMN IF NOT EXISTS target_host TEXT NOT NULL DEFAULT '';
+ALTER TABLE url ADD COLUMN IF NOT EXISTS click_count BIGINT NOT NULL DEFAULT 0;
+
+UPDATE url SET target_host = lower(coalesce(substring(url FROM '^[a-zA-Z][a-zA-Z0-9+.-]*://(?:[^@/?#]*@)?([^/:?#]+)'), ''));
+UPDATE url SET click_count = (SELECT COUNT(*) FROM clicks WHERE clicks.url_id = url.id);
+
+CREATE INDEX IF NOT EXISTS idx_url_created_at ON url(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_url_click_count ON url(click_count, id);
+CREATE INDEX IF NOT EXISTS idx_url_target_host ON url(target_host);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS url_revisions;
+ALTER TABLE url DROP COLUMN IF EXISTS revision;
+ALTER TABLE url DROP COLUMN IF EXISTS redirect_type;
@@ -0,0 +1,4 @@
+ALTER TABLE url_revisions DROP COLUMN IF EXISTS utm;
+ALTER TABLE url_revisions DROP COLUMN IF EXISTS pass_query;
+ALTER TABLE url DROP COLUMN IF EXISTS utm;
+ALTER TABLE url DROP COLUMN IF EXISTS pass_query;
@@ -0,0 +1,6 @@
+ALTER TABLE url ADD COLUMN IF NOT EXISTS pass_query BOOLEAN NOT NULL DEFAULT FALSE;
+-- utm holds the utm_* parameters of the link as a query string
+ALTER TABLE url ADD COLUMN IF NOT EXISTS utm TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE url_revisions ADD COLUMN IF NOT EXISTS pass_query BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE url_revisions ADD COLUMN IF NOT EXISTS utm TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE url_revisions DROP COLUMN IF EXISTS interstitial;
+ALTER TABLE url DROP COLUMN IF EXISTS interstitial;
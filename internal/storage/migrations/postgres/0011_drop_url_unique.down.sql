@@ -0,0 +1,3 @@
+-- fails while a url has several links, delete the extra ones first
+DROP INDEX IF EXISTS idx_url_url;
+ALTER TABLE url ADD CONSTRAINT url_url_key UNIQUE (url);
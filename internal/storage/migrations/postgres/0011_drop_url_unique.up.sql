@@ -0,0 +1,3 @@
+-- several aliases may lead to the same url, duplicates are handled by links.duplicates
+ALTER TABLE url DROP CONSTRAINT IF EXISTS url_url_key;
+CREATE INDEX IF NOT EXISTS idx_url_url ON url(url);
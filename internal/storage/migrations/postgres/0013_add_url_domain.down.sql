@@ -0,0 +1,8 @@
+-- links of custom domains go back under "alias@host"
+DROP INDEX IF EXISTS idx_url_domain_url;
+CREATE INDEX IF NOT EXISTS idx_url_url ON url(url);
+CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
+ALTER TABLE url DROP CONSTRAINT IF EXISTS url_domain_alias_key;
+UPDATE url SET alias = alias || '@' || domain WHERE domain <> '';
+ALTER TABLE url ADD CONSTRAINT url_alias_key UNIQUE (alias);
+ALTER TABLE url DROP COLUMN IF EXISTS domain;
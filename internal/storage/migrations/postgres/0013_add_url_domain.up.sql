@@ -0,0 +1,11 @@
+-- aliases are unique per domain, links of the primary domain have an empty
+-- one. Links of custom domains were stored under "alias@host" before.
+ALTER TABLE url ADD COLUMN IF NOT EXISTS domain TEXT NOT NULL DEFAULT '';
+UPDATE url SET domain = substr(alias, strpos(alias, '@') + 1), alias = substr(alias, 1, strpos(alias, '@') - 1)
+WHERE strpos(alias, '@') > 0;
+
+ALTER TABLE url DROP CONSTRAINT IF EXISTS url_alias_key;
+ALTER TABLE url ADD CONSTRAINT url_domain_alias_key UNIQUE (domain, alias);
+DROP INDEX IF EXISTS idx_alias;
+DROP INDEX IF EXISTS idx_url_url;
+CREATE INDEX IF NOT EXISTS idx_url_domain_url ON url(domain, url);
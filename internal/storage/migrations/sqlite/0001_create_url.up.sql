@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS url (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    alias TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
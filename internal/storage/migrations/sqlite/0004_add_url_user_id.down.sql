@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_url_user_id;
+ALTER TABLE url DROP COLUMN user_id;
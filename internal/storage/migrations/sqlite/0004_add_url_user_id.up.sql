@@ -0,0 +1,3 @@
+-- 0 marks links created before ownership existed or by the legacy shared account
+ALTER TABLE url ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_url_user_id ON url(user_id);
@@ -0,0 +1,20 @@
+-- sqlite can't add a column with a non-constant default, existing links get the migration time
+ALTER TABLE url ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE url ADD COLUMN target_host TEXT NOT NULL DEFAULT '';
+ALTER TABLE url ADD COLUMN click_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE url SET created_at = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+
+-- sqlite has no regexp, take everything between :// and the first slash and drop the port
+UPDATE url SET target_host = substr(url, instr(url, '://') + 3) WHERE instr(url, '://') > 0;
+UPDATE url SET target_host = substr(target_host, 1, instr(target_host, '/') - 1) WHERE instr(target_host, '/') > 0;
+UPDATE url SET target_host = substr(target_host, 1, instr(target_host, '?') - 1) WHERE instr(target_host, '?') > 0;
+UPDATE url SET target_host = substr(target_host, instr(target_host, '@') + 1) WHERE instr(target_host, '@') > 0;
+UPDATE url SET target_host = lower(substr(target_host, 1, instr(target_host, ':') - 1)) WHERE instr(target_host, ':') > 0;
+UPDATE url SET target_host = lower(target_host);
+
+UPDATE url SET click_count = (SELECT COUNT(*) FROM clicks WHERE clicks.url_id = url.id);
+
+CREATE INDEX IF NOT EXISTS idx_url_created_at ON url(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_url_click_count ON url(click_count, id);
+CREATE INDEX IF NOT EXISTS idx_url_target_host ON url(target_host);
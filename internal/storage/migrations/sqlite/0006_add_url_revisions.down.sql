@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS url_revisions;
+ALTER TABLE url DROP COLUMN revision;
+ALTER TABLE url DROP COLUMN redirect_type;
@@ -0,0 +1,18 @@
+ALTER TABLE url ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 302;
+ALTER TABLE url ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS url_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INTEGER NOT NULL REFERENCES url(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    redirect_type INTEGER NOT NULL,
+    changed_by INTEGER NOT NULL DEFAULT 0,
+    changed_at TIMESTAMP NOT NULL,
+    UNIQUE (url_id, revision)
+);
+
+-- existing links start their history with the state they have now
+INSERT INTO url_revisions(url_id, revision, url, expires_at, redirect_type, changed_by, changed_at)
+SELECT id, revision, url, expires_at, redirect_type, user_id, created_at FROM url;
@@ -0,0 +1,4 @@
+ALTER TABLE url_revisions DROP COLUMN utm;
+ALTER TABLE url_revisions DROP COLUMN pass_query;
+ALTER TABLE url DROP COLUMN utm;
+ALTER TABLE url DROP COLUMN pass_query;
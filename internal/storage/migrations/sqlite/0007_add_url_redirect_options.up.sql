@@ -0,0 +1,6 @@
+ALTER TABLE url ADD COLUMN pass_query BOOLEAN NOT NULL DEFAULT 0;
+-- utm holds the utm_* parameters of the link as a query string
+ALTER TABLE url ADD COLUMN utm TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE url_revisions ADD COLUMN pass_query BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE url_revisions ADD COLUMN utm TEXT NOT NULL DEFAULT '';
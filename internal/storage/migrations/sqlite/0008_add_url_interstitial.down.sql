@@ -0,0 +1,2 @@
+ALTER TABLE url_revisions DROP COLUMN interstitial;
+ALTER TABLE url DROP COLUMN interstitial;
@@ -0,0 +1,2 @@
+ALTER TABLE url ADD COLUMN interstitial BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE url_revisions ADD COLUMN interstitial BOOLEAN NOT NULL DEFAULT 0;
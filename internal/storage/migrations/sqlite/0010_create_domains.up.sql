@@ -0,0 +1,9 @@
+-- links of a domain are stored under "alias@host", so aliases are unique per domain
+CREATE TABLE IF NOT EXISTS domains (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host TEXT NOT NULL UNIQUE,
+    default_url TEXT NOT NULL DEFAULT '',
+    not_found_url TEXT NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,46 @@
+-- links of custom domains go back under "alias@host"
+CREATE TEMP TABLE clicks_backup AS SELECT * FROM clicks;
+CREATE TEMP TABLE url_revisions_backup AS SELECT * FROM url_revisions;
+CREATE TEMP TABLE url_sequence AS SELECT seq FROM sqlite_sequence WHERE name = 'url';
+
+CREATE TABLE url_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    alias TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00',
+    target_host TEXT NOT NULL DEFAULT '',
+    click_count INTEGER NOT NULL DEFAULT 0,
+    redirect_type INTEGER NOT NULL DEFAULT 302,
+    revision INTEGER NOT NULL DEFAULT 1,
+    pass_query BOOLEAN NOT NULL DEFAULT 0,
+    utm TEXT NOT NULL DEFAULT '',
+    interstitial BOOLEAN NOT NULL DEFAULT 0
+);
+INSERT INTO url_new(id, alias, url, expires_at, user_id, created_at, target_host, click_count, redirect_type, revision, pass_query, utm, interstitial)
+SELECT id, CASE WHEN domain <> '' THEN alias || '@' || domain ELSE alias END,
+    url, expires_at, user_id, created_at, target_host, click_count, redirect_type, revision, pass_query, utm, interstitial
+FROM url;
+
+DROP TABLE url;
+ALTER TABLE url_new RENAME TO url;
+
+-- ids reserved by NextURLID but never saved stay taken
+DELETE FROM sqlite_sequence WHERE name = 'url';
+INSERT INTO sqlite_sequence(name, seq)
+SELECT 'url', max(coalesce((SELECT seq FROM url_sequence), 0), coalesce((SELECT max(id) FROM url), 0));
+
+INSERT INTO clicks SELECT * FROM clicks_backup;
+INSERT INTO url_revisions SELECT * FROM url_revisions_backup;
+DROP TABLE clicks_backup;
+DROP TABLE url_revisions_backup;
+DROP TABLE url_sequence;
+
+CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
+CREATE INDEX IF NOT EXISTS idx_url_expires_at ON url(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_url_user_id ON url(user_id);
+CREATE INDEX IF NOT EXISTS idx_url_created_at ON url(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_url_click_count ON url(click_count, id);
+CREATE INDEX IF NOT EXISTS idx_url_target_host ON url(target_host);
+CREATE INDEX IF NOT EXISTS idx_url_url ON url(url);
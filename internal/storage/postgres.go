@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -10,12 +11,30 @@ import (
 	"log"
 )
 
-type Storage struct {
-	DB *sql.DB
+// NewPostgres соберет и вернет storage поверх postgres
+func NewPostgres(cfg *config.Config) (*SQLStorage, error) {
+	db, err := openPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSchema(db, TypePostgres); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &SQLStorage{
+		DB:              db,
+		dialect:         TypePostgres,
+		uniqueViolation: pgUniqueViolation,
+		truncTime:       pgTruncTime,
+		urlID:           pgURLID,
+		reserveURLID:    pgReserveURLID,
+		lockURL:         pgLockURL,
+	}, nil
 }
 
-// NewStorage соберет и вернет объект storage
-func NewStorage(cfg *config.Config) (*Storage, error) {
+func openPostgres(cfg *config.Config) (*sql.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Storage.Host,
@@ -36,80 +55,48 @@ func NewStorage(cfg *config.Config) (*Storage, error) {
 	}
 	log.Println("Подключение к postgres установлено!")
 
-	// Выполняем SQL-запрос на создание таблицы
-	createTable := `
-    CREATE TABLE IF NOT EXISTS url (
-        id SERIAL PRIMARY KEY,
-        alias TEXT NOT NULL UNIQUE,
-        url TEXT NOT NULL UNIQUE
-    );
-    CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
-    `
-	_, err = db.Exec(createTable)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка при создании таблицы url: %w", err)
-	}
-
-	return &Storage{DB: db}, nil
+	return db, nil
 }
 
-func (s *Storage) SaveURL(urlToSave string, alias string) (int64, error) {
-	const op = "storage.postgres.SaveUrl"
-
-	var id int64
-	query := "INSERT INTO url(url, alias) VALUES ($1, $2) RETURNING id"
+// pgUniqueViolation maps constraint names like domains_host_key to their column
+func pgUniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return "", false
+	}
 
-	err := s.DB.QueryRow(query, urlToSave, alias).Scan(&id)
-	if err != nil {
-		var pqErr *pq.Error
-		if errors.As(err, &pqErr) {
-			if pqErr.Code == "23505" {
-				if pqErr.Constraint == "url_url_key" {
-					return 0, ErrURLExists
-				}
-				if pqErr.Constraint == "url_alias_key" {
-					return 0, ErrAliasExists
-				}
-			}
-		}
-		return 0, fmt.Errorf("%s: %w", op, err)
+	switch pqErr.Constraint {
+	case "url_domain_alias_key":
+		return "alias", true
+	case "domains_host_key":
+		return "host", true
 	}
 
-	return id, nil
+	return "", false
 }
 
-func (s *Storage) GetUrl(alias string) (string, error) {
-	const op = "storage.postgres.GetUrl"
-
-	var urlString string
-
-	err := s.DB.QueryRow(`SELECT url FROM url WHERE alias = $1`, alias).Scan(&urlString)
-	if errors.Is(err, sql.ErrNoRows) {
-		return "", fmt.Errorf("url not found: %w", err)
-	}
-	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
-	}
-
-	return urlString, nil
+func pgTruncTime(column, bucket string) string {
+	return fmt.Sprintf(
+		"to_char(date_trunc('%s', %s AT TIME ZONE 'UTC'), 'YYYY-MM-DD HH24:MI:SS')",
+		bucket, column,
+	)
 }
 
-func (s *Storage) DeleteURL(alias string) error {
-	const op = "storage.postgres.DeleteURL"
+func pgURLID(placeholder string) string {
+	return fmt.Sprintf("COALESCE(CAST(%s AS BIGINT), nextval(pg_get_serial_sequence('url', 'id')))", placeholder)
+}
 
-	result, err := s.DB.Exec(`DELETE FROM url WHERE alias = $1`, alias)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+func pgReserveURLID(ctx context.Context, db *sql.DB) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('url', 'id'))`).Scan(&id)
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	return id, err
+}
 
-	if rowsAffected == 0 {
-		return ErrAliasNotFound
-	}
+// pgLockURL takes an advisory lock released with tx, a hash collision of
+// two keys only makes their saves wait for each other
+func pgLockURL(ctx context.Context, tx *sql.Tx, key string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key)
 
-	return nil
+	return err
 }
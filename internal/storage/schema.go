@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/storage/migrations"
+)
+
+var ErrSchemaOutdated = errors.New("database schema is outdated, run `migrate up`")
+
+// OpenDB connects to the SQL database of the configured backend without
+// checking its schema, it is what the migrate command works on
+func OpenDB(cfg *config.Config) (*sql.DB, error) {
+	const op = "storage.OpenDB"
+
+	switch cfg.Storage.Type {
+	case TypePostgres, "":
+		return openPostgres(cfg)
+	case TypeSQLite:
+		return openSQLite(cfg.Storage.Path)
+	default:
+		return nil, fmt.Errorf("%s: storage type %q has no database schema", op, cfg.Storage.Type)
+	}
+}
+
+// checkSchema refuses to work on a database with pending migrations
+func checkSchema(db *sql.DB, dialect string) error {
+	const op = "storage.checkSchema"
+
+	m, err := migrations.New(db, dialect)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%s: %d pending migration(s): %w", op, len(pending), ErrSchemaOutdated)
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) Ping(ctx context.Context) error {
+	const op = "storage.sql.Ping"
+
+	if err := s.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) PendingMigrations(ctx context.Context) (int, error) {
+	const op = "storage.sql.PendingMigrations"
+
+	m, err := migrations.New(s.DB, s.dialect)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(pending), nil
+}
@@ -0,0 +1,1262 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SQLStorage implements Storage on top of database/sql.
+// Postgres and SQLite share it and differ only in the driver
+// and in the way unique violations are reported.
+type SQLStorage struct {
+	DB *sql.DB
+
+	// dialect selects the migrations of the database
+	dialect string
+
+	// uniqueViolation returns the column whose unique constraint err violated
+	uniqueViolation func(err error) (string, bool)
+	// truncTime returns an expression truncating column to the start of
+	// the hour or day in UTC, formatted as "2006-01-02 15:04:05"
+	truncTime func(column, bucket string) string
+	// urlID returns the value of url.id for placeholder, which is bound
+	// to an id reserved with reserveURLID or to NULL for the next one
+	urlID func(placeholder string) string
+	// reserveURLID takes the next id of the url table
+	reserveURLID func(ctx context.Context, db *sql.DB) (int64, error)
+	// lockURL keeps the links of an owner to a url on a domain, named by
+	// key, from being saved by other transactions until tx ends
+	lockURL func(ctx context.Context, tx *sql.Tx, key string) error
+}
+
+// urlColumns are scanned by scanURL
+const urlColumns = "id, domain, alias, url, expires_at, user_id, created_at, click_count, redirect_type, revision, pass_query, utm, interstitial"
+
+func (s *SQLStorage) SaveURL(ctx context.Context, u models.URL, unique bool) (int64, error) {
+	const op = "storage.sql.SaveUrl"
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	u.CreatedAt = createdAt(u)
+	u.RedirectType = redirectType(u)
+
+	if unique {
+		linked, err := s.linked(ctx, tx, u.URL, u.Domain, ownerOf(u), "", u.CreatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if linked {
+			return 0, ErrURLExists
+		}
+	}
+
+	var id int64
+	query := `
+    INSERT INTO url(url, domain, alias, expires_at, user_id, created_at, target_host, redirect_type, pass_query, utm, interstitial, id)
+    VALUES ` + s.urlValues(0) + ` RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query,
+		u.URL, u.Domain, u.Alias, nullTime(u.ExpiresAt), u.UserID, u.CreatedAt, targetHost(u.URL), u.RedirectType,
+		u.PassQuery, encodeUTM(u.UTM), u.Interstitial, nullID(u.ID),
+	).Scan(&id)
+	if err != nil {
+		return 0, s.saveError(op, err)
+	}
+
+	// the history of a link starts with its creation
+	err = insertRevision(ctx, tx, id, models.URLRevision{
+		Revision:     1,
+		URL:          u.URL,
+		ExpiresAt:    u.ExpiresAt,
+		RedirectType: u.RedirectType,
+		PassQuery:    u.PassQuery,
+		UTM:          u.UTM,
+		Interstitial: u.Interstitial,
+		ChangedBy:    u.UserID,
+		ChangedAt:    u.CreatedAt,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// batchSize bounds the rows of one statement, it keeps the number of
+// bind parameters below the limits of both drivers
+const batchSize = 500
+
+func (s *SQLStorage) SaveURLs(ctx context.Context, urls []models.URL, unique bool) ([]error, error) {
+	const op = "storage.sql.SaveURLs"
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := createdAt(models.URL{})
+	errs := make([]error, len(urls))
+
+	// saving are the positions in urls to insert, at first all of them
+	saving := make([]int, len(urls))
+	for i := range saving {
+		saving[i] = i
+	}
+
+	if unique {
+		if saving, err = s.unlinked(ctx, tx, urls, errs, now); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	kept := make([]models.URL, len(saving))
+	for j, i := range saving {
+		kept[j] = urls[i]
+	}
+	keptErrs := make([]error, len(kept))
+
+	for start := 0; start < len(kept); start += batchSize {
+		chunk := kept[start:min(start+batchSize, len(kept))]
+
+		if err := s.saveChunk(ctx, tx, chunk, keptErrs[start:], now); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for j, i := range saving {
+		errs[i] = keptErrs[j]
+	}
+
+	return errs, nil
+}
+
+// unlinked returns the positions in urls that have no live link of their
+// owner on their domain at now and sets ErrURLExists in errs for the others. The urls are
+// locked in the order of their keys, so concurrent batches don't deadlock.
+func (s *SQLStorage) unlinked(ctx context.Context, tx *sql.Tx, urls []models.URL, errs []error, now time.Time) ([]int, error) {
+	keys := make([]string, len(urls))
+	for i, u := range urls {
+		keys[i] = urlKey(u.URL, u.Domain, ownerOf(u))
+	}
+
+	sorted := slices.Compact(slices.Sorted(slices.Values(keys)))
+	for _, key := range sorted {
+		if err := s.lockURL(ctx, tx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		saving []int
+		seen   = make(map[string]bool, len(urls))
+	)
+
+	for i, u := range urls {
+		if seen[keys[i]] {
+			errs[i] = ErrURLExists
+			continue
+		}
+		seen[keys[i]] = true
+
+		_, err := s.findURL(ctx, tx, u.URL, u.Domain, ownerOf(u), "", now)
+		switch {
+		case err == nil:
+			errs[i] = ErrURLExists
+		case errors.Is(err, sql.ErrNoRows):
+			saving = append(saving, i)
+		default:
+			return nil, err
+		}
+	}
+
+	return saving, nil
+}
+
+// linked locks the links of o to rawURL on domain until tx ends and
+// reports whether one of them but except is live at now
+func (s *SQLStorage) linked(ctx context.Context, tx *sql.Tx, rawURL, domain string, o owner, except string, now time.Time) (bool, error) {
+	if err := s.lockURL(ctx, tx, urlKey(rawURL, domain, o)); err != nil {
+		return false, err
+	}
+
+	_, err := s.findURL(ctx, tx, rawURL, domain, o, except, now)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
+
+// urlKey names the links of o to rawURL on domain for lockURL, only
+// rawURL may have spaces
+func urlKey(rawURL, domain string, o owner) string {
+	return domain + " " + o.String() + " " + rawURL
+}
+
+// saveChunk inserts urls with one statement, rows violating a unique
+// constraint are skipped and get their error in errs
+func (s *SQLStorage) saveChunk(ctx context.Context, tx *sql.Tx, urls []models.URL, errs []error, now time.Time) error {
+	var (
+		values []string
+		args   []any
+	)
+
+	for i := range urls {
+		u := &urls[i]
+		if u.CreatedAt.IsZero() {
+			u.CreatedAt = now
+		}
+		u.CreatedAt = createdAt(*u)
+		u.RedirectType = redirectType(*u)
+
+		values = append(values, s.urlValues(len(args)))
+		args = append(args,
+			u.URL, u.Domain, u.Alias, nullTime(u.ExpiresAt), u.UserID, u.CreatedAt, targetHost(u.URL), u.RedirectType,
+			u.PassQuery, encodeUTM(u.UTM), u.Interstitial, nullID(u.ID),
+		)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+    INSERT INTO url(url, domain, alias, expires_at, user_id, created_at, target_host, redirect_type, pass_query, utm, interstitial, id)
+    VALUES `+strings.Join(values, ", ")+`
+    ON CONFLICT DO NOTHING RETURNING id, domain, alias, url`, args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type key struct{ domain, alias, url string }
+	ids := make(map[key]int64)
+
+	for rows.Next() {
+		var (
+			id int64
+			k  key
+		)
+		if err := rows.Scan(&id, &k.domain, &k.alias, &k.url); err != nil {
+			return err
+		}
+		ids[k] = id
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var revisions []string
+	args = args[:0]
+
+	for i, u := range urls {
+		k := key{domain: u.Domain, alias: u.Alias, url: u.URL}
+
+		// the same link twice in a batch is inserted once, the alias on its
+		// domain is the only unique key a row can violate
+		id, ok := ids[k]
+		if !ok {
+			errs[i] = ErrAliasExists
+			continue
+		}
+		delete(ids, k)
+
+		revisions = append(revisions, placeholders(len(args), 10))
+		args = append(args,
+			id, 1, u.URL, nullTime(u.ExpiresAt), u.RedirectType, u.PassQuery, encodeUTM(u.UTM), u.Interstitial,
+			u.UserID, u.CreatedAt,
+		)
+	}
+
+	if len(revisions) > 0 {
+		_, err := tx.ExecContext(ctx, `
+    INSERT INTO url_revisions(url_id, revision, url, expires_at, redirect_type, pass_query, utm, interstitial, changed_by, changed_at)
+    VALUES `+strings.Join(revisions, ", "), args...,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// urlValues returns the VALUES row of an url insert taking 12 arguments from
+// $from+1, the last one is the reserved id or NULL
+func (s *SQLStorage) urlValues(from int) string {
+	row := placeholders(from, 11)
+
+	return row[:len(row)-1] + ", " + s.urlID(fmt.Sprintf("$%d", from+12)) + ")"
+}
+
+// NextURLID reserves an id, a url saved with it keeps it as its row id
+func (s *SQLStorage) NextURLID(ctx context.Context) (int64, error) {
+	const op = "storage.sql.NextURLID"
+
+	id, err := s.reserveURLID(ctx, s.DB)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// placeholders returns "($from+1, ..., $from+n)"
+func placeholders(from, n int) string {
+	var b strings.Builder
+
+	b.WriteByte('(')
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "$%d", from+i)
+	}
+	b.WriteByte(')')
+
+	return b.String()
+}
+
+// saveError maps unique violations of the url table to storage errors
+func (s *SQLStorage) saveError(op string, err error) error {
+	if column, ok := s.uniqueViolation(err); ok {
+		switch column {
+		case "alias":
+			return ErrAliasExists
+		case "host":
+			return ErrDomainExists
+		}
+	}
+
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+func (s *SQLStorage) GetUrl(ctx context.Context, domain, alias string) (models.URL, error) {
+	const op = "storage.sql.GetUrl"
+
+	u, err := scanURL(s.DB.QueryRowContext(ctx,
+		`SELECT `+urlColumns+` FROM url WHERE domain = $1 AND alias = $2`, domain, alias,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.URL{}, ErrURLNotFound
+	}
+	if err != nil {
+		return models.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return u, nil
+}
+
+func (s *SQLStorage) FindURL(ctx context.Context, rawURL, domain string, userID int64, team string, now time.Time) (models.URL, error) {
+	const op = "storage.sql.FindURL"
+
+	u, err := s.findURL(ctx, s.DB, rawURL, domain, ownerOfFind(userID, team), "", now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.URL{}, ErrURLNotFound
+	}
+	if err != nil {
+		return models.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return u, nil
+}
+
+// queryRower is a *sql.DB or a *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// findURL selects the oldest link of o to rawURL on domain but except that is live at now
+func (s *SQLStorage) findURL(ctx context.Context, q queryRower, rawURL, domain string, o owner, except string, now time.Time) (models.URL, error) {
+	where := []string{`url = $1`, `(expires_at IS NULL OR expires_at > $2)`, `domain = $3`}
+	args := []any{rawURL, now.UTC(), domain}
+
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if o.team != "" {
+		prefix := models.TeamAlias(o.team, "")
+		where = append(where, fmt.Sprintf("substr(alias, 1, %s) = %s", arg(utf8.RuneCountInString(prefix)), arg(prefix)))
+	} else {
+		where = append(where, "user_id = "+arg(o.userID), `alias NOT LIKE '%/%'`)
+	}
+	if except != "" {
+		where = append(where, "alias <> "+arg(except))
+	}
+
+	return scanURL(q.QueryRowContext(ctx, `
+    SELECT `+urlColumns+` FROM url
+    WHERE `+strings.Join(where, " AND ")+`
+    ORDER BY id LIMIT 1`, args...,
+	))
+}
+
+func (s *SQLStorage) ListURLs(ctx context.Context, filter models.URLFilter) (models.URLPage, error) {
+	const op = "storage.sql.ListURLs"
+
+	var (
+		where []string
+		args  []any
+	)
+
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != nil {
+		where = append(where, "user_id = "+arg(*filter.UserID))
+	}
+	if filter.AliasPrefix != "" {
+		// substr instead of LIKE: no escaping and case sensitive on every backend
+		where = append(where, fmt.Sprintf("substr(alias, 1, %s) = %s",
+			arg(utf8.RuneCountInString(filter.AliasPrefix)), arg(filter.AliasPrefix),
+		))
+	}
+	if filter.Domain != "" {
+		where = append(where, "target_host = "+arg(strings.ToLower(filter.Domain)))
+	}
+	if filter.ShortDomain != nil {
+		where = append(where, "domain = "+arg(*filter.ShortDomain))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.CreatedFrom.UTC()))
+	}
+	if !filter.CreatedTo.IsZero() {
+		where = append(where, "created_at < "+arg(filter.CreatedTo.UTC()))
+	}
+
+	column, direction, compare := "created_at", "ASC", ">"
+	if filter.SortBy == models.SortByClicks {
+		column = "click_count"
+	}
+	if filter.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		var value any = filter.After.CreatedAt.UTC()
+		if filter.SortBy == models.SortByClicks {
+			value = filter.After.Clicks
+		}
+
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, compare, arg(value), arg(filter.After.ID)))
+	}
+
+	query := `SELECT ` + urlColumns + ` FROM url`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// one extra row tells whether there is a next page
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT %s`, column, direction, direction, arg(filter.Limit+1))
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return models.URLPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var page models.URLPage
+	for rows.Next() {
+		u, err := scanURL(rows)
+		if err != nil {
+			return models.URLPage{}, fmt.Errorf("%s: %w", op, err)
+		}
+		page.URLs = append(page.URLs, u)
+	}
+	if err := rows.Err(); err != nil {
+		return models.URLPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(page.URLs) > filter.Limit {
+		page.URLs = page.URLs[:filter.Limit]
+		page.Next = models.CursorOf(page.URLs[len(page.URLs)-1])
+	}
+
+	return page, nil
+}
+
+func (s *SQLStorage) UpdateURL(ctx context.Context, u models.URL, revision int64, changedBy int64, unique bool) (models.URL, error) {
+	const op = "storage.sql.UpdateURL"
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	changedAt := time.Now().UTC().Truncate(time.Microsecond)
+
+	if unique {
+		// a missing alias and a stale revision are told by the update below
+		var (
+			current string
+			userID  int64
+		)
+		err := tx.QueryRowContext(ctx,
+			`SELECT url, user_id FROM url WHERE domain = $1 AND alias = $2 AND revision = $3`, u.Domain, u.Alias, revision,
+		).Scan(&current, &userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return models.URL{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err == nil && current != u.URL {
+			o := ownerOf(models.URL{Alias: u.Alias, UserID: userID})
+			linked, err := s.linked(ctx, tx, u.URL, u.Domain, o, u.Alias, changedAt)
+			if err != nil {
+				return models.URL{}, fmt.Errorf("%s: %w", op, err)
+			}
+			if linked {
+				return models.URL{}, ErrURLExists
+			}
+		}
+	}
+
+	updated, err := scanURL(tx.QueryRowContext(ctx, `
+    UPDATE url SET url = $1, expires_at = $2, redirect_type = $3, target_host = $4,
+        pass_query = $5, utm = $6, interstitial = $7, revision = revision + 1
+    WHERE domain = $8 AND alias = $9 AND revision = $10
+    RETURNING `+urlColumns,
+		u.URL, nullTime(u.ExpiresAt), redirectType(u), targetHost(u.URL), u.PassQuery, encodeUTM(u.UTM),
+		u.Interstitial, u.Domain, u.Alias, revision,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		// tell a missing alias apart from a concurrent update
+		var exists int
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM url WHERE domain = $1 AND alias = $2`, u.Domain, u.Alias).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.URL{}, ErrURLNotFound
+		}
+		if err != nil {
+			return models.URL{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return models.URL{}, ErrRevisionMismatch
+	}
+	if err != nil {
+		return models.URL{}, s.saveError(op, err)
+	}
+
+	err = insertRevision(ctx, tx, updated.ID, models.URLRevision{
+		Revision:     updated.Revision,
+		URL:          updated.URL,
+		ExpiresAt:    updated.ExpiresAt,
+		RedirectType: updated.RedirectType,
+		PassQuery:    updated.PassQuery,
+		UTM:          updated.UTM,
+		Interstitial: updated.Interstitial,
+		ChangedBy:    changedBy,
+		ChangedAt:    changedAt,
+	})
+	if err != nil {
+		return models.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updated, nil
+}
+
+func (s *SQLStorage) URLRevisions(ctx context.Context, domain, alias string) ([]models.URLRevision, error) {
+	const op = "storage.sql.URLRevisions"
+
+	var urlID int64
+	err := s.DB.QueryRowContext(ctx, `SELECT id FROM url WHERE domain = $1 AND alias = $2`, domain, alias).Scan(&urlID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `
+    SELECT revision, url, expires_at, redirect_type, pass_query, utm, interstitial, changed_by, changed_at FROM url_revisions
+    WHERE url_id = $1 ORDER BY revision DESC`, urlID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var revisions []models.URLRevision
+	for rows.Next() {
+		var (
+			r         models.URLRevision
+			expiresAt sql.NullTime
+			utm       string
+		)
+		err := rows.Scan(
+			&r.Revision, &r.URL, &expiresAt, &r.RedirectType, &r.PassQuery, &utm, &r.Interstitial, &r.ChangedBy, &r.ChangedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.UTM = decodeUTM(utm)
+
+		if expiresAt.Valid {
+			r.ExpiresAt = &expiresAt.Time
+		}
+		r.ChangedAt = r.ChangedAt.UTC()
+
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revisions, nil
+}
+
+func insertRevision(ctx context.Context, tx *sql.Tx, urlID int64, r models.URLRevision) error {
+	_, err := tx.ExecContext(ctx, `
+    INSERT INTO url_revisions(url_id, revision, url, expires_at, redirect_type, pass_query, utm, interstitial, changed_by, changed_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		urlID, r.Revision, r.URL, nullTime(r.ExpiresAt), r.RedirectType, r.PassQuery, encodeUTM(r.UTM), r.Interstitial,
+		r.ChangedBy, r.ChangedAt.UTC(),
+	)
+
+	return err
+}
+
+func (s *SQLStorage) DeleteURL(ctx context.Context, domain, alias string) error {
+	const op = "storage.sql.DeleteURL"
+
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM url WHERE domain = $1 AND alias = $2`, domain, alias)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) DeleteURLs(ctx context.Context, domain string, aliases []string, userID *int64) ([]string, error) {
+	const op = "storage.sql.DeleteURLs"
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var deleted []string
+
+	for start := 0; start < len(aliases); start += batchSize {
+		chunk := aliases[start:min(start+batchSize, len(aliases))]
+
+		args := make([]any, 0, len(chunk)+2)
+		for _, alias := range chunk {
+			args = append(args, alias)
+		}
+		args = append(args, domain)
+
+		query := fmt.Sprintf(`DELETE FROM url WHERE alias IN %s AND domain = $%d`, placeholders(0, len(chunk)), len(args))
+		if userID != nil {
+			args = append(args, *userID)
+			query += fmt.Sprintf(` AND user_id = $%d`, len(args))
+		}
+
+		rows, err := tx.QueryContext(ctx, query+` RETURNING alias`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for rows.Next() {
+			var alias string
+			if err := rows.Scan(&alias); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			deleted = append(deleted, alias)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+func (s *SQLStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	const op = "storage.sql.DeleteExpired"
+
+	result, err := s.DB.ExecContext(ctx,
+		`DELETE FROM url WHERE expires_at IS NOT NULL AND expires_at <= $1`, now.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+func (s *SQLStorage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	const op = "storage.sql.SaveClicks"
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// clicks of an alias deleted in the meantime are silently dropped
+	stmt, err := tx.PrepareContext(ctx, `
+    INSERT INTO clicks(url_id, clicked_at, referrer, user_agent, country, request_id, visitor_id)
+    SELECT id, $3, $4, $5, $6, $7, $8 FROM url WHERE domain = $1 AND alias = $2`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	type link struct{ domain, alias string }
+	counts := make(map[link]int64)
+	for _, c := range clicks {
+		_, err := stmt.ExecContext(ctx,
+			c.Domain, c.Alias, c.ClickedAt.UTC(), c.Referrer, c.UserAgent, c.Country, c.RequestID, c.VisitorID,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		counts[link{domain: c.Domain, alias: c.Alias}]++
+	}
+
+	// click_count is denormalized so links can be sorted and paginated by it
+	for l, count := range counts {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE url SET click_count = click_count + $1 WHERE domain = $2 AND alias = $3`, count, l.domain, l.alias,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) URLStats(ctx context.Context, domain, alias string, from, to time.Time, bucket string) (models.Stats, error) {
+	const op = "storage.sql.URLStats"
+
+	if bucket != models.BucketHour && bucket != models.BucketDay {
+		return models.Stats{}, ErrInvalidBucket
+	}
+
+	from, to = from.UTC(), to.UTC()
+	stats := models.Stats{Domain: domain, Alias: alias, From: from, To: to}
+
+	var urlID int64
+	err := s.DB.QueryRowContext(ctx, `SELECT id FROM url WHERE domain = $1 AND alias = $2`, domain, alias).Scan(&urlID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Stats{}, ErrURLNotFound
+	}
+	if err != nil {
+		return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.DB.QueryRowContext(ctx, `
+    SELECT COUNT(*), COUNT(DISTINCT visitor_id) FROM clicks
+    WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3`,
+		urlID, from, to,
+	).Scan(&stats.Total, &stats.UniqueVisitors)
+	if err != nil {
+		return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+    SELECT %s AS bucket, COUNT(*) FROM clicks
+    WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3
+    GROUP BY bucket ORDER BY bucket`, s.truncTime("clicked_at", bucket)),
+		urlID, from, to,
+	)
+	if err != nil {
+		return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			start string
+			b     models.StatsBucket
+		)
+		if err := rows.Scan(&start, &b.Count); err != nil {
+			return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		b.Start, err = time.Parse(time.DateTime, start)
+		if err != nil {
+			return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		stats.Buckets = append(stats.Buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+// apiKeyColumns are scanned by scanAPIKey
+const apiKeyColumns = "id, name, prefix, key_hash, scopes, user_id, created_at, expires_at, last_used_at, revoked_at"
+
+func (s *SQLStorage) SaveAPIKey(ctx context.Context, k models.APIKey) (int64, error) {
+	const op = "storage.sql.SaveAPIKey"
+
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+    INSERT INTO api_keys(name, prefix, key_hash, scopes, user_id, created_at, expires_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		k.Name, k.Prefix, k.Hash, strings.Join(k.Scopes, " "), k.UserID, apiKeyCreatedAt(k), nullTime(k.ExpiresAt),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *SQLStorage) APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	const op = "storage.sql.APIKeyByHash"
+
+	k, err := scanAPIKey(s.DB.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, hash,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return k, nil
+}
+
+func (s *SQLStorage) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	const op = "storage.sql.ListAPIKeys"
+
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY id DESC`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *SQLStorage) RevokeAPIKey(ctx context.Context, id int64, userID *int64, at time.Time) (models.APIKey, error) {
+	const op = "storage.sql.RevokeAPIKey"
+
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`
+	args := []any{at.UTC(), id}
+	if userID != nil {
+		query += ` AND user_id = $3`
+		args = append(args, *userID)
+	}
+
+	k, err := scanAPIKey(s.DB.QueryRowContext(ctx, query+` RETURNING `+apiKeyColumns, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return k, nil
+}
+
+func (s *SQLStorage) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	const op = "storage.sql.TouchAPIKey"
+
+	result, err := s.DB.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, at.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// domainColumns are scanned by scanDomain
+const domainColumns = "id, host, default_url, not_found_url, user_id, created_at"
+
+func (s *SQLStorage) SaveDomain(ctx context.Context, d models.Domain) (int64, error) {
+	const op = "storage.sql.SaveDomain"
+
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+    INSERT INTO domains(host, default_url, not_found_url, user_id, created_at)
+    VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		d.Host, d.DefaultURL, d.NotFoundURL, d.UserID, domainCreatedAt(d),
+	).Scan(&id)
+	if err != nil {
+		return 0, s.saveError(op, err)
+	}
+
+	return id, nil
+}
+
+func (s *SQLStorage) GetDomain(ctx context.Context, host string) (models.Domain, error) {
+	const op = "storage.sql.GetDomain"
+
+	d, err := scanDomain(s.DB.QueryRowContext(ctx,
+		`SELECT `+domainColumns+` FROM domains WHERE host = $1`, host,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Domain{}, ErrDomainNotFound
+	}
+	if err != nil {
+		return models.Domain{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return d, nil
+}
+
+func (s *SQLStorage) ListDomains(ctx context.Context) ([]models.Domain, error) {
+	const op = "storage.sql.ListDomains"
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+domainColumns+` FROM domains ORDER BY host`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	domains := []models.Domain{}
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		domains = append(domains, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return domains, nil
+}
+
+func (s *SQLStorage) UpdateDomain(ctx context.Context, d models.Domain) (models.Domain, error) {
+	const op = "storage.sql.UpdateDomain"
+
+	updated, err := scanDomain(s.DB.QueryRowContext(ctx,
+		`UPDATE domains SET default_url = $1, not_found_url = $2 WHERE host = $3 RETURNING `+domainColumns,
+		d.DefaultURL, d.NotFoundURL, d.Host,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Domain{}, ErrDomainNotFound
+	}
+	if err != nil {
+		return models.Domain{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updated, nil
+}
+
+func (s *SQLStorage) DeleteDomain(ctx context.Context, host string) error {
+	const op = "storage.sql.DeleteDomain"
+
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM domains WHERE host = $1`, host)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrDomainNotFound
+	}
+
+	return nil
+}
+
+// idempotencyKeyColumns are scanned by scanIdempotencyKey
+const idempotencyKeyColumns = "owner, idempotency_key, request_hash, status, body, created_at, expires_at"
+
+func (s *SQLStorage) SaveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) error {
+	const op = "storage.sql.SaveIdempotencyKey"
+
+	// the conflicting row is only taken over once it has expired
+	result, err := s.DB.ExecContext(ctx, `
+    INSERT INTO idempotency_keys(owner, idempotency_key, request_hash, status, body, created_at, expires_at)
+    VALUES ($1, $2, $3, 0, '', $4, $5)
+    ON CONFLICT (owner, idempotency_key) DO UPDATE SET
+        request_hash = excluded.request_hash, status = 0, body = '',
+        created_at = excluded.created_at, expires_at = excluded.expires_at
+    WHERE idempotency_keys.expires_at <= excluded.created_at`,
+		k.Owner, k.Key, k.RequestHash, idempotencyKeyCreatedAt(k), k.ExpiresAt.UTC().Truncate(time.Microsecond),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrIdempotencyKeyExists
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) GetIdempotencyKey(ctx context.Context, owner, key string, now time.Time) (models.IdempotencyKey, error) {
+	const op = "storage.sql.GetIdempotencyKey"
+
+	k, err := scanIdempotencyKey(s.DB.QueryRowContext(ctx,
+		`SELECT `+idempotencyKeyColumns+` FROM idempotency_keys
+        WHERE owner = $1 AND idempotency_key = $2 AND expires_at > $3`,
+		owner, key, now.UTC(),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.IdempotencyKey{}, ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return models.IdempotencyKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return k, nil
+}
+
+func (s *SQLStorage) CompleteIdempotencyKey(ctx context.Context, k models.IdempotencyKey) error {
+	const op = "storage.sql.CompleteIdempotencyKey"
+
+	result, err := s.DB.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status = $1, body = $2 WHERE owner = $3 AND idempotency_key = $4 AND status = 0`,
+		k.Status, string(k.Body), k.Owner, k.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) DeleteIdempotencyKey(ctx context.Context, owner, key string) error {
+	const op = "storage.sql.DeleteIdempotencyKey"
+
+	result, err := s.DB.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE owner = $1 AND idempotency_key = $2 AND status = 0`, owner, key,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	const op = "storage.sql.DeleteExpiredIdempotencyKeys"
+
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+func (s *SQLStorage) Close() error {
+	return s.DB.Close()
+}
+
+// nullTime stores times in UTC, sqlite compares them as text
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return t.UTC()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanURL reads a row selected with urlColumns
+func scanURL(row rowScanner) (models.URL, error) {
+	var (
+		u         models.URL
+		expiresAt sql.NullTime
+		utm       string
+	)
+
+	err := row.Scan(
+		&u.ID, &u.Domain, &u.Alias, &u.URL, &expiresAt, &u.UserID, &u.CreatedAt, &u.Clicks, &u.RedirectType, &u.Revision,
+		&u.PassQuery, &utm, &u.Interstitial,
+	)
+	if err != nil {
+		return models.URL{}, err
+	}
+	u.UTM = decodeUTM(utm)
+
+	if expiresAt.Valid {
+		u.ExpiresAt = &expiresAt.Time
+	}
+	u.CreatedAt = u.CreatedAt.UTC()
+
+	return u, nil
+}
+
+// scanAPIKey reads a row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var (
+		k                                models.APIKey
+		scopes                           string
+		expiresAt, lastUsedAt, revokedAt sql.NullTime
+	)
+
+	err := row.Scan(
+		&k.ID, &k.Name, &k.Prefix, &k.Hash, &scopes, &k.UserID, &k.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt,
+	)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	k.Scopes = strings.Fields(scopes)
+	k.CreatedAt = k.CreatedAt.UTC()
+	k.ExpiresAt = timeOf(expiresAt)
+	k.LastUsedAt = timeOf(lastUsedAt)
+	k.RevokedAt = timeOf(revokedAt)
+
+	return k, nil
+}
+
+// scanDomain reads a row selected with domainColumns
+func scanDomain(row rowScanner) (models.Domain, error) {
+	var d models.Domain
+
+	err := row.Scan(&d.ID, &d.Host, &d.DefaultURL, &d.NotFoundURL, &d.UserID, &d.CreatedAt)
+	if err != nil {
+		return models.Domain{}, err
+	}
+	d.CreatedAt = d.CreatedAt.UTC()
+
+	return d, nil
+}
+
+// scanIdempotencyKey reads a row selected with idempotencyKeyColumns
+func scanIdempotencyKey(row rowScanner) (models.IdempotencyKey, error) {
+	var (
+		k    models.IdempotencyKey
+		body string
+	)
+
+	err := row.Scan(&k.Owner, &k.Key, &k.RequestHash, &k.Status, &body, &k.CreatedAt, &k.ExpiresAt)
+	if err != nil {
+		return models.IdempotencyKey{}, err
+	}
+	k.Body = []byte(body)
+	k.CreatedAt = k.CreatedAt.UTC()
+	k.ExpiresAt = k.ExpiresAt.UTC()
+
+	return k, nil
+}
+
+func timeOf(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	utc := t.Time.UTC()
+
+	return &utc
+}
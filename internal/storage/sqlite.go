@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
+)
+
+// NewSQLite opens the sqlite database file at path
+func NewSQLite(path string) (*SQLStorage, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSchema(db, TypeSQLite); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &SQLStorage{
+		DB:              db,
+		dialect:         TypeSQLite,
+		uniqueViolation: sqliteUniqueViolation,
+		truncTime:       sqliteTruncTime,
+		urlID:           sqliteURLID,
+		reserveURLID:    sqliteReserveURLID,
+		lockURL:         sqliteLockURL,
+	}, nil
+}
+
+func openSQLite(path string) (*sql.DB, error) {
+	const op = "storage.sqlite.open"
+
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// sqlite allows a single writer, serialize access instead of getting SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return db, nil
+}
+
+// sqliteUniqueViolation parses errors like "UNIQUE constraint failed: url.alias"
+func sqliteUniqueViolation(err error) (string, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return "", false
+	}
+
+	_, columns, found := strings.Cut(sqliteErr.Error(), "UNIQUE constraint failed: ")
+	if !found {
+		return "", false
+	}
+
+	// composite constraints are reported as "t.a, t.b (2067)", the last
+	// column names them: url(domain, alias) is the one of alias
+	columns, _, _ = strings.Cut(columns, " (")
+	column := columns[strings.LastIndex(columns, " ")+1:]
+	_, column, _ = strings.Cut(column, ".")
+
+	return column, true
+}
+
+func sqliteTruncTime(column, bucket string) string {
+	if bucket == models.BucketDay {
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00', %s)", column)
+	}
+
+	return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s)", column)
+}
+
+// sqliteURLID relies on NULL taking the next id of an INTEGER PRIMARY KEY
+func sqliteURLID(placeholder string) string {
+	return placeholder
+}
+
+// sqliteReserveURLID bumps the AUTOINCREMENT counter of the url table,
+// its row appears with the first insert so it may be missing yet
+func sqliteReserveURLID(ctx context.Context, db *sql.DB) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `UPDATE sqlite_sequence SET seq = seq + 1 WHERE name = 'url' RETURNING seq`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		id = 1
+		_, err = tx.ExecContext(ctx, `INSERT INTO sqlite_sequence(name, seq) VALUES ('url', $1)`, id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// sqliteLockURL has nothing to lock: the storage has a single connection,
+// so its transactions run one by one, and of two processes writing after
+// reading the same rows sqlite fails one rather than letting both through
+func sqliteLockURL(context.Context, *sql.Tx, string) error {
+	return nil
+}
@@ -1,10 +1,258 @@
 package storage
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
 
 var (
 	ErrURLNotFound   = errors.New("url not found")
 	ErrURLExists     = errors.New("URL already exist")
 	ErrAliasExists   = errors.New("alias already exists")
 	ErrAliasNotFound = errors.New("alias not found")
+	ErrInvalidBucket = errors.New("invalid stats bucket")
+	// ErrRevisionMismatch means the link was changed since the revision the caller has seen
+	ErrRevisionMismatch = errors.New("revision mismatch")
+	ErrAPIKeyNotFound   = errors.New("api key not found")
+	ErrDomainExists     = errors.New("domain already exists")
+	ErrDomainNotFound   = errors.New("domain not found")
+	// ErrIdempotencyKeyExists means a live key of the owner is taken by another request
+	ErrIdempotencyKeyExists   = errors.New("idempotency key already exists")
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
 )
+
+// Failed tells errors of the database from expected outcomes like a missing alias
+func Failed(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, expected := range []error{
+		ErrURLNotFound,
+		ErrURLExists,
+		ErrAliasExists,
+		ErrAliasNotFound,
+		ErrInvalidBucket,
+		ErrRevisionMismatch,
+		ErrAPIKeyNotFound,
+		ErrDomainExists,
+		ErrDomainNotFound,
+		ErrIdempotencyKeyExists,
+		ErrIdempotencyKeyNotFound,
+	} {
+		if errors.Is(err, expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+const (
+	TypePostgres = "postgres"
+	TypeSQLite   = "sqlite"
+	TypeMemory   = "memory"
+)
+
+// Storage is implemented by every backend the service can run on
+type Storage interface {
+	// SaveURL saves u with u.ID if it was reserved with NextURLID, with the next id otherwise.
+	// With unique it is ErrURLExists if a live link to u.URL is on u.Domain,
+	// the check and the insert are atomic. Aliases are unique per domain.
+	SaveURL(ctx context.Context, u models.URL, unique bool) (int64, error)
+	// SaveURLs saves urls in one transaction, the returned slice holds
+	// ErrAliasExists for every url that wasn't saved. With unique it holds
+	// ErrURLExists for the urls SaveURL would reject and for a url repeated
+	// on the same domain after its first.
+	SaveURLs(ctx context.Context, urls []models.URL, unique bool) ([]error, error)
+	// NextURLID reserves an id of a url, so an alias can be derived from it before saving
+	NextURLID(ctx context.Context) (int64, error)
+	// GetUrl returns the link of alias on the custom domain, on the primary one if domain is empty
+	GetUrl(ctx context.Context, domain, alias string) (models.URL, error)
+	// FindURL returns the oldest link to rawURL on the custom domain, on the
+	// primary one if domain is empty, that hasn't expired at now. Only links
+	// in the namespace of team are looked at, or the ones userID has outside
+	// namespaces if team is empty.
+	FindURL(ctx context.Context, rawURL, domain string, userID int64, team string, now time.Time) (models.URL, error)
+	ListURLs(ctx context.Context, filter models.URLFilter) (models.URLPage, error)
+	// UpdateURL replaces the target, expiry and redirect type of u.Alias on u.Domain if it is still at revision.
+	// With unique a new target is ErrURLExists if another live link of the same owner to it is on the domain.
+	UpdateURL(ctx context.Context, u models.URL, revision int64, changedBy int64, unique bool) (models.URL, error)
+	// URLRevisions returns the history of alias on domain, newest first
+	URLRevisions(ctx context.Context, domain, alias string) ([]models.URLRevision, error)
+	DeleteURL(ctx context.Context, domain, alias string) error
+	// DeleteURLs deletes aliases on domain owned by userID, or by anyone if
+	// userID is nil, and returns the aliases that were deleted
+	DeleteURLs(ctx context.Context, domain string, aliases []string, userID *int64) ([]string, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+	SaveClicks(ctx context.Context, clicks []models.Click) error
+	URLStats(ctx context.Context, domain, alias string, from, to time.Time, bucket string) (models.Stats, error)
+	// SaveAPIKey saves k and returns its id
+	SaveAPIKey(ctx context.Context, k models.APIKey) (int64, error)
+	// APIKeyByHash returns the key with the hash, revoked and expired ones included
+	APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// ListAPIKeys returns the keys of userID, newest first
+	ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	// RevokeAPIKey revokes key id of userID, or of anyone if userID is nil,
+	// and returns it. Revoking a revoked key keeps its first revocation time.
+	RevokeAPIKey(ctx context.Context, id int64, userID *int64, at time.Time) (models.APIKey, error)
+	// TouchAPIKey records that key id was used at
+	TouchAPIKey(ctx context.Context, id int64, at time.Time) error
+	// SaveDomain saves d and returns its id, ErrDomainExists if its host is taken
+	SaveDomain(ctx context.Context, d models.Domain) (int64, error)
+	GetDomain(ctx context.Context, host string) (models.Domain, error)
+	// ListDomains returns every domain ordered by host
+	ListDomains(ctx context.Context) ([]models.Domain, error)
+	// UpdateDomain replaces the default and the not found URLs of d.Host and returns the domain
+	UpdateDomain(ctx context.Context, d models.Domain) (models.Domain, error)
+	// DeleteDomain deletes the domain of host, its links are kept
+	DeleteDomain(ctx context.Context, host string) error
+	// SaveIdempotencyKey saves the pending key k, an expired key of the same
+	// owner is replaced and a live one is ErrIdempotencyKeyExists
+	SaveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) error
+	// GetIdempotencyKey returns the key of owner that hasn't expired at now
+	GetIdempotencyKey(ctx context.Context, owner, key string, now time.Time) (models.IdempotencyKey, error)
+	// CompleteIdempotencyKey stores the response of the pending key k.Key of k.Owner
+	CompleteIdempotencyKey(ctx context.Context, k models.IdempotencyKey) error
+	// DeleteIdempotencyKey deletes the pending key of owner, so the request may be retried
+	DeleteIdempotencyKey(ctx context.Context, owner, key string) error
+	// DeleteExpiredIdempotencyKeys deletes the keys expired at now and returns their number
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+	// Ping checks that the database answers
+	Ping(ctx context.Context) error
+	// PendingMigrations returns the number of migrations not applied to the database yet
+	PendingMigrations(ctx context.Context) (int, error)
+	Close() error
+}
+
+// NewStorage returns the backend selected by cfg.Storage.Type
+func NewStorage(cfg *config.Config) (Storage, error) {
+	const op = "storage.NewStorage"
+
+	switch cfg.Storage.Type {
+	case TypePostgres, "":
+		return NewPostgres(cfg)
+	case TypeSQLite:
+		return NewSQLite(cfg.Storage.Path)
+	case TypeMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown storage type %q", op, cfg.Storage.Type)
+	}
+}
+
+// owner is who links are unique among: a url has one live link on a domain
+// in the namespace of a team, and one outside namespaces for every user
+type owner struct {
+	userID int64
+	team   string
+}
+
+// ownerOf returns the owner of u, aliases outside namespaces have no "/"
+func ownerOf(u models.URL) owner {
+	if team := models.TeamOf(u.Alias); team != "" {
+		return owner{team: team}
+	}
+
+	return owner{userID: u.UserID}
+}
+
+// String names o in urlKey, team names have no spaces
+func (o owner) String() string {
+	if o.team != "" {
+		return "team:" + o.team
+	}
+
+	return "user:" + strconv.FormatInt(o.userID, 10)
+}
+
+// ownerOfFind is the owner FindURL looks among
+func ownerOfFind(userID int64, team string) owner {
+	if team != "" {
+		return owner{team: team}
+	}
+
+	return owner{userID: userID}
+}
+
+// nullID returns the id to insert for u, nil lets the database assign the next one
+func nullID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// createdAt returns the creation time to store for u, postgres keeps microseconds only
+func createdAt(u models.URL) time.Time {
+	if u.CreatedAt.IsZero() {
+		return time.Now().UTC().Truncate(time.Microsecond)
+	}
+
+	return u.CreatedAt.UTC().Truncate(time.Microsecond)
+}
+
+// apiKeyCreatedAt returns the creation time to store for k
+func apiKeyCreatedAt(k models.APIKey) time.Time {
+	if k.CreatedAt.IsZero() {
+		return time.Now().UTC().Truncate(time.Microsecond)
+	}
+
+	return k.CreatedAt.UTC().Truncate(time.Microsecond)
+}
+
+// domainCreatedAt returns the creation time to store for d
+func domainCreatedAt(d models.Domain) time.Time {
+	if d.CreatedAt.IsZero() {
+		return time.Now().UTC().Truncate(time.Microsecond)
+	}
+
+	return d.CreatedAt.UTC().Truncate(time.Microsecond)
+}
+
+// idempotencyKeyCreatedAt returns the creation time to store for k
+func idempotencyKeyCreatedAt(k models.IdempotencyKey) time.Time {
+	if k.CreatedAt.IsZero() {
+		return time.Now().UTC().Truncate(time.Microsecond)
+	}
+
+	return k.CreatedAt.UTC().Truncate(time.Microsecond)
+}
+
+// redirectType returns the redirect status code to store for u
+func redirectType(u models.URL) int {
+	if u.RedirectType == 0 {
+		return models.DefaultRedirectType
+	}
+
+	return u.RedirectType
+}
+
+// encodeUTM stores the utm parameters of a link as a query string
+func encodeUTM(utm models.UTM) string {
+	return utm.Params().Encode()
+}
+
+func decodeUTM(raw string) models.UTM {
+	params, _ := url.ParseQuery(raw)
+
+	return models.UTMFromParams(params)
+}
+
+// targetHost is the lowercased host of the destination url, links are filtered by it
+func targetHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
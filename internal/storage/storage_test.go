@@ -0,0 +1,884 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage/migrations"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// backends returns every storage that can run without external services
+func backends(t *testing.T) map[string]Storage {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	db, err := openSQLite(path)
+	require.NoError(t, err)
+
+	m, err := migrations.New(db, TypeSQLite)
+	require.NoError(t, err)
+
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	sqlite, err := NewSQLite(path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = sqlite.Close() })
+
+	return map[string]Storage{
+		TypeMemory: NewMemory(),
+		TypeSQLite: sqlite,
+	}
+}
+
+func TestStorage(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			id, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, false)
+			require.NoError(t, err)
+			require.NotZero(t, id)
+
+			// several aliases may lead to the same url
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "other"}, false)
+			require.NoError(t, err)
+
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://yandex.ru", Alias: "google"}, false)
+			require.ErrorIs(t, err, ErrAliasExists)
+
+			got, err := s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, id, got.ID)
+			require.Equal(t, "https://google.com", got.URL)
+			require.Nil(t, got.ExpiresAt)
+			require.Zero(t, got.UserID)
+
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://bing.com", Alias: "bing", UserID: 42}, false)
+			require.NoError(t, err)
+
+			got, err = s.GetUrl(ctx, "", "bing")
+			require.NoError(t, err)
+			require.Equal(t, int64(42), got.UserID)
+
+			_, err = s.GetUrl(ctx, "", "missing")
+			require.ErrorIs(t, err, ErrURLNotFound)
+
+			require.NoError(t, s.DeleteURL(ctx, "", "google"))
+			require.ErrorIs(t, s.DeleteURL(ctx, "", "google"), ErrAliasNotFound)
+
+			// the url is free again once its alias is deleted
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, false)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewSQLiteOutdatedSchema(t *testing.T) {
+	_, err := NewSQLite(filepath.Join(t.TempDir(), "storage.db"))
+	require.ErrorIs(t, err, ErrSchemaOutdated)
+}
+
+func TestStorageStats(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, false)
+			require.NoError(t, err)
+
+			err = s.SaveClicks(ctx, []models.Click{
+				{Alias: "google", ClickedAt: day.Add(10 * time.Minute), VisitorID: "a"},
+				{Alias: "google", ClickedAt: day.Add(20 * time.Minute), VisitorID: "a"},
+				{Alias: "google", ClickedAt: day.Add(2*time.Hour + time.Second), VisitorID: "b"},
+				{Alias: "google", ClickedAt: day.Add(25 * time.Hour), VisitorID: "c"},
+				// clicks of unknown aliases are dropped
+				{Alias: "missing", ClickedAt: day, VisitorID: "d"},
+			})
+			require.NoError(t, err)
+
+			stats, err := s.URLStats(ctx, "", "google", day, day.Add(24*time.Hour), models.BucketHour)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), stats.Total)
+			require.Equal(t, int64(2), stats.UniqueVisitors)
+			require.Equal(t, []models.StatsBucket{
+				{Start: day, Count: 2},
+				{Start: day.Add(2 * time.Hour), Count: 1},
+			}, stats.Buckets)
+
+			stats, err = s.URLStats(ctx, "", "google", day, day.Add(48*time.Hour), models.BucketDay)
+			require.NoError(t, err)
+			require.Equal(t, int64(4), stats.Total)
+			require.Equal(t, []models.StatsBucket{
+				{Start: day, Count: 3},
+				{Start: day.Add(24 * time.Hour), Count: 1},
+			}, stats.Buckets)
+
+			_, err = s.URLStats(ctx, "", "google", day, day.Add(time.Hour), "week")
+			require.ErrorIs(t, err, ErrInvalidBucket)
+
+			_, err = s.URLStats(ctx, "", "missing", day, day.Add(time.Hour), models.BucketDay)
+			require.ErrorIs(t, err, ErrURLNotFound)
+		})
+	}
+}
+
+func TestStorageExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "expired", ExpiresAt: &past}, false)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://yandex.ru", Alias: "alive", ExpiresAt: &future}, false)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://bing.com", Alias: "forever"}, false)
+			require.NoError(t, err)
+
+			got, err := s.GetUrl(ctx, "", "expired")
+			require.NoError(t, err)
+			require.NotNil(t, got.ExpiresAt)
+			require.True(t, got.ExpiresAt.Equal(past))
+			require.True(t, got.Expired(now))
+
+			deleted, err := s.DeleteExpired(ctx, now)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), deleted)
+
+			_, err = s.GetUrl(ctx, "", "expired")
+			require.ErrorIs(t, err, ErrURLNotFound)
+
+			for _, alias := range []string{"alive", "forever"} {
+				_, err = s.GetUrl(ctx, "", alias)
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStorageListURLs(t *testing.T) {
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	owner := int64(42)
+
+	links := []models.URL{
+		{Alias: "promo-1", URL: "https://example.com/a", UserID: owner, CreatedAt: base},
+		{Alias: "promo-2", URL: "https://EXAMPLE.com:8080/b", UserID: owner, CreatedAt: base.Add(time.Hour)},
+		{Alias: "promo-3", URL: "https://other.org/c", CreatedAt: base.Add(2 * time.Hour)},
+		{Alias: "docs", URL: "https://example.com/docs", UserID: owner, CreatedAt: base.Add(3 * time.Hour)},
+		{Alias: "blog", URL: "https://blog.example.com", CreatedAt: base.Add(4 * time.Hour)},
+		{Domain: "go.brand.com", Alias: "promo-1", URL: "https://brand.com", CreatedAt: base.Add(5 * time.Hour)},
+	}
+
+	primary, brand := "", "go.brand.com"
+
+	aliases := func(urls []models.URL) []string {
+		var out []string
+		for _, u := range urls {
+			out = append(out, u.Alias)
+		}
+		return out
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, u := range links {
+				_, err := s.SaveURL(ctx, u, false)
+				require.NoError(t, err)
+			}
+
+			clicks := []models.Click{
+				{Alias: "promo-3", ClickedAt: base}, {Alias: "promo-3", ClickedAt: base}, {Alias: "promo-3", ClickedAt: base},
+				{Alias: "docs", ClickedAt: base},
+			}
+			require.NoError(t, s.SaveClicks(ctx, clicks))
+
+			// walk every page, newest first
+			var (
+				got   []string
+				after *models.URLCursor
+			)
+			for i := 0; ; i++ {
+				require.Less(t, i, len(links), "pagination does not end")
+
+				page, err := s.ListURLs(ctx, models.URLFilter{Desc: true, Limit: 2, After: after})
+				require.NoError(t, err)
+
+				got = append(got, aliases(page.URLs)...)
+				if page.Next == nil {
+					break
+				}
+				after = page.Next
+			}
+			require.Equal(t, []string{"promo-1", "blog", "docs", "promo-3", "promo-2", "promo-1"}, got)
+
+			cases := []struct {
+				name   string
+				filter models.URLFilter
+				want   []string
+			}{
+				{
+					name:   "owner",
+					filter: models.URLFilter{UserID: &owner},
+					want:   []string{"promo-1", "promo-2", "docs"},
+				},
+				{
+					name:   "alias prefix",
+					filter: models.URLFilter{AliasPrefix: "promo-"},
+					want:   []string{"promo-1", "promo-2", "promo-3", "promo-1"},
+				},
+				{
+					name:   "alias prefix on the primary domain",
+					filter: models.URLFilter{AliasPrefix: "promo-", ShortDomain: &primary},
+					want:   []string{"promo-1", "promo-2", "promo-3"},
+				},
+				{
+					name:   "short domain",
+					filter: models.URLFilter{ShortDomain: &brand},
+					want:   []string{"promo-1"},
+				},
+				{
+					name:   "domain",
+					filter: models.URLFilter{Domain: "Example.com"},
+					want:   []string{"promo-1", "promo-2", "docs"},
+				},
+				{
+					name:   "created range",
+					filter: models.URLFilter{CreatedFrom: base.Add(time.Hour), CreatedTo: base.Add(3 * time.Hour)},
+					want:   []string{"promo-2", "promo-3"},
+				},
+				{
+					name:   "most clicked",
+					filter: models.URLFilter{SortBy: models.SortByClicks, Desc: true, Limit: 2},
+					want:   []string{"promo-3", "docs"},
+				},
+			}
+
+			for _, tc := range cases {
+				if tc.filter.Limit == 0 {
+					tc.filter.Limit = 10
+				}
+
+				page, err := s.ListURLs(ctx, tc.filter)
+				require.NoError(t, err, tc.name)
+				require.Equal(t, tc.want, aliases(page.URLs), tc.name)
+			}
+
+			page, err := s.ListURLs(ctx, models.URLFilter{SortBy: models.SortByClicks, Desc: true, Limit: 1})
+			require.NoError(t, err)
+			require.Equal(t, int64(3), page.URLs[0].Clicks)
+			require.True(t, page.URLs[0].CreatedAt.Equal(base.Add(2*time.Hour)))
+		})
+	}
+}
+
+func TestStorageFindURL(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Hour)
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, u := range []models.URL{
+				{URL: "https://google.com", Alias: "theirs", UserID: 8},
+				{URL: "https://google.com", Alias: "old", UserID: 7, ExpiresAt: &expired},
+				{URL: "https://google.com", Alias: "google", UserID: 7},
+				{URL: "https://google.com", Alias: "google2", UserID: 7},
+				{URL: "https://google.com", Domain: "go.brand.com", Alias: "promo", UserID: 7},
+				{URL: "https://google.com", Alias: "sales/spring", UserID: 8},
+				{URL: "https://google.com/", Alias: "slash", UserID: 7},
+			} {
+				_, err := s.SaveURL(ctx, u, false)
+				require.NoError(t, err)
+			}
+
+			u, err := s.FindURL(ctx, "https://google.com", "", 7, "", now)
+			require.NoError(t, err)
+			require.Equal(t, "google", u.Alias)
+
+			// the links of another owner aren't looked at
+			u, err = s.FindURL(ctx, "https://google.com", "", 8, "", now)
+			require.NoError(t, err)
+			require.Equal(t, "theirs", u.Alias)
+
+			_, err = s.FindURL(ctx, "https://google.com", "", 9, "", now)
+			require.ErrorIs(t, err, ErrURLNotFound)
+
+			// the ones of a team are shared by its members
+			u, err = s.FindURL(ctx, "https://google.com", "", 7, "sales", now)
+			require.NoError(t, err)
+			require.Equal(t, "sales/spring", u.Alias)
+
+			_, err = s.FindURL(ctx, "https://google.com", "", 8, "sale", now)
+			require.ErrorIs(t, err, ErrURLNotFound)
+
+			u, err = s.FindURL(ctx, "https://google.com", "go.brand.com", 7, "", now)
+			require.NoError(t, err)
+			require.Equal(t, "go.brand.com", u.Domain)
+			require.Equal(t, "promo", u.Alias)
+
+			_, err = s.FindURL(ctx, "https://google.com", "brand.com", 7, "", now)
+			require.ErrorIs(t, err, ErrURLNotFound)
+
+			_, err = s.FindURL(ctx, "https://bing.com", "", 7, "", now)
+			require.ErrorIs(t, err, ErrURLNotFound)
+		})
+	}
+}
+
+func TestStorageUniqueURLs(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, true)
+			require.NoError(t, err)
+
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "other"}, true)
+			require.ErrorIs(t, err, ErrURLExists)
+
+			// other domains, other owners and expired links don't count
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Domain: "go.brand.com", Alias: "promo"}, true)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "mine", UserID: 7}, true)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "sales/google", UserID: 7}, true)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "sales/google2", UserID: 8}, true)
+			require.ErrorIs(t, err, ErrURLExists)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://yandex.ru", Alias: "old", ExpiresAt: &past}, true)
+			require.NoError(t, err)
+
+			errs, err := s.SaveURLs(ctx, []models.URL{
+				{URL: "https://google.com", Alias: "google2"},
+				{URL: "https://yandex.ru", Alias: "ya"},
+				{URL: "https://yandex.ru", Alias: "ya2"},
+				{URL: "https://bing.com", Alias: "google"},
+				{URL: "https://bing.com", Alias: "bing7", UserID: 7},
+				{URL: "https://bing.com", Alias: "bing8", UserID: 8},
+			}, true)
+			require.NoError(t, err)
+			require.Equal(t, []error{ErrURLExists, nil, ErrURLExists, ErrAliasExists, nil, nil}, errs)
+
+			promo, err := s.GetUrl(ctx, "go.brand.com", "promo")
+			require.NoError(t, err)
+
+			// the link itself doesn't count, the other ones on its domain do
+			promo.URL = "https://google.com"
+			_, err = s.UpdateURL(ctx, promo, promo.Revision, 0, true)
+			require.NoError(t, err)
+
+			ya, err := s.GetUrl(ctx, "", "ya")
+			require.NoError(t, err)
+
+			ya.URL = "https://google.com"
+			_, err = s.UpdateURL(ctx, ya, ya.Revision, 0, true)
+			require.ErrorIs(t, err, ErrURLExists)
+
+			_, err = s.UpdateURL(ctx, ya, ya.Revision, 0, false)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestStorageUniqueURLsConcurrent(t *testing.T) {
+	const saves = 20
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			errs := make(chan error, saves)
+			for i := 0; i < saves; i++ {
+				go func() {
+					_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: fmt.Sprintf("google%d", i)}, true)
+					errs <- err
+				}()
+			}
+
+			saved := 0
+			for i := 0; i < saves; i++ {
+				err := <-errs
+				if err == nil {
+					saved++
+					continue
+				}
+				require.ErrorIs(t, err, ErrURLExists)
+			}
+			require.Equal(t, 1, saved)
+		})
+	}
+}
+
+func TestStorageUpdateURL(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := s.SaveURL(ctx, models.URL{URL: "https://gogle.com", Alias: "google", UserID: 42}, false)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://yandex.ru", Alias: "yandex"}, false)
+			require.NoError(t, err)
+
+			u, err := s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, int64(1), u.Revision)
+			require.Equal(t, models.DefaultRedirectType, u.RedirectType)
+
+			u.URL = "https://google.com"
+			u.ExpiresAt = &expiresAt
+			u.RedirectType = 301
+
+			updated, err := s.UpdateURL(ctx, u, 1, 7, false)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), updated.Revision)
+			require.Equal(t, "https://google.com", updated.URL)
+			require.Equal(t, 301, updated.RedirectType)
+			require.True(t, updated.ExpiresAt.Equal(expiresAt))
+			require.Equal(t, int64(42), updated.UserID)
+
+			got, err := s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, updated, got)
+
+			_, err = s.UpdateURL(ctx, u, 1, 7, false)
+			require.ErrorIs(t, err, ErrRevisionMismatch)
+
+			_, err = s.UpdateURL(ctx, models.URL{Alias: "missing", URL: "https://bing.com"}, 1, 7, false)
+			require.ErrorIs(t, err, ErrURLNotFound)
+
+			page, err := s.ListURLs(ctx, models.URLFilter{Domain: "google.com", Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, page.URLs, 1)
+
+			revisions, err := s.URLRevisions(ctx, "", "google")
+			require.NoError(t, err)
+			require.Len(t, revisions, 2)
+			require.Equal(t, int64(2), revisions[0].Revision)
+			require.Equal(t, "https://google.com", revisions[0].URL)
+			require.Equal(t, int64(7), revisions[0].ChangedBy)
+			require.Equal(t, int64(1), revisions[1].Revision)
+			require.Equal(t, "https://gogle.com", revisions[1].URL)
+			require.Nil(t, revisions[1].ExpiresAt)
+			require.Equal(t, int64(42), revisions[1].ChangedBy)
+
+			_, err = s.URLRevisions(ctx, "", "missing")
+			require.ErrorIs(t, err, ErrURLNotFound)
+		})
+	}
+}
+
+func TestStorageRedirectOptions(t *testing.T) {
+	utm := models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring sale"}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := s.SaveURL(ctx, models.URL{
+				URL: "https://google.com", Alias: "google", RedirectType: 308, PassQuery: true, UTM: utm, Interstitial: true,
+			}, false)
+			require.NoError(t, err)
+
+			errs, err := s.SaveURLs(ctx, []models.URL{{URL: "https://yandex.ru", Alias: "ya", UTM: utm}}, false)
+			require.NoError(t, err)
+			require.NoError(t, errs[0])
+
+			u, err := s.GetUrl(ctx, "", "google")
+			require.NoError(t, err)
+			require.Equal(t, 308, u.RedirectType)
+			require.True(t, u.PassQuery)
+			require.Equal(t, utm, u.UTM)
+			require.True(t, u.Interstitial)
+
+			ya, err := s.GetUrl(ctx, "", "ya")
+			require.NoError(t, err)
+			require.False(t, ya.PassQuery)
+			require.Equal(t, utm, ya.UTM)
+
+			u.PassQuery = false
+			u.UTM = models.UTM{}
+			u.Interstitial = false
+
+			updated, err := s.UpdateURL(ctx, u, u.Revision, 0, false)
+			require.NoError(t, err)
+			require.False(t, updated.PassQuery)
+			require.Equal(t, models.UTM{}, updated.UTM)
+			require.False(t, updated.Interstitial)
+
+			revisions, err := s.URLRevisions(ctx, "", "google")
+			require.NoError(t, err)
+			require.Len(t, revisions, 2)
+			require.Equal(t, models.UTM{}, revisions[0].UTM)
+			require.True(t, revisions[1].PassQuery)
+			require.Equal(t, utm, revisions[1].UTM)
+			require.True(t, revisions[1].Interstitial)
+		})
+	}
+}
+
+func TestStorageBatch(t *testing.T) {
+	owner := int64(42)
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, false)
+			require.NoError(t, err)
+
+			urls := []models.URL{
+				{URL: "https://yandex.ru", Alias: "yandex", UserID: owner},
+				{URL: "https://google.com", Alias: "google2", UserID: owner},
+				{URL: "https://bing.com", Alias: "google", UserID: owner},
+				{URL: "https://duckduckgo.com", Alias: "ddg", UserID: owner},
+				{URL: "https://duckduckgo.com/", Alias: "ddg", UserID: owner},
+				{URL: "https://yandex.ru", Alias: "yandex2", UserID: owner},
+			}
+			// more than one statement worth of rows
+			for i := 0; i < batchSize; i++ {
+				urls = append(urls, models.URL{URL: fmt.Sprintf("https://example.com/%d", i), Alias: fmt.Sprintf("ex%d", i)})
+			}
+
+			errs, err := s.SaveURLs(ctx, urls, false)
+			require.NoError(t, err)
+			require.Len(t, errs, len(urls))
+			require.Equal(t, []error{nil, nil, ErrAliasExists, nil, ErrAliasExists, nil}, errs[:6])
+			for _, err := range errs[6:] {
+				require.NoError(t, err)
+			}
+
+			u, err := s.GetUrl(ctx, "", "ddg")
+			require.NoError(t, err)
+			require.Equal(t, "https://duckduckgo.com", u.URL)
+			require.Equal(t, owner, u.UserID)
+			require.Equal(t, int64(1), u.Revision)
+
+			revisions, err := s.URLRevisions(ctx, "", "ddg")
+			require.NoError(t, err)
+			require.Len(t, revisions, 1)
+
+			_, err = s.GetUrl(ctx, "", fmt.Sprintf("ex%d", batchSize-1))
+			require.NoError(t, err)
+
+			deleted, err := s.DeleteURLs(ctx, "", []string{"google", "yandex", "missing"}, &owner)
+			require.NoError(t, err)
+			require.Equal(t, []string{"yandex"}, deleted)
+
+			deleted, err = s.DeleteURLs(ctx, "", []string{"google", "ddg"}, nil)
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"google", "ddg"}, deleted)
+
+			for _, alias := range []string{"google", "yandex", "ddg"} {
+				_, err = s.GetUrl(ctx, "", alias)
+				require.ErrorIs(t, err, ErrURLNotFound)
+			}
+		})
+	}
+}
+
+func TestStorageNextURLID(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			// the counter starts before the first url is saved
+			first, err := s.NextURLID(ctx)
+			require.NoError(t, err)
+			require.NotZero(t, first)
+
+			second, err := s.NextURLID(ctx)
+			require.NoError(t, err)
+			require.Greater(t, second, first)
+
+			id, err := s.SaveURL(ctx, models.URL{ID: second, URL: "https://google.com", Alias: "google"}, false)
+			require.NoError(t, err)
+			require.Equal(t, second, id)
+
+			id, err = s.SaveURL(ctx, models.URL{URL: "https://yandex.ru", Alias: "ya"}, false)
+			require.NoError(t, err)
+			require.Greater(t, id, second)
+
+			reserved, err := s.NextURLID(ctx)
+			require.NoError(t, err)
+			require.Greater(t, reserved, id)
+
+			errs, err := s.SaveURLs(ctx, []models.URL{
+				{ID: reserved, URL: "https://bing.com", Alias: "bing"},
+				{URL: "https://duckduckgo.com", Alias: "ddg"},
+			}, false)
+			require.NoError(t, err)
+			require.Equal(t, []error{nil, nil}, errs)
+
+			got, err := s.GetUrl(ctx, "", "bing")
+			require.NoError(t, err)
+			require.Equal(t, reserved, got.ID)
+
+			got, err = s.GetUrl(ctx, "", "ddg")
+			require.NoError(t, err)
+			require.Greater(t, got.ID, reserved)
+		})
+	}
+}
+
+func TestStorageHealth(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			require.NoError(t, s.Ping(ctx))
+
+			pending, err := s.PendingMigrations(ctx)
+			require.NoError(t, err)
+			require.Zero(t, pending)
+		})
+	}
+}
+
+func TestStorageAPIKeys(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+			expires := now.Add(time.Hour)
+
+			id, err := s.SaveAPIKey(ctx, models.APIKey{
+				Name:      "deploy",
+				Prefix:    "usk_abcd",
+				Hash:      "hash-1",
+				Scopes:    []string{models.ScopeLinksWrite, models.ScopeStatsRead},
+				UserID:    42,
+				CreatedAt: now,
+				ExpiresAt: &expires,
+			})
+			require.NoError(t, err)
+			require.NotZero(t, id)
+
+			other, err := s.SaveAPIKey(ctx, models.APIKey{Name: "ci", Prefix: "usk_efgh", Hash: "hash-2", UserID: 42})
+			require.NoError(t, err)
+
+			_, err = s.SaveAPIKey(ctx, models.APIKey{Name: "service", Prefix: "usk_ijkl", Hash: "hash-3"})
+			require.NoError(t, err)
+
+			k, err := s.APIKeyByHash(ctx, "hash-1")
+			require.NoError(t, err)
+			require.Equal(t, id, k.ID)
+			require.Equal(t, "deploy", k.Name)
+			require.Equal(t, []string{models.ScopeLinksWrite, models.ScopeStatsRead}, k.Scopes)
+			require.Equal(t, now, k.CreatedAt)
+			require.Equal(t, expires, k.ExpiresAt.UTC())
+			require.Nil(t, k.LastUsedAt)
+			require.Nil(t, k.RevokedAt)
+
+			_, err = s.APIKeyByHash(ctx, "missing")
+			require.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+			keys, err := s.ListAPIKeys(ctx, 42)
+			require.NoError(t, err)
+			require.Len(t, keys, 2)
+			require.Equal(t, other, keys[0].ID)
+			require.Empty(t, keys[0].Scopes)
+
+			used := now.Add(time.Minute)
+			require.NoError(t, s.TouchAPIKey(ctx, id, used))
+			require.ErrorIs(t, s.TouchAPIKey(ctx, 1000, used), ErrAPIKeyNotFound)
+
+			k, err = s.APIKeyByHash(ctx, "hash-1")
+			require.NoError(t, err)
+			require.Equal(t, used, k.LastUsedAt.UTC())
+
+			// only the owner may revoke
+			stranger := int64(7)
+			_, err = s.RevokeAPIKey(ctx, id, &stranger, now)
+			require.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+			owner := int64(42)
+			k, err = s.RevokeAPIKey(ctx, id, &owner, now)
+			require.NoError(t, err)
+			require.Equal(t, now, k.RevokedAt.UTC())
+
+			// the first revocation is kept
+			k, err = s.RevokeAPIKey(ctx, id, nil, now.Add(time.Hour))
+			require.NoError(t, err)
+			require.Equal(t, now, k.RevokedAt.UTC())
+
+			_, err = s.RevokeAPIKey(ctx, 1000, nil, now)
+			require.ErrorIs(t, err, ErrAPIKeyNotFound)
+		})
+	}
+}
+
+func TestStorageIdempotencyKeys(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			k := models.IdempotencyKey{
+				Owner:       "user:42",
+				Key:         "job-1",
+				RequestHash: "hash-1",
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(time.Hour),
+			}
+			require.NoError(t, s.SaveIdempotencyKey(ctx, k))
+			require.ErrorIs(t, s.SaveIdempotencyKey(ctx, k), ErrIdempotencyKeyExists)
+
+			// keys of other owners don't clash
+			require.NoError(t, s.SaveIdempotencyKey(ctx, models.IdempotencyKey{
+				Owner: "service", Key: "job-1", RequestHash: "hash-2", CreatedAt: now, ExpiresAt: now.Add(time.Minute),
+			}))
+
+			got, err := s.GetIdempotencyKey(ctx, "user:42", "job-1", now)
+			require.NoError(t, err)
+			require.True(t, got.Pending())
+			require.Equal(t, "hash-1", got.RequestHash)
+			require.Equal(t, now.Add(time.Hour), got.ExpiresAt)
+
+			k.Status, k.Body = 200, []byte(`{"status":"OK","alias":"job"}`)
+			require.NoError(t, s.CompleteIdempotencyKey(ctx, k))
+			// a completed key is neither completed again nor released
+			require.ErrorIs(t, s.CompleteIdempotencyKey(ctx, k), ErrIdempotencyKeyNotFound)
+			require.ErrorIs(t, s.DeleteIdempotencyKey(ctx, "user:42", "job-1"), ErrIdempotencyKeyNotFound)
+
+			got, err = s.GetIdempotencyKey(ctx, "user:42", "job-1", now)
+			require.NoError(t, err)
+			require.Equal(t, 200, got.Status)
+			require.Equal(t, k.Body, got.Body)
+
+			// a released key may be taken again
+			require.NoError(t, s.DeleteIdempotencyKey(ctx, "service", "job-1"))
+			_, err = s.GetIdempotencyKey(ctx, "service", "job-1", now)
+			require.ErrorIs(t, err, ErrIdempotencyKeyNotFound)
+
+			// an expired key is gone for lookups and may be taken by another request
+			later := now.Add(2 * time.Hour)
+			_, err = s.GetIdempotencyKey(ctx, "user:42", "job-1", later)
+			require.ErrorIs(t, err, ErrIdempotencyKeyNotFound)
+
+			require.NoError(t, s.SaveIdempotencyKey(ctx, models.IdempotencyKey{
+				Owner: "user:42", Key: "job-1", RequestHash: "hash-3", CreatedAt: later, ExpiresAt: later.Add(time.Hour),
+			}))
+			got, err = s.GetIdempotencyKey(ctx, "user:42", "job-1", later)
+			require.NoError(t, err)
+			require.True(t, got.Pending())
+			require.Equal(t, "hash-3", got.RequestHash)
+
+			deleted, err := s.DeleteExpiredIdempotencyKeys(ctx, later.Add(2*time.Hour))
+			require.NoError(t, err)
+			require.Equal(t, int64(1), deleted)
+		})
+	}
+}
+
+func TestStorageDomains(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			id, err := s.SaveDomain(ctx, models.Domain{
+				Host:       "go.brand.com",
+				DefaultURL: "https://brand.com",
+				UserID:     42,
+				CreatedAt:  now,
+			})
+			require.NoError(t, err)
+			require.NotZero(t, id)
+
+			_, err = s.SaveDomain(ctx, models.Domain{Host: "go.brand.com"})
+			require.ErrorIs(t, err, ErrDomainExists)
+
+			_, err = s.SaveDomain(ctx, models.Domain{Host: "brand.link"})
+			require.NoError(t, err)
+
+			d, err := s.GetDomain(ctx, "go.brand.com")
+			require.NoError(t, err)
+			require.Equal(t, models.Domain{
+				ID:         id,
+				Host:       "go.brand.com",
+				DefaultURL: "https://brand.com",
+				UserID:     42,
+				CreatedAt:  now,
+			}, d)
+
+			_, err = s.GetDomain(ctx, "missing.com")
+			require.ErrorIs(t, err, ErrDomainNotFound)
+
+			domains, err := s.ListDomains(ctx)
+			require.NoError(t, err)
+			require.Len(t, domains, 2)
+			require.Equal(t, "brand.link", domains[0].Host)
+
+			d, err = s.UpdateDomain(ctx, models.Domain{Host: "go.brand.com", NotFoundURL: "https://brand.com/404"})
+			require.NoError(t, err)
+			require.Empty(t, d.DefaultURL)
+			require.Equal(t, "https://brand.com/404", d.NotFoundURL)
+			require.Equal(t, now, d.CreatedAt)
+
+			_, err = s.UpdateDomain(ctx, models.Domain{Host: "missing.com"})
+			require.ErrorIs(t, err, ErrDomainNotFound)
+
+			// the same alias may be taken on every domain
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://a.example.com", Alias: "promo"}, false)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://b.example.com", Domain: "go.brand.com", Alias: "promo"}, false)
+			require.NoError(t, err)
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://c.example.com", Domain: "go.brand.com", Alias: "promo"}, false)
+			require.ErrorIs(t, err, ErrAliasExists)
+
+			u, err := s.GetUrl(ctx, "", "promo")
+			require.NoError(t, err)
+			require.Equal(t, "https://a.example.com", u.URL)
+
+			// clicks, stats and deletes stay on the domain of the link
+			clickedAt := now.Add(-time.Minute)
+			require.NoError(t, s.SaveClicks(ctx, []models.Click{
+				{Domain: "go.brand.com", Alias: "promo", ClickedAt: clickedAt},
+				{Domain: "go.brand.com", Alias: "promo", ClickedAt: clickedAt},
+				{Alias: "promo", ClickedAt: clickedAt},
+			}))
+
+			stats, err := s.URLStats(ctx, "go.brand.com", "promo", now.Add(-time.Hour), now, models.BucketDay)
+			require.NoError(t, err)
+			require.Equal(t, "go.brand.com", stats.Domain)
+			require.Equal(t, int64(2), stats.Total)
+
+			deleted, err := s.DeleteURLs(ctx, "go.brand.com", []string{"promo"}, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"promo"}, deleted)
+
+			_, err = s.GetUrl(ctx, "", "promo")
+			require.NoError(t, err)
+
+			_, err = s.SaveURL(ctx, models.URL{URL: "https://b.example.com", Domain: "go.brand.com", Alias: "promo"}, false)
+			require.NoError(t, err)
+
+			require.NoError(t, s.DeleteDomain(ctx, "go.brand.com"))
+			require.ErrorIs(t, s.DeleteDomain(ctx, "go.brand.com"), ErrDomainNotFound)
+
+			// links of a deleted domain are kept
+			u, err = s.GetUrl(ctx, "go.brand.com", "promo")
+			require.NoError(t, err)
+			require.Equal(t, "https://b.example.com", u.URL)
+		})
+	}
+}
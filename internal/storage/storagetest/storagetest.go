@@ -0,0 +1,22 @@
+// Package storagetest has storages for the tests of the storage decorators
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+)
+
+// ErrDown is what a storage that lost its database answers
+var ErrDown = errors.New("connection refused")
+
+// Failing is a storage whose database is down. Only SaveClicks answers
+// with ErrDown, the other calls go to the embedded storage.
+type Failing struct {
+	storage.Storage
+}
+
+func (Failing) SaveClicks(context.Context, []models.Click) error {
+	return ErrDown
+}
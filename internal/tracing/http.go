@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/lib/api/route"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Middleware starts a span for every request, a child of the caller's one
+// if it sent a traceparent header. The span is named after the chi route
+// pattern like /url/{alias}, so it has to be used on the top router, after
+// middleware.RequestID to tag the span with the request id.
+func (t *Tracing) Middleware(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		// the pattern is known once the request was routed
+		route := route.Pattern(r)
+
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			attribute.String("request_id", middleware.GetReqID(r.Context())),
+		)
+	})
+
+	return otelhttp.NewHandler(named, "http.server",
+		otelhttp.WithTracerProvider(t.provider),
+		otelhttp.WithPropagators(t.propagator),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }),
+	)
+}
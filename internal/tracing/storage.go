@@ -0,0 +1,289 @@
+package tracing
+
+import (
+	"context"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// Storage makes every query to another storage a client span of the
+// request's trace. Its methods are written out one by one, a method
+// added to storage.Storage doesn't compile here until it has its span.
+type Storage struct {
+	next   storage.Storage
+	t      *Tracing
+	system attribute.KeyValue
+}
+
+// WrapStorage traces next of the given storage type, it goes below the
+// cache so that a span is a query to the database
+func (t *Tracing) WrapStorage(next storage.Storage, storageType string) *Storage {
+	system := semconv.DBSystemKey.String(storageType)
+	switch storageType {
+	case storage.TypePostgres:
+		system = semconv.DBSystemPostgreSQL
+	case storage.TypeSQLite:
+		system = semconv.DBSystemSqlite
+	}
+
+	return &Storage{next: next, t: t, system: system}
+}
+
+// start starts the span of a call of method
+func (s *Storage) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.t.tracer.Start(ctx, "storage."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(s.system, semconv.DBOperationName(method)),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// end ends span of a call that returned err, a missing alias or
+// a conflict is an answer of the storage and doesn't fail the span
+func end(span trace.Span, err error) {
+	if storage.Failed(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if err != nil {
+		span.SetAttributes(attribute.String("storage.result", err.Error()))
+	}
+
+	span.End()
+}
+
+func aliasAttr(alias string) attribute.KeyValue {
+	return attribute.String("url.alias", alias)
+}
+
+func (s *Storage) SaveURL(ctx context.Context, u models.URL, unique bool) (id int64, err error) {
+	ctx, span := s.start(ctx, "SaveURL", domainAttr(u.Domain), aliasAttr(u.Alias))
+	defer func() { end(span, err) }()
+
+	return s.next.SaveURL(ctx, u, unique)
+}
+
+func (s *Storage) SaveURLs(ctx context.Context, urls []models.URL, unique bool) (errs []error, err error) {
+	ctx, span := s.start(ctx, "SaveURLs", attribute.Int("urls.count", len(urls)))
+	defer func() { end(span, err) }()
+
+	return s.next.SaveURLs(ctx, urls, unique)
+}
+
+func (s *Storage) NextURLID(ctx context.Context) (id int64, err error) {
+	ctx, span := s.start(ctx, "NextURLID")
+	defer func() { end(span, err) }()
+
+	return s.next.NextURLID(ctx)
+}
+
+func (s *Storage) GetUrl(ctx context.Context, domain, alias string) (u models.URL, err error) {
+	ctx, span := s.start(ctx, "GetUrl", domainAttr(domain), aliasAttr(alias))
+	defer func() { end(span, err) }()
+
+	return s.next.GetUrl(ctx, domain, alias)
+}
+
+func (s *Storage) FindURL(ctx context.Context, rawURL, domain string, userID int64, team string, now time.Time) (u models.URL, err error) {
+	ctx, span := s.start(ctx, "FindURL", domainAttr(domain))
+	defer func() { end(span, err) }()
+
+	return s.next.FindURL(ctx, rawURL, domain, userID, team, now)
+}
+
+func (s *Storage) ListURLs(ctx context.Context, filter models.URLFilter) (page models.URLPage, err error) {
+	ctx, span := s.start(ctx, "ListURLs")
+	defer func() { end(span, err) }()
+
+	return s.next.ListURLs(ctx, filter)
+}
+
+func (s *Storage) UpdateURL(ctx context.Context, u models.URL, revision int64, changedBy int64, unique bool) (updated models.URL, err error) {
+	ctx, span := s.start(ctx, "UpdateURL", domainAttr(u.Domain), aliasAttr(u.Alias))
+	defer func() { end(span, err) }()
+
+	return s.next.UpdateURL(ctx, u, revision, changedBy, unique)
+}
+
+func (s *Storage) URLRevisions(ctx context.Context, domain, alias string) (revisions []models.URLRevision, err error) {
+	ctx, span := s.start(ctx, "URLRevisions", domainAttr(domain), aliasAttr(alias))
+	defer func() { end(span, err) }()
+
+	return s.next.URLRevisions(ctx, domain, alias)
+}
+
+func (s *Storage) DeleteURL(ctx context.Context, domain, alias string) (err error) {
+	ctx, span := s.start(ctx, "DeleteURL", domainAttr(domain), aliasAttr(alias))
+	defer func() { end(span, err) }()
+
+	return s.next.DeleteURL(ctx, domain, alias)
+}
+
+func (s *Storage) DeleteURLs(ctx context.Context, domain string, aliases []string, userID *int64) (deleted []string, err error) {
+	ctx, span := s.start(ctx, "DeleteURLs", domainAttr(domain), attribute.Int("urls.count", len(aliases)))
+	defer func() { end(span, err) }()
+
+	return s.next.DeleteURLs(ctx, domain, aliases, userID)
+}
+
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time) (deleted int64, err error) {
+	ctx, span := s.start(ctx, "DeleteExpired")
+	defer func() { end(span, err) }()
+
+	return s.next.DeleteExpired(ctx, now)
+}
+
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) (err error) {
+	ctx, span := s.start(ctx, "SaveClicks", attribute.Int("clicks.count", len(clicks)))
+	defer func() { end(span, err) }()
+
+	return s.next.SaveClicks(ctx, clicks)
+}
+
+func (s *Storage) URLStats(ctx context.Context, domain, alias string, from, to time.Time, bucket string) (stats models.Stats, err error) {
+	ctx, span := s.start(ctx, "URLStats", domainAttr(domain), aliasAttr(alias), attribute.String("stats.bucket", bucket))
+	defer func() { end(span, err) }()
+
+	return s.next.URLStats(ctx, domain, alias, from, to, bucket)
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, k models.APIKey) (id int64, err error) {
+	ctx, span := s.start(ctx, "SaveAPIKey", keyOwnerAttr(k.UserID))
+	defer func() { end(span, err) }()
+
+	return s.next.SaveAPIKey(ctx, k)
+}
+
+// APIKeyByHash carries no attribute, the hash would be as good as the key
+func (s *Storage) APIKeyByHash(ctx context.Context, hash string) (k models.APIKey, err error) {
+	ctx, span := s.start(ctx, "APIKeyByHash")
+	defer func() { end(span, err) }()
+
+	return s.next.APIKeyByHash(ctx, hash)
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, userID int64) (keys []models.APIKey, err error) {
+	ctx, span := s.start(ctx, "ListAPIKeys", keyOwnerAttr(userID))
+	defer func() { end(span, err) }()
+
+	return s.next.ListAPIKeys(ctx, userID)
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64, userID *int64, at time.Time) (k models.APIKey, err error) {
+	ctx, span := s.start(ctx, "RevokeAPIKey", keyAttr(id))
+	defer func() { end(span, err) }()
+
+	return s.next.RevokeAPIKey(ctx, id, userID, at)
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, id int64, at time.Time) (err error) {
+	ctx, span := s.start(ctx, "TouchAPIKey", keyAttr(id))
+	defer func() { end(span, err) }()
+
+	return s.next.TouchAPIKey(ctx, id, at)
+}
+
+func keyAttr(id int64) attribute.KeyValue {
+	return attribute.Int64("api_key.id", id)
+}
+
+func keyOwnerAttr(userID int64) attribute.KeyValue {
+	return attribute.Int64("api_key.user_id", userID)
+}
+
+func (s *Storage) SaveDomain(ctx context.Context, d models.Domain) (id int64, err error) {
+	ctx, span := s.start(ctx, "SaveDomain", domainAttr(d.Host))
+	defer func() { end(span, err) }()
+
+	return s.next.SaveDomain(ctx, d)
+}
+
+func (s *Storage) GetDomain(ctx context.Context, host string) (d models.Domain, err error) {
+	ctx, span := s.start(ctx, "GetDomain", domainAttr(host))
+	defer func() { end(span, err) }()
+
+	return s.next.GetDomain(ctx, host)
+}
+
+func (s *Storage) ListDomains(ctx context.Context) (domains []models.Domain, err error) {
+	ctx, span := s.start(ctx, "ListDomains")
+	defer func() { end(span, err) }()
+
+	return s.next.ListDomains(ctx)
+}
+
+func (s *Storage) UpdateDomain(ctx context.Context, d models.Domain) (updated models.Domain, err error) {
+	ctx, span := s.start(ctx, "UpdateDomain", domainAttr(d.Host))
+	defer func() { end(span, err) }()
+
+	return s.next.UpdateDomain(ctx, d)
+}
+
+func (s *Storage) DeleteDomain(ctx context.Context, host string) (err error) {
+	ctx, span := s.start(ctx, "DeleteDomain", domainAttr(host))
+	defer func() { end(span, err) }()
+
+	return s.next.DeleteDomain(ctx, host)
+}
+
+func domainAttr(host string) attribute.KeyValue {
+	return attribute.String("domain.host", host)
+}
+
+func (s *Storage) SaveIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (err error) {
+	ctx, span := s.start(ctx, "SaveIdempotencyKey", idempotencyOwnerAttr(k.Owner))
+	defer func() { end(span, err) }()
+
+	return s.next.SaveIdempotencyKey(ctx, k)
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, owner, key string, now time.Time) (k models.IdempotencyKey, err error) {
+	ctx, span := s.start(ctx, "GetIdempotencyKey", idempotencyOwnerAttr(owner))
+	defer func() { end(span, err) }()
+
+	return s.next.GetIdempotencyKey(ctx, owner, key, now)
+}
+
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, k models.IdempotencyKey) (err error) {
+	ctx, span := s.start(ctx, "CompleteIdempotencyKey", idempotencyOwnerAttr(k.Owner), attribute.Int("idempotency_key.status", k.Status))
+	defer func() { end(span, err) }()
+
+	return s.next.CompleteIdempotencyKey(ctx, k)
+}
+
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, owner, key string) (err error) {
+	ctx, span := s.start(ctx, "DeleteIdempotencyKey", idempotencyOwnerAttr(owner))
+	defer func() { end(span, err) }()
+
+	return s.next.DeleteIdempotencyKey(ctx, owner, key)
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (deleted int64, err error) {
+	ctx, span := s.start(ctx, "DeleteExpiredIdempotencyKeys")
+	defer func() { end(span, err) }()
+
+	return s.next.DeleteExpiredIdempotencyKeys(ctx, now)
+}
+
+// idempotencyOwnerAttr names the owner only, keys are chosen by clients and may carry anything
+func idempotencyOwnerAttr(owner string) attribute.KeyValue {
+	return attribute.String("idempotency_key.owner", owner)
+}
+
+// Ping, PendingMigrations and Close start no span, they come from probes
+// and shutdown, not from a request whose trace they'd belong to
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.next.Ping(ctx)
+}
+
+func (s *Storage) PendingMigrations(ctx context.Context) (int, error) {
+	return s.next.PendingMigrations(ctx)
+}
+
+func (s *Storage) Close() error {
+	return s.next.Close()
+}
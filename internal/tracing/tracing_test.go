@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/lostmyescape/url-shortener/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newRecorded returns a Tracing that records every span it ends
+func newRecorded(t *testing.T) (*Tracing, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	return newTracing(provider, propagation.TraceContext{}, provider.Shutdown), recorder
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+
+	return attribute.Value{}
+}
+
+func TestNew(t *testing.T) {
+	tr, err := New(context.Background(), config.Tracing{Exporter: ExporterNone})
+	require.NoError(t, err)
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	_, err = New(context.Background(), config.Tracing{Exporter: "jaeger"})
+	require.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	tr, recorder := newRecorded(t)
+
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(tr.Middleware)
+	router.Get("/{alias}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://google.com", http.StatusFound)
+	})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	req := httptest.NewRequest(http.MethodGet, "/google", nil)
+	req.Header.Set("traceparent", traceparent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/b", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "GET /{alias}", spans[0].Name())
+	require.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	require.Equal(t, "/{alias}", attr(spans[0], "http.route").AsString())
+	require.NotEmpty(t, attr(spans[0], "request_id").AsString())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+
+	require.Equal(t, "GET unmatched", spans[1].Name())
+	require.False(t, spans[1].Parent().IsValid())
+}
+
+func TestStorage(t *testing.T) {
+	tr, recorder := newRecorded(t)
+	ctx := context.Background()
+
+	s := tr.WrapStorage(storage.NewMemory(), storage.TypeMemory)
+
+	_, err := s.SaveURL(ctx, models.URL{URL: "https://google.com", Alias: "google"}, false)
+	require.NoError(t, err)
+
+	_, err = s.GetUrl(ctx, "", "missing")
+	require.ErrorIs(t, err, storage.ErrURLNotFound)
+
+	require.Error(t, tr.WrapStorage(storagetest.Failing{}, storage.TypePostgres).SaveClicks(ctx, nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	require.Equal(t, "storage.SaveURL", spans[0].Name())
+	require.Equal(t, "google", attr(spans[0], "url.alias").AsString())
+	require.Equal(t, "memory", attr(spans[0], "db.system").AsString())
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	// a missing alias is an answer, not a failure
+	require.Equal(t, "storage.GetUrl", spans[1].Name())
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+
+	require.Equal(t, "storage.SaveClicks", spans[2].Name())
+	require.Equal(t, "postgresql", attr(spans[2], "db.system").AsString())
+	require.Equal(t, codes.Error, spans[2].Status().Code)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	tr, recorder := newRecorded(t)
+	interceptor := tr.UnaryClientInterceptor()
+
+	var sent metadata.MD
+	invoker := func(err error) grpc.UnaryInvoker {
+		return func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			sent, _ = metadata.FromOutgoingContext(ctx)
+			return err
+		}
+	}
+
+	ctx, parent := tr.tracer.Start(context.Background(), "GET /url")
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer token")
+
+	const method = "/auth.Auth/IsAdmin"
+
+	require.NoError(t, interceptor(ctx, method, nil, nil, nil, invoker(nil)))
+	require.Equal(t, []string{"Bearer token"}, sent.Get("authorization"))
+	require.Len(t, sent.Get("traceparent"), 1)
+
+	require.Error(t, interceptor(ctx, method, nil, nil, nil, invoker(status.Error(grpccodes.Unavailable, "down"))))
+
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	require.Equal(t, "auth.Auth/IsAdmin", spans[0].Name())
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	require.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	require.Contains(t, sent.Get("traceparent")[0], spans[1].SpanContext().SpanID().String())
+	require.Equal(t, int64(grpccodes.OK), attr(spans[0], "rpc.grpc.status_code").AsInt64())
+
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+	require.Equal(t, int64(grpccodes.Unavailable), attr(spans[1], "rpc.grpc.status_code").AsInt64())
+}
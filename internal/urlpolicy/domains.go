@@ -0,0 +1,116 @@
+package urlpolicy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// domains is a set of domains, each one matches its subdomains too
+type domains map[string]bool
+
+func (d domains) match(host string) (string, bool) {
+	host = normalizeHost(host)
+
+	for {
+		if d[host] {
+			return host, true
+		}
+
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			return "", false
+		}
+		host = parent
+	}
+}
+
+// loadDomains merges list with the domains in file, one per line,
+// blank lines and the ones starting with # are skipped
+func loadDomains(list []string, file string) (domains, error) {
+	d := make(domains, len(list))
+	for _, domain := range list {
+		if domain = normalizeHost(strings.TrimSpace(domain)); domain != "" {
+			d[domain] = true
+		}
+	}
+
+	if file == "" {
+		return d, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		d[normalizeHost(line)] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+
+	return d, nil
+}
+
+// DeniedDomains rejects links to the domains and their subdomains
+func DeniedDomains(denied domains) Check {
+	return CheckFunc(func(_ context.Context, u *url.URL) error {
+		if domain, ok := denied.match(u.Hostname()); ok {
+			return violation(RuleDomainDenied, "field URL points to the denied domain %s", domain)
+		}
+
+		return nil
+	})
+}
+
+// AllowedDomains rejects links to any other domains, it allows everything if empty
+func AllowedDomains(allowed domains) Check {
+	return CheckFunc(func(_ context.Context, u *url.URL) error {
+		if len(allowed) == 0 {
+			return nil
+		}
+
+		if _, ok := allowed.match(u.Hostname()); !ok {
+			return violation(RuleDomainNotAllowed, "field URL points to the domain %s that isn't allowed", normalizeHost(u.Hostname()))
+		}
+
+		return nil
+	})
+}
+
+// DomainFinder finds the custom domain served at a host, storage.ErrDomainNotFound if none
+type DomainFinder interface {
+	GetDomain(ctx context.Context, host string) (models.Domain, error)
+}
+
+// CustomDomains rejects links to the custom domains the service serves,
+// like SelfHosts does for the configured ones
+func CustomDomains(finder DomainFinder) Check {
+	return CheckFunc(func(ctx context.Context, u *url.URL) error {
+		_, err := finder.GetDomain(ctx, normalizeHost(u.Hostname()))
+		switch {
+		case errors.Is(err, storage.ErrDomainNotFound):
+			return nil
+		case err != nil:
+			return fmt.Errorf("urlpolicy.CustomDomains: %w", err)
+		}
+
+		return violation(RuleLoop, "field URL must not point to the shortener itself")
+	})
+}
@@ -0,0 +1,157 @@
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolver looks up the addresses of a host, *net.Resolver is one
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// nonPublic are the ranges that aren't reachable from the internet
+// beyond what netip.Addr tells: shared address space, "this network"
+// and NAT64, whose translator may well map an address to a private one
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// PublicAddresses rejects hosts that are or resolve to loopback,
+// private, link-local (like the cloud metadata 169.254.169.254) or
+// other non-public addresses. A host that doesn't exist is accepted,
+// there's nothing it could reach yet. A lookup that fails or times out
+// is a violation, unless failOpen, since the host may well be private.
+func PublicAddresses(resolver Resolver, timeout time.Duration, failOpen bool) Check {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return CheckFunc(func(ctx context.Context, u *url.URL) error {
+		host := u.Hostname()
+		if host == "" {
+			return nil
+		}
+
+		if addr, ok := parseAddr(host); ok {
+			if !IsPublic(addr) {
+				return violation(RulePrivateAddress, "field URL points to the non-public address %s", addr)
+			}
+
+			return nil
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if failOpen || errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				return nil
+			}
+
+			return violation(RuleUnresolved, "field URL host %s could not be resolved", host)
+		}
+
+		for _, addr := range addrs {
+			if !IsPublic(addr) {
+				return violation(RulePrivateAddress, "field URL host %s resolves to the non-public address %s", host, addr)
+			}
+		}
+
+		return nil
+	})
+}
+
+// parseAddr parses host as an IP address, IPv4 ones in any form the
+// resolvers of HTTP clients take as well: 2130706433, 0x7f.1 or 0177.0.0.1
+// are all 127.0.0.1 and never reach DNS
+func parseAddr(host string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr, true
+	}
+
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+
+	var ip uint32
+	for i, part := range parts {
+		n, ok := parseAddrPart(part)
+		if !ok {
+			return netip.Addr{}, false
+		}
+
+		// the last part fills the bytes the ones before left
+		bits := 8
+		if i == len(parts)-1 {
+			bits = 8 * (4 - i)
+		}
+		if n >= 1<<bits {
+			return netip.Addr{}, false
+		}
+
+		ip = ip<<bits | uint32(n)
+	}
+
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
+
+// parseAddrPart parses a decimal, 0x hexadecimal or 0 octal part of an IPv4 address
+func parseAddrPart(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) > 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		base, part = 16, part[2:]
+	case len(part) > 1 && part[0] == '0':
+		base, part = 8, part[1:]
+	}
+
+	// ParseUint would take signs, underscores and prefixes of its own
+	for _, c := range strings.ToLower(part) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return 0, false
+		}
+	}
+
+	n, err := strconv.ParseUint(part, base, 32)
+
+	return n, err == nil
+}
+
+// IsPublic reports whether addr is reachable on the internet, loopback,
+// private, link-local and the other special-purpose ranges are not
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range nonPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
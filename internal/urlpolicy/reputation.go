@@ -0,0 +1,89 @@
+package urlpolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ReputationChecker asks an external service whether a URL is malicious,
+// like a phishing or malware list, reason is shown to the client
+type ReputationChecker interface {
+	CheckReputation(ctx context.Context, rawURL string) (malicious bool, reason string, err error)
+}
+
+// Reputation rejects the URLs the checker flags, nothing can be
+// saved while the checker fails
+func Reputation(checker ReputationChecker) Check {
+	return CheckFunc(func(ctx context.Context, u *url.URL) error {
+		malicious, reason, err := checker.CheckReputation(ctx, u.String())
+		if err != nil {
+			return fmt.Errorf("urlpolicy.Reputation: %w", err)
+		}
+
+		if malicious {
+			if reason == "" {
+				reason = "unsafe"
+			}
+
+			return violation(RuleReputation, "field URL is flagged as %s", reason)
+		}
+
+		return nil
+	})
+}
+
+// Webhook is a ReputationChecker that POSTs {"url": "..."} to an endpoint
+// and expects {"malicious": true|false, "reason": "..."} back
+type Webhook struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewWebhook(endpoint string, timeout time.Duration) *Webhook {
+	return &Webhook{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (wh *Webhook) CheckReputation(ctx context.Context, rawURL string) (bool, string, error) {
+	const op = "urlpolicy.Webhook.CheckReputation"
+
+	body, err := json.Marshal(struct {
+		URL string `json:"url"`
+	}{URL: rawURL})
+	if err != nil {
+		return false, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, "", fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := wh.client.Do(req)
+	if err != nil {
+		return false, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("%s: unexpected status %d", op, res.StatusCode)
+	}
+
+	var verdict struct {
+		Malicious bool   `json:"malicious"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&verdict); err != nil {
+		return false, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return verdict.Malicious, verdict.Reason, nil
+}
@@ -0,0 +1,169 @@
+package urlpolicy
+
+import (
+	"context"
+	"fmt"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Rules a URL can be rejected by
+const (
+	RuleInvalid          = "invalid"
+	RuleScheme           = "scheme"
+	RuleLoop             = "loop"
+	RuleDomainDenied     = "domain_denied"
+	RuleDomainNotAllowed = "domain_not_allowed"
+	RulePrivateAddress   = "private_address"
+	RuleUnresolved       = "unresolved"
+	RuleReputation       = "reputation"
+)
+
+// Violation is the reason a URL is rejected, any other error of
+// a check means the URL couldn't be checked
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+func violation(rule, format string, args ...any) *Violation {
+	return &Violation{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+// Check is one rule of a policy, it gets a parsed absolute URL
+type Check interface {
+	Check(ctx context.Context, u *url.URL) error
+}
+
+// CheckFunc adapts a function to a Check
+type CheckFunc func(ctx context.Context, u *url.URL) error
+
+func (f CheckFunc) Check(ctx context.Context, u *url.URL) error {
+	return f(ctx, u)
+}
+
+// Policy runs its checks in order and stops at the first one that fails
+type Policy struct {
+	checks []Check
+}
+
+func NewPolicy(checks ...Check) *Policy {
+	return &Policy{checks: checks}
+}
+
+// New builds the policy configured by cfg: schemes, links back to the
+// service and to its custom domains if a finder is given, denied and
+// allowed domains, then the addresses the host resolves to and the
+// reputation if a checker is given. Cheap checks go first, so a URL
+// rejected by them doesn't cost a lookup.
+func New(cfg config.URLPolicy, customDomains DomainFinder, resolver Resolver, reputation ReputationChecker) (*Policy, error) {
+	const op = "urlpolicy.New"
+
+	denied, err := loadDomains(cfg.DeniedDomains, cfg.DeniedDomainsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	allowed, err := loadDomains(cfg.AllowedDomains, cfg.AllowedDomainsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	checks := []Check{
+		Schemes(cfg.Schemes),
+		SelfHosts(cfg.SelfHosts),
+	}
+
+	if customDomains != nil {
+		checks = append(checks, CustomDomains(customDomains))
+	}
+
+	checks = append(checks, DeniedDomains(denied), AllowedDomains(allowed))
+
+	if cfg.BlockPrivateNetworks {
+		checks = append(checks, PublicAddresses(resolver, cfg.ResolveTimeout, cfg.ResolveFailOpen))
+	}
+
+	if reputation != nil {
+		checks = append(checks, Reputation(reputation))
+	}
+
+	return NewPolicy(checks...), nil
+}
+
+// Check rejects rawURL with a *Violation if it breaks a rule
+func (p *Policy) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() {
+		return violation(RuleInvalid, "field URL is not a valid URL")
+	}
+
+	for _, check := range p.checks {
+		if err := check.Check(ctx, u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Schemes allows only the given schemes, http and https if none
+func Schemes(schemes []string) Check {
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+
+	allowed := make(map[string]bool, len(schemes))
+	for _, scheme := range schemes {
+		allowed[strings.ToLower(scheme)] = true
+	}
+
+	list := strings.Join(schemes, ", ")
+
+	return CheckFunc(func(_ context.Context, u *url.URL) error {
+		if !allowed[strings.ToLower(u.Scheme)] {
+			return violation(RuleScheme, "field URL must use one of the schemes %s", list)
+		}
+
+		// a web link without a host can't be followed
+		if (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() == "" {
+			return violation(RuleInvalid, "field URL is not a valid URL")
+		}
+
+		return nil
+	})
+}
+
+// SelfHosts rejects links to the hosts the service itself is served at,
+// a short link to a short link could redirect in a loop
+func SelfHosts(hosts []string) Check {
+	self := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if host = normalizeHost(strings.TrimSpace(host)); host != "" {
+			self[host] = true
+		}
+	}
+
+	return CheckFunc(func(_ context.Context, u *url.URL) error {
+		if self[normalizeHost(u.Hostname())] {
+			return violation(RuleLoop, "field URL must not point to the shortener itself")
+		}
+
+		return nil
+	})
+}
+
+// normalizeHost lowercases host and drops the port and the trailing dot of a FQDN
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
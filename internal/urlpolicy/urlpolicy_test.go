@@ -0,0 +1,220 @@
+package urlpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lostmyescape/url-shortener/internal/config"
+	"github.com/lostmyescape/url-shortener/internal/domain/models"
+	"github.com/lostmyescape/url-shortener/internal/storage"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// resolverStub resolves the hosts it knows, the others don't exist
+// but timeout.example.com, whose lookup times out
+type resolverStub map[string][]string
+
+func (r resolverStub) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	if host == "timeout.example.com" {
+		return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+	}
+
+	raw, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	addrs := make([]netip.Addr, 0, len(raw))
+	for _, a := range raw {
+		addrs = append(addrs, netip.MustParseAddr(a))
+	}
+
+	return addrs, nil
+}
+
+// reputationStub flags the URLs it has a reason for
+type reputationStub map[string]string
+
+func (r reputationStub) CheckReputation(_ context.Context, rawURL string) (bool, string, error) {
+	if rawURL == "https://down.example.com" {
+		return false, "", errors.New("connection refused")
+	}
+
+	reason, ok := r[rawURL]
+
+	return ok, reason, nil
+}
+
+// domainsStub serves the custom domains it has
+type domainsStub map[string]bool
+
+func (d domainsStub) GetDomain(_ context.Context, host string) (models.Domain, error) {
+	if !d[host] {
+		return models.Domain{}, storage.ErrDomainNotFound
+	}
+
+	return models.Domain{Host: host}, nil
+}
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	deniedFile := filepath.Join(t.TempDir(), "denied.txt")
+	require.NoError(t, os.WriteFile(deniedFile, []byte("# phishing\nevil.com\n\nbad.org\n"), 0o600))
+
+	resolver := resolverStub{
+		"google.com":       {"142.250.74.46", "2a00:1450:4010:c02::65"},
+		"internal.corp":    {"10.0.0.12"},
+		"rebind.me":        {"93.184.216.34", "127.0.0.1"},
+		"down.example.com": {"93.184.216.34"},
+		"flagged.com":      {"93.184.216.34"},
+	}
+
+	policy, err := New(config.URLPolicy{
+		Schemes:              []string{"http", "https"},
+		BlockPrivateNetworks: true,
+		DeniedDomains:        []string{"Spam.NET"},
+		DeniedDomainsFile:    deniedFile,
+		SelfHosts:            []string{"sho.rt", "localhost:8080"},
+	}, domainsStub{"go.brand.com": true}, resolver, reputationStub{"https://flagged.com": "phishing"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		url      string
+		wantRule string
+		wantErr  bool
+	}{
+		{name: "Public", url: "https://google.com/search?q=go"},
+		{name: "Unresolvable host", url: "https://unknown.example.org"},
+		{name: "Public IP", url: "http://93.184.216.34:8080/"},
+		{name: "Relative", url: "/path", wantRule: RuleInvalid},
+		{name: "javascript", url: "javascript:alert(1)", wantRule: RuleScheme},
+		{name: "file", url: "file:///etc/passwd", wantRule: RuleScheme},
+		{name: "Scheme case", url: "HTTPS://google.com"},
+		{name: "No host", url: "https:///path", wantRule: RuleInvalid},
+		{name: "Self", url: "https://sho.rt/abc", wantRule: RuleLoop},
+		{name: "Self FQDN", url: "https://SHO.RT./abc", wantRule: RuleLoop},
+		{name: "Custom domain", url: "https://Go.Brand.com/promo", wantRule: RuleLoop},
+		{name: "Denied in config", url: "https://www.spam.net", wantRule: RuleDomainDenied},
+		{name: "Denied in file", url: "https://login.evil.com/account", wantRule: RuleDomainDenied},
+		{name: "Suffix isn't a subdomain", url: "https://notevil.com", wantRule: ""},
+		{name: "Metadata address", url: "http://169.254.169.254/latest/meta-data", wantRule: RulePrivateAddress},
+		{name: "Loopback", url: "http://127.0.0.1:6379", wantRule: RulePrivateAddress},
+		{name: "IPv6 loopback", url: "http://[::1]/", wantRule: RulePrivateAddress},
+		{name: "IPv4-mapped", url: "http://[::ffff:10.0.0.1]/", wantRule: RulePrivateAddress},
+		{name: "Shared address space", url: "http://100.64.1.1/", wantRule: RulePrivateAddress},
+		{name: "Resolves to private", url: "https://internal.corp", wantRule: RulePrivateAddress},
+		{name: "Any address private", url: "https://rebind.me", wantRule: RulePrivateAddress},
+		{name: "Decimal IPv4", url: "http://2130706433/", wantRule: RulePrivateAddress},
+		{name: "Hex IPv4", url: "http://0x7f.1/", wantRule: RulePrivateAddress},
+		{name: "Octal IPv4", url: "http://0177.0.0.1/", wantRule: RulePrivateAddress},
+		{name: "Short IPv4", url: "http://10.1/", wantRule: RulePrivateAddress},
+		{name: "Numeric public", url: "http://1572395042/"},
+		{name: "NAT64", url: "http://[64:ff9b::a9fe:a9fe]/", wantRule: RulePrivateAddress},
+		{name: "Lookup times out", url: "https://timeout.example.com", wantRule: RuleUnresolved},
+		{name: "Flagged", url: "https://flagged.com", wantRule: RuleReputation},
+		{name: "Reputation fails", url: "https://down.example.com", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := policy.Check(context.Background(), tc.url)
+
+			var violation *Violation
+			switch {
+			case tc.wantRule != "":
+				require.ErrorAs(t, err, &violation)
+				require.Equal(t, tc.wantRule, violation.Rule)
+			case tc.wantErr:
+				require.Error(t, err)
+				require.False(t, errors.As(err, &violation))
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAllowedDomains(t *testing.T) {
+	t.Parallel()
+
+	policy, err := New(config.URLPolicy{AllowedDomains: []string{"example.com"}}, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, policy.Check(context.Background(), "https://docs.example.com/a"))
+
+	var violation *Violation
+	require.ErrorAs(t, policy.Check(context.Background(), "https://example.org"), &violation)
+	require.Equal(t, RuleDomainNotAllowed, violation.Rule)
+
+	// private networks aren't blocked unless asked to
+	require.NoError(t, NewPolicy(Schemes(nil)).Check(context.Background(), "http://127.0.0.1"))
+}
+
+func TestPublicAddressesFailOpen(t *testing.T) {
+	t.Parallel()
+
+	policy := NewPolicy(PublicAddresses(resolverStub{}, 0, true))
+
+	require.NoError(t, policy.Check(context.Background(), "https://timeout.example.com"))
+
+	var violation *Violation
+	require.ErrorAs(t, policy.Check(context.Background(), "http://0x7f000001/"), &violation)
+	require.Equal(t, RulePrivateAddress, violation.Rule)
+}
+
+func TestNewMissingFile(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(config.URLPolicy{DeniedDomainsFile: filepath.Join(t.TempDir(), "missing.txt")}, nil, nil, nil)
+	require.Error(t, err)
+}
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch req.URL {
+		case "https://phish.example.com":
+			_, _ = w.Write([]byte(`{"malicious": true, "reason": "phishing"}`))
+		case "https://broken.example.com":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte(`{"malicious": false}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	wh := NewWebhook(server.URL, 0)
+	ctx := context.Background()
+
+	malicious, reason, err := wh.CheckReputation(ctx, "https://phish.example.com")
+	require.NoError(t, err)
+	require.True(t, malicious)
+	require.Equal(t, "phishing", reason)
+
+	malicious, _, err = wh.CheckReputation(ctx, "https://google.com")
+	require.NoError(t, err)
+	require.False(t, malicious)
+
+	_, _, err = wh.CheckReputation(ctx, "https://broken.example.com")
+	require.Error(t, err)
+}
@@ -25,10 +25,13 @@ func TestURLShortener(t *testing.T) {
 
 	e := httpexpect.Default(t, u.String())
 
+	alias, err := random.String(random.Alphabet, 10)
+	require.NoError(t, err)
+
 	e.POST("/url").
 		WithJSON(save.Request{
 			URL:   gofakeit.URL(),
-			Alias: random.NewRandomString(10),
+			Alias: alias,
 		}).WithBasicAuth("lostmyescape", "asdfg").
 		Expect().Status(200).JSON().Object().ContainsKey("alias")
 }